@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// certificateExtensions lists the file extensions picked up when scanning a
+// directory. Files given explicitly with --file are parsed regardless of their
+// extension.
+var certificateExtensions = map[string]bool{
+	".pem":        true,
+	".crt":        true,
+	".cer":        true,
+	".der":        true,
+	".p12":        true,
+	".pfx":        true,
+	".jks":        true,
+	".keystore":   true,
+	".truststore": true,
+}
+
+// jksMagic is the leading magic number of a Java KeyStore (JKS) file.
+const jksMagic = 0xFEEDFEED
+
+// ExpandCertificatePaths resolves the --file and --dir glob patterns to a
+// sorted, de-duplicated list of files. Every pattern must match at least one
+// path; directories are scanned (non-recursively) for files with a known
+// certificate extension.
+func ExpandCertificatePaths(files []string, dirs []string) ([]string, error) {
+	seen := map[string]bool{}
+	paths := []string{}
+
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			paths = append(paths, path)
+		}
+	}
+
+	for _, pattern := range files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", pattern)
+		}
+		for _, match := range matches {
+			add(match)
+		}
+	}
+
+	for _, pattern := range dirs {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no directories match %q", pattern)
+		}
+		for _, dir := range matches {
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				return nil, err
+			}
+			for _, entry := range entries {
+				if !entry.Type().IsRegular() {
+					continue
+				}
+				if certificateExtensions[strings.ToLower(filepath.Ext(entry.Name()))] {
+					add(filepath.Join(dir, entry.Name()))
+				}
+			}
+		}
+	}
+
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// LoadCertificates reads a file and returns all certificates it contains.
+func LoadCertificates(path string, password string) ([]*x509.Certificate, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCertificates(data, password)
+}
+
+// ParseCertificates detects the encoding of data (PEM, JKS, DER or PKCS#12)
+// and returns all certificates it contains. The password is only needed for
+// PKCS#12 bundles; certificates in a JKS file are stored unencrypted.
+func ParseCertificates(data []byte, password string) ([]*x509.Certificate, error) {
+	if bytes.Contains(data, []byte("-----BEGIN")) {
+		return parsePEM(data)
+	}
+
+	if len(data) >= 4 && binary.BigEndian.Uint32(data) == jksMagic {
+		return parseJKS(data)
+	}
+
+	if certs, err := x509.ParseCertificates(data); err == nil && len(certs) > 0 {
+		return certs, nil
+	}
+
+	// A keystore holds a single key entry with its chain, a truststore only
+	// trusted certificates.
+	_, cert, chain, err := pkcs12.DecodeChain(data, password)
+	if err == nil {
+		return append([]*x509.Certificate{cert}, chain...), nil
+	}
+	certs, terr := pkcs12.DecodeTrustStore(data, password)
+	if terr == nil {
+		return certs, nil
+	}
+
+	return nil, fmt.Errorf("unrecognized certificate format or wrong password (%v)", err)
+}
+
+func parsePEM(data []byte) ([]*x509.Certificate, error) {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no CERTIFICATE block found")
+	}
+	return certs, nil
+}
+
+// parseJKS extracts the certificates of a Java KeyStore. Private keys are
+// skipped without being decrypted and the integrity digest is not verified,
+// so no password is required.
+func parseJKS(data []byte) ([]*x509.Certificate, error) {
+	r := bytes.NewReader(data)
+
+	var header struct {
+		Magic   uint32
+		Version uint32
+		Count   uint32
+	}
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, fmt.Errorf("jks: %w", err)
+	}
+	if header.Version != 1 && header.Version != 2 {
+		return nil, fmt.Errorf("jks: unsupported version %d", header.Version)
+	}
+
+	readUint32 := func() (uint32, error) {
+		var v uint32
+		err := binary.Read(r, binary.BigEndian, &v)
+		return v, err
+	}
+	skip := func(n int64) error {
+		_, err := r.Seek(n, io.SeekCurrent)
+		return err
+	}
+	skipUTF := func() error {
+		var n uint16
+		if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+			return err
+		}
+		return skip(int64(n))
+	}
+	readCert := func() (*x509.Certificate, error) {
+		if header.Version == 2 {
+			if err := skipUTF(); err != nil { // certificate type, e.g. "X.509"
+				return nil, err
+			}
+		}
+		n, err := readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if int64(n) > int64(r.Len()) {
+			return nil, io.ErrUnexpectedEOF
+		}
+		der := make([]byte, n)
+		if _, err := io.ReadFull(r, der); err != nil {
+			return nil, err
+		}
+		return x509.ParseCertificate(der)
+	}
+
+	certs := []*x509.Certificate{}
+	for i := uint32(0); i < header.Count; i++ {
+		tag, err := readUint32()
+		if err != nil {
+			return nil, fmt.Errorf("jks: %w", err)
+		}
+		if err := skipUTF(); err != nil { // alias
+			return nil, fmt.Errorf("jks: %w", err)
+		}
+		if err := skip(8); err != nil { // creation timestamp
+			return nil, fmt.Errorf("jks: %w", err)
+		}
+
+		switch tag {
+		case 1: // private key entry with certificate chain
+			n, err := readUint32()
+			if err != nil {
+				return nil, fmt.Errorf("jks: %w", err)
+			}
+			if err := skip(int64(n)); err != nil {
+				return nil, fmt.Errorf("jks: %w", err)
+			}
+			chain, err := readUint32()
+			if err != nil {
+				return nil, fmt.Errorf("jks: %w", err)
+			}
+			for j := uint32(0); j < chain; j++ {
+				cert, err := readCert()
+				if err != nil {
+					return nil, fmt.Errorf("jks: %w", err)
+				}
+				certs = append(certs, cert)
+			}
+		case 2: // trusted certificate entry
+			cert, err := readCert()
+			if err != nil {
+				return nil, fmt.Errorf("jks: %w", err)
+			}
+			certs = append(certs, cert)
+		default:
+			return nil, fmt.Errorf("jks: unsupported entry type %d", tag)
+		}
+	}
+
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("jks: keystore contains no certificates")
+	}
+	return certs, nil
+}
+
+// FileResult holds the certificates found in one file, or the error raised
+// while reading it.
+type FileResult struct {
+	Path  string
+	Certs []*x509.Certificate
+	Err   error
+}
+
+// ScanFiles loads the certificates of all given files. A file that cannot be
+// read or parsed is reported through its result rather than aborting the scan.
+func ScanFiles(paths []string, password string) []FileResult {
+	results := make([]FileResult, 0, len(paths))
+	for _, path := range paths {
+		certs, err := LoadCertificates(path, password)
+		results = append(results, FileResult{Path: path, Certs: certs, Err: err})
+	}
+	return results
+}
+
+// EvaluateFiles applies CheckExpiry to every certificate and returns the
+// level (ok|warning|critical) with a report listing the soonest expiry, one
+// detail line per certificate and the days left of each file as perfdata.
+// Expired certificates and unreadable files are critical.
+func (cc *CertificateChecker) EvaluateFiles(results []FileResult) (string, string) {
+	var (
+		total, warning, critical int
+		soonest                  *x509.Certificate
+		soonestPath              string
+		details                  []string
+		perfs                    []string
+	)
+
+	now := time.Now()
+	for _, result := range results {
+		if result.Err != nil {
+			critical++
+			details = append(details, fmt.Sprintf("- %s: CRITICAL %s", result.Path, result.Err))
+			continue
+		}
+
+		fileDaysLeft := math.Inf(1)
+		for _, cert := range result.Certs {
+			total++
+			expiring, daysLeft, _ := cc.CheckExpiry(cert)
+			fileDaysLeft = math.Min(fileDaysLeft, daysLeft)
+
+			if soonest == nil || cert.NotAfter.Before(soonest.NotAfter) {
+				soonest = cert
+				soonestPath = result.Path
+			}
+
+			status := "OK"
+			switch {
+			case now.After(cert.NotAfter):
+				critical++
+				status = "CRITICAL expired"
+			case now.Before(cert.NotBefore):
+				critical++
+				status = "CRITICAL not yet valid"
+			case expiring:
+				warning++
+				status = "WARNING"
+			}
+			details = append(details, fmt.Sprintf("- %s: %s %s, Not After: %s UTC (%0.1f days left)",
+				result.Path, status, cert.Subject.CommonName,
+				cert.NotAfter.Format("2006-01-02 15:04:05"), daysLeft))
+		}
+
+		perfs = append(perfs, fmt.Sprintf("'%s'=%0.1f;%d;0", result.Path, fileDaysLeft, cc.config.Expiry))
+	}
+
+	summary := fmt.Sprintf("%d certificates in %d files", total, len(results))
+	if soonest != nil {
+		summary += fmt.Sprintf(", soonest expiry: %s in %s at %s UTC (%0.1f days left)",
+			soonest.Subject.CommonName, soonestPath,
+			soonest.NotAfter.Format("2006-01-02 15:04:05"),
+			soonest.NotAfter.Sub(now).Hours()/24)
+	}
+
+	output := summary
+	if len(perfs) > 0 {
+		output += " | " + strings.Join(perfs, " ")
+	}
+	if len(details) > 0 {
+		output += "\n" + strings.Join(details, "\n")
+	}
+
+	switch {
+	case critical > 0:
+		return "critical", output
+	case warning > 0:
+		return "warning", output
+	default:
+		return "ok", output
+	}
+}
+
+// RunFiles executes the certificate check against local files instead of a
+// network endpoint.
+func (cc *CertificateChecker) RunFiles(c *check.CheckStruct) {
+	paths, err := ExpandCertificatePaths(cc.config.Files, cc.config.Dirs)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	if len(paths) == 0 {
+		c.Error(fmt.Errorf("no certificate files found"))
+		return
+	}
+
+	level, output := cc.EvaluateFiles(ScanFiles(paths, cc.config.Password))
+	c.Report(level, output)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// testCertificate returns a parsed self-signed certificate valid from
+// notBefore to notAfter together with its private key.
+func testCertificate(t *testing.T, notBefore, notAfter time.Time, commonName string) (*x509.Certificate, any) {
+	t.Helper()
+	tlsCert, err := generateTestCertificate(notBefore, notAfter, []string{"localhost"}, commonName)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(tlsCert.Certificate[0])
+	require.NoError(t, err)
+	return cert, tlsCert.PrivateKey
+}
+
+// buildJKS encodes a version 2 Java KeyStore with one private key entry
+// (holding chain) and one trusted certificate entry per trusted cert.
+func buildJKS(chain []*x509.Certificate, trusted []*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	write := func(v any) { binary.Write(&buf, binary.BigEndian, v) }
+	writeUTF := func(s string) {
+		write(uint16(len(s)))
+		buf.WriteString(s)
+	}
+	writeCert := func(cert *x509.Certificate) {
+		writeUTF("X.509")
+		write(uint32(len(cert.Raw)))
+		buf.Write(cert.Raw)
+	}
+
+	count := len(trusted)
+	if len(chain) > 0 {
+		count++
+	}
+	write(uint32(jksMagic))
+	write(uint32(2))
+	write(uint32(count))
+
+	if len(chain) > 0 {
+		write(uint32(1))
+		writeUTF("server")
+		write(uint64(time.Now().UnixMilli()))
+		key := []byte("encrypted-key-material")
+		write(uint32(len(key)))
+		buf.Write(key)
+		write(uint32(len(chain)))
+		for _, cert := range chain {
+			writeCert(cert)
+		}
+	}
+	for i, cert := range trusted {
+		write(uint32(2))
+		writeUTF("ca" + string(rune('0'+i)))
+		write(uint64(time.Now().UnixMilli()))
+		writeCert(cert)
+	}
+
+	buf.Write(make([]byte, 20)) // integrity digest
+	return buf.Bytes()
+}
+
+func TestParseCertificates(t *testing.T) {
+	now := time.Now()
+	cert, key := testCertificate(t, now.Add(-24*time.Hour), now.Add(90*24*time.Hour), "leaf.example.com")
+	ca, _ := testCertificate(t, now.Add(-24*time.Hour), now.Add(365*24*time.Hour), "ca.example.com")
+
+	pemData := append(
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}),
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})...)
+
+	keystore, err := pkcs12.Modern.Encode(key, cert, []*x509.Certificate{ca}, "secret")
+	require.NoError(t, err)
+	truststore, err := pkcs12.Modern.EncodeTrustStore([]*x509.Certificate{ca}, "changeit")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		password    string
+		expectNames []string
+		expectError string
+	}{
+		{name: "PEM bundle", data: pemData, expectNames: []string{"leaf.example.com", "ca.example.com"}},
+		{name: "PEM with private key only", data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1}}), expectError: "no CERTIFICATE block"},
+		{name: "DER", data: cert.Raw, expectNames: []string{"leaf.example.com"}},
+		{name: "PKCS#12 keystore", data: keystore, password: "secret", expectNames: []string{"leaf.example.com", "ca.example.com"}},
+		{name: "PKCS#12 keystore wrong password", data: keystore, password: "wrong", expectError: "wrong password"},
+		{name: "PKCS#12 truststore", data: truststore, password: "changeit", expectNames: []string{"ca.example.com"}},
+		{name: "JKS", data: buildJKS([]*x509.Certificate{cert}, []*x509.Certificate{ca}), expectNames: []string{"leaf.example.com", "ca.example.com"}},
+		{name: "JKS truncated", data: buildJKS([]*x509.Certificate{cert}, nil)[:40], expectError: "jks:"},
+		{name: "garbage", data: []byte("not a certificate"), expectError: "unrecognized certificate format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certs, err := ParseCertificates(tt.data, tt.password)
+			if tt.expectError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectError)
+				return
+			}
+			require.NoError(t, err)
+
+			names := []string{}
+			for _, c := range certs {
+				names = append(names, c.Subject.CommonName)
+			}
+			assert.Equal(t, tt.expectNames, names)
+		})
+	}
+}
+
+func TestExpandCertificatePaths(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.pem", "b.CRT", "c.p12", "notes.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte{}, 0o600))
+	}
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub.pem"), 0o700))
+
+	paths, err := ExpandCertificatePaths(nil, []string{dir})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "a.pem"),
+		filepath.Join(dir, "b.CRT"),
+		filepath.Join(dir, "c.p12"),
+	}, paths)
+
+	// explicit files are taken regardless of extension and de-duplicated
+	paths, err = ExpandCertificatePaths([]string{filepath.Join(dir, "*.txt"), filepath.Join(dir, "a.*")}, []string{dir})
+	assert.NoError(t, err)
+	assert.Len(t, paths, 4)
+	assert.Contains(t, paths, filepath.Join(dir, "notes.txt"))
+
+	_, err = ExpandCertificatePaths([]string{filepath.Join(dir, "*.der")}, nil)
+	assert.ErrorContains(t, err, "no files match")
+
+	_, err = ExpandCertificatePaths(nil, []string{filepath.Join(dir, "missing*")})
+	assert.ErrorContains(t, err, "no directories match")
+
+	_, err = ExpandCertificatePaths([]string{"[invalid"}, nil)
+	assert.Error(t, err)
+}
+
+func TestCertificateChecker_EvaluateFiles(t *testing.T) {
+	now := time.Now()
+	valid, _ := testCertificate(t, now.Add(-24*time.Hour), now.Add(90*24*time.Hour), "valid.example.com")
+	expiring, _ := testCertificate(t, now.Add(-24*time.Hour), now.Add(10*24*time.Hour), "expiring.example.com")
+	expired, _ := testCertificate(t, now.Add(-48*time.Hour), now.Add(-24*time.Hour), "expired.example.com")
+
+	checker := NewCertificateChecker(Config{Expiry: 30})
+
+	tests := []struct {
+		name           string
+		results        []FileResult
+		expectLevel    string
+		expectContains []string
+	}{
+		{
+			name:        "all valid",
+			results:     []FileResult{{Path: "valid.pem", Certs: []*x509.Certificate{valid}}},
+			expectLevel: "ok",
+			expectContains: []string{
+				"1 certificates in 1 files, soonest expiry: valid.example.com in valid.pem",
+				"| 'valid.pem'=",
+				"- valid.pem: OK valid.example.com",
+			},
+		},
+		{
+			name: "soonest expiry wins",
+			results: []FileResult{
+				{Path: "valid.pem", Certs: []*x509.Certificate{valid}},
+				{Path: "bundle.p12", Certs: []*x509.Certificate{valid, expiring}},
+			},
+			expectLevel: "warning",
+			expectContains: []string{
+				"3 certificates in 2 files, soonest expiry: expiring.example.com in bundle.p12",
+				"'bundle.p12'=10.0;30;0",
+				"- bundle.p12: WARNING expiring.example.com",
+			},
+		},
+		{
+			name: "expired is critical",
+			results: []FileResult{
+				{Path: "valid.pem", Certs: []*x509.Certificate{valid}},
+				{Path: "old.pem", Certs: []*x509.Certificate{expired}},
+			},
+			expectLevel:    "critical",
+			expectContains: []string{"- old.pem: CRITICAL expired expired.example.com"},
+		},
+		{
+			name: "unreadable file is critical",
+			results: []FileResult{
+				{Path: "valid.pem", Certs: []*x509.Certificate{valid}},
+				{Path: "broken.p12", Err: os.ErrPermission},
+			},
+			expectLevel:    "critical",
+			expectContains: []string{"- broken.p12: CRITICAL permission denied"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, output := checker.EvaluateFiles(tt.results)
+			assert.Equal(t, tt.expectLevel, level)
+			for _, s := range tt.expectContains {
+				assert.Contains(t, output, s)
+			}
+		})
+	}
+}
+
+func TestCertificateChecker_RunFiles(t *testing.T) {
+	now := time.Now()
+	cert, _ := testCertificate(t, now.Add(-24*time.Hour), now.Add(20*24*time.Hour), "file.example.com")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "server.crt")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw}), 0o600))
+
+	run := func(cfg Config) int {
+		exitCode := -1
+		c := check.New("TestCheck")
+		c.ExitFn = func(code int) {
+			if exitCode == -1 {
+				exitCode = code
+			}
+		}
+		NewCertificateChecker(cfg).RunFiles(c)
+		return exitCode
+	}
+
+	assert.Equal(t, 0, run(Config{Expiry: 10, Dirs: []string{dir}}))
+	assert.Equal(t, 1, run(Config{Expiry: 30, Files: []string{path}}))
+	assert.Equal(t, 3, run(Config{Expiry: 30, Files: []string{filepath.Join(dir, "*.p12")}}))
+	assert.Equal(t, 3, run(Config{Expiry: 30, Dirs: []string{t.TempDir()}}))
+}
+
+func TestSetupOptions_FileMode(t *testing.T) {
+	c := check.New("TestCheck")
+	cfg := SetupOptions(c)
+
+	err := c.Option.Parse([]string{"--file", "/etc/ssl/a.pem", "--file", "/etc/ssl/*.crt", "--dir", "/etc/pki/*", "--password", "changeit"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/etc/ssl/a.pem", "/etc/ssl/*.crt"}, cfg.Files)
+	assert.Equal(t, []string{"/etc/pki/*"}, cfg.Dirs)
+	assert.Equal(t, "changeit", cfg.Password)
+}
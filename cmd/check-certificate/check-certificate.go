@@ -14,10 +14,17 @@ import (
 
 // Config holds the configuration for the certificate check
 type Config struct {
-	Host    string
-	Port    int
-	Timeout int64
-	Expiry  int64
+	Host        string
+	Port        int
+	Timeout     int64
+	Expiry      int64
+	StartTLS    string
+	Files       []string
+	Dirs        []string
+	Password    string
+	Targets     string
+	Concurrency int
+	Deadline    time.Duration
 }
 
 // CertificateChecker performs TLS certificate validation
@@ -45,13 +52,54 @@ func NewCertificateCheckerWithTLSConfig(cfg Config, tlsConfig *tls.Config) *Cert
 	}
 }
 
-// Connect establishes a TLS connection to the target host
+// Connect establishes a TLS connection to the target host. With a STARTTLS
+// protocol configured, the plaintext upgrade is negotiated first.
 func (cc *CertificateChecker) Connect() (*tls.Conn, error) {
 	address := cc.config.Host + ":" + strconv.Itoa(cc.config.Port)
-	conn, err := tls.DialWithDialer(cc.dialer, "tcp", address, cc.tlsConfig)
+	if len(cc.config.StartTLS) == 0 {
+		conn, err := tls.DialWithDialer(cc.dialer, "tcp", address, cc.tlsConfig)
+		if err != nil {
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	protocol, err := lookupStartTLS(cc.config.StartTLS)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := cc.dialer.Dial("tcp", address)
 	if err != nil {
 		return nil, err
 	}
+
+	// The dialer timeout only covers connecting; bound the negotiation and
+	// handshake as well so a silent server cannot hang the check.
+	if cc.dialer.Timeout > 0 {
+		raw.SetDeadline(time.Now().Add(cc.dialer.Timeout))
+	}
+
+	if err := protocol.upgrade(raw); err != nil {
+		raw.Close()
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{}
+	if cc.tlsConfig != nil {
+		tlsConfig = cc.tlsConfig.Clone()
+	}
+	if len(tlsConfig.ServerName) == 0 {
+		tlsConfig.ServerName = cc.config.Host
+	}
+
+	conn := tls.Client(raw, tlsConfig)
+	if err := conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	raw.SetDeadline(time.Time{})
+
 	return conn, nil
 }
 
@@ -155,6 +203,13 @@ func SetupOptions(c *check.CheckStruct) *Config {
 	c.Option.IntVarP(&cfg.Port, "port", "P", 443, "PORT")
 	c.Option.Int64VarP(&cfg.Timeout, "timeout", "t", 5, "TIMEOUT")
 	c.Option.Int64VarP(&cfg.Expiry, "expiry", "e", 30, "EXPIRY warning in days")
+	c.Option.StringVar(&cfg.StartTLS, "starttls", "", "STARTTLS protocol to negotiate before the handshake ("+strings.Join(StartTLSProtocols(), "|")+")")
+	c.Option.StringArrayVar(&cfg.Files, "file", []string{}, "Certificate file glob (PEM, DER, PKCS#12 or JKS) to check instead of a host, repeatable")
+	c.Option.StringArrayVar(&cfg.Dirs, "dir", []string{}, "Directory glob to scan for certificate files instead of a host, repeatable")
+	c.Option.StringVar(&cfg.Password, "password", "", "Password for PKCS#12 files")
+	c.Option.StringVar(&cfg.Targets, "targets", "", "File with one host[:port] per line for batch mode")
+	c.Option.IntVar(&cfg.Concurrency, "concurrency", 10, "Maximum number of targets checked concurrently in batch mode")
+	c.Option.DurationVar(&cfg.Deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
 
 	return &cfg
 }
@@ -169,9 +224,28 @@ func main() {
 	// Step 3: Parse the command-line arguments
 	c.Init()
 
-	// Step 4: Create the certificate checker with the configuration
+	// Step 4: Default the port to the protocol's well-known port when using
+	// STARTTLS without an explicit --port
+	if len(config.StartTLS) > 0 && !c.Option.Changed("port") {
+		protocol, err := lookupStartTLS(config.StartTLS)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		config.Port = protocol.defaultPort
+	}
+
+	// Step 5: Create the certificate checker with the configuration
 	checker := NewCertificateChecker(*config)
 
-	// Step 5: Run the check and report results via the check instance
+	// Step 6: Run the check and report results via the check instance
+	if len(config.Targets) > 0 {
+		checker.RunTargets(c)
+		return
+	}
+	if len(config.Files) > 0 || len(config.Dirs) > 0 {
+		checker.RunFiles(c)
+		return
+	}
 	checker.Run(c)
 }
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// starttlsUpgrader performs the plaintext part of a protocol exchange on conn
+// until the server is ready to start the TLS handshake.
+type starttlsUpgrader func(conn net.Conn) error
+
+// starttlsProtocol describes a protocol that negotiates TLS in-band.
+type starttlsProtocol struct {
+	defaultPort int
+	upgrade     starttlsUpgrader
+}
+
+var starttlsProtocols = map[string]starttlsProtocol{
+	"smtp":     {defaultPort: 25, upgrade: starttlsSMTP},
+	"imap":     {defaultPort: 143, upgrade: starttlsIMAP},
+	"pop3":     {defaultPort: 110, upgrade: starttlsPOP3},
+	"ldap":     {defaultPort: 389, upgrade: starttlsLDAP},
+	"postgres": {defaultPort: 5432, upgrade: starttlsPostgres},
+	"mysql":    {defaultPort: 3306, upgrade: starttlsMySQL},
+}
+
+// StartTLSProtocols returns the sorted list of supported STARTTLS protocols.
+func StartTLSProtocols() []string {
+	names := make([]string, 0, len(starttlsProtocols))
+	for name := range starttlsProtocols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupStartTLS(name string) (starttlsProtocol, error) {
+	protocol, ok := starttlsProtocols[strings.ToLower(name)]
+	if !ok {
+		return starttlsProtocol{}, fmt.Errorf("unsupported starttls protocol %q (expected one of: %s)", name, strings.Join(StartTLSProtocols(), ", "))
+	}
+	return protocol, nil
+}
+
+// ensureDrained guards against a server sending data after its "go ahead"
+// response: anything still buffered would otherwise be lost (or, worse,
+// injected) once the TLS handshake starts on the raw connection.
+func ensureDrained(r *bufio.Reader) error {
+	if r.Buffered() > 0 {
+		return fmt.Errorf("starttls: unexpected data from server before TLS handshake")
+	}
+	return nil
+}
+
+// readSMTPReply reads a (possibly multi-line) SMTP reply and returns its code
+// and the text of all lines.
+func readSMTPReply(r *bufio.Reader) (string, []string, error) {
+	lines := []string{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", lines, fmt.Errorf("starttls smtp: %w", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) < 3 {
+			return "", lines, fmt.Errorf("starttls smtp: malformed reply %q", line)
+		}
+		lines = append(lines, line)
+		if len(line) == 3 || line[3] == ' ' {
+			return line[:3], lines, nil
+		}
+	}
+}
+
+func starttlsSMTP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+
+	code, lines, err := readSMTPReply(r)
+	if err != nil {
+		return err
+	}
+	if code != "220" {
+		return fmt.Errorf("starttls smtp: unexpected greeting %q", strings.Join(lines, " "))
+	}
+
+	name, err := os.Hostname()
+	if err != nil || len(name) == 0 {
+		name = "localhost"
+	}
+	if _, err := fmt.Fprintf(conn, "EHLO %s\r\n", name); err != nil {
+		return fmt.Errorf("starttls smtp: %w", err)
+	}
+	code, lines, err = readSMTPReply(r)
+	if err != nil {
+		return err
+	}
+	if code != "250" {
+		return fmt.Errorf("starttls smtp: EHLO rejected %q", strings.Join(lines, " "))
+	}
+
+	supported := false
+	for _, line := range lines[1:] {
+		if len(line) > 4 && strings.EqualFold(strings.TrimSpace(line[4:]), "STARTTLS") {
+			supported = true
+		}
+	}
+	if !supported {
+		return fmt.Errorf("starttls smtp: server does not advertise STARTTLS")
+	}
+
+	if _, err := io.WriteString(conn, "STARTTLS\r\n"); err != nil {
+		return fmt.Errorf("starttls smtp: %w", err)
+	}
+	code, lines, err = readSMTPReply(r)
+	if err != nil {
+		return err
+	}
+	if code != "220" {
+		return fmt.Errorf("starttls smtp: STARTTLS rejected %q", strings.Join(lines, " "))
+	}
+
+	return ensureDrained(r)
+}
+
+func starttlsIMAP(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("starttls imap: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("starttls imap: unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+
+	if _, err := io.WriteString(conn, "a001 STARTTLS\r\n"); err != nil {
+		return fmt.Errorf("starttls imap: %w", err)
+	}
+
+	// Untagged responses may precede the tagged completion result.
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("starttls imap: %w", err)
+		}
+		if !strings.HasPrefix(line, "a001 ") {
+			continue
+		}
+		if !strings.HasPrefix(strings.ToUpper(line), "A001 OK") {
+			return fmt.Errorf("starttls imap: STARTTLS rejected %q", strings.TrimSpace(line))
+		}
+		return ensureDrained(r)
+	}
+}
+
+func starttlsPOP3(conn net.Conn) error {
+	r := bufio.NewReader(conn)
+
+	greeting, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("starttls pop3: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "+OK") {
+		return fmt.Errorf("starttls pop3: unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+
+	if _, err := io.WriteString(conn, "STLS\r\n"); err != nil {
+		return fmt.Errorf("starttls pop3: %w", err)
+	}
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("starttls pop3: %w", err)
+	}
+	if !strings.HasPrefix(line, "+OK") {
+		return fmt.Errorf("starttls pop3: STLS rejected %q", strings.TrimSpace(line))
+	}
+
+	return ensureDrained(r)
+}
+
+// ldapStartTLSOID is the object identifier of the LDAP StartTLS extended
+// operation (RFC 4511, section 4.14).
+const ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// ldapStartTLSRequest returns the BER encoded LDAPMessage carrying a StartTLS
+// ExtendedRequest with message id 1.
+func ldapStartTLSRequest() []byte {
+	oid := []byte(ldapStartTLSOID)
+	extended := append([]byte{0x80, byte(len(oid))}, oid...) // requestName [0]
+	op := append([]byte{0x77, byte(len(extended))}, extended...)
+	body := append([]byte{0x02, 0x01, 0x01}, op...) // messageID 1
+	return append([]byte{0x30, byte(len(body))}, body...)
+}
+
+// readBERElement reads one BER TLV element and returns its tag and content.
+func readBERElement(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+
+	length := int(header[1])
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 {
+			return 0, nil, fmt.Errorf("unsupported BER length encoding")
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, nil, err
+		}
+		length = 0
+		for _, b := range buf {
+			length = length<<8 | int(b)
+		}
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return header[0], content, nil
+}
+
+// splitBERElement splits the first TLV element off data.
+func splitBERElement(data []byte) (byte, []byte, []byte, error) {
+	r := bytes.NewReader(data)
+	tag, content, err := readBERElement(r)
+	if err != nil {
+		return 0, nil, nil, err
+	}
+	return tag, content, data[len(data)-r.Len():], nil
+}
+
+func starttlsLDAP(conn net.Conn) error {
+	if _, err := conn.Write(ldapStartTLSRequest()); err != nil {
+		return fmt.Errorf("starttls ldap: %w", err)
+	}
+
+	tag, message, err := readBERElement(conn)
+	if err != nil {
+		return fmt.Errorf("starttls ldap: %w", err)
+	}
+	if tag != 0x30 {
+		return fmt.Errorf("starttls ldap: unexpected response tag 0x%02x", tag)
+	}
+
+	// messageID
+	_, _, rest, err := splitBERElement(message)
+	if err != nil {
+		return fmt.Errorf("starttls ldap: %w", err)
+	}
+	tag, response, _, err := splitBERElement(rest)
+	if err != nil {
+		return fmt.Errorf("starttls ldap: %w", err)
+	}
+	if tag != 0x78 {
+		return fmt.Errorf("starttls ldap: unexpected operation tag 0x%02x (expected ExtendedResponse)", tag)
+	}
+	tag, code, _, err := splitBERElement(response)
+	if err != nil {
+		return fmt.Errorf("starttls ldap: %w", err)
+	}
+	if tag != 0x0a || len(code) != 1 {
+		return fmt.Errorf("starttls ldap: malformed result code")
+	}
+	if code[0] != 0 {
+		return fmt.Errorf("starttls ldap: StartTLS rejected with result code %d", code[0])
+	}
+
+	return nil
+}
+
+// postgresSSLRequestCode is the magic protocol version of a PostgreSQL
+// SSLRequest message.
+const postgresSSLRequestCode = 80877103
+
+func starttlsPostgres(conn net.Conn) error {
+	request := make([]byte, 8)
+	binary.BigEndian.PutUint32(request[0:4], 8)
+	binary.BigEndian.PutUint32(request[4:8], postgresSSLRequestCode)
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("starttls postgres: %w", err)
+	}
+
+	answer := make([]byte, 1)
+	if _, err := io.ReadFull(conn, answer); err != nil {
+		return fmt.Errorf("starttls postgres: %w", err)
+	}
+	switch answer[0] {
+	case 'S':
+		return nil
+	case 'N':
+		return fmt.Errorf("starttls postgres: server does not support SSL")
+	default:
+		return fmt.Errorf("starttls postgres: unexpected response 0x%02x", answer[0])
+	}
+}
+
+// MySQL capability flags used during the SSL upgrade.
+const (
+	mysqlClientProtocol41       = 0x00000200
+	mysqlClientSSL              = 0x00000800
+	mysqlClientSecureConnection = 0x00008000
+)
+
+// readMySQLPacket reads one MySQL protocol packet and returns its sequence
+// number and payload.
+func readMySQLPacket(r io.Reader) (byte, []byte, error) {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, nil, err
+	}
+	length := int(header[0]) | int(header[1])<<8 | int(header[2])<<16
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	return header[3], payload, nil
+}
+
+// mysqlServerCapabilities extracts the lower capability flags from an initial
+// handshake (protocol version 10) packet.
+func mysqlServerCapabilities(payload []byte) (uint16, error) {
+	if len(payload) == 0 {
+		return 0, fmt.Errorf("empty handshake")
+	}
+	if payload[0] == 0xff {
+		return 0, fmt.Errorf("server sent error packet")
+	}
+	if payload[0] != 10 {
+		return 0, fmt.Errorf("unsupported protocol version %d", payload[0])
+	}
+
+	// server version (NUL terminated)
+	end := bytes.IndexByte(payload[1:], 0)
+	if end < 0 {
+		return 0, fmt.Errorf("malformed handshake")
+	}
+	pos := 1 + end + 1
+	pos += 4 + 8 + 1 // connection id, auth-plugin-data-part-1, filler
+	if len(payload) < pos+2 {
+		return 0, fmt.Errorf("malformed handshake")
+	}
+	return binary.LittleEndian.Uint16(payload[pos : pos+2]), nil
+}
+
+func starttlsMySQL(conn net.Conn) error {
+	seq, payload, err := readMySQLPacket(conn)
+	if err != nil {
+		return fmt.Errorf("starttls mysql: %w", err)
+	}
+	capabilities, err := mysqlServerCapabilities(payload)
+	if err != nil {
+		return fmt.Errorf("starttls mysql: %w", err)
+	}
+	if capabilities&mysqlClientSSL == 0 {
+		return fmt.Errorf("starttls mysql: server does not support SSL")
+	}
+
+	// SSLRequest: capability flags, max packet size, character set, 23 zero bytes
+	request := make([]byte, 4+32)
+	request[0] = 32
+	request[3] = seq + 1
+	binary.LittleEndian.PutUint32(request[4:8], mysqlClientProtocol41|mysqlClientSSL|mysqlClientSecureConnection)
+	binary.LittleEndian.PutUint32(request[8:12], 16777216)
+	request[12] = 45 // utf8mb4_general_ci
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("starttls mysql: %w", err)
+	}
+
+	return nil
+}
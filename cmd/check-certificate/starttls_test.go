@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createStartTLSServer starts a plaintext listener that runs the given protocol
+// exchange and then upgrades the connection to TLS with cert. If the exchange
+// returns false the connection is closed without a handshake.
+func createStartTLSServer(cert tls.Certificate, exchange func(conn net.Conn) bool) (net.Listener, int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if !exchange(conn) {
+					return
+				}
+				tlsConn := tls.Server(conn, &tls.Config{Certificates: []tls.Certificate{cert}})
+				if err := tlsConn.Handshake(); err != nil {
+					return
+				}
+				time.Sleep(100 * time.Millisecond)
+			}(conn)
+		}
+	}()
+
+	return listener, listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+func readLine(r *bufio.Reader) string {
+	line, _ := r.ReadString('\n')
+	return strings.TrimRight(line, "\r\n")
+}
+
+func fakeSMTP(advertise bool) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "220-mail.example.com ESMTP\r\n220 ready\r\n")
+		if !strings.HasPrefix(readLine(r), "EHLO ") {
+			return false
+		}
+		if advertise {
+			io.WriteString(conn, "250-mail.example.com\r\n250-PIPELINING\r\n250-STARTTLS\r\n250 8BITMIME\r\n")
+		} else {
+			io.WriteString(conn, "250-mail.example.com\r\n250 8BITMIME\r\n")
+			return false
+		}
+		if readLine(r) != "STARTTLS" {
+			return false
+		}
+		io.WriteString(conn, "220 2.0.0 Ready to start TLS\r\n")
+		return true
+	}
+}
+
+func fakeIMAP(accept bool) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		r := bufio.NewReader(conn)
+		io.WriteString(conn, "* OK [CAPABILITY IMAP4rev1 STARTTLS] ready\r\n")
+		if readLine(r) != "a001 STARTTLS" {
+			return false
+		}
+		if !accept {
+			io.WriteString(conn, "a001 BAD STARTTLS not available\r\n")
+			return false
+		}
+		io.WriteString(conn, "a001 OK Begin TLS negotiation now\r\n")
+		return true
+	}
+}
+
+func fakePOP3(conn net.Conn) bool {
+	r := bufio.NewReader(conn)
+	io.WriteString(conn, "+OK POP3 ready\r\n")
+	if readLine(r) != "STLS" {
+		return false
+	}
+	io.WriteString(conn, "+OK Begin TLS negotiation\r\n")
+	return true
+}
+
+func fakeLDAP(resultCode byte) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		tag, content, err := readBERElement(conn)
+		if err != nil || tag != 0x30 || !bytes.Contains(content, []byte(ldapStartTLSOID)) {
+			return false
+		}
+		// LDAPMessage { messageID 1, ExtendedResponse { resultCode, matchedDN "", diagnosticMessage "" } }
+		response := []byte{0x0a, 0x01, resultCode, 0x04, 0x00, 0x04, 0x00}
+		op := append([]byte{0x78, byte(len(response))}, response...)
+		body := append([]byte{0x02, 0x01, 0x01}, op...)
+		conn.Write(append([]byte{0x30, byte(len(body))}, body...))
+		return resultCode == 0
+	}
+}
+
+func fakePostgres(answer byte) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		request := make([]byte, 8)
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return false
+		}
+		if binary.BigEndian.Uint32(request[4:]) != postgresSSLRequestCode {
+			return false
+		}
+		conn.Write([]byte{answer})
+		return answer == 'S'
+	}
+}
+
+func fakeMySQL(capabilities uint16) func(conn net.Conn) bool {
+	return func(conn net.Conn) bool {
+		payload := []byte{10}
+		payload = append(payload, []byte("8.0.36\x00")...)
+		payload = append(payload, 1, 0, 0, 0)            // connection id
+		payload = append(payload, []byte("abcdefgh")...) // auth-plugin-data-part-1
+		payload = append(payload, 0)                     // filler
+		payload = binary.LittleEndian.AppendUint16(payload, capabilities)
+		payload = append(payload, 45, 2, 0, 0, 0) // charset, status, upper capabilities
+		packet := []byte{byte(len(payload)), 0, 0, 0}
+		conn.Write(append(packet, payload...))
+
+		if capabilities&mysqlClientSSL == 0 {
+			return false
+		}
+		seq, request, err := readMySQLPacket(conn)
+		if err != nil || seq != 1 || len(request) != 32 {
+			return false
+		}
+		return binary.LittleEndian.Uint32(request[0:4])&mysqlClientSSL != 0
+	}
+}
+
+func TestCertificateChecker_ConnectStartTLS(t *testing.T) {
+	cert, err := generateTestCertificate(
+		time.Now().Add(-24*time.Hour),
+		time.Now().Add(90*24*time.Hour),
+		[]string{"localhost"},
+		"test.example.com",
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name        string
+		protocol    string
+		exchange    func(conn net.Conn) bool
+		expectError string
+	}{
+		{name: "smtp", protocol: "smtp", exchange: fakeSMTP(true)},
+		{name: "smtp without STARTTLS", protocol: "smtp", exchange: fakeSMTP(false), expectError: "does not advertise STARTTLS"},
+		{name: "imap", protocol: "imap", exchange: fakeIMAP(true)},
+		{name: "imap rejected", protocol: "imap", exchange: fakeIMAP(false), expectError: "STARTTLS rejected"},
+		{name: "pop3", protocol: "pop3", exchange: fakePOP3},
+		{name: "ldap", protocol: "ldap", exchange: fakeLDAP(0)},
+		{name: "ldap rejected", protocol: "ldap", exchange: fakeLDAP(2), expectError: "result code 2"},
+		{name: "postgres", protocol: "postgres", exchange: fakePostgres('S')},
+		{name: "postgres without ssl", protocol: "postgres", exchange: fakePostgres('N'), expectError: "does not support SSL"},
+		{name: "mysql", protocol: "mysql", exchange: fakeMySQL(0xffff)},
+		{name: "mysql without ssl", protocol: "mysql", exchange: fakeMySQL(0xffff &^ mysqlClientSSL), expectError: "does not support SSL"},
+		{name: "uppercase protocol", protocol: "SMTP", exchange: fakeSMTP(true)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			listener, port, err := createStartTLSServer(cert, tt.exchange)
+			assert.NoError(t, err)
+			defer listener.Close()
+
+			checker := NewCertificateCheckerWithTLSConfig(Config{
+				Host:     "localhost",
+				Port:     port,
+				Timeout:  5,
+				Expiry:   30,
+				StartTLS: tt.protocol,
+			}, &tls.Config{InsecureSkipVerify: true})
+
+			conn, err := checker.Connect()
+			if tt.expectError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectError)
+				return
+			}
+			assert.NoError(t, err)
+			defer conn.Close()
+
+			validCert, err := checker.ValidateCertificate(conn)
+			assert.NoError(t, err)
+
+			expiring, daysLeft, _ := checker.CheckExpiry(validCert)
+			assert.False(t, expiring)
+			assert.InDelta(t, 90, daysLeft, 1)
+		})
+	}
+}
+
+func TestCertificateChecker_ConnectStartTLSUnknownProtocol(t *testing.T) {
+	checker := NewCertificateChecker(Config{Host: "localhost", Port: 1, Timeout: 1, StartTLS: "gopher"})
+
+	conn, err := checker.Connect()
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported starttls protocol")
+}
+
+func TestCertificateChecker_ConnectStartTLSSilentServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(3 * time.Second)
+	}()
+
+	checker := NewCertificateChecker(Config{
+		Host:     "localhost",
+		Port:     listener.Addr().(*net.TCPAddr).Port,
+		Timeout:  1,
+		StartTLS: "smtp",
+	})
+
+	start := time.Now()
+	_, err = checker.Connect()
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 3*time.Second)
+}
+
+func TestStartTLSProtocols(t *testing.T) {
+	assert.Equal(t, []string{"imap", "ldap", "mysql", "pop3", "postgres", "smtp"}, StartTLSProtocols())
+
+	for _, name := range StartTLSProtocols() {
+		protocol, err := lookupStartTLS(name)
+		assert.NoError(t, err)
+		assert.NotZero(t, protocol.defaultPort)
+	}
+}
+
+func TestLDAPStartTLSRequest(t *testing.T) {
+	tag, content, err := readBERElement(bytes.NewReader(ldapStartTLSRequest()))
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x30), tag)
+
+	tag, id, rest, err := splitBERElement(content)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x02), tag)
+	assert.Equal(t, []byte{1}, id)
+
+	tag, op, _, err := splitBERElement(rest)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x77), tag)
+
+	tag, name, _, err := splitBERElement(op)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x80), tag)
+	assert.Equal(t, ldapStartTLSOID, string(name))
+}
+
+func TestMySQLServerCapabilities(t *testing.T) {
+	_, err := mysqlServerCapabilities([]byte{})
+	assert.Error(t, err)
+
+	_, err = mysqlServerCapabilities([]byte{0xff, 0x15, 0x04})
+	assert.Error(t, err)
+
+	_, err = mysqlServerCapabilities([]byte{9, 'x', 0})
+	assert.Error(t, err)
+
+	_, err = mysqlServerCapabilities([]byte{10, 'x'})
+	assert.Error(t, err)
+}
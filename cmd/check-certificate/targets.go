@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// parseTarget splits a "host[:port]" target (IPv6 addresses in brackets) and
+// falls back to defaultPort when no port is given.
+func parseTarget(target string, defaultPort int) (string, int, error) {
+	if !strings.Contains(target, ":") || (strings.HasPrefix(target, "[") && strings.HasSuffix(target, "]")) {
+		return strings.Trim(target, "[]"), defaultPort, nil
+	}
+
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := strconv.Atoi(port)
+	if err != nil || n <= 0 || n > 65535 {
+		return "", 0, fmt.Errorf("invalid port in target %q", target)
+	}
+	return host, n, nil
+}
+
+// Probe checks the certificate of a single "host[:port]" target in batch mode,
+// using the checker's options for everything else. Connection and validation
+// failures are critical, an expiring certificate is a warning.
+func (cc *CertificateChecker) Probe(ctx context.Context, target string) batch.Outcome {
+	host, port, err := parseTarget(target, cc.config.Port)
+	if err != nil {
+		return batch.Outcome{Label: target, Status: "critical", Message: err.Error()}
+	}
+
+	cfg := cc.config
+	cfg.Host = host
+	cfg.Port = port
+	dialer := *cc.dialer
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	checker := &CertificateChecker{config: cfg, dialer: &dialer, tlsConfig: cc.tlsConfig}
+
+	label := net.JoinHostPort(host, strconv.Itoa(port))
+	conn, err := checker.Connect()
+	if err != nil {
+		return batch.Outcome{Label: label, Status: "critical", Message: err.Error()}
+	}
+	defer conn.Close()
+
+	cert, err := checker.ValidateCertificate(conn)
+	if err != nil {
+		return batch.Outcome{Label: label, Status: "critical", Message: err.Error()}
+	}
+
+	expiring, daysLeft, warning := checker.CheckExpiry(cert)
+	if expiring {
+		return batch.Outcome{Label: label, Status: "warning", Message: warning}
+	}
+
+	return batch.Outcome{Label: label, Status: "ok",
+		Message: fmt.Sprintf("Not After: %s UTC (%0.1f days left)", cert.NotAfter.Format("2006-01-02 15:04:05"), daysLeft)}
+}
+
+// RunTargets checks every target of the targets file concurrently and reports
+// the aggregated result (worst-status-wins).
+func (cc *CertificateChecker) RunTargets(c *check.CheckStruct) {
+	targets, err := batch.ReadTargets(cc.config.Targets)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	outcomes := batch.Run(targets, cc.config.Concurrency, cc.config.Deadline, cc.Probe,
+		func(target string) batch.Outcome {
+			return batch.Outcome{Label: target, Status: "critical", Message: "deadline reached before the check completed"}
+		})
+
+	status, output := batch.Aggregate(outcomes)
+	c.Report(status, output)
+}
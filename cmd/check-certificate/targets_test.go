@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+func TestParseTarget(t *testing.T) {
+	tests := []struct {
+		target      string
+		host        string
+		port        int
+		expectError bool
+	}{
+		{target: "example.com", host: "example.com", port: 443},
+		{target: "example.com:8443", host: "example.com", port: 8443},
+		{target: "192.0.2.1:993", host: "192.0.2.1", port: 993},
+		{target: "[2001:db8::1]:636", host: "2001:db8::1", port: 636},
+		{target: "[2001:db8::1]", host: "2001:db8::1", port: 443},
+		{target: "example.com:https", expectError: true},
+		{target: "example.com:70000", expectError: true},
+		{target: "2001:db8::1", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			host, port, err := parseTarget(tt.target, 443)
+			if tt.expectError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.host, host)
+			assert.Equal(t, tt.port, port)
+		})
+	}
+}
+
+func TestCertificateChecker_Probe(t *testing.T) {
+	valid, err := generateTestCertificate(time.Now().Add(-24*time.Hour), time.Now().Add(90*24*time.Hour), []string{"localhost"}, "valid.example.com")
+	require.NoError(t, err)
+	expiring, err := generateTestCertificate(time.Now().Add(-24*time.Hour), time.Now().Add(10*24*time.Hour), []string{"localhost"}, "expiring.example.com")
+	require.NoError(t, err)
+
+	validListener, validPort, err := createTestTLSServer(valid)
+	require.NoError(t, err)
+	defer validListener.Close()
+	expiringListener, expiringPort, err := createTestTLSServer(expiring)
+	require.NoError(t, err)
+	defer expiringListener.Close()
+
+	checker := NewCertificateCheckerWithTLSConfig(Config{Port: validPort, Timeout: 5, Expiry: 30}, &tls.Config{InsecureSkipVerify: true})
+
+	outcome := checker.Probe(context.Background(), "localhost")
+	assert.Equal(t, "ok", outcome.Status)
+	assert.Equal(t, fmt.Sprintf("localhost:%d", validPort), outcome.Label)
+	assert.Contains(t, outcome.Message, "days left")
+
+	outcome = checker.Probe(context.Background(), fmt.Sprintf("localhost:%d", expiringPort))
+	assert.Equal(t, "warning", outcome.Status)
+	assert.Contains(t, outcome.Message, "Certificate about to expire")
+
+	// hostname mismatch
+	outcome = checker.Probe(context.Background(), fmt.Sprintf("127.0.0.1:%d", validPort))
+	assert.Equal(t, "critical", outcome.Status)
+
+	outcome = checker.Probe(context.Background(), "localhost:abc")
+	assert.Equal(t, "critical", outcome.Status)
+	assert.Equal(t, "localhost:abc", outcome.Label)
+
+	// the checker's own configuration is left untouched
+	assert.Empty(t, checker.config.Host)
+	assert.Equal(t, validPort, checker.config.Port)
+}
+
+func TestCertificateChecker_RunTargets(t *testing.T) {
+	valid, err := generateTestCertificate(time.Now().Add(-24*time.Hour), time.Now().Add(90*24*time.Hour), []string{"localhost"}, "valid.example.com")
+	require.NoError(t, err)
+	listener, port, err := createTestTLSServer(valid)
+	require.NoError(t, err)
+	defer listener.Close()
+
+	run := func(targets string) (int, string) {
+		file := filepath.Join(t.TempDir(), "targets.txt")
+		require.NoError(t, os.WriteFile(file, []byte(targets), 0o600))
+
+		exitCode := -1
+		c := check.New("TestCheck")
+		c.ExitFn = func(code int) {
+			if exitCode == -1 {
+				exitCode = code
+			}
+		}
+		checker := NewCertificateCheckerWithTLSConfig(Config{
+			Port: port, Timeout: 2, Expiry: 30, Targets: file, Concurrency: 2, Deadline: 10 * time.Second,
+		}, &tls.Config{InsecureSkipVerify: true})
+		checker.RunTargets(c)
+		return exitCode, file
+	}
+
+	code, _ := run(fmt.Sprintf("# certificates\nlocalhost\nlocalhost:%d\n", port))
+	assert.Equal(t, 0, code)
+
+	code, _ = run("localhost\nlocalhost:1\n")
+	assert.Equal(t, 2, code)
+
+	code, _ = run("# empty\n")
+	assert.Equal(t, 3, code)
+}
@@ -2,78 +2,256 @@ package main
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
+// options holds the thresholds beyond the aggregate idle check. Thresholds of
+// zero are disabled.
+type options struct {
+	perCore   bool
+	cores     int
+	steal     check.Threshold
+	iowait    check.Threshold
+	softirq   check.Threshold
+	psi       check.Threshold
+	psiWindow string
+}
+
+// Indexes of the /proc/stat cpu columns.
+const (
+	statIowait  = 4
+	statSoftirq = 6
+	statSteal   = 7
+)
+
 func main() {
 	var (
 		warn  int
 		crit  int
 		sleep int
+		opts  options
 	)
 
 	c := check.New("CheckCPU")
 	c.Option.IntVarP(&warn, "warn", "w", 80, "Warning threshold")
 	c.Option.IntVarP(&crit, "crit", "c", 90, "Critical threshold")
 	c.Option.IntVarP(&sleep, "sleep", "s", 1, "Sleep time for sampling")
+	c.Option.BoolVar(&opts.perCore, "per-core", false, "Also evaluate the usage of every core against the warning/critical thresholds")
+	c.Option.IntVar(&opts.cores, "cores", 1, "Number of cores that must exceed a threshold to alert (with --per-core)")
+	c.Option.Float64Var(&opts.steal.Warning, "steal-warn", 0, "Warning threshold for steal % (0 disables)")
+	c.Option.Float64Var(&opts.steal.Critical, "steal-crit", 0, "Critical threshold for steal % (0 disables)")
+	c.Option.Float64Var(&opts.iowait.Warning, "iowait-warn", 0, "Warning threshold for iowait % (0 disables)")
+	c.Option.Float64Var(&opts.iowait.Critical, "iowait-crit", 0, "Critical threshold for iowait % (0 disables)")
+	c.Option.Float64Var(&opts.softirq.Warning, "softirq-warn", 0, "Warning threshold for softirq % (0 disables)")
+	c.Option.Float64Var(&opts.softirq.Critical, "softirq-crit", 0, "Critical threshold for softirq % (0 disables)")
+	c.Option.Float64Var(&opts.psi.Warning, "psi-warn", 0, "Warning threshold for CPU pressure (some) % from /proc/pressure/cpu (0 disables)")
+	c.Option.Float64Var(&opts.psi.Critical, "psi-crit", 0, "Critical threshold for CPU pressure (some) % from /proc/pressure/cpu (0 disables)")
+	c.Option.StringVar(&opts.psiWindow, "psi-window", "avg10", "Pressure average the PSI thresholds apply to (avg10|avg60)")
 	c.Init()
 
-	usage, err := cpuUsage(sleep)
+	if opts.psiWindow != "avg10" && opts.psiWindow != "avg60" {
+		c.Error(fmt.Errorf("invalid --psi-window %q (expected avg10 or avg60)", opts.psiWindow))
+		return
+	}
+
+	usages, err := cpuUsages(sleep)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	level, message := evaluate(usage, warn, crit)
-	report(c, level, message)
+	var pressure *common.PressureStats
+	if opts.psi.Enabled() {
+		stats, err := common.GetPressure("cpu")
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		some := stats["some"]
+		pressure = &some
+	}
+
+	level, message, err := evaluateAll(usages, pressure, warn, crit, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	c.Report(level, message)
 }
 
-// report maps a level (ok|warning|critical) to the matching check result.
-func report(c *check.CheckStruct, level string, message string) {
-	switch level {
-	case "critical":
-		c.Critical(message)
-	case "warning":
-		c.Warning(message)
+// idleLevel decides the level of an idle percentage against usage thresholds.
+func idleLevel(idle float64, warn, crit int) string {
+	switch {
+	case idle <= float64(100-crit):
+		return "critical"
+	case idle <= float64(100-warn):
+		return "warning"
 	default:
-		c.Ok(message)
+		return "ok"
 	}
 }
 
-// evaluate formats the CPU usage and decides the level (ok|warning|critical)
-// based on the idle percentage (usageStats[3]) against the thresholds.
-func evaluate(usageStats []float64, warn, crit int) (string, string) {
-	output, perf := formatOutput(usageStats, warn, crit)
-	message := fmt.Sprintf("%s | %s", output, perf)
+// evaluateAll decides the level from the idle percentage of the aggregate
+// usage and the per-core, steal/iowait/softirq and pressure checks enabled in
+// opts. usages holds the aggregate usage first, followed by one entry per
+// core. pressure is nil unless PSI is enabled. The overall level is the worst
+// of all enabled checks.
+func evaluateAll(usages []cpuUsage, pressure *common.PressureStats, warn, crit int, opts options) (string, string, error) {
+	if len(usages) == 0 || len(usages[0].Stats) < 5 {
+		return "", "", fmt.Errorf("no aggregate cpu line with at least 5 fields in /proc/stat")
+	}
+	aggregate := usages[0].Stats
+	output, perf := formatOutput(aggregate, warn, crit)
+	outputs := []string{output}
+	perfs := []string{perf}
+	levels := []string{idleLevel(aggregate[3], warn, crit)}
+
+	columns := []struct {
+		name      string
+		index     int
+		threshold check.Threshold
+	}{
+		{"steal", statSteal, opts.steal},
+		{"softirq", statSoftirq, opts.softirq},
+		{"iowait", statIowait, opts.iowait},
+	}
+	for _, column := range columns {
+		if !column.threshold.Enabled() {
+			continue
+		}
+		var value float64
+		if column.index < len(aggregate) {
+			value = aggregate[column.index]
+		}
+		level := column.threshold.Level(value)
+		levels = append(levels, level)
+		if level != "ok" {
+			outputs = append(outputs, fmt.Sprintf("%s %.2f%% exceeds %s", column.name, value, level))
+		}
+		// iowait is already part of the default perfdata
+		if column.name != "iowait" {
+			perfs = append(perfs, fmt.Sprintf("cpu_%s=%.2f%%;%s", column.name, value, column.threshold.Perf()))
+		}
+	}
+
+	if opts.perCore && len(usages) > 1 {
+		level, coreOutput, corePerf := evaluateCores(usages[1:], warn, crit, opts.cores)
+		levels = append(levels, level)
+		if len(coreOutput) > 0 {
+			outputs = append(outputs, coreOutput)
+		}
+		perfs = append(perfs, corePerf)
+	}
+
+	if pressure != nil {
+		value := pressure.Avg10
+		if opts.psiWindow == "avg60" {
+			value = pressure.Avg60
+		}
+		level := opts.psi.Level(value)
+		levels = append(levels, level)
+		if level != "ok" {
+			outputs = append(outputs, fmt.Sprintf("cpu pressure %s %.2f%% exceeds %s", opts.psiWindow, value, level))
+		}
+		perfs = append(perfs, fmt.Sprintf("cpu_pressure_avg10=%.2f%% cpu_pressure_avg60=%.2f%%", pressure.Avg10, pressure.Avg60))
+	}
 
+	message := fmt.Sprintf("%s | %s", strings.Join(outputs, " "), strings.Join(perfs, " "))
+	return check.WorstLevel(levels...), message, nil
+}
+
+// evaluateCores counts the cores whose usage (100 - idle) reaches the
+// thresholds. The level is critical (warning) when at least minCores cores
+// reach the critical (warning) threshold.
+func evaluateCores(cores []cpuUsage, warn, crit int, minCores int) (string, string, string) {
+	if minCores < 1 {
+		minCores = 1
+	}
+
+	var warnCount, critCount int
+	busy := []string{}
+	perfs := []string{}
+	for _, core := range cores {
+		usage := 100 - core.Stats[3]
+		switch {
+		case usage >= float64(crit):
+			critCount++
+			warnCount++
+			busy = append(busy, fmt.Sprintf("%s=%.2f%%", core.Name, usage))
+		case usage >= float64(warn):
+			warnCount++
+			busy = append(busy, fmt.Sprintf("%s=%.2f%%", core.Name, usage))
+		}
+		perfs = append(perfs, fmt.Sprintf("%s_usage=%.2f%%;%d;%d", core.Name, usage, warn, crit))
+	}
+
+	output := ""
+	if len(busy) > 0 {
+		output = fmt.Sprintf("%d of %d cores busy: %s", len(busy), len(cores), strings.Join(busy, " "))
+	}
+
+	level := "ok"
 	switch {
-	case usageStats[3] <= float64(100-crit):
-		return "critical", message
-	case usageStats[3] <= float64(100-warn):
-		return "warning", message
-	default:
-		return "ok", message
+	case critCount >= minCores:
+		level = "critical"
+	case warnCount >= minCores:
+		level = "warning"
 	}
+
+	return level, output, strings.Join(perfs, " ")
 }
 
-func cpuUsage(sleep int) ([]float64, error) {
-	var totalDiff float64
+// cpuUsage holds the usage percentages of one /proc/stat cpu line.
+type cpuUsage struct {
+	Name  string
+	Stats []float64
+}
 
-	beforeStats, err := common.GetStats()
+// cpuUsages samples /proc/stat twice, sleep seconds apart, and returns the
+// usage of the aggregate line followed by every core.
+func cpuUsages(sleep int) ([]cpuUsage, error) {
+	before, err := common.GetCPUStats()
 	if err != nil {
-		return []float64{}, err
+		return nil, err
 	}
 
 	time.Sleep(time.Duration(sleep) * time.Second)
 
-	afterStats, err := common.GetStats()
+	after, err := common.GetCPUStats()
 	if err != nil {
-		return []float64{}, err
+		return nil, err
+	}
+
+	return usagesFromStats(before, after), nil
+}
+
+// usagesFromStats computes the usage between two samples. Cores that are
+// missing from one of the samples (e.g. taken offline) are skipped.
+func usagesFromStats(before, after []common.CPUStats) []cpuUsage {
+	previous := map[string][]float64{}
+	for _, stats := range before {
+		previous[stats.Name] = stats.Values
 	}
 
+	result := []cpuUsage{}
+	for _, stats := range after {
+		values, ok := previous[stats.Name]
+		if !ok || len(values) != len(stats.Values) {
+			continue
+		}
+		result = append(result, cpuUsage{Name: stats.Name, Stats: usageStats(values, stats.Values)})
+	}
+	return result
+}
+
+// usageStats converts two samples of jiffies into percentages of the total.
+func usageStats(beforeStats, afterStats []float64) []float64 {
+	var totalDiff float64
+
 	diffStats := make([]float64, len(beforeStats))
 	for i := range beforeStats {
 		diffStats[i] = afterStats[i] - beforeStats[i]
@@ -84,7 +262,7 @@ func cpuUsage(sleep int) ([]float64, error) {
 	for i := range diffStats {
 		usageStats[i] = 100.0 - (100.0 * (totalDiff - diffStats[i]) / totalDiff)
 	}
-	return usageStats, nil
+	return usageStats
 }
 
 func formatOutput(usageStats []float64, warn int, crit int) (string, string) {
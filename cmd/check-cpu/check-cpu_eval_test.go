@@ -5,9 +5,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
-func TestEvaluate(t *testing.T) {
+func TestEvaluateIdle(t *testing.T) {
 	// usageStats layout: user, nice, system, idle(3), iowait, ...
 	tests := []struct {
 		name          string
@@ -24,7 +25,8 @@ func TestEvaluate(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			level, message := evaluate(tt.usage, tt.warn, tt.crit)
+			level, message, err := evaluateAll([]cpuUsage{{Name: "cpu", Stats: tt.usage}}, nil, tt.warn, tt.crit, options{cores: 1})
+			assert.NoError(t, err)
 			assert.Equal(t, tt.expectedLevel, level)
 			assert.Contains(t, message, "idle=")
 			assert.Contains(t, message, "cpu_user=")
@@ -32,13 +34,142 @@ func TestEvaluate(t *testing.T) {
 	}
 }
 
-func TestReport(t *testing.T) {
-	cases := map[string]int{"ok": 0, "warning": 1, "critical": 2, "other": 0}
-	for level, expected := range cases {
-		var got int
-		c := check.New("CheckCPU")
-		c.ExitFn = func(code int) { got = code }
-		report(c, level, "msg")
-		assert.Equal(t, expected, got, "level %q", level)
+// usage builds a usage row: user, nice, system, idle, iowait, irq, softirq, steal
+func usage(name string, user, idle, iowait, softirq, steal float64) cpuUsage {
+	return cpuUsage{Name: name, Stats: []float64{user, 0, 0, idle, iowait, 0, softirq, steal, 0, 0}}
+}
+
+func TestEvaluateAll(t *testing.T) {
+	idleHost := []cpuUsage{
+		usage("cpu", 10, 80, 5, 1, 4),
+		usage("cpu0", 15, 75, 5, 1, 4),
+		usage("cpu1", 5, 85, 5, 1, 4),
+	}
+	oneBusyCore := []cpuUsage{
+		usage("cpu", 50, 50, 0, 0, 0),
+		usage("cpu0", 95, 5, 0, 0, 0),
+		usage("cpu1", 5, 95, 0, 0, 0),
+	}
+	pressure := &common.PressureStats{Avg10: 25, Avg60: 12}
+
+	tests := []struct {
+		name           string
+		usages         []cpuUsage
+		pressure       *common.PressureStats
+		opts           options
+		expectedLevel  string
+		expectContains []string
+		expectMissing  []string
+	}{
+		{
+			name:           "defaults",
+			usages:         idleHost,
+			opts:           options{cores: 1},
+			expectedLevel:  "ok",
+			expectContains: []string{"idle=80.00%"},
+			expectMissing:  []string{"cpu0_usage", "cpu_steal", "pressure"},
+		},
+		{
+			name:           "steal warning",
+			usages:         idleHost,
+			opts:           options{cores: 1, steal: check.Threshold{Warning: 3, Critical: 10}},
+			expectedLevel:  "warning",
+			expectContains: []string{"steal 4.00% exceeds warning", "cpu_steal=4.00%;3;10"},
+		},
+		{
+			name:           "softirq critical",
+			usages:         idleHost,
+			opts:           options{cores: 1, softirq: check.Threshold{Critical: 1}},
+			expectedLevel:  "critical",
+			expectContains: []string{"softirq 1.00% exceeds critical", "cpu_softirq=1.00%;;1"},
+		},
+		{
+			name:          "iowait below threshold",
+			usages:        idleHost,
+			opts:          options{cores: 1, iowait: check.Threshold{Warning: 10}},
+			expectedLevel: "ok",
+			expectMissing: []string{"exceeds"},
+		},
+		{
+			name:           "one busy core alerts",
+			usages:         oneBusyCore,
+			opts:           options{perCore: true, cores: 1},
+			expectedLevel:  "critical",
+			expectContains: []string{"1 of 2 cores busy: cpu0=95.00%", "cpu0_usage=95.00%;80;90", "cpu1_usage=5.00%;80;90"},
+		},
+		{
+			name:           "one busy core below --cores",
+			usages:         oneBusyCore,
+			opts:           options{perCore: true, cores: 2},
+			expectedLevel:  "ok",
+			expectContains: []string{"1 of 2 cores busy"},
+		},
+		{
+			name:           "pressure avg10 critical",
+			usages:         idleHost,
+			pressure:       pressure,
+			opts:           options{cores: 1, psi: check.Threshold{Warning: 10, Critical: 20}, psiWindow: "avg10"},
+			expectedLevel:  "critical",
+			expectContains: []string{"cpu pressure avg10 25.00% exceeds critical", "cpu_pressure_avg10=25.00% cpu_pressure_avg60=12.00%"},
+		},
+		{
+			name:           "pressure avg60 warning",
+			usages:         idleHost,
+			pressure:       pressure,
+			opts:           options{cores: 1, psi: check.Threshold{Warning: 10, Critical: 20}, psiWindow: "avg60"},
+			expectedLevel:  "warning",
+			expectContains: []string{"cpu pressure avg60 12.00% exceeds warning"},
+		},
 	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, message, err := evaluateAll(tt.usages, tt.pressure, 80, 90, tt.opts)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLevel, level)
+			assert.Contains(t, message, " | ")
+			for _, s := range tt.expectContains {
+				assert.Contains(t, message, s)
+			}
+			for _, s := range tt.expectMissing {
+				assert.NotContains(t, message, s)
+			}
+		})
+	}
+}
+
+func TestEvaluateAllDefaults(t *testing.T) {
+	stats := []float64{10, 0, 5, 80, 5, 0, 0, 0}
+	level, message, err := evaluateAll([]cpuUsage{{Name: "cpu", Stats: stats}}, nil, 80, 90, options{cores: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "user=10.00% system=5.00% iowait=5.00% other=0.00% idle=80.00% | cpu_user=10.00%;80;90 cpu_system=5.00%;80;90 cpu_iowait=5.00%;80;90 cpu_other=0.00%;80;90 cpu_idle=80.00%", message)
+}
+
+func TestEvaluateAllEmpty(t *testing.T) {
+	_, _, err := evaluateAll(nil, nil, 80, 90, options{cores: 1})
+	assert.Error(t, err)
+
+	_, _, err = evaluateAll([]cpuUsage{{Name: "cpu", Stats: []float64{10, 0, 5, 80}}}, nil, 80, 90, options{cores: 1})
+	assert.Error(t, err)
+}
+
+func TestUsagesFromStats(t *testing.T) {
+	before := []common.CPUStats{
+		{Name: "cpu", Values: []float64{100, 0, 100, 800, 0}},
+		{Name: "cpu0", Values: []float64{50, 0, 50, 400, 0}},
+		{Name: "cpu1", Values: []float64{50, 0, 50, 400, 0}},
+	}
+	after := []common.CPUStats{
+		{Name: "cpu", Values: []float64{200, 0, 100, 900, 0}},
+		{Name: "cpu0", Values: []float64{150, 0, 50, 400, 0}},
+		{Name: "cpu2", Values: []float64{0, 0, 0, 100, 0}},
+	}
+
+	usages := usagesFromStats(before, after)
+	assert.Equal(t, 2, len(usages))
+	assert.Equal(t, "cpu", usages[0].Name)
+	assert.InDelta(t, 50.0, usages[0].Stats[3], 0.01)
+	assert.Equal(t, "cpu0", usages[1].Name)
+	assert.InDelta(t, 100.0, usages[1].Stats[0], 0.01)
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func main() {
+	var (
+		sleep   int
+		include string
+		exclude string
+		await   check.Threshold
+		util    check.Threshold
+	)
+
+	c := check.New("CheckDiskIO")
+	c.Option.IntVarP(&sleep, "sleep", "s", 1, "Sleep time for sampling")
+	c.Option.StringVarP(&include, "include", "i", "", "Only check devices matching this regular expression")
+	c.Option.StringVarP(&exclude, "exclude", "x", `^(loop|ram|fd)\d+$`, "Skip devices matching this regular expression")
+	c.Option.Float64Var(&await.Warning, "await-warn", 0, "Warning threshold for the average wait per request in ms (0 disables)")
+	c.Option.Float64Var(&await.Critical, "await-crit", 0, "Critical threshold for the average wait per request in ms (0 disables)")
+	c.Option.Float64Var(&util.Warning, "util-warn", 0, "Warning threshold for device utilisation % (0 disables)")
+	c.Option.Float64Var(&util.Critical, "util-crit", 0, "Critical threshold for device utilisation % (0 disables)")
+	c.Init()
+
+	includeRe, err := common.CompileFilter(include)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid --include: %w", err))
+		return
+	}
+	excludeRe, err := common.CompileFilter(exclude)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid --exclude: %w", err))
+		return
+	}
+
+	devices, err := common.SampleDiskIO(sleep)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	devices = common.SelectDiskIO(devices, includeRe, excludeRe)
+	if len(devices) == 0 {
+		c.Error(fmt.Errorf("no block devices found"))
+		return
+	}
+
+	level, message := evaluate(devices, await, util)
+	c.Report(level, message)
+}
+
+// evaluate compares the await and utilisation of every device against the
+// thresholds and returns the worst level with one summary per device and the
+// rates as perfdata.
+func evaluate(devices []common.DiskIO, await, util check.Threshold) (string, string) {
+	outputs := []string{}
+	exceeded := []string{}
+	perfs := []string{}
+	levels := []string{}
+
+	for _, d := range devices {
+		outputs = append(outputs, fmt.Sprintf("%s %.1f r/s %.1f w/s %s/s await %.2fms util %.2f%%",
+			d.Name, d.ReadIOPS, d.WriteIOPS, check.FormatBytes(uint64(d.ReadBytes+d.WriteBytes)), d.Await, d.Util))
+
+		for _, value := range []struct {
+			name      string
+			value     float64
+			unit      string
+			threshold check.Threshold
+		}{
+			{"await", d.Await, "ms", await},
+			{"util", d.Util, "%", util},
+		} {
+			level := value.threshold.Level(value.value)
+			levels = append(levels, level)
+			if level != "ok" {
+				exceeded = append(exceeded, fmt.Sprintf("%s %s %.2f%s exceeds %s", d.Name, value.name, value.value, value.unit, level))
+			}
+		}
+
+		perfs = append(perfs, fmt.Sprintf("%s_read_iops=%.2f %s_write_iops=%.2f %s_read_bytes=%.0fB %s_write_bytes=%.0fB %s_await=%.2fms;%s %s_util=%.2f%%;%s;0;100",
+			d.Name, d.ReadIOPS, d.Name, d.WriteIOPS, d.Name, d.ReadBytes, d.Name, d.WriteBytes,
+			d.Name, d.Await, await.Perf(),
+			d.Name, d.Util, util.Perf()))
+	}
+
+	output := strings.Join(outputs, ", ")
+	if len(exceeded) > 0 {
+		output = strings.Join(exceeded, ", ") + " (" + output + ")"
+	}
+
+	return check.WorstLevel(levels...), output + " | " + strings.Join(perfs, " ")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func TestEvaluate(t *testing.T) {
+	devices := []common.DiskIO{
+		{Name: "sda", ReadIOPS: 120, WriteIOPS: 30, ReadBytes: 1024 * 1024, WriteBytes: 512 * 1024, Await: 4.5, Util: 35},
+		{Name: "nvme0n1", ReadIOPS: 2000, WriteIOPS: 800, ReadBytes: 200 * 1024 * 1024, Await: 0.2, Util: 92},
+	}
+
+	tests := []struct {
+		name           string
+		await          check.Threshold
+		util           check.Threshold
+		expectedLevel  string
+		expectContains []string
+	}{
+		{
+			name:          "no thresholds",
+			expectedLevel: "ok",
+			expectContains: []string{
+				"sda 120.0 r/s 30.0 w/s 1.50MiB/s await 4.50ms util 35.00%, nvme0n1",
+				"sda_read_iops=120.00 sda_write_iops=30.00 sda_read_bytes=1048576B sda_write_bytes=524288B sda_await=4.50ms;; sda_util=35.00%;;;0;100",
+			},
+		},
+		{
+			name:           "util critical",
+			util:           check.Threshold{Warning: 80, Critical: 90},
+			expectedLevel:  "critical",
+			expectContains: []string{"nvme0n1 util 92.00% exceeds critical (sda", "nvme0n1_util=92.00%;80;90;0;100"},
+		},
+		{
+			name:           "await warning",
+			await:          check.Threshold{Warning: 4, Critical: 10},
+			expectedLevel:  "warning",
+			expectContains: []string{"sda await 4.50ms exceeds warning", "sda_await=4.50ms;4;10"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, message := evaluate(devices, tt.await, tt.util)
+			assert.Equal(t, tt.expectedLevel, level)
+			for _, s := range tt.expectContains {
+				assert.Contains(t, message, s)
+			}
+		})
+	}
+}
@@ -3,11 +3,14 @@ package main
 import (
 	"fmt"
 	"math"
-	"os/exec"
+	"os"
+	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
 type input struct {
@@ -19,12 +22,24 @@ type input struct {
 	FstypeExclude string
 	MountExclude  string
 	Path          string
+	Inodes        check.Threshold
+	FreeWarn      string
+	FreeCrit      string
+	IncludeMount  string
+	ExcludeMount  string
+	IncludeDevice string
+	ExcludeDevice string
+	IncludeFstype string
+	ExcludeFstype string
 }
 
 type session struct {
 	Input          input
 	FstypeExcludes []string
 	MountExcludes  []string
+	Filters        filters
+	FreeWarn       uint64
+	FreeCrit       uint64
 	FWarn          float64
 	FCrit          float64
 	WarnMnt        []string
@@ -34,6 +49,52 @@ type session struct {
 	FSize          float64
 }
 
+// filters holds the compiled include/exclude expressions. A nil expression
+// matches everything (include) or nothing (exclude).
+type filters struct {
+	IncludeMount  *regexp.Regexp
+	ExcludeMount  *regexp.Regexp
+	IncludeDevice *regexp.Regexp
+	ExcludeDevice *regexp.Regexp
+	IncludeFstype *regexp.Regexp
+	ExcludeFstype *regexp.Regexp
+}
+
+// fsStats holds the statfs values of a filesystem; sizes are in bytes.
+type fsStats struct {
+	Size       uint64
+	Free       uint64
+	Avail      uint64
+	Inodes     uint64
+	InodesFree uint64
+}
+
+// filesystem is a mounted filesystem together with its statistics.
+type filesystem struct {
+	common.Mount
+	fsStats
+}
+
+// remoteFstypes lists network filesystems, which are skipped like `df -l` does.
+var remoteFstypes = map[string]bool{
+	"nfs":        true,
+	"nfs4":       true,
+	"cifs":       true,
+	"smbfs":      true,
+	"smb3":       true,
+	"ncpfs":      true,
+	"afs":        true,
+	"ceph":       true,
+	"glusterfs":  true,
+	"lustre":     true,
+	"9p":         true,
+	"afpfs":      true,
+	"webdav":     true,
+	"davfs":      true,
+	"sshfs":      true,
+	"fuse.sshfs": true,
+}
+
 func main() {
 	var session session
 
@@ -46,53 +107,105 @@ func main() {
 	c.Option.StringVarP(&session.Input.FstypeExclude, "exclude", "x", "", "Comma separated list of file system types to exclude")
 	c.Option.StringVarP(&session.Input.MountExclude, "ignore", "i", "", "Comma separated list of mount points to ignore")
 	c.Option.StringVarP(&session.Input.Path, "path", "p", "", "Limit check to specified path")
+	c.Option.Float64Var(&session.Input.Inodes.Warning, "inode-warn", 0, "Warning threshold for inode usage % (0 disables)")
+	c.Option.Float64Var(&session.Input.Inodes.Critical, "inode-crit", 0, "Critical threshold for inode usage % (0 disables)")
+	c.Option.StringVar(&session.Input.FreeWarn, "free-warn", "", "Warning when free space is less than or equal to this size, e.g. 10G (empty disables)")
+	c.Option.StringVar(&session.Input.FreeCrit, "free-crit", "", "Critical when free space is less than or equal to this size, e.g. 2G (empty disables)")
+	c.Option.StringVar(&session.Input.IncludeMount, "include-mount", "", "Only check mount points matching this regular expression")
+	c.Option.StringVar(&session.Input.ExcludeMount, "exclude-mount", "", "Skip mount points matching this regular expression")
+	c.Option.StringVar(&session.Input.IncludeDevice, "include-device", "", "Only check devices matching this regular expression")
+	c.Option.StringVar(&session.Input.ExcludeDevice, "exclude-device", "", "Skip devices matching this regular expression")
+	c.Option.StringVar(&session.Input.IncludeFstype, "include-fstype", "", "Only check file system types matching this regular expression")
+	c.Option.StringVar(&session.Input.ExcludeFstype, "exclude-fstype", "", "Skip file system types matching this regular expression")
 	c.Init()
 
 	(&session).parseExcludes()
+	if err := (&session).parseOptions(); err != nil {
+		c.Error(err)
+		return
+	}
 
 	usage, err := diskUsage(session.Input.Path)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
-	for _, u := range usage {
-		if !Contains(session.FstypeExcludes, u[1]) && !Contains(session.MountExcludes, u[6]) {
-			cap, err := strconv.ParseFloat(strings.TrimRight(u[5], "%"), 64)
-			if err != nil {
-				c.Error(err)
-			}
+	for _, fs := range usage {
+		if session.selected(fs.Mount) {
+			(&session).evaluate(fs)
+		}
+	}
 
-			session.FSize, err = strconv.ParseFloat(u[2], 64)
-			if err != nil {
-				c.Error(err)
-			}
+	level, message := session.result()
+	c.Report(level, message)
+}
 
-			(&session).caluculateFCritAndFWarn()
+func (s *session) parseExcludes() {
+	s.FstypeExcludes = strings.Split(s.Input.FstypeExclude, ",")
+	s.MountExcludes = strings.Split(s.Input.MountExclude, ",")
+}
 
-			switch {
-			case cap >= session.FCrit:
-				session.CritMnt = append(session.CritMnt, u[6]+" "+u[5])
-			case cap >= session.FWarn:
-				session.WarnMnt = append(session.WarnMnt, u[6]+" "+u[5])
-			}
-			session.Perf = append(session.Perf, fmt.Sprintf("%s=%s;%.2f;%.2f", u[6], u[5], session.FWarn, session.FCrit))
+// parseOptions compiles the include/exclude expressions and parses the free
+// space thresholds.
+func (s *session) parseOptions() error {
+	expressions := []struct {
+		value  string
+		target **regexp.Regexp
+	}{
+		{s.Input.IncludeMount, &s.Filters.IncludeMount},
+		{s.Input.ExcludeMount, &s.Filters.ExcludeMount},
+		{s.Input.IncludeDevice, &s.Filters.IncludeDevice},
+		{s.Input.ExcludeDevice, &s.Filters.ExcludeDevice},
+		{s.Input.IncludeFstype, &s.Filters.IncludeFstype},
+		{s.Input.ExcludeFstype, &s.Filters.ExcludeFstype},
+	}
+	for _, e := range expressions {
+		if len(e.value) == 0 {
+			continue
 		}
+		re, err := regexp.Compile(e.value)
+		if err != nil {
+			return err
+		}
+		*e.target = re
 	}
 
-	session.Perfs = strings.Join(session.Perf, " ")
-	switch {
-	case len(session.CritMnt) > 0:
-		c.Critical(strings.Join(session.CritMnt, ", ") + " | " + session.Perfs)
-	case len(session.WarnMnt) > 0:
-		c.Warning(strings.Join(session.WarnMnt, ", ") + " | " + session.Perfs)
-	default:
-		c.Ok("OK" + " | " + session.Perfs)
+	var err error
+	if s.FreeWarn, err = check.ParseBytes(s.Input.FreeWarn); err != nil {
+		return err
 	}
+	if s.FreeCrit, err = check.ParseBytes(s.Input.FreeCrit); err != nil {
+		return err
+	}
+	return nil
 }
 
-func (s *session) parseExcludes() {
-	s.FstypeExcludes = strings.Split(s.Input.FstypeExclude, ",")
-	s.MountExcludes = strings.Split(s.Input.MountExclude, ",")
+// selected reports whether a mount passes the exclude lists and the
+// include/exclude expressions.
+func (s *session) selected(m common.Mount) bool {
+	if Contains(s.FstypeExcludes, m.FSType) || Contains(s.MountExcludes, m.MountPoint) {
+		return false
+	}
+
+	checks := []struct {
+		value   string
+		include *regexp.Regexp
+		exclude *regexp.Regexp
+	}{
+		{m.MountPoint, s.Filters.IncludeMount, s.Filters.ExcludeMount},
+		{m.Device, s.Filters.IncludeDevice, s.Filters.ExcludeDevice},
+		{m.FSType, s.Filters.IncludeFstype, s.Filters.ExcludeFstype},
+	}
+	for _, c := range checks {
+		if c.include != nil && !c.include.MatchString(c.value) {
+			return false
+		}
+		if c.exclude != nil && c.exclude.MatchString(c.value) {
+			return false
+		}
+	}
+	return true
 }
 
 func (s *session) caluculateFCritAndFWarn() {
@@ -105,32 +218,208 @@ func (s *session) caluculateFCritAndFWarn() {
 	}
 }
 
-func diskUsage(path string) ([][]string, error) {
-	var (
-		out []byte
-		err error
-	)
-	if len(path) > 0 {
-		out, err = exec.Command("df", "-lTP", path).Output()
-	} else {
-		out, err = exec.Command("df", "-lTP").Output()
+// evaluate checks the space usage, inode usage, free space and read-only
+// state of a filesystem and records the findings and perfdata.
+func (s *session) evaluate(fs filesystem) {
+	mount := fs.MountPoint
+	label := perfLabel(mount)
+
+	// df reports the size in 1K blocks; the magic adjustment expects the same
+	s.FSize = float64(fs.Size) / 1024
+	s.caluculateFCritAndFWarn()
+
+	used := usedPercent(fs.Size-fs.Free, fs.Avail)
+	switch {
+	case used >= s.FCrit:
+		s.CritMnt = append(s.CritMnt, fmt.Sprintf("%s %.0f%%", mount, used))
+	case used >= s.FWarn:
+		s.WarnMnt = append(s.WarnMnt, fmt.Sprintf("%s %.0f%%", mount, used))
+	}
+	s.Perf = append(s.Perf, fmt.Sprintf("%s=%.0f%%;%.2f;%.2f", label, used, s.FWarn, s.FCrit))
+
+	if fs.Inodes > 0 {
+		inodes := usedPercent(fs.Inodes-fs.InodesFree, fs.InodesFree)
+		switch s.Input.Inodes.Level(inodes) {
+		case "critical":
+			s.CritMnt = append(s.CritMnt, fmt.Sprintf("%s inodes %.0f%%", mount, inodes))
+		case "warning":
+			s.WarnMnt = append(s.WarnMnt, fmt.Sprintf("%s inodes %.0f%%", mount, inodes))
+		}
+		s.Perf = append(s.Perf, fmt.Sprintf("%s=%.0f%%;%s", perfLabel(mount+"_inodes"), inodes, s.Input.Inodes.Perf()))
+	}
+
+	if s.FreeWarn > 0 || s.FreeCrit > 0 {
+		switch {
+		case s.FreeCrit > 0 && fs.Avail <= s.FreeCrit:
+			s.CritMnt = append(s.CritMnt, fmt.Sprintf("%s %s free", mount, check.FormatBytes(fs.Avail)))
+		case s.FreeWarn > 0 && fs.Avail <= s.FreeWarn:
+			s.WarnMnt = append(s.WarnMnt, fmt.Sprintf("%s %s free", mount, check.FormatBytes(fs.Avail)))
+		}
+		s.Perf = append(s.Perf, fmt.Sprintf("%s=%dB;%s;%s", perfLabel(mount+"_free"), fs.Avail,
+			formatByteLimit(s.FreeWarn), formatByteLimit(s.FreeCrit)))
+	}
+
+	// A filesystem mounted read-write whose superblock turned read-only was
+	// remounted by the kernel, typically after I/O errors (errors=remount-ro).
+	if fs.HasOption("rw") && fs.HasSuperOption("ro") {
+		s.CritMnt = append(s.CritMnt, fmt.Sprintf("%s remounted read-only", mount))
 	}
+}
+
+// result returns the level (ok|warning|critical) and the message of all
+// evaluated filesystems.
+func (s *session) result() (string, string) {
+	s.Perfs = strings.Join(s.Perf, " ")
+	switch {
+	case len(s.CritMnt) > 0:
+		return "critical", strings.Join(s.CritMnt, ", ") + " | " + s.Perfs
+	case len(s.WarnMnt) > 0:
+		return "warning", strings.Join(s.WarnMnt, ", ") + " | " + s.Perfs
+	default:
+		return "ok", "OK" + " | " + s.Perfs
+	}
+}
+
+// diskUsage returns the local filesystems with their statistics, or only the
+// filesystem containing path when path is set.
+func diskUsage(path string) ([]filesystem, error) {
+	mounts, err := getMounts()
 	if err != nil {
-		return [][]string{}, err
+		return []filesystem{}, err
 	}
+	mounts = localMounts(mounts)
 
-	lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")[1:]
-	result := make([][]string, len(lines))
+	if len(path) > 0 {
+		mount, err := mountOf(mounts, path)
+		if err != nil {
+			return []filesystem{}, err
+		}
+		stats, err := statfs(mount.MountPoint)
+		if err != nil {
+			return []filesystem{}, err
+		}
+		return []filesystem{{Mount: mount, fsStats: stats}}, nil
+	}
 
-	for i := range lines {
-		stats := strings.Fields(lines[i])
-		// return device, fstype, size, used, avail, pctused, mountpoint
-		result[i] = []string{stats[0], stats[1], stats[2], stats[3], stats[4], stats[5], stats[6]}
+	result := []filesystem{}
+	for _, mount := range mounts {
+		stats, err := statfs(mount.MountPoint)
+		// Like df, skip filesystems that cannot be read and pseudo
+		// filesystems without blocks (proc, sysfs, cgroup, ...)
+		if err != nil || stats.Size == 0 {
+			continue
+		}
+		result = append(result, filesystem{Mount: mount, fsStats: stats})
 	}
 
 	return result, nil
 }
 
+// localMounts drops remote filesystems and mounts hidden by a later mount on
+// the same mount point, and keeps one mount per device (preferring the
+// filesystem root, then the shortest mount point) so bind mounts are not
+// reported twice.
+func localMounts(mounts []common.Mount) []common.Mount {
+	visible := map[string]int{}
+	for i, m := range mounts {
+		visible[m.MountPoint] = i
+	}
+
+	type device struct{ major, minor int }
+	chosen := map[device]int{}
+	for i, m := range mounts {
+		if visible[m.MountPoint] != i || isRemote(m) {
+			continue
+		}
+		key := device{m.Major, m.Minor}
+		current, found := chosen[key]
+		if !found || preferMount(m, mounts[current]) {
+			chosen[key] = i
+		}
+	}
+
+	result := []common.Mount{}
+	for i, m := range mounts {
+		if current, found := chosen[device{m.Major, m.Minor}]; found && current == i {
+			result = append(result, m)
+		}
+	}
+	return result
+}
+
+// preferMount reports whether a should be reported instead of b for the same
+// device.
+func preferMount(a, b common.Mount) bool {
+	if (a.Root == "/") != (b.Root == "/") {
+		return a.Root == "/"
+	}
+	return len(a.MountPoint) < len(b.MountPoint)
+}
+
+// isRemote reports whether a mount is a network filesystem.
+func isRemote(m common.Mount) bool {
+	return remoteFstypes[m.FSType] || strings.Contains(m.Device, ":") || strings.HasPrefix(m.Device, "//")
+}
+
+// mountOf returns the mount containing path, i.e. the one with the longest
+// mount point that is a prefix of the resolved path.
+func mountOf(mounts []common.Mount, path string) (common.Mount, error) {
+	resolved, err := filepath.Abs(path)
+	if err != nil {
+		return common.Mount{}, err
+	}
+	if resolved, err = filepath.EvalSymlinks(resolved); err != nil {
+		return common.Mount{}, err
+	}
+	if _, err := os.Stat(resolved); err != nil {
+		return common.Mount{}, err
+	}
+
+	var (
+		best  common.Mount
+		found bool
+	)
+	for _, m := range mounts {
+		prefix := strings.TrimSuffix(m.MountPoint, "/") + "/"
+		if resolved != m.MountPoint && !strings.HasPrefix(resolved, prefix) {
+			continue
+		}
+		if !found || len(m.MountPoint) > len(best.MountPoint) {
+			best, found = m, true
+		}
+	}
+	if !found {
+		return common.Mount{}, fmt.Errorf("no local filesystem found for %s", path)
+	}
+	return best, nil
+}
+
+// usedPercent returns the usage like df: used / (used + available), rounded
+// up to the next integer.
+func usedPercent(used, avail uint64) float64 {
+	if used+avail == 0 {
+		return 0
+	}
+	return math.Ceil(float64(used) * 100 / float64(used+avail))
+}
+
+// perfLabel quotes perfdata labels containing spaces, quotes or equal signs.
+func perfLabel(label string) string {
+	if !strings.ContainsAny(label, " '=") {
+		return label
+	}
+	return "'" + strings.ReplaceAll(label, "'", "''") + "'"
+}
+
+// formatByteLimit renders a byte threshold for perfdata, leaving disabled
+// ones empty.
+func formatByteLimit(limit uint64) string {
+	if limit == 0 {
+		return ""
+	}
+	return strconv.FormatUint(limit, 10)
+}
+
 func Contains(a []string, x string) bool {
 	for _, n := range a {
 		if x == n {
@@ -4,6 +4,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
 func TestDiskUsageNoPath(t *testing.T) {
@@ -19,7 +21,7 @@ func TestDiskUsage(t *testing.T) {
 	results, err := diskUsage("unknown")
 
 	assert.NotNil(t, err)
-	assert.Equal(t, "exit status 1", err.Error())
+	assert.Contains(t, err.Error(), "no such file or directory")
 	assert.GreaterOrEqual(t, len(results), 0)
 }
 
@@ -78,3 +80,172 @@ func TestCaluculateFCritAndFWarnVariant2(t *testing.T) {
 	assert.Equal(t, 90.0, session.FCrit)
 	assert.Equal(t, 0.0, session.FWarn)
 }
+
+func TestDiskUsagePath(t *testing.T) {
+	results, err := diskUsage(t.TempDir())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(results))
+	assert.Greater(t, results[0].Size, uint64(0))
+}
+
+func TestLocalMounts(t *testing.T) {
+	mounts := []common.Mount{
+		{MountPoint: "/", Root: "/", Major: 254, Minor: 0, FSType: "ext4", Device: "/dev/vda1"},
+		{MountPoint: "/dev/shm", Root: "/", Major: 0, Minor: 24, FSType: "tmpfs", Device: "tmpfs"},
+		{MountPoint: "/etc/hosts", Root: "/var/lib/hosts", Major: 254, Minor: 0, FSType: "ext4", Device: "/dev/vda1"},
+		{MountPoint: "/srv/nfs", Root: "/", Major: 0, Minor: 45, FSType: "nfs4", Device: "server:/exports"},
+		{MountPoint: "/mnt/share", Root: "/", Major: 0, Minor: 46, FSType: "fuse.unknown", Device: "//nas/share"},
+		{MountPoint: "/dev/shm", Root: "/", Major: 0, Minor: 27, FSType: "tmpfs", Device: "tmpfs"},
+	}
+
+	result := localMounts(mounts)
+	assert.Equal(t, 2, len(result))
+	assert.Equal(t, "/", result[0].MountPoint)
+	assert.Equal(t, 27, result[1].Minor)
+}
+
+func TestMountOf(t *testing.T) {
+	dir := t.TempDir()
+	mounts := []common.Mount{
+		{MountPoint: "/"},
+		{MountPoint: dir},
+		{MountPoint: dir + "-other"},
+	}
+
+	mount, err := mountOf(mounts, dir)
+	assert.Nil(t, err)
+	assert.Equal(t, dir, mount.MountPoint)
+
+	mount, err = mountOf(mounts[:1], dir)
+	assert.Nil(t, err)
+	assert.Equal(t, "/", mount.MountPoint)
+
+	_, err = mountOf(mounts[1:], "/")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no local filesystem found")
+
+	_, err = mountOf(mounts, dir+"/missing")
+	assert.NotNil(t, err)
+}
+
+func TestSelected(t *testing.T) {
+	session := session{Input: input{
+		FstypeExclude: "tmpfs",
+		MountExclude:  "/boot",
+		ExcludeMount:  "^/snap/",
+		IncludeDevice: "^/dev/",
+		ExcludeFstype: "^squash",
+	}}
+	(&session).parseExcludes()
+	assert.Nil(t, (&session).parseOptions())
+
+	assert.True(t, session.selected(common.Mount{MountPoint: "/", Device: "/dev/vda1", FSType: "ext4"}))
+	assert.False(t, session.selected(common.Mount{MountPoint: "/run", Device: "/dev/tmp", FSType: "tmpfs"}))
+	assert.False(t, session.selected(common.Mount{MountPoint: "/boot", Device: "/dev/vda2", FSType: "ext4"}))
+	assert.False(t, session.selected(common.Mount{MountPoint: "/snap/core/1", Device: "/dev/loop0", FSType: "ext4"}))
+	assert.False(t, session.selected(common.Mount{MountPoint: "/data", Device: "rpool/data", FSType: "zfs"}))
+	assert.False(t, session.selected(common.Mount{MountPoint: "/media", Device: "/dev/sr0", FSType: "squashfs"}))
+}
+
+func TestParseOptions(t *testing.T) {
+	s := session{Input: input{FreeWarn: "10G", FreeCrit: "512M"}}
+	assert.Nil(t, (&s).parseOptions())
+	assert.Equal(t, uint64(10*1024*1024*1024), s.FreeWarn)
+	assert.Equal(t, uint64(512*1024*1024), s.FreeCrit)
+
+	s = session{Input: input{IncludeMount: "["}}
+	assert.NotNil(t, (&s).parseOptions())
+
+	s = session{Input: input{FreeCrit: "lots"}}
+	assert.NotNil(t, (&s).parseOptions())
+}
+
+func TestEvaluate(t *testing.T) {
+	const gib = 1024 * 1024 * 1024
+	root := filesystem{
+		Mount:   common.Mount{MountPoint: "/", Options: []string{"rw"}, SuperOptions: []string{"rw"}},
+		fsStats: fsStats{Size: 100 * gib, Free: 30 * gib, Avail: 25 * gib, Inodes: 1000, InodesFree: 50},
+	}
+	remounted := root
+	remounted.Mount = common.Mount{MountPoint: "/my data", Options: []string{"rw"}, SuperOptions: []string{"ro"}}
+
+	tests := []struct {
+		name           string
+		input          input
+		filesystems    []filesystem
+		expectedLevel  string
+		expectContains []string
+	}{
+		{
+			name:           "space warning",
+			input:          input{Warn: 70, Crit: 90, Minimum: 1000},
+			filesystems:    []filesystem{root},
+			expectedLevel:  "warning",
+			expectContains: []string{"/ 74%", "/=74%;70.00;90.00", "/_inodes=95%;;"},
+		},
+		{
+			name:           "all ok",
+			input:          input{Warn: 80, Crit: 90, Minimum: 1000},
+			filesystems:    []filesystem{root},
+			expectedLevel:  "ok",
+			expectContains: []string{"OK | /=74%;80.00;90.00"},
+		},
+		{
+			name:           "inode critical",
+			input:          input{Warn: 80, Crit: 90, Minimum: 1000, Inodes: check.Threshold{Warning: 80, Critical: 90}},
+			filesystems:    []filesystem{root},
+			expectedLevel:  "critical",
+			expectContains: []string{"/ inodes 95%", "/_inodes=95%;80;90"},
+		},
+		{
+			name:           "free space critical",
+			input:          input{Warn: 80, Crit: 90, Minimum: 1000, FreeWarn: "50G", FreeCrit: "25G"},
+			filesystems:    []filesystem{root},
+			expectedLevel:  "critical",
+			expectContains: []string{"/ 25.00GiB free", "/_free=26843545600B;53687091200;26843545600"},
+		},
+		{
+			name:           "free space warning",
+			input:          input{Warn: 80, Crit: 90, Minimum: 1000, FreeWarn: "50G"},
+			filesystems:    []filesystem{root},
+			expectedLevel:  "warning",
+			expectContains: []string{"/ 25.00GiB free", "/_free=26843545600B;53687091200;"},
+		},
+		{
+			name:           "read-only remount",
+			input:          input{Warn: 80, Crit: 90, Minimum: 1000},
+			filesystems:    []filesystem{root, remounted},
+			expectedLevel:  "critical",
+			expectContains: []string{"/my data remounted read-only", "'/my data'=74%;80.00;90.00", "'/my data_inodes'=95%"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := session{Input: tt.input}
+			assert.Nil(t, (&session).parseOptions())
+			for _, fs := range tt.filesystems {
+				(&session).evaluate(fs)
+			}
+
+			level, message := session.result()
+			assert.Equal(t, tt.expectedLevel, level)
+			for _, s := range tt.expectContains {
+				assert.Contains(t, message, s)
+			}
+		})
+	}
+}
+
+func TestUsedPercent(t *testing.T) {
+	assert.Equal(t, 0.0, usedPercent(0, 0))
+	assert.Equal(t, 18.0, usedPercent(18055676, 83392064))
+	assert.Equal(t, 100.0, usedPercent(10, 0))
+}
+
+func TestPerfLabel(t *testing.T) {
+	assert.Equal(t, "/var", perfLabel("/var"))
+	assert.Equal(t, "'/my data'", perfLabel("/my data"))
+	assert.Equal(t, "'/it''s'", perfLabel("/it's"))
+}
@@ -0,0 +1,61 @@
+//go:build darwin
+
+package main
+
+import (
+	"golang.org/x/sys/unix"
+
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+// getMounts returns the mounted filesystems of getfsstat(2). macOS has no
+// separate superblock options, so a read-only mount is never reported as
+// remounted read-only, and the device number is taken from the filesystem ID.
+func getMounts() ([]common.Mount, error) {
+	n, err := unix.Getfsstat(nil, unix.MNT_NOWAIT)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]unix.Statfs_t, n)
+	if n, err = unix.Getfsstat(buf, unix.MNT_NOWAIT); err != nil {
+		return nil, err
+	}
+
+	mounts := []common.Mount{}
+	for i, st := range buf[:n] {
+		options := []string{"rw"}
+		if st.Flags&unix.MNT_RDONLY != 0 {
+			options = []string{"ro"}
+		}
+		dev := uint32(st.Fsid.Val[0])
+		mounts = append(mounts, common.Mount{
+			ID:           i,
+			Major:        int(dev >> 24),
+			Minor:        int(dev & 0xffffff),
+			Root:         "/",
+			MountPoint:   unix.ByteSliceToString(st.Mntonname[:]),
+			Options:      options,
+			FSType:       unix.ByteSliceToString(st.Fstypename[:]),
+			Device:       unix.ByteSliceToString(st.Mntfromname[:]),
+			SuperOptions: options,
+		})
+	}
+	return mounts, nil
+}
+
+// statfs returns the block and inode counts of the filesystem mounted at path.
+func statfs(path string) (fsStats, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return fsStats{}, err
+	}
+
+	bsize := uint64(st.Bsize)
+	return fsStats{
+		Size:       st.Blocks * bsize,
+		Free:       st.Bfree * bsize,
+		Avail:      st.Bavail * bsize,
+		Inodes:     st.Files,
+		InodesFree: st.Ffree,
+	}, nil
+}
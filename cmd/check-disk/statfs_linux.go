@@ -0,0 +1,36 @@
+//go:build linux
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+// getMounts returns the mounts of /proc/self/mountinfo.
+func getMounts() ([]common.Mount, error) {
+	return common.GetMounts()
+}
+
+// statfs returns the block and inode counts of the filesystem mounted at path.
+func statfs(path string) (fsStats, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return fsStats{}, err
+	}
+
+	// Block counts are in units of the fragment size, like df uses.
+	bsize := uint64(st.Frsize)
+	if bsize == 0 {
+		bsize = uint64(st.Bsize)
+	}
+
+	return fsStats{
+		Size:       st.Blocks * bsize,
+		Free:       st.Bfree * bsize,
+		Avail:      st.Bavail * bsize,
+		Inodes:     st.Files,
+		InodesFree: st.Ffree,
+	}, nil
+}
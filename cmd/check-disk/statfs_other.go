@@ -0,0 +1,20 @@
+//go:build !linux && !darwin
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+// getMounts is only implemented for Linux and macOS.
+func getMounts() ([]common.Mount, error) {
+	return nil, fmt.Errorf("check-disk is not supported on %s", runtime.GOOS)
+}
+
+// statfs is only implemented for Linux and macOS.
+func statfs(path string) (fsStats, error) {
+	return fsStats{}, fmt.Errorf("check-disk is not supported on %s", runtime.GOOS)
+}
@@ -1,68 +1,254 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
-	"strconv"
+	"fmt"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
-type healthStruct struct {
-	Status string
+type options struct {
+	unassigned   check.Threshold
+	initializing check.Threshold
+	pending      check.Threshold
+	activeShards check.Threshold
+	heap         check.Threshold
+	diskHigh     watermark
+	diskFlood    watermark
+}
+
+// indexResult is the health of the named indices, or the reason it could
+// not be read.
+type indexResult struct {
+	Indices map[string]indexHealth
+	Err     error
 }
 
 func main() {
 	var (
-		host    string
-		port    int
-		timeout int
+		conn       connection
+		opts       options
+		timeout    int
+		nodes      bool
+		watermarks bool
+		diskWarn   float64
+		diskCrit   float64
+		indices    []string
+		indexWait  int
 	)
 
 	c := check.New("CheckElasticsearch")
-	c.Option.StringVarP(&host, "host", "h", "localhost", "HOST")
-	c.Option.IntVarP(&port, "port", "P", 9200, "PORT")
+	c.Option.StringVarP(&conn.Host, "host", "h", "localhost", "HOST")
+	c.Option.IntVarP(&conn.Port, "port", "P", 9200, "PORT")
 	c.Option.IntVarP(&timeout, "timeout", "t", 30, "TIMEOUT")
+	c.Option.StringVar(&conn.Scheme, "scheme", "http", "http or https")
+	c.Option.StringVar(&conn.Username, "username", "", "Username for basic authentication")
+	c.Option.StringVar(&conn.Password, "password", "", "Password for basic authentication")
+	c.Option.StringVar(&conn.APIKey, "api-key", "", "Base64 encoded API key (id:api_key), used instead of basic authentication")
+	c.Option.BoolVarP(&conn.Insecure, "insecure", "k", false, "INSECURE (skips peer certificate validation)")
+	c.Option.StringVar(&conn.CACert, "ca-cert", "", "CA certificate file (PEM) to verify the server certificate")
+	c.Option.Float64Var(&opts.unassigned.Warning, "unassigned-warn", 0, "Warning if at least this many shards are unassigned (0 disables)")
+	c.Option.Float64Var(&opts.unassigned.Critical, "unassigned-crit", 0, "Critical if at least this many shards are unassigned (0 disables)")
+	c.Option.Float64Var(&opts.initializing.Warning, "initializing-warn", 0, "Warning if at least this many shards are initializing (0 disables)")
+	c.Option.Float64Var(&opts.initializing.Critical, "initializing-crit", 0, "Critical if at least this many shards are initializing (0 disables)")
+	c.Option.Float64Var(&opts.pending.Warning, "pending-warn", 0, "Warning if at least this many cluster tasks are pending (0 disables)")
+	c.Option.Float64Var(&opts.pending.Critical, "pending-crit", 0, "Critical if at least this many cluster tasks are pending (0 disables)")
+	c.Option.Float64Var(&opts.activeShards.Warning, "active-shards-warn", 0, "Warning if less than this % of shards are active (0 disables)")
+	c.Option.Float64Var(&opts.activeShards.Critical, "active-shards-crit", 0, "Critical if less than this % of shards are active (0 disables)")
+	c.Option.BoolVar(&nodes, "nodes", false, "Check disk and JVM heap usage of each node")
+	c.Option.Float64Var(&diskWarn, "disk-warn", 0, "Warning if a node uses at least this % of its disk (0 disables)")
+	c.Option.Float64Var(&diskCrit, "disk-crit", 0, "Critical if a node uses at least this % of its disk (0 disables)")
+	c.Option.BoolVar(&watermarks, "watermarks", false, "Use the cluster's high and flood stage disk watermarks as disk warning and critical")
+	c.Option.Float64Var(&opts.heap.Warning, "heap-warn", 0, "Warning if a node uses at least this % of its JVM heap (0 disables)")
+	c.Option.Float64Var(&opts.heap.Critical, "heap-crit", 0, "Critical if a node uses at least this % of its JVM heap (0 disables)")
+	c.Option.StringSliceVar(&indices, "index", nil, "Also check the health of these indices (comma separated or repeated, wildcards allowed)")
+	c.Option.IntVar(&indexWait, "index-timeout", 5, "Seconds Elasticsearch waits for a missing index before reporting it (capped at half of --timeout)")
 	c.Init()
 
-	status, err := healthStatus(host, port, timeout)
+	if conn.Scheme != "http" && conn.Scheme != "https" {
+		c.Error(fmt.Errorf("invalid scheme %q, use http or https", conn.Scheme))
+		return
+	}
+	conn.Timeout = time.Duration(timeout) * time.Second
+	opts.diskHigh = watermark{Percent: diskWarn}
+	opts.diskFlood = watermark{Percent: diskCrit}
+
+	client, err := newClient(conn)
 	if err != nil {
 		c.Error(err)
+		return
+	}
+
+	h, err := client.clusterHealth()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	var stats *nodeStats
+	if nodes || watermarks || opts.heap.Enabled() || diskWarn > 0 || diskCrit > 0 {
+		if watermarks {
+			if opts.diskHigh, opts.diskFlood, err = client.watermarks(); err != nil {
+				c.Error(err)
+				return
+			}
+		}
+		s, err := client.nodeStats()
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		stats = &s
+	}
+
+	var index *indexResult
+	if len(indices) > 0 {
+		wait := time.Duration(indexWait) * time.Second
+		if wait > conn.Timeout/2 {
+			wait = conn.Timeout / 2
+		}
+		result, err := client.indexHealth(indices, wait)
+		if err != nil && !indexMissing(err) {
+			c.Error(err)
+			return
+		}
+		index = &indexResult{Indices: result, Err: err}
 	}
 
+	level, message := evaluate(h, stats, index, opts)
+	c.Report(level, message)
+}
+
+// statusLevel maps a health colour to a level. An unknown status is
+// critical.
+func statusLevel(status string) string {
 	switch status {
 	case "green":
-		c.Ok("Cluster is green")
+		return "ok"
 	case "yellow":
-		c.Warning("Cluster is yellow")
-	case "red":
-		c.Critical("Cluster is red")
+		return "warning"
+	default:
+		return "critical"
 	}
 }
 
-func healthStatus(host string, port int, timeout int) (string, error) {
-	var health healthStruct
-	http.DefaultClient.Timeout = time.Duration(timeout) * time.Second
-	url := "http://" + host + ":" + strconv.Itoa(port) + "/_cluster/health"
+// evaluate applies the thresholds to the cluster health, the node stats (nil
+// unless node checks are enabled) and the index health (nil without
+// indices).
+func evaluate(h health, stats *nodeStats, index *indexResult, opts options) (string, string) {
+	levels := []string{}
+	problems := []string{}
+	apply := func(level string, problem string) {
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, fmt.Sprintf("%s, %s", problem, level))
+		}
+	}
 
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return "", err
+	status := h.Status
+	if len(status) == 0 {
+		status = "unknown"
 	}
+	levels = append(levels, statusLevel(status))
 
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return "", err
+	apply(opts.unassigned.Level(float64(h.UnassignedShards)), fmt.Sprintf("%d unassigned shards", h.UnassignedShards))
+	apply(opts.initializing.Level(float64(h.InitializingShards)), fmt.Sprintf("%d initializing shards", h.InitializingShards))
+	apply(opts.pending.Level(float64(h.NumberOfPendingTasks)), fmt.Sprintf("%d pending tasks", h.NumberOfPendingTasks))
+	apply(opts.activeShards.MinLevel(h.ActiveShardsPercentAsNumber), fmt.Sprintf("%.1f%% of shards active", h.ActiveShardsPercentAsNumber))
+
+	output := fmt.Sprintf("Cluster %sis %s, %d nodes, %d active shards (%.1f%%)", clusterName(h), status, h.NumberOfNodes, h.ActiveShards, h.ActiveShardsPercentAsNumber)
+	if h.UnassignedShards > 0 || h.InitializingShards > 0 || h.RelocatingShards > 0 {
+		output += fmt.Sprintf(", %d unassigned, %d initializing, %d relocating", h.UnassignedShards, h.InitializingShards, h.RelocatingShards)
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", err
+	perfs := []string{
+		fmt.Sprintf("es_nodes=%d", h.NumberOfNodes),
+		fmt.Sprintf("es_data_nodes=%d", h.NumberOfDataNodes),
+		fmt.Sprintf("es_active_shards=%d", h.ActiveShards),
+		fmt.Sprintf("es_active_shards_percent=%.1f%%;%s;0;100", h.ActiveShardsPercentAsNumber, opts.activeShards.Perf()),
+		fmt.Sprintf("es_unassigned_shards=%d;%s;0;", h.UnassignedShards, opts.unassigned.Perf()),
+		fmt.Sprintf("es_initializing_shards=%d;%s;0;", h.InitializingShards, opts.initializing.Perf()),
+		fmt.Sprintf("es_relocating_shards=%d", h.RelocatingShards),
+		fmt.Sprintf("es_pending_tasks=%d;%s;0;", h.NumberOfPendingTasks, opts.pending.Perf()),
+	}
+
+	if stats != nil {
+		for _, id := range sortedNodes(stats.Nodes) {
+			n := stats.Nodes[id]
+			label := check.PerfLabel(n.Name)
+
+			heap := n.JVM.Mem.HeapUsedPercent
+			apply(opts.heap.Level(heap), fmt.Sprintf("node %s heap at %.0f%%", n.Name, heap))
+			perfs = append(perfs, fmt.Sprintf("es_heap_used_%s=%.0f%%;%s;0;100", label, heap, opts.heap.Perf()))
+
+			total := n.FS.Total.TotalInBytes
+			if total == 0 || !n.holdsData() {
+				continue
+			}
+			available := n.FS.Total.AvailableInBytes
+			used := float64(total-min(available, total)) / float64(total) * 100
+			apply(diskLevel(used, available, opts.diskHigh, opts.diskFlood), fmt.Sprintf("node %s disk at %.1f%% (%s free)", n.Name, used, check.FormatBytes(available)))
+			perfs = append(perfs, fmt.Sprintf("es_disk_used_%s=%.1f%%;%s;%s;0;100", label, used, check.FormatLimit(opts.diskHigh.Percent), check.FormatLimit(opts.diskFlood.Percent)))
+		}
+	}
+
+	if index != nil {
+		switch {
+		case index.Err != nil:
+			apply("critical", fmt.Sprintf("index health: %s", index.Err))
+		case len(index.Indices) == 0:
+			apply("critical", "no matching index")
+		default:
+			names := make([]string, 0, len(index.Indices))
+			for name := range index.Indices {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			for _, name := range names {
+				apply(statusLevel(index.Indices[name].Status), fmt.Sprintf("index %s is %s", name, index.Indices[name].Status))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		output += ": " + strings.Join(problems, ", ")
 	}
-	defer response.Body.Close()
+	return check.WorstLevel(levels...), output + " | " + strings.Join(perfs, " ")
+}
 
-	json.Unmarshal(body, &health)
-	return health.Status, nil
+func clusterName(h health) string {
+	if len(h.ClusterName) == 0 {
+		return ""
+	}
+	return h.ClusterName + " "
+}
+
+// diskLevel compares a node's disk usage with the watermarks, which are
+// either a percentage of used space or the least free space.
+func diskLevel(used float64, available uint64, high, flood watermark) string {
+	reached := func(w watermark) bool {
+		return (w.Percent > 0 && used >= w.Percent) || (w.Free > 0 && available <= w.Free)
+	}
+	switch {
+	case reached(flood):
+		return "critical"
+	case reached(high):
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// sortedNodes orders the node IDs by node name.
+func sortedNodes(nodes map[string]node) []string {
+	ids := make([]string, 0, len(nodes))
+	for id := range nodes {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return nodes[ids[i]].Name < nodes[ids[j]].Name
+	})
+	return ids
 }
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// fakeCluster serves the fixtures and requires the given Authorization
+// header.
+func fakeCluster(t *testing.T, authorization string) connection {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != authorization {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":{"type":"security_exception","reason":"unable to authenticate user"},"status":401}`))
+			return
+		}
+		fixtures := map[string]string{
+			"/_cluster/health":     "cluster_health.json",
+			"/_nodes/stats/fs,jvm": "nodes_stats.json",
+			"/_cluster/settings":   "cluster_settings.json",
+			"/_cluster/health/logs-2026.06.01,logs-2026.06.02": "index_health.json",
+			"/_cluster/health/missing":                         "index_not_found.json",
+			"/_cluster/health/logs-2026.06.03,audit":           "index_timed_out.json",
+		}
+		fixture, ok := fixtures[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		switch fixture {
+		case "index_not_found.json":
+			w.WriteHeader(http.StatusNotFound)
+		case "index_timed_out.json":
+			assert.Equal(t, "500ms", r.URL.Query().Get("timeout"))
+			w.WriteHeader(http.StatusRequestTimeout)
+		}
+		contents, err := os.ReadFile("testdata/" + fixture)
+		require.NoError(t, err)
+		w.Write(contents)
+	}))
+	t.Cleanup(server.Close)
+
+	address, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(address.Port())
+	return connection{Scheme: "http", Host: address.Hostname(), Port: port, Timeout: time.Second}
+}
+
+func TestClient(t *testing.T) {
+	conn := fakeCluster(t, "Basic "+base64.StdEncoding.EncodeToString([]byte("elastic:secret")))
+	conn.Username = "elastic"
+	conn.Password = "secret"
+	client, err := newClient(conn)
+	require.NoError(t, err)
+
+	h, err := client.clusterHealth()
+	assert.NoError(t, err)
+	assert.Equal(t, "production", h.ClusterName)
+	assert.Equal(t, "yellow", h.Status)
+	assert.Equal(t, 8, h.UnassignedShards)
+	assert.Equal(t, 4, h.NumberOfPendingTasks)
+
+	stats, err := client.nodeStats()
+	assert.NoError(t, err)
+	assert.Len(t, stats.Nodes, 3)
+	assert.Equal(t, uint64(10737418240), stats.Nodes["f3Kd9aQ1RZ2x"].FS.Total.AvailableInBytes)
+	assert.Equal(t, 70.0, stats.Nodes["f3Kd9aQ1RZ2x"].JVM.Mem.HeapUsedPercent)
+
+	high, flood, err := client.watermarks()
+	assert.NoError(t, err)
+	assert.Equal(t, watermark{Percent: 85}, high)
+	assert.Equal(t, watermark{Free: 5 * 1024 * 1024 * 1024}, flood)
+
+	indices, err := client.indexHealth([]string{"logs-2026.06.01", "logs-2026.06.02"}, 500*time.Millisecond)
+	assert.NoError(t, err)
+	assert.Equal(t, "yellow", indices["logs-2026.06.02"].Status)
+
+	_, err = client.indexHealth([]string{"missing"}, 500*time.Millisecond)
+	var status *statusError
+	assert.ErrorAs(t, err, &status)
+	assert.Equal(t, http.StatusNotFound, status.Code)
+	assert.True(t, indexMissing(err))
+	assert.EqualError(t, err, "received HTTP status code 404 from /_cluster/health/missing?level=indices&timeout=500ms: no such index [missing]")
+
+	_, err = client.indexHealth([]string{"logs-2026.06.03", "audit"}, 500*time.Millisecond)
+	assert.True(t, indexMissing(err))
+	assert.EqualError(t, err, "received HTTP status code 408 from /_cluster/health/logs-2026.06.03,audit?level=indices&timeout=500ms: no such index within 500ms")
+
+	conn.Password = "wrong"
+	client, _ = newClient(conn)
+	_, err = client.clusterHealth()
+	assert.EqualError(t, err, "received HTTP status code 401 from /_cluster/health: unable to authenticate user")
+	assert.False(t, indexMissing(err))
+}
+
+func TestClientAPIKey(t *testing.T) {
+	conn := fakeCluster(t, "ApiKey VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw==")
+	conn.APIKey = "VnVhQ2ZHY0JDZGJrUW0tZTVhT3g6dWkybHAyYXhUTm1zeWFrdzl0dk5udw=="
+	conn.Username = "ignored"
+	client, err := newClient(conn)
+	require.NoError(t, err)
+
+	h, err := client.clusterHealth()
+	assert.NoError(t, err)
+	assert.Equal(t, "yellow", h.Status)
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := newClient(connection{Scheme: "https", Host: "::1", Port: 9200, Insecure: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://[::1]:9200", client.base)
+
+	_, err = newClient(connection{Scheme: "https", Host: "localhost", Port: 9200, CACert: "testdata/missing.pem"})
+	assert.Error(t, err)
+
+	_, err = newClient(connection{Scheme: "https", Host: "localhost", Port: 9200, CACert: "testdata/cluster_health.json"})
+	assert.ErrorContains(t, err, "no certificates")
+}
+
+func TestParseWatermark(t *testing.T) {
+	cases := map[string]watermark{
+		"90%":   {Percent: 90},
+		"95.5%": {Percent: 95.5},
+		"0.85":  {Percent: 85},
+		"50gb":  {Free: 50 * 1024 * 1024 * 1024},
+		"500mb": {Free: 500 * 1024 * 1024},
+	}
+	for value, expected := range cases {
+		w, err := parseWatermark(value)
+		assert.NoError(t, err, value)
+		assert.InDelta(t, expected.Percent, w.Percent, 0.0001, value)
+		assert.Equal(t, expected.Free, w.Free, value)
+	}
+
+	for _, value := range []string{"x%", "lots"} {
+		_, err := parseWatermark(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func green() health {
+	return health{ClusterName: "production", Status: "green", NumberOfNodes: 3, NumberOfDataNodes: 2, ActiveShards: 120, ActiveShardsPercentAsNumber: 100}
+}
+
+func TestEvaluateStatus(t *testing.T) {
+	level, message := evaluate(green(), nil, nil, options{})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Cluster production is green, 3 nodes, 120 active shards (100.0%) | es_nodes=3 es_data_nodes=2 es_active_shards=120 es_active_shards_percent=100.0%;;;0;100 es_unassigned_shards=0;;;0; es_initializing_shards=0;;;0; es_relocating_shards=0 es_pending_tasks=0;;;0;", message)
+
+	cases := map[string]string{"yellow": "warning", "red": "critical", "": "critical", "purple": "critical"}
+	for status, expected := range cases {
+		h := green()
+		h.Status = status
+		level, _ := evaluate(h, nil, nil, options{})
+		assert.Equal(t, expected, level, status)
+	}
+
+	h := green()
+	h.Status = ""
+	_, message = evaluate(h, nil, nil, options{})
+	assert.Contains(t, message, "Cluster production is unknown")
+}
+
+func TestEvaluateShards(t *testing.T) {
+	h := green()
+	h.UnassignedShards = 8
+	h.InitializingShards = 2
+	h.RelocatingShards = 1
+	h.NumberOfPendingTasks = 4
+	h.ActiveShardsPercentAsNumber = 91.67
+
+	opts := options{
+		unassigned:   check.Threshold{Warning: 5, Critical: 20},
+		initializing: check.Threshold{Warning: 5},
+		pending:      check.Threshold{Warning: 10},
+		activeShards: check.Threshold{Warning: 95, Critical: 80},
+	}
+	level, message := evaluate(h, nil, nil, opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "Cluster production is green, 3 nodes, 120 active shards (91.7%), 8 unassigned, 2 initializing, 1 relocating: 8 unassigned shards, warning, 91.7% of shards active, warning |")
+	assert.Contains(t, message, "es_active_shards_percent=91.7%;95;80;0;100 es_unassigned_shards=8;5;20;0;")
+
+	opts.pending = check.Threshold{Critical: 4}
+	level, message = evaluate(h, nil, nil, opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "4 pending tasks, critical")
+}
+
+func TestEvaluateNodes(t *testing.T) {
+	client, _ := newClient(fakeCluster(t, ""))
+	stats, err := client.nodeStats()
+	require.NoError(t, err)
+
+	level, message := evaluate(green(), &stats, nil, options{})
+	assert.Equal(t, "ok", level)
+	assert.Contains(t, message, "es_heap_used_es-data-1=70%;;;0;100 es_disk_used_es-data-1=90.0%;;;0;100 es_heap_used_es-data-2=30%;;;0;100 es_disk_used_es-data-2=40.0%;;;0;100 es_heap_used_es-master-1=40%;;;0;100")
+	// the disk of a node without a data role is not checked
+	assert.NotContains(t, message, "es_disk_used_es-master-1")
+
+	opts := options{heap: check.Threshold{Warning: 65, Critical: 85}, diskHigh: watermark{Percent: 85}, diskFlood: watermark{Percent: 95}}
+	level, message = evaluate(green(), &stats, nil, opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, ": node es-data-1 heap at 70%, warning, node es-data-1 disk at 90.0% (10.00GiB free), warning |")
+	assert.Contains(t, message, "es_disk_used_es-data-1=90.0%;85;95;0;100")
+
+	opts.diskFlood = watermark{Free: 20 * 1024 * 1024 * 1024}
+	level, message = evaluate(green(), &stats, nil, opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "node es-data-1 disk at 90.0% (10.00GiB free), critical")
+	assert.NotContains(t, message, "node es-master-1 disk")
+}
+
+func TestEvaluateIndices(t *testing.T) {
+	index := &indexResult{Indices: map[string]indexHealth{
+		"logs-2026.06.01": {Status: "green"},
+		"logs-2026.06.02": {Status: "yellow", UnassignedShards: 1},
+	}}
+	level, message := evaluate(green(), nil, index, options{})
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, ": index logs-2026.06.02 is yellow, warning |")
+
+	index.Indices["logs-2026.06.03"] = indexHealth{Status: "red"}
+	level, _ = evaluate(green(), nil, index, options{})
+	assert.Equal(t, "critical", level)
+
+	level, message = evaluate(green(), nil, &indexResult{Indices: map[string]indexHealth{}}, options{})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "no matching index, critical")
+
+	missing := &statusError{Code: 404, Path: "/_cluster/health/missing?level=indices", Reason: "no such index [missing]"}
+	level, message = evaluate(green(), nil, &indexResult{Err: missing}, options{})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "index health: received HTTP status code 404 from /_cluster/health/missing?level=indices: no such index [missing], critical")
+}
+
+func TestDiskLevel(t *testing.T) {
+	assert.Equal(t, "ok", diskLevel(90, 10, watermark{}, watermark{}))
+	assert.Equal(t, "warning", diskLevel(90, 10, watermark{Percent: 90}, watermark{Percent: 95}))
+	assert.Equal(t, "critical", diskLevel(96, 10, watermark{Percent: 90}, watermark{Percent: 95}))
+	assert.Equal(t, "critical", diskLevel(50, 10, watermark{Percent: 90}, watermark{Free: 10}))
+	assert.Equal(t, "warning", diskLevel(50, 100, watermark{Free: 200}, watermark{Free: 10}))
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+// connection describes how to reach the cluster. APIKey is the base64
+// encoded "id:api_key" pair as returned by the create API key API.
+type connection struct {
+	Scheme   string
+	Host     string
+	Port     int
+	Username string
+	Password string
+	APIKey   string
+	Insecure bool
+	CACert   string
+	Timeout  time.Duration
+}
+
+type client struct {
+	base       string
+	connection connection
+	http       *http.Client
+}
+
+// health is the response of _cluster/health, with level=indices the health
+// of each index.
+type health struct {
+	ClusterName                 string                 `json:"cluster_name"`
+	Status                      string                 `json:"status"`
+	NumberOfNodes               int                    `json:"number_of_nodes"`
+	NumberOfDataNodes           int                    `json:"number_of_data_nodes"`
+	ActiveShards                int                    `json:"active_shards"`
+	RelocatingShards            int                    `json:"relocating_shards"`
+	InitializingShards          int                    `json:"initializing_shards"`
+	UnassignedShards            int                    `json:"unassigned_shards"`
+	NumberOfPendingTasks        int                    `json:"number_of_pending_tasks"`
+	ActiveShardsPercentAsNumber float64                `json:"active_shards_percent_as_number"`
+	Indices                     map[string]indexHealth `json:"indices"`
+}
+
+type indexHealth struct {
+	Status             string `json:"status"`
+	UnassignedShards   int    `json:"unassigned_shards"`
+	InitializingShards int    `json:"initializing_shards"`
+}
+
+// nodeStats is the part of _nodes/stats/fs,jvm the check uses.
+type nodeStats struct {
+	Nodes map[string]node `json:"nodes"`
+}
+
+type node struct {
+	Name  string   `json:"name"`
+	Roles []string `json:"roles"`
+	FS    struct {
+		Total struct {
+			TotalInBytes     uint64 `json:"total_in_bytes"`
+			AvailableInBytes uint64 `json:"available_in_bytes"`
+		} `json:"total"`
+	} `json:"fs"`
+	JVM struct {
+		Mem struct {
+			HeapUsedPercent float64 `json:"heap_used_percent"`
+		} `json:"mem"`
+	} `json:"jvm"`
+}
+
+// holdsData reports whether the node has a data role (data, data_hot,
+// data_content, ...), the only nodes the disk watermarks apply to. Nodes that
+// do not report their roles are assumed to hold data.
+func (n node) holdsData() bool {
+	if len(n.Roles) == 0 {
+		return true
+	}
+	for _, role := range n.Roles {
+		if strings.HasPrefix(role, "data") {
+			return true
+		}
+	}
+	return false
+}
+
+// watermark is a disk watermark, either a percentage of used space or the
+// least free space in bytes.
+type watermark struct {
+	Percent float64
+	Free    uint64
+}
+
+func newClient(c connection) (*client, error) {
+	httpClient, err := common.NewHTTPClient(c.Timeout, c.Insecure, c.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		base:       c.Scheme + "://" + net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		connection: c,
+		http:       httpClient,
+	}, nil
+}
+
+// get requests path and decodes the JSON response into v. Error responses
+// are reported with the reason Elasticsearch gives.
+func (c *client) get(path string, v interface{}) error {
+	request, err := http.NewRequest("GET", c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(c.connection.APIKey) > 0:
+		request.Header.Set("Authorization", "ApiKey "+c.connection.APIKey)
+	case len(c.connection.Username) > 0:
+		request.SetBasicAuth(c.connection.Username, c.connection.Password)
+	}
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return &statusError{Code: response.StatusCode, Path: path, Reason: errorReason(body)}
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// statusError is an unexpected HTTP status code.
+type statusError struct {
+	Code   int
+	Path   string
+	Reason string
+}
+
+func (e *statusError) Error() string {
+	message := fmt.Sprintf("received HTTP status code %d from %s", e.Code, e.Path)
+	if len(e.Reason) > 0 {
+		message += ": " + e.Reason
+	}
+	return message
+}
+
+// errorReason extracts the reason of an Elasticsearch error response.
+func errorReason(body []byte) string {
+	var response struct {
+		Error struct {
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return ""
+	}
+	return response.Error.Reason
+}
+
+func (c *client) clusterHealth() (health, error) {
+	var h health
+	err := c.get("/_cluster/health", &h)
+	return h, err
+}
+
+// indexHealth reads the health of the given indices, which may contain
+// wildcards. Elasticsearch waits up to wait for a named index that does not
+// exist and then answers 408 with timed_out set, so wait has to be shorter
+// than the client timeout for a missing index to be told apart from an
+// unreachable cluster.
+func (c *client) indexHealth(indices []string, wait time.Duration) (map[string]indexHealth, error) {
+	var h health
+	escaped := make([]string, len(indices))
+	for i, index := range indices {
+		escaped[i] = url.PathEscape(index)
+	}
+	path := fmt.Sprintf("/_cluster/health/%s?level=indices&timeout=%dms", strings.Join(escaped, ","), wait.Milliseconds())
+	err := c.get(path, &h)
+	var status *statusError
+	if errors.As(err, &status) && status.Code == http.StatusRequestTimeout && len(status.Reason) == 0 {
+		status.Reason = fmt.Sprintf("no such index within %s", wait)
+	}
+	return h.Indices, err
+}
+
+// indexMissing reports whether err means that a named index does not exist:
+// 404 when the request names a single missing index, 408 when the health
+// request timed out waiting for it.
+func indexMissing(err error) bool {
+	var status *statusError
+	return errors.As(err, &status) && (status.Code == http.StatusNotFound || status.Code == http.StatusRequestTimeout)
+}
+
+func (c *client) nodeStats() (nodeStats, error) {
+	var stats nodeStats
+	err := c.get("/_nodes/stats/fs,jvm", &stats)
+	return stats, err
+}
+
+// watermarks reads the effective high and flood stage disk watermarks.
+func (c *client) watermarks() (watermark, watermark, error) {
+	var settings map[string]map[string]interface{}
+	if err := c.get("/_cluster/settings?include_defaults=true&flat_settings=true", &settings); err != nil {
+		return watermark{}, watermark{}, err
+	}
+
+	lookup := func(name string) (watermark, error) {
+		for _, scope := range []string{"transient", "persistent", "defaults"} {
+			if value, ok := settings[scope][name].(string); ok {
+				return parseWatermark(value)
+			}
+		}
+		return watermark{}, fmt.Errorf("setting %s not found", name)
+	}
+
+	high, err := lookup("cluster.routing.allocation.disk.watermark.high")
+	if err != nil {
+		return watermark{}, watermark{}, err
+	}
+	flood, err := lookup("cluster.routing.allocation.disk.watermark.flood_stage")
+	return high, flood, err
+}
+
+// parseWatermark parses a watermark setting: a percentage ("90%"), a ratio
+// ("0.9") or the least free space ("50gb").
+func parseWatermark(value string) (watermark, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil {
+			return watermark{}, fmt.Errorf("invalid watermark %q", value)
+		}
+		return watermark{Percent: percent}, nil
+	}
+	if ratio, err := strconv.ParseFloat(value, 64); err == nil {
+		return watermark{Percent: ratio * 100}, nil
+	}
+	free, err := check.ParseBytes(value)
+	if err != nil {
+		return watermark{}, fmt.Errorf("invalid watermark %q", value)
+	}
+	return watermark{Free: free}, nil
+}
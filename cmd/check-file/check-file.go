@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// input holds the raw command line options.
+type input struct {
+	Files       string
+	Absent      bool
+	Count       check.Range
+	Age         check.Threshold
+	SizeWarn    string
+	SizeCrit    string
+	MinSizeWarn string
+	MinSizeCrit string
+	Content     string
+	Newest      bool
+}
+
+// options holds the parsed thresholds.
+type options struct {
+	count   check.Range
+	age     check.Threshold
+	size    check.Threshold
+	minSize check.Threshold
+	content *regexp.Regexp
+	newest  bool
+}
+
+// fileInfo is one matched regular file. Matched is nil unless a content
+// expression is given.
+type fileInfo struct {
+	Path    string
+	Size    int64
+	ModTime time.Time
+	Matched *bool
+}
+
+func main() {
+	var in input
+
+	c := check.New("CheckFile")
+	c.Option.StringVarP(&in.Files, "file", "f", "", "Comma-separated file paths or glob patterns")
+	c.Option.BoolVar(&in.Absent, "absent", false, "Critical if any file matches (same as --crit-min 0 --crit-max 0)")
+	c.Option.IntVar(&in.Count.WarnMin, "warn-min", 0, "Warning if fewer files match (0 disables)")
+	c.Option.IntVar(&in.Count.WarnMax, "warn-max", -1, "Warning if more files match (-1 disables)")
+	c.Option.IntVar(&in.Count.CritMin, "crit-min", 1, "Critical if fewer files match (0 disables)")
+	c.Option.IntVar(&in.Count.CritMax, "crit-max", -1, "Critical if more files match (-1 disables)")
+	c.Option.Float64VarP(&in.Age.Warning, "age-warn", "w", 0, "Warning threshold for the time since the last modification in seconds (0 disables)")
+	c.Option.Float64VarP(&in.Age.Critical, "age-crit", "c", 0, "Critical threshold for the time since the last modification in seconds (0 disables)")
+	c.Option.StringVar(&in.SizeWarn, "size-warn", "", "Warning when a file is at least this size, e.g. 10M (empty disables)")
+	c.Option.StringVar(&in.SizeCrit, "size-crit", "", "Critical when a file is at least this size, e.g. 1G (empty disables)")
+	c.Option.StringVar(&in.MinSizeWarn, "min-size-warn", "", "Warning when a file is smaller than this size, e.g. 1K (empty disables)")
+	c.Option.StringVar(&in.MinSizeCrit, "min-size-crit", "", "Critical when a file is smaller than this size, e.g. 1 (empty disables)")
+	c.Option.StringVarP(&in.Content, "content", "r", "", "Critical when a file has no line matching this regular expression")
+	c.Option.BoolVarP(&in.Newest, "newest", "n", false, "Only check the age, size and content of the most recently modified file")
+	c.Init()
+
+	patterns, opts, err := parseOptions(in)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	files, err := findFiles(patterns, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	level, message := evaluate(files, strings.Join(patterns, ","), opts, time.Now())
+	c.Report(level, message)
+}
+
+// parseOptions validates the input and returns the file patterns and the
+// parsed thresholds.
+func parseOptions(in input) ([]string, options, error) {
+	opts := options{count: in.Count, age: in.Age, newest: in.Newest}
+
+	patterns := []string{}
+	for _, pattern := range strings.Split(in.Files, ",") {
+		if pattern = strings.TrimSpace(pattern); len(pattern) > 0 {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, opts, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			patterns = append(patterns, pattern)
+		}
+	}
+	if len(patterns) == 0 {
+		return nil, opts, fmt.Errorf("--file is required")
+	}
+
+	if in.Absent {
+		opts.count = check.Range{WarnMax: -1, CritMax: 0}
+	}
+
+	limits := []struct {
+		value  string
+		target *float64
+	}{
+		{in.SizeWarn, &opts.size.Warning},
+		{in.SizeCrit, &opts.size.Critical},
+		{in.MinSizeWarn, &opts.minSize.Warning},
+		{in.MinSizeCrit, &opts.minSize.Critical},
+	}
+	for _, limit := range limits {
+		size, err := check.ParseBytes(limit.value)
+		if err != nil {
+			return nil, opts, err
+		}
+		*limit.target = float64(size)
+	}
+
+	if len(in.Content) > 0 {
+		re, err := regexp.Compile(in.Content)
+		if err != nil {
+			return nil, opts, err
+		}
+		opts.content = re
+	}
+
+	return patterns, opts, nil
+}
+
+// findFiles returns the regular files matching the patterns, most recently
+// modified first. Content is only searched for the files that are evaluated.
+func findFiles(patterns []string, opts options) ([]fileInfo, error) {
+	seen := map[string]bool{}
+	files := []fileInfo{}
+
+	for _, pattern := range patterns {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range matches {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+
+			info, err := os.Stat(path)
+			if err != nil {
+				// removed since the glob, e.g. a lock file
+				if os.IsNotExist(err) {
+					continue
+				}
+				return nil, err
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			files = append(files, fileInfo{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool { return files[i].ModTime.After(files[j].ModTime) })
+
+	if opts.content != nil {
+		for i := range files {
+			if opts.newest && i > 0 {
+				break
+			}
+			matched, err := containsMatch(files[i].Path, opts.content)
+			if err != nil {
+				return nil, err
+			}
+			files[i].Matched = &matched
+		}
+	}
+
+	return files, nil
+}
+
+// containsMatch reports whether any line of the file, without its line ending,
+// matches the expression.
+func containsMatch(path string, re *regexp.Regexp) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && re.Match(bytes.TrimRight(line, "\r\n")) {
+			return true, nil
+		}
+		if err != nil {
+			if err == io.EOF {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+}
+
+// evaluate checks the number of files and the age, size and content of every
+// file, or only of the newest one. files must be sorted newest first. The
+// overall level is the worst of all checks.
+func evaluate(files []fileInfo, pattern string, opts options, now time.Time) (string, string) {
+	level, output := describe(pattern, len(files), opts.count)
+	levels := []string{level}
+	outputs := []string{output}
+	perfs := []string{fmt.Sprintf("files=%d;%s", len(files), opts.count.Perf())}
+
+	checked := files
+	if opts.newest && len(files) > 1 {
+		checked = files[:1]
+	}
+
+	var oldest float64
+	var total int64
+	for _, f := range checked {
+		age := math.Max(0, now.Sub(f.ModTime).Seconds())
+		oldest = math.Max(oldest, age)
+		total += f.Size
+
+		if opts.age.Enabled() {
+			level := opts.age.Level(age)
+			levels = append(levels, level)
+			if level != "ok" {
+				outputs = append(outputs, fmt.Sprintf("%s modified %s ago", f.Path, formatAge(age)))
+			}
+		}
+
+		if opts.size.Enabled() {
+			level := opts.size.Level(float64(f.Size))
+			levels = append(levels, level)
+			if level != "ok" {
+				outputs = append(outputs, fmt.Sprintf("%s has %s", f.Path, check.FormatBytes(uint64(f.Size))))
+			}
+		}
+
+		if opts.minSize.Enabled() {
+			level := opts.minSize.MinLevel(float64(f.Size))
+			levels = append(levels, level)
+			if level != "ok" {
+				outputs = append(outputs, fmt.Sprintf("%s has only %s", f.Path, check.FormatBytes(uint64(f.Size))))
+			}
+		}
+
+		if f.Matched != nil && !*f.Matched {
+			levels = append(levels, "critical")
+			outputs = append(outputs, fmt.Sprintf("%s does not match %q", f.Path, opts.content.String()))
+		}
+	}
+
+	if len(checked) > 0 {
+		perfs = append(perfs,
+			fmt.Sprintf("age=%.0fs;%s", oldest, opts.age.Perf()),
+			fmt.Sprintf("size=%dB", total))
+	}
+
+	message := fmt.Sprintf("%s | %s", strings.Join(outputs, ", "), strings.Join(perfs, " "))
+	return check.WorstLevel(levels...), message
+}
+
+// describe turns a file count into a level and message.
+func describe(pattern string, count int, r check.Range) (string, string) {
+	level := r.Level(count)
+	switch {
+	case count == 0 && level != "ok":
+		return level, fmt.Sprintf("No file matches [%s]", pattern)
+	case level == "critical" && r.CritMax == 0:
+		return level, fmt.Sprintf("File [%s]: %d file(s) present, expected none", pattern, count)
+	case level != "ok":
+		return level, fmt.Sprintf("File [%s]: %d file(s), expected %s", pattern, count, r.Expected(level))
+	}
+	return "ok", fmt.Sprintf("File [%s]: %d file(s)", pattern, count)
+}
+
+// formatAge renders seconds as a short duration, e.g. "26h0m0s".
+func formatAge(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
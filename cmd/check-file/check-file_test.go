@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+var now = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// writeFile creates a file with content that was last modified age ago.
+func writeFile(t *testing.T, path string, content string, age time.Duration) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	modified := now.Add(-age)
+	require.NoError(t, os.Chtimes(path, modified, modified))
+}
+
+func defaults() input {
+	return input{Count: check.Range{WarnMax: -1, CritMin: 1, CritMax: -1}}
+}
+
+// run parses the input, scans the files and evaluates them like main does.
+func run(t *testing.T, in input) (string, string) {
+	patterns, opts, err := parseOptions(in)
+	require.NoError(t, err)
+	files, err := findFiles(patterns, opts)
+	require.NoError(t, err)
+	return evaluate(files, in.Files, opts, now)
+}
+
+func TestParseOptions(t *testing.T) {
+	in := defaults()
+	_, _, err := parseOptions(in)
+	assert.Error(t, err)
+
+	in.Files = "/backup/[a.tar"
+	_, _, err = parseOptions(in)
+	assert.Error(t, err)
+
+	in.Files = "/backup/*.tar, /backup/*.tgz"
+	in.SizeWarn = "10x"
+	_, _, err = parseOptions(in)
+	assert.Error(t, err)
+
+	in.SizeWarn = "1G"
+	in.MinSizeCrit = "1K"
+	in.Content = "(unclosed"
+	_, _, err = parseOptions(in)
+	assert.Error(t, err)
+
+	in.Content = "OK$"
+	in.Absent = true
+	patterns, opts, err := parseOptions(in)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/backup/*.tar", "/backup/*.tgz"}, patterns)
+	assert.Equal(t, float64(1<<30), opts.size.Warning)
+	assert.Equal(t, 1024.0, opts.minSize.Critical)
+	assert.Equal(t, check.Range{WarnMax: -1, CritMax: 0}, opts.count)
+	assert.NotNil(t, opts.content)
+}
+
+func TestFindFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "a.log"), "a", time.Hour)
+	writeFile(t, filepath.Join(dir, "b.log"), "b", time.Minute)
+	writeFile(t, filepath.Join(dir, "c.txt"), "c", 2*time.Hour)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "d.log"), 0o755))
+
+	files, err := findFiles([]string{filepath.Join(dir, "*.log"), filepath.Join(dir, "a.*")}, options{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(files))
+	assert.Equal(t, filepath.Join(dir, "b.log"), files[0].Path)
+	assert.Equal(t, int64(1), files[0].Size)
+	assert.Nil(t, files[0].Matched)
+
+	files, err = findFiles([]string{filepath.Join(dir, "missing")}, options{})
+	assert.NoError(t, err)
+	assert.Empty(t, files)
+}
+
+func TestContainsMatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "status")
+	writeFile(t, path, "started\nfinished: OK", 0)
+
+	_, opts, err := parseOptions(input{Files: path, Content: "^finished: OK$"})
+	require.NoError(t, err)
+	matched, err := containsMatch(path, opts.content)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+
+	_, opts, _ = parseOptions(input{Files: path, Content: "^ERROR"})
+	matched, err = containsMatch(path, opts.content)
+	assert.NoError(t, err)
+	assert.False(t, matched)
+
+	_, err = containsMatch(filepath.Join(dir, "missing"), opts.content)
+	assert.Error(t, err)
+}
+
+func TestExistence(t *testing.T) {
+	dir := t.TempDir()
+	in := defaults()
+	in.Files = filepath.Join(dir, "*.lock")
+
+	level, message := run(t, in)
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "No file matches ["+in.Files+"] | files=0;;1:", message)
+
+	writeFile(t, filepath.Join(dir, "app.lock"), "42", time.Minute)
+	level, message = run(t, in)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "File ["+in.Files+"]: 1 file(s) | files=1;;1: age=60s;; size=2B", message)
+
+	in.Absent = true
+	level, message = run(t, in)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "1 file(s) present, expected none")
+
+	in = defaults()
+	in.Files = filepath.Join(dir, "*.lock")
+	in.Count = check.Range{WarnMin: 2, WarnMax: 5, CritMin: 1, CritMax: 10}
+	level, message = run(t, in)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "1 file(s), expected 2..5")
+}
+
+func TestAge(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "backup-1.tar"), "old", 50*time.Hour)
+	writeFile(t, filepath.Join(dir, "backup-2.tar"), "new", 2*time.Hour)
+
+	in := defaults()
+	in.Files = filepath.Join(dir, "backup-*.tar")
+	in.Age = check.Threshold{Warning: 26 * 3600, Critical: 48 * 3600}
+
+	level, message := run(t, in)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, filepath.Join(dir, "backup-1.tar")+" modified 50h0m0s ago")
+	assert.Contains(t, message, "age=180000s;93600;172800")
+
+	in.Newest = true
+	level, message = run(t, in)
+	assert.Equal(t, "ok", level)
+	assert.Contains(t, message, "age=7200s;93600;172800 size=3B")
+}
+
+func TestSize(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "empty.dump"), "", time.Hour)
+	writeFile(t, filepath.Join(dir, "large.dump"), string(make([]byte, 3000)), time.Hour)
+
+	in := defaults()
+	in.Files = filepath.Join(dir, "*.dump")
+	in.SizeWarn = "2K"
+	in.SizeCrit = "10K"
+	level, message := run(t, in)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, filepath.Join(dir, "large.dump")+" has 2.93KiB")
+
+	in = defaults()
+	in.Files = filepath.Join(dir, "*.dump")
+	in.MinSizeWarn = "4K"
+	in.MinSizeCrit = "1"
+	level, message = run(t, in)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, filepath.Join(dir, "empty.dump")+" has only 0B")
+	assert.Contains(t, message, filepath.Join(dir, "large.dump")+" has only 2.93KiB")
+	assert.Contains(t, message, "size=3000B")
+}
+
+func TestContent(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "job-1.log"), "running\nERROR disk full\n", 2*time.Hour)
+	writeFile(t, filepath.Join(dir, "job-2.log"), "running\nfinished\n", time.Hour)
+
+	in := defaults()
+	in.Files = filepath.Join(dir, "job-*.log")
+	in.Content = "^finished$"
+	level, message := run(t, in)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, filepath.Join(dir, "job-1.log")+` does not match "^finished$"`)
+	assert.NotContains(t, message, "job-2.log does not match")
+
+	in.Newest = true
+	level, _ = run(t, in)
+	assert.Equal(t, "ok", level)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"io"
@@ -10,6 +11,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
@@ -29,7 +31,12 @@ type request struct {
 }
 
 func main() {
-	request := request{}
+	var (
+		request     = request{}
+		targets     string
+		concurrency int
+		deadline    time.Duration
+	)
 
 	c := check.New("check-http-json")
 	c.Option.SortFlags = false
@@ -44,11 +51,32 @@ func main() {
 	c.Option.StringVarP(&request.proxyURL, "proxy-url", "", "", "Proxy URL which can include a PORT")
 	c.Option.BoolVarP(&request.noProxy, "no-proxy", "", false, "Do not use http proxy (also not from environment)")
 	c.Option.IntVarP(&request.code, "code", "c", 200, "Expected response code")
+	c.Option.StringVar(&targets, "targets", "", "File with one URL per line for batch mode")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of URLs probed concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
 	c.Init()
 
+	// Batch mode: send the same request to every URL in the file.
+	if len(targets) > 0 {
+		urls, err := batch.ReadTargets(targets)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		outcomes := batch.Run(urls, concurrency, deadline,
+			func(ctx context.Context, url string) batch.Outcome {
+				return probe(ctx, request, url)
+			},
+			expired)
+		status, output := batch.Aggregate(outcomes)
+		c.Report(status, output)
+		return
+	}
+
 	status, response, err := send(&request)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
 	switch {
@@ -59,7 +87,34 @@ func main() {
 	}
 }
 
+// probe sends the request to a single URL in batch mode. Request errors count
+// as critical for that URL.
+func probe(ctx context.Context, request request, url string) batch.Outcome {
+	request.url = url
+
+	status, response, err := sendContext(ctx, &request)
+	switch {
+	case err != nil:
+		return batch.Outcome{Label: url, Status: "critical", Message: err.Error()}
+	case status == "CRITICAL":
+		return batch.Outcome{Label: url, Status: "critical", Message: response}
+	default:
+		return batch.Outcome{Label: url, Status: "ok", Message: response}
+	}
+}
+
+// expired is the batch outcome of a URL that did not complete before the
+// overall deadline.
+func expired(url string) batch.Outcome {
+	return batch.Outcome{Label: url, Status: "critical", Message: "deadline reached before the check completed"}
+}
+
 func send(request *request) (string, string, error) {
+	return sendContext(context.Background(), request)
+}
+
+// sendContext sends the request bound to ctx and evaluates the response.
+func sendContext(ctx context.Context, request *request) (string, string, error) {
 	tr := &http.Transport{
 		Proxy:           http.ProxyFromEnvironment,
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: request.insecure},
@@ -79,7 +134,7 @@ func send(request *request) (string, string, error) {
 
 	client := &http.Client{Transport: tr, Timeout: request.timeout}
 
-	r, err := http.NewRequest(request.method, request.url, strings.NewReader(request.body))
+	r, err := http.NewRequestWithContext(ctx, request.method, request.url, strings.NewReader(request.body))
 	if err != nil {
 		return "", "", err
 	}
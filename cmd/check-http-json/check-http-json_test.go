@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,6 +12,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
 )
 
 func TestSendWithStatusCodes(t *testing.T) {
@@ -494,3 +496,67 @@ func TestSendResponseTime(t *testing.T) {
 	assert.Contains(t, response, "took [")
 	assert.Contains(t, response, " ms]")
 }
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/healthy":
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"status":"green"}`)
+		case "/degraded":
+			w.WriteHeader(http.StatusOK)
+			io.WriteString(w, `{"status":"red"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	req := request{timeout: 5 * time.Second, method: "GET", code: http.StatusOK, pattern: `"green"`}
+
+	outcome := probe(context.Background(), req, server.URL+"/healthy")
+	assert.Equal(t, "ok", outcome.Status)
+	assert.Equal(t, server.URL+"/healthy", outcome.Label)
+	assert.Contains(t, outcome.Message, "Status code [200]")
+
+	outcome = probe(context.Background(), req, server.URL+"/degraded")
+	assert.Equal(t, "critical", outcome.Status)
+	assert.Contains(t, outcome.Message, "doesn't match")
+
+	outcome = probe(context.Background(), req, server.URL+"/missing")
+	assert.Equal(t, "critical", outcome.Status)
+	assert.Contains(t, outcome.Message, "Status code [404]")
+
+	outcome = probe(context.Background(), req, "://invalid")
+	assert.Equal(t, "critical", outcome.Status)
+
+	// the request passed by value must not be modified
+	assert.Empty(t, req.url)
+}
+
+func TestBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			time.Sleep(2 * time.Second)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a", server.URL + "/slow", server.URL + "/b"}
+	req := request{timeout: 5 * time.Second, method: "GET", code: http.StatusOK}
+
+	start := time.Now()
+	outcomes := batch.Run(urls, 3, 200*time.Millisecond,
+		func(ctx context.Context, url string) batch.Outcome {
+			return probe(ctx, req, url)
+		},
+		expired)
+	assert.Less(t, time.Since(start), time.Second)
+
+	status, output := batch.Aggregate(outcomes)
+	assert.Equal(t, "critical", status)
+	assert.Contains(t, output, "1 critical, 0 warning, 2 ok (of 3)")
+	assert.Contains(t, output, "- "+server.URL+"/slow: CRITICAL")
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"crypto/tls"
 	"net/http"
 	"strconv"
 	"time"
 
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
@@ -19,8 +21,11 @@ type input struct {
 
 func main() {
 	var (
-		input    input
-		redirect bool
+		input       input
+		redirect    bool
+		targets     string
+		concurrency int
+		deadline    time.Duration
 	)
 
 	c := check.New("CheckHTTP")
@@ -29,34 +34,89 @@ func main() {
 	c.Option.StringVarP(&input.Username, "username", "", "", "Username for basic authentication")
 	c.Option.StringVarP(&input.Password, "password", "", "", "Password for basic authentication")
 	c.Option.BoolVarP(&input.Insecure, "insecure", "k", false, "INSECURE (skips peer certificate validation)")
+	c.Option.StringVar(&targets, "targets", "", "File with one URL per line for batch mode")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of URLs probed concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
 
 	c.Init()
 
+	// Batch mode: probe every URL in the file with the same options.
+	if len(targets) > 0 {
+		urls, err := batch.ReadTargets(targets)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		outcomes := batch.Run(urls, concurrency, deadline,
+			func(ctx context.Context, url string) batch.Outcome {
+				return probe(ctx, input, url, redirect)
+			},
+			expired)
+		level, output := batch.Aggregate(outcomes)
+		c.Report(level, output)
+		return
+	}
+
 	status, err := statusCode(input)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
+	level, output := evaluate(status, redirect)
+	c.Report(level, output)
+}
+
+// evaluate maps an HTTP status code to a level (ok|warning|critical).
+func evaluate(status int, redirect bool) (string, string) {
+	output := strconv.Itoa(status)
+
 	switch {
 	case status >= 400:
-		c.Critical(strconv.Itoa(status))
+		return "critical", output
 	case status >= 300 && redirect:
-		c.Ok(strconv.Itoa(status))
+		return "ok", output
 	case status >= 300:
-		c.Warning(strconv.Itoa(status))
+		return "warning", output
 	default:
-		c.Ok(strconv.Itoa(status))
+		return "ok", output
 	}
 }
 
+// probe checks a single URL in batch mode. Request errors count as critical
+// for that URL.
+func probe(ctx context.Context, input input, url string, redirect bool) batch.Outcome {
+	input.Url = url
+
+	status, err := statusCodeContext(ctx, input)
+	if err != nil {
+		return batch.Outcome{Label: url, Status: "critical", Message: err.Error()}
+	}
+
+	level, output := evaluate(status, redirect)
+	return batch.Outcome{Label: url, Status: level, Message: output}
+}
+
+// expired is the batch outcome of a URL that did not complete before the
+// overall deadline.
+func expired(url string) batch.Outcome {
+	return batch.Outcome{Label: url, Status: "critical", Message: "deadline reached before the check completed"}
+}
+
 func statusCode(input input) (int, error) {
+	return statusCodeContext(context.Background(), input)
+}
+
+// statusCodeContext performs the request bound to ctx and returns the
+// response status code.
+func statusCodeContext(ctx context.Context, input input) (int, error) {
 	c := http.Client{
 		Timeout: time.Duration(input.Timeout) * time.Second,
 		Transport: &http.Transport{
 			ResponseHeaderTimeout: time.Duration(input.Timeout) * time.Second,
 			TLSClientConfig:       &tls.Config{InsecureSkipVerify: input.Insecure}}}
 
-	request, err := http.NewRequest(http.MethodGet, input.Url, http.NoBody)
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, input.Url, http.NoBody)
 	if err != nil {
 		return 0, err
 	}
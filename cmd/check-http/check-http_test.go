@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -8,6 +9,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
 )
 
 func TestStatusCode(t *testing.T) {
@@ -243,3 +245,85 @@ func TestStatusCodeWithHTTPS(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		status   int
+		redirect bool
+		expected string
+	}{
+		{200, false, "ok"},
+		{204, false, "ok"},
+		{301, false, "warning"},
+		{301, true, "ok"},
+		{404, false, "critical"},
+		{503, true, "critical"},
+	}
+
+	for _, tt := range tests {
+		level, output := evaluate(tt.status, tt.redirect)
+		assert.Equal(t, tt.expected, level, "status %d", tt.status)
+		assert.Equal(t, fmt.Sprint(tt.status), output)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/slow":
+			time.Sleep(2 * time.Second)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	in := input{Timeout: 5}
+
+	outcome := probe(context.Background(), in, server.URL+"/ok", false)
+	assert.Equal(t, batch.Outcome{Label: server.URL + "/ok", Status: "ok", Message: "200"}, outcome)
+
+	outcome = probe(context.Background(), in, server.URL+"/missing", false)
+	assert.Equal(t, "critical", outcome.Status)
+	assert.Equal(t, "404", outcome.Message)
+
+	outcome = probe(context.Background(), in, "http://[::1]:namedport", false)
+	assert.Equal(t, "critical", outcome.Status)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	outcome = probe(ctx, in, server.URL+"/slow", false)
+	assert.Equal(t, "critical", outcome.Status)
+	assert.Contains(t, outcome.Message, "context deadline exceeded")
+}
+
+func TestBatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/down" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	urls := []string{server.URL + "/a", server.URL + "/down", server.URL + "/b"}
+	outcomes := batch.Run(urls, 2, 5*time.Second,
+		func(ctx context.Context, url string) batch.Outcome {
+			return probe(ctx, input{Timeout: 5}, url, false)
+		},
+		expired)
+
+	status, output := batch.Aggregate(outcomes)
+	assert.Equal(t, "critical", status)
+	assert.Contains(t, output, "1 critical, 0 warning, 2 ok (of 3)")
+	assert.Contains(t, output, "- "+server.URL+"/down: CRITICAL 503")
+}
+
+func TestExpired(t *testing.T) {
+	outcome := expired("http://example.com/")
+	assert.Equal(t, "critical", outcome.Status)
+	assert.Equal(t, "http://example.com/", outcome.Label)
+}
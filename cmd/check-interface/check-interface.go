@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func main() {
+	var (
+		sleep   int
+		include string
+		exclude string
+		errors  check.Threshold
+		drops   check.Threshold
+	)
+
+	c := check.New("CheckInterface")
+	c.Option.IntVarP(&sleep, "sleep", "s", 1, "Sleep time for sampling")
+	c.Option.StringVarP(&include, "include", "i", "", "Only check interfaces matching this regular expression")
+	c.Option.StringVarP(&exclude, "exclude", "x", "^lo$", "Skip interfaces matching this regular expression")
+	c.Option.Float64Var(&errors.Warning, "error-warn", 0, "Warning threshold for rx + tx errors per second (0 disables)")
+	c.Option.Float64Var(&errors.Critical, "error-crit", 0, "Critical threshold for rx + tx errors per second (0 disables)")
+	c.Option.Float64Var(&drops.Warning, "drop-warn", 0, "Warning threshold for rx + tx drops per second (0 disables)")
+	c.Option.Float64Var(&drops.Critical, "drop-crit", 0, "Critical threshold for rx + tx drops per second (0 disables)")
+	c.Init()
+
+	includeRe, err := common.CompileFilter(include)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid --include: %w", err))
+		return
+	}
+	excludeRe, err := common.CompileFilter(exclude)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid --exclude: %w", err))
+		return
+	}
+
+	interfaces, err := common.SampleNetIO(sleep)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	interfaces = common.SelectNetIO(interfaces, includeRe, excludeRe)
+	if len(interfaces) == 0 {
+		c.Error(fmt.Errorf("no network interfaces found"))
+		return
+	}
+
+	level, message := evaluate(interfaces, errors, drops)
+	c.Report(level, message)
+}
+
+// evaluate raises a critical for every administratively up interface without
+// link and compares the error and drop rates against the thresholds.
+// Administratively down interfaces are listed but never alert.
+func evaluate(interfaces []common.NetIO, errors, drops check.Threshold) (string, string) {
+	outputs := []string{}
+	exceeded := []string{}
+	perfs := []string{}
+	levels := []string{}
+
+	for _, i := range interfaces {
+		state := i.OperState
+		if !i.AdminUp {
+			state = "admin down"
+		}
+		outputs = append(outputs, fmt.Sprintf("%s %s", i.Name, state))
+
+		if i.LinkDown {
+			levels = append(levels, "critical")
+			exceeded = append(exceeded, fmt.Sprintf("%s link down", i.Name))
+		}
+
+		for _, value := range []struct {
+			name      string
+			value     float64
+			threshold check.Threshold
+		}{
+			{"errors", i.RxErrors + i.TxErrors, errors},
+			{"drops", i.RxDropped + i.TxDropped, drops},
+		} {
+			level := value.threshold.Level(value.value)
+			levels = append(levels, level)
+			if level != "ok" {
+				exceeded = append(exceeded, fmt.Sprintf("%s %s %.2f/s exceeds %s", i.Name, value.name, value.value, level))
+			}
+		}
+
+		perfs = append(perfs, fmt.Sprintf("%s_rx_bytes=%.0fB %s_tx_bytes=%.0fB %s_errors=%.2f;%s %s_drops=%.2f;%s",
+			i.Name, i.RxBytes, i.Name, i.TxBytes,
+			i.Name, i.RxErrors+i.TxErrors, errors.Perf(),
+			i.Name, i.RxDropped+i.TxDropped, drops.Perf()))
+	}
+
+	output := strings.Join(outputs, ", ")
+	if len(exceeded) > 0 {
+		output = strings.Join(exceeded, ", ") + " (" + output + ")"
+	}
+
+	return check.WorstLevel(levels...), output + " | " + strings.Join(perfs, " ")
+}
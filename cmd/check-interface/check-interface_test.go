@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func TestEvaluate(t *testing.T) {
+	eth0 := common.NetIO{Name: "eth0", AdminUp: true, OperState: "up", RxBytes: 2048, TxBytes: 1024, RxErrors: 1.5, TxErrors: 0.5, RxDropped: 4, TxDropped: 1}
+	eth1 := common.NetIO{Name: "eth1", AdminUp: true, LinkDown: true, OperState: "down"}
+	ifb0 := common.NetIO{Name: "ifb0", OperState: "down"}
+
+	tests := []struct {
+		name           string
+		interfaces     []common.NetIO
+		errors         check.Threshold
+		drops          check.Threshold
+		expectedLevel  string
+		expectContains []string
+	}{
+		{
+			name:          "healthy and admin down",
+			interfaces:    []common.NetIO{eth0, ifb0},
+			expectedLevel: "ok",
+			expectContains: []string{
+				"eth0 up, ifb0 admin down |",
+				"eth0_rx_bytes=2048B eth0_tx_bytes=1024B eth0_errors=2.00;; eth0_drops=5.00;;",
+			},
+		},
+		{
+			name:           "link down",
+			interfaces:     []common.NetIO{eth0, eth1},
+			expectedLevel:  "critical",
+			expectContains: []string{"eth1 link down (eth0 up, eth1 down)"},
+		},
+		{
+			name:           "error warning",
+			interfaces:     []common.NetIO{eth0},
+			errors:         check.Threshold{Warning: 1, Critical: 10},
+			expectedLevel:  "warning",
+			expectContains: []string{"eth0 errors 2.00/s exceeds warning", "eth0_errors=2.00;1;10"},
+		},
+		{
+			name:           "drop critical",
+			interfaces:     []common.NetIO{eth0},
+			drops:          check.Threshold{Warning: 1, Critical: 5},
+			expectedLevel:  "critical",
+			expectContains: []string{"eth0 drops 5.00/s exceeds critical", "eth0_drops=5.00;1;5"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, message := evaluate(tt.interfaces, tt.errors, tt.drops)
+			assert.Equal(t, tt.expectedLevel, level)
+			for _, s := range tt.expectContains {
+				assert.Contains(t, message, s)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// loadAvg holds the contents of /proc/loadavg.
+type loadAvg struct {
+	Load    [3]float64
+	Running int
+	Total   int
+}
+
+func main() {
+	var (
+		warn   string
+		crit   string
+		perCPU bool
+	)
+
+	c := check.New("CheckLoad")
+	c.Option.StringVarP(&warn, "warn", "w", "10,8,6", "Warning thresholds for the 1, 5 and 15 minute load (comma separated)")
+	c.Option.StringVarP(&crit, "crit", "c", "20,15,10", "Critical thresholds for the 1, 5 and 15 minute load (comma separated)")
+	c.Option.BoolVarP(&perCPU, "per-cpu", "p", false, "Divide the load by the number of online CPUs before comparing")
+	c.Init()
+
+	warnings, err := parseTriple(warn)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid --warn: %w", err))
+		return
+	}
+	criticals, err := parseTriple(crit)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid --crit: %w", err))
+		return
+	}
+
+	load, err := parseLoadavg("/proc/loadavg")
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	cpus := 1
+	if perCPU {
+		cpus = onlineCPUs("/sys/devices/system/cpu/online")
+	}
+
+	level, message := evaluate(load, cpus, warnings, criticals)
+	c.Report(level, message)
+}
+
+// evaluate divides the load averages by cpus and compares each against its
+// warning and critical threshold. The worst of the three levels wins.
+func evaluate(load loadAvg, cpus int, warnings, criticals [3]float64) (string, string) {
+	if cpus < 1 {
+		cpus = 1
+	}
+
+	names := [3]string{"load1", "load5", "load15"}
+	values := []string{}
+	perfs := []string{}
+	levels := []string{}
+	exceeded := []string{}
+
+	for i := range load.Load {
+		value := load.Load[i] / float64(cpus)
+		level := check.Threshold{Warning: warnings[i], Critical: criticals[i]}.Level(value)
+		levels = append(levels, level)
+		switch level {
+		case "critical":
+			exceeded = append(exceeded, fmt.Sprintf("%s %.2f >= %g", names[i], value, criticals[i]))
+		case "warning":
+			exceeded = append(exceeded, fmt.Sprintf("%s %.2f >= %g", names[i], value, warnings[i]))
+		}
+		values = append(values, fmt.Sprintf("%.2f", value))
+		perfs = append(perfs, fmt.Sprintf("%s=%.2f;%g;%g;0", names[i], value, warnings[i], criticals[i]))
+	}
+	perfs = append(perfs, fmt.Sprintf("procs_running=%d;;;0;%d procs_total=%d;;;0", load.Running, load.Total, load.Total))
+
+	output := fmt.Sprintf("load average: %s", strings.Join(values, ", "))
+	if cpus > 1 {
+		output += fmt.Sprintf(" (per CPU, %d CPUs)", cpus)
+	}
+	output += fmt.Sprintf(", tasks: %d running, %d total", load.Running, load.Total)
+	if len(exceeded) > 0 {
+		output += " (" + strings.Join(exceeded, ", ") + ")"
+	}
+
+	return check.WorstLevel(levels...), output + " | " + strings.Join(perfs, " ")
+}
+
+// parseTriple parses a "1,5,15" threshold string. A single value applies to
+// all three averages.
+func parseTriple(value string) ([3]float64, error) {
+	var result [3]float64
+
+	parts := strings.Split(value, ",")
+	if len(parts) != 1 && len(parts) != 3 {
+		return result, fmt.Errorf("expected one or three comma separated values, got %q", value)
+	}
+
+	for i := range result {
+		part := parts[0]
+		if len(parts) == 3 {
+			part = parts[i]
+		}
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return result, err
+		}
+		if v < 0 {
+			return result, fmt.Errorf("threshold must not be negative, got %g", v)
+		}
+		result[i] = v
+	}
+
+	return result, nil
+}
+
+// parseLoadavg reads a loadavg formatted file:
+//
+//	0.20 0.18 0.12 1/80 11206
+func parseLoadavg(filepath string) (loadAvg, error) {
+	var load loadAvg
+
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return load, err
+	}
+
+	fields := strings.Fields(string(contents))
+	if len(fields) < 4 {
+		return load, fmt.Errorf("unexpected format of %s: %q", filepath, strings.TrimSpace(string(contents)))
+	}
+
+	for i := range load.Load {
+		load.Load[i], err = strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return load, err
+		}
+	}
+
+	running, total, found := strings.Cut(fields[3], "/")
+	if !found {
+		return load, fmt.Errorf("unexpected task counts in %s: %q", filepath, fields[3])
+	}
+	load.Running, err = strconv.Atoi(running)
+	if err != nil {
+		return load, err
+	}
+	load.Total, err = strconv.Atoi(total)
+	if err != nil {
+		return load, err
+	}
+
+	return load, nil
+}
+
+// onlineCPUs counts the CPUs listed in a cpu list file such as
+// /sys/devices/system/cpu/online ("0-3,6,8-11"). It falls back to the number
+// of CPUs usable by this process if the file cannot be read or parsed.
+func onlineCPUs(filepath string) int {
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return runtime.NumCPU()
+	}
+
+	count, err := parseCPUList(strings.TrimSpace(string(contents)))
+	if err != nil || count == 0 {
+		return runtime.NumCPU()
+	}
+	return count
+}
+
+// parseCPUList counts the CPUs of a kernel cpu list ("0-3,6,8-11").
+func parseCPUList(list string) (int, error) {
+	count := 0
+	for _, part := range strings.Split(list, ",") {
+		if len(part) == 0 {
+			continue
+		}
+		first, last, isRange := strings.Cut(part, "-")
+		if !isRange {
+			if _, err := strconv.Atoi(first); err != nil {
+				return 0, err
+			}
+			count++
+			continue
+		}
+		from, err := strconv.Atoi(first)
+		if err != nil {
+			return 0, err
+		}
+		to, err := strconv.Atoi(last)
+		if err != nil {
+			return 0, err
+		}
+		if to < from {
+			return 0, fmt.Errorf("invalid cpu range %q", part)
+		}
+		count += to - from + 1
+	}
+	return count, nil
+}
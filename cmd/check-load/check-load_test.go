@@ -0,0 +1,142 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFixture(t *testing.T, content string) string {
+	tmpfile, err := os.CreateTemp("", "check-load-*.txt")
+	assert.NoError(t, err)
+	t.Cleanup(func() { os.Remove(tmpfile.Name()) })
+	_, err = tmpfile.WriteString(content)
+	assert.NoError(t, err)
+	tmpfile.Close()
+	return tmpfile.Name()
+}
+
+func TestParseLoadavg(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expected      loadAvg
+		expectedError bool
+	}{
+		{
+			name:     "Standard loadavg",
+			content:  "0.20 0.18 0.12 1/80 11206\n",
+			expected: loadAvg{Load: [3]float64{0.20, 0.18, 0.12}, Running: 1, Total: 80},
+		},
+		{
+			name:     "Busy host",
+			content:  "32.51 28.04 19.97 35/1532 998877\n",
+			expected: loadAvg{Load: [3]float64{32.51, 28.04, 19.97}, Running: 35, Total: 1532},
+		},
+		{
+			name:          "Empty file",
+			content:       "",
+			expectedError: true,
+		},
+		{
+			name:          "Invalid load",
+			content:       "abc 0.18 0.12 1/80 11206\n",
+			expectedError: true,
+		},
+		{
+			name:          "Missing task separator",
+			content:       "0.20 0.18 0.12 80 11206\n",
+			expectedError: true,
+		},
+		{
+			name:          "Invalid task count",
+			content:       "0.20 0.18 0.12 1/x 11206\n",
+			expectedError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			load, err := parseLoadavg(writeFixture(t, tt.content))
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, load)
+		})
+	}
+}
+
+func TestParseLoadavgMissingFile(t *testing.T) {
+	_, err := parseLoadavg("/non/existent/file")
+	assert.Error(t, err)
+}
+
+func TestParseTriple(t *testing.T) {
+	triple, err := parseTriple("10,8,6")
+	assert.NoError(t, err)
+	assert.Equal(t, [3]float64{10, 8, 6}, triple)
+
+	triple, err = parseTriple(" 1.5 ")
+	assert.NoError(t, err)
+	assert.Equal(t, [3]float64{1.5, 1.5, 1.5}, triple)
+
+	for _, invalid := range []string{"", "1,2", "1,2,3,4", "a,b,c", "1,-2,3"} {
+		_, err = parseTriple(invalid)
+		assert.Error(t, err, "value %q", invalid)
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	cases := map[string]int{"0": 1, "0-3": 4, "0-3,6,8-11": 9, "": 0}
+	for list, expected := range cases {
+		count, err := parseCPUList(list)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, count, "list %q", list)
+	}
+
+	for _, invalid := range []string{"a", "0-b", "3-1"} {
+		_, err := parseCPUList(invalid)
+		assert.Error(t, err, "list %q", invalid)
+	}
+}
+
+func TestOnlineCPUs(t *testing.T) {
+	assert.Equal(t, 6, onlineCPUs(writeFixture(t, "0-3,6-7\n")))
+	assert.Equal(t, runtime.NumCPU(), onlineCPUs(writeFixture(t, "garbage\n")))
+	assert.Equal(t, runtime.NumCPU(), onlineCPUs("/non/existent/file"))
+}
+
+func TestEvaluate(t *testing.T) {
+	warnings := [3]float64{4, 3, 2}
+	criticals := [3]float64{8, 6, 4}
+
+	tests := []struct {
+		name           string
+		load           [3]float64
+		cpus           int
+		expectedLevel  string
+		expectContains []string
+	}{
+		{"ok", [3]float64{1, 1, 1}, 1, "ok", []string{"load average: 1.00, 1.00, 1.00", "load1=1.00;4;8;0"}},
+		{"warning on 15 minute load", [3]float64{1, 1, 2.5}, 1, "warning", []string{"load15 2.50 >= 2"}},
+		{"critical on 1 minute load", [3]float64{9, 5, 3}, 1, "critical", []string{"load1 9.00 >= 8", "load5 5.00 >= 3", "load15 3.00 >= 2"}},
+		{"normalised per cpu", [3]float64{9, 5, 3}, 4, "ok", []string{"load average: 2.25, 1.25, 0.75 (per CPU, 4 CPUs)", "load1=2.25;4;8;0"}},
+		{"zero cpus treated as one", [3]float64{9, 5, 3}, 0, "critical", []string{"load average: 9.00"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, message := evaluate(loadAvg{Load: tt.load, Running: 3, Total: 412}, tt.cpus, warnings, criticals)
+			assert.Equal(t, tt.expectedLevel, level)
+			assert.Contains(t, message, "tasks: 3 running, 412 total")
+			assert.Contains(t, message, "procs_running=3;;;0;412 procs_total=412;;;0")
+			for _, s := range tt.expectContains {
+				assert.Contains(t, message, s)
+			}
+		})
+	}
+}
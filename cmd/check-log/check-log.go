@@ -0,0 +1,300 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/state"
+)
+
+// maxLineLength caps the length of a matched entry in the output.
+const maxLineLength = 200
+
+// maxEntryLength caps the size of an entry, so a multiline entry that never
+// ends (or a continuation expression that never matches) does not grow
+// without bound. Continuation lines beyond it are counted but not matched.
+const maxEntryLength = 64 * 1024
+
+// options holds the expressions applied to every entry. Nil expressions are
+// disabled.
+type options struct {
+	warn      *regexp.Regexp
+	crit      *regexp.Regexp
+	exclude   *regexp.Regexp
+	multiline *regexp.Regexp
+	maxLines  int
+}
+
+// position is the state kept between runs: the inode of the log file and the
+// offset up to which it was read.
+type position struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// result holds the number of entries matched in the new part of the log and
+// the first maxLines of each kind for the output.
+type result struct {
+	Lines         int
+	CriticalCount int
+	WarningCount  int
+	Critical      []string
+	Warning       []string
+	Rotated       bool
+	Truncated     bool
+}
+
+func main() {
+	var (
+		file      string
+		warn      string
+		crit      string
+		exclude   string
+		multiline string
+		stateFile string
+		readAll   bool
+		opts      options
+	)
+
+	c := check.New("CheckLog")
+	c.Option.StringVarP(&file, "file", "f", "", "Log file to scan")
+	c.Option.StringVarP(&warn, "warn", "w", "", "Warning for entries matching this regular expression")
+	c.Option.StringVarP(&crit, "crit", "c", "", "Critical for entries matching this regular expression")
+	c.Option.StringVarP(&exclude, "exclude", "x", "", "Ignore entries matching this regular expression")
+	c.Option.StringVarP(&multiline, "multiline", "m", "", "Lines matching this regular expression start a new entry; other lines continue the previous one")
+	c.Option.IntVarP(&opts.maxLines, "max-lines", "n", 5, "Maximum number of matched entries in the output")
+	c.Option.StringVar(&stateFile, "state-file", "", "File keeping the read position between runs (default: derived from the file and expressions in the temp directory)")
+	c.Option.BoolVar(&readAll, "read-all", false, "Scan the whole file on the first run instead of starting at its end")
+	c.Init()
+
+	if len(file) == 0 {
+		c.Error(fmt.Errorf("--file is required"))
+		return
+	}
+	if len(warn) == 0 && len(crit) == 0 {
+		c.Error(fmt.Errorf("at least one of --warn or --crit is required"))
+		return
+	}
+
+	var err error
+	for _, expression := range []struct {
+		value  string
+		target **regexp.Regexp
+	}{
+		{warn, &opts.warn},
+		{crit, &opts.crit},
+		{exclude, &opts.exclude},
+		{multiline, &opts.multiline},
+	} {
+		if len(expression.value) == 0 {
+			continue
+		}
+		if *expression.target, err = regexp.Compile(expression.value); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if len(stateFile) == 0 {
+		stateFile = state.DefaultFile("check-log-"+filepath.Base(file), file, warn, crit, exclude, multiline)
+	}
+
+	var previous *position
+	var saved position
+	if _, err := os.Stat(stateFile); err == nil {
+		if err := state.Load(stateFile, &saved); err != nil {
+			c.Error(fmt.Errorf("invalid state file %s: %w", stateFile, err))
+			return
+		}
+		previous = &saved
+	}
+
+	res, next, err := scanFile(file, previous, readAll, opts)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := state.Save(stateFile, next); err != nil {
+		c.Error(err)
+		return
+	}
+
+	level, message := evaluate(file, res, opts.maxLines)
+	c.Report(level, message)
+}
+
+// startOffset decides where to continue reading. A different inode means the
+// log was rotated and a smaller size that it was truncated; both restart at
+// the beginning. Lines appended to the old file after the previous run are not
+// read. Without a previous position the file is read from the start
+// with readAll, else from its end.
+func startOffset(previous *position, current position, readAll bool) (int64, bool, bool) {
+	switch {
+	case previous == nil && readAll:
+		return 0, false, false
+	case previous == nil:
+		return current.Offset, false, false
+	case previous.Inode != current.Inode:
+		return 0, true, false
+	case current.Offset < previous.Offset:
+		return 0, false, true
+	default:
+		return previous.Offset, false, false
+	}
+}
+
+// scanFile reads the log from the position of the previous run and returns
+// the matches and the position to continue from next time.
+func scanFile(file string, previous *position, readAll bool, opts options) (result, position, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return result{}, position{}, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return result{}, position{}, err
+	}
+
+	current := position{Inode: inode(info), Offset: info.Size()}
+	offset, rotated, truncated := startOffset(previous, current, readAll)
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return result{}, position{}, err
+	}
+
+	res, consumed, err := scan(f, opts)
+	if err != nil {
+		return result{}, position{}, err
+	}
+	res.Rotated, res.Truncated = rotated, truncated
+
+	return res, position{Inode: current.Inode, Offset: offset + consumed}, nil
+}
+
+// scan evaluates the complete lines of r and returns the matches and the
+// number of bytes consumed. A trailing line without newline is left for the
+// next run, as it may still be written. With a multiline expression, lines
+// that do not start a new entry are joined to the previous one, up to
+// maxEntryLength. The entry at the end of r is matched as it is, so an entry
+// that is still being written is split across runs.
+func scan(r io.Reader, opts options) (result, int64, error) {
+	var res result
+	var consumed int64
+	entry := []string{}
+	size := 0
+
+	flush := func() {
+		if len(entry) == 0 {
+			return
+		}
+		match(strings.Join(entry, "\n"), opts, &res)
+		entry = entry[:0]
+		size = 0
+	}
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, consumed, err
+		}
+		consumed += int64(len(line))
+		res.Lines++
+
+		text := string(bytes.TrimRight(line, "\r\n"))
+		if opts.multiline == nil || opts.multiline.MatchString(text) {
+			flush()
+		}
+		if size >= maxEntryLength {
+			continue
+		}
+		if len(text) > maxEntryLength-size {
+			text = strings.ToValidUTF8(text[:maxEntryLength-size], "")
+		}
+		entry = append(entry, text)
+		size += len(text) + 1
+	}
+	flush()
+
+	return res, consumed, nil
+}
+
+// match counts an entry as critical or warning unless it is excluded, and
+// keeps it for the output while fewer than maxLines of its kind are kept.
+func match(entry string, opts options, res *result) {
+	if opts.exclude != nil && opts.exclude.MatchString(entry) {
+		return
+	}
+	switch {
+	case opts.crit != nil && opts.crit.MatchString(entry):
+		res.CriticalCount++
+		if len(res.Critical) < opts.maxLines {
+			res.Critical = append(res.Critical, shorten(entry))
+		}
+	case opts.warn != nil && opts.warn.MatchString(entry):
+		res.WarningCount++
+		if len(res.Warning) < opts.maxLines {
+			res.Warning = append(res.Warning, shorten(entry))
+		}
+	}
+}
+
+// evaluate reports the matches, critical entries first, showing at most
+// maxLines of them.
+func evaluate(file string, res result, maxLines int) (string, string) {
+	level := "ok"
+	switch {
+	case res.CriticalCount > 0:
+		level = "critical"
+	case res.WarningCount > 0:
+		level = "warning"
+	}
+
+	output := fmt.Sprintf("%s: %d critical, %d warning match(es) in %d new line(s)", file, res.CriticalCount, res.WarningCount, res.Lines)
+	switch {
+	case res.Rotated:
+		output += " (rotated)"
+	case res.Truncated:
+		output += " (truncated)"
+	}
+
+	shown := append(append([]string{}, res.Critical...), res.Warning...)
+	if maxLines < 0 {
+		maxLines = 0
+	}
+	if len(shown) > maxLines {
+		shown = shown[:maxLines]
+	}
+	if len(shown) > 0 {
+		output += ": " + strings.Join(shown, "; ")
+	}
+	if hidden := res.CriticalCount + res.WarningCount - len(shown); hidden > 0 {
+		output += fmt.Sprintf(" (%d more)", hidden)
+	}
+
+	perf := fmt.Sprintf("critical=%d warning=%d lines=%d", res.CriticalCount, res.WarningCount, res.Lines)
+	return level, fmt.Sprintf("%s | %s", output, perf)
+}
+
+// shorten puts a multiline entry on one line and caps its length, as the
+// Sensu output is a single line. "|" is replaced as it starts the perfdata.
+func shorten(entry string) string {
+	entry = strings.NewReplacer("\n", " ", "|", "/").Replace(entry)
+	if len(entry) > maxLineLength {
+		entry = strings.ToValidUTF8(entry[:maxLineLength], "") + "..."
+	}
+	return entry
+}
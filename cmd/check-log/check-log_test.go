@@ -0,0 +1,195 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOptions() options {
+	return options{
+		warn:     regexp.MustCompile(`WARN`),
+		crit:     regexp.MustCompile(`ERROR|FATAL`),
+		maxLines: 5,
+	}
+}
+
+func appendLog(t *testing.T, file string, content string) {
+	f, err := os.OpenFile(file, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestStartOffset(t *testing.T) {
+	current := position{Inode: 10, Offset: 500}
+
+	offset, rotated, truncated := startOffset(nil, current, false)
+	assert.Equal(t, []interface{}{int64(500), false, false}, []interface{}{offset, rotated, truncated})
+
+	offset, _, _ = startOffset(nil, current, true)
+	assert.Equal(t, int64(0), offset)
+
+	offset, rotated, truncated = startOffset(&position{Inode: 10, Offset: 200}, current, false)
+	assert.Equal(t, []interface{}{int64(200), false, false}, []interface{}{offset, rotated, truncated})
+
+	offset, rotated, truncated = startOffset(&position{Inode: 9, Offset: 200}, current, false)
+	assert.Equal(t, []interface{}{int64(0), true, false}, []interface{}{offset, rotated, truncated})
+
+	offset, rotated, truncated = startOffset(&position{Inode: 10, Offset: 900}, current, false)
+	assert.Equal(t, []interface{}{int64(0), false, true}, []interface{}{offset, rotated, truncated})
+}
+
+func TestScan(t *testing.T) {
+	opts := testOptions()
+	opts.exclude = regexp.MustCompile(`ERROR: expected`)
+
+	log := "INFO start\nWARN slow\nERROR: expected failure\nERROR broken\npartial ERROR"
+	res, consumed, err := scan(strings.NewReader(log), opts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(len(log)-len("partial ERROR")), consumed)
+	assert.Equal(t, 4, res.Lines)
+	assert.Equal(t, []string{"ERROR broken"}, res.Critical)
+	assert.Equal(t, []string{"WARN slow"}, res.Warning)
+}
+
+func TestScanMultiline(t *testing.T) {
+	opts := testOptions()
+	opts.multiline = regexp.MustCompile(`^\d{4}-\d{2}-\d{2} `)
+	opts.exclude = regexp.MustCompile(`RetryableException`)
+
+	log := strings.Join([]string{
+		"2026-06-01 12:00:00 INFO request failed",
+		"java.lang.IllegalStateException: ERROR in handler",
+		"  at Handler.run",
+		"2026-06-01 12:00:01 INFO retry",
+		"io.RetryableException: ERROR temporary",
+		"2026-06-01 12:00:02 WARN slow\r",
+		"",
+	}, "\n")
+	res, _, err := scan(strings.NewReader(log), opts)
+	require.NoError(t, err)
+	assert.Equal(t, 6, res.Lines)
+	assert.Equal(t, []string{"2026-06-01 12:00:00 INFO request failed java.lang.IllegalStateException: ERROR in handler   at Handler.run"}, res.Critical)
+	assert.Equal(t, []string{"2026-06-01 12:00:02 WARN slow"}, res.Warning)
+}
+
+func TestScanLimits(t *testing.T) {
+	opts := testOptions()
+	opts.maxLines = 2
+
+	log := "ERROR 1\nWARN 1\nERROR 2\nERROR 3\nWARN 2\nWARN 3\nWARN 4\n"
+	res, _, err := scan(strings.NewReader(log), opts)
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.CriticalCount)
+	assert.Equal(t, 4, res.WarningCount)
+	assert.Equal(t, []string{"ERROR 1", "ERROR 2"}, res.Critical)
+	assert.Equal(t, []string{"WARN 1", "WARN 2"}, res.Warning)
+
+	// an entry that never ends is capped, its later lines are not matched
+	opts.multiline = regexp.MustCompile(`^START`)
+	continuation := strings.Repeat(strings.Repeat("x", 1023)+"\n", maxEntryLength/1024+1)
+	log = "START\n" + continuation + "ERROR beyond the cap\nSTART\nERROR\n"
+	res, _, err = scan(strings.NewReader(log), opts)
+	require.NoError(t, err)
+	assert.Equal(t, 1, res.CriticalCount)
+	assert.Equal(t, []string{"START ERROR"}, res.Critical)
+}
+
+func TestScanFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.log")
+	appendLog(t, file, "ERROR before the first run\n")
+
+	// the first run starts at the end
+	res, pos, err := scanFile(file, nil, false, testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Lines)
+	assert.Equal(t, int64(27), pos.Offset)
+
+	res, _, err = scanFile(file, nil, true, testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ERROR before the first run"}, res.Critical)
+
+	// only new lines are read
+	appendLog(t, file, "WARN new\nINFO fine\n")
+	res, pos, err = scanFile(file, &pos, false, testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Lines)
+	assert.Equal(t, []string{"WARN new"}, res.Warning)
+	assert.Empty(t, res.Critical)
+
+	res, pos, err = scanFile(file, &pos, false, testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Lines)
+
+	// a partial line is read once it is complete
+	appendLog(t, file, "ERROR half")
+	res, pos, err = scanFile(file, &pos, false, testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Lines)
+	appendLog(t, file, " written\n")
+	res, pos, err = scanFile(file, &pos, false, testOptions())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ERROR half written"}, res.Critical)
+
+	// truncation
+	require.NoError(t, os.WriteFile(file, []byte("FATAL restart\n"), 0o644))
+	res, pos, err = scanFile(file, &pos, false, testOptions())
+	require.NoError(t, err)
+	assert.True(t, res.Truncated)
+	assert.Equal(t, []string{"FATAL restart"}, res.Critical)
+
+	// rotation: the old file is moved away and a new one is created
+	require.NoError(t, os.Rename(file, file+".1"))
+	appendLog(t, file, "WARN rotated log with more content than before\n")
+	res, _, err = scanFile(file, &pos, false, testOptions())
+	require.NoError(t, err)
+	if pos.Inode != 0 {
+		assert.True(t, res.Rotated)
+	}
+	assert.Equal(t, []string{"WARN rotated log with more content than before"}, res.Warning)
+
+	_, _, err = scanFile(filepath.Join(dir, "missing.log"), nil, false, testOptions())
+	assert.Error(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	level, message := evaluate("/var/log/app.log", result{Lines: 12}, 5)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "/var/log/app.log: 0 critical, 0 warning match(es) in 12 new line(s) | critical=0 warning=0 lines=12", message)
+
+	level, message = evaluate("/var/log/app.log", result{Lines: 3, WarningCount: 1, Warning: []string{"WARN a/b"}, Rotated: true}, 5)
+	assert.Equal(t, "warning", level)
+	assert.Equal(t, "/var/log/app.log: 0 critical, 1 warning match(es) in 3 new line(s) (rotated): WARN a/b | critical=0 warning=1 lines=3", message)
+
+	// only the first entries are kept, the counts cover all matches
+	res := result{
+		Lines:         9,
+		CriticalCount: 4,
+		WarningCount:  2,
+		Critical:      []string{"ERROR 1", "ERROR 2   at line"},
+		Warning:       []string{"WARN 1", "WARN 2"},
+	}
+	level, message = evaluate("app.log", res, 2)
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "app.log: 4 critical, 2 warning match(es) in 9 new line(s): ERROR 1; ERROR 2   at line (4 more) | critical=4 warning=2 lines=9", message)
+
+	_, message = evaluate("app.log", res, 5)
+	assert.Contains(t, message, "ERROR 1; ERROR 2   at line; WARN 1; WARN 2 (2 more) |")
+
+	_, message = evaluate("app.log", result{Lines: 1, CriticalCount: 1, Critical: []string{"ERROR"}, Truncated: true}, 0)
+	assert.Equal(t, "app.log: 1 critical, 0 warning match(es) in 1 new line(s) (truncated) (1 more) | critical=1 warning=0 lines=1", message)
+}
+
+func TestShorten(t *testing.T) {
+	assert.Equal(t, "ERROR 2   at line", shorten("ERROR 2\n  at line"))
+	assert.Equal(t, "WARN a/b", shorten("WARN a|b"))
+	assert.Equal(t, strings.Repeat("x", 200)+"...", shorten(strings.Repeat("x", 300)))
+}
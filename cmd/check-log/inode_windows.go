@@ -0,0 +1,11 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// inode is not available on Windows; rotation is then only detected when the
+// file shrinks.
+func inode(info os.FileInfo) uint64 {
+	return 0
+}
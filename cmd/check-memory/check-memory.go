@@ -5,78 +5,244 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
+// options holds the thresholds beyond the memory usage check. Thresholds of
+// zero are disabled.
+type options struct {
+	swap      check.Threshold
+	swapRate  check.Threshold
+	sleep     int
+	psiSome   check.Threshold
+	psiFull   check.Threshold
+	psiWindow string
+}
+
+// meminfo holds the /proc/meminfo values used by the check. Memory and swap
+// are in MB, HugePages in pages of HugepageSize kB.
+type meminfo struct {
+	MemTotal       float64
+	MemAvailable   float64
+	SwapTotal      float64
+	SwapFree       float64
+	HugePagesTotal float64
+	HugePagesFree  float64
+	HugePagesRsvd  float64
+	HugePagesSurp  float64
+	HugepageSize   float64
+}
+
+// swapRate holds the swap-in and swap-out rates in pages per second.
+type swapRate struct {
+	In  float64
+	Out float64
+}
+
 func main() {
 	var (
 		warn int
 		crit int
+		opts options
 	)
 
 	c := check.New("CheckMemory")
 	c.Option.IntVarP(&warn, "warn", "w", 80, "Warning (>=) threshold level")
 	c.Option.IntVarP(&crit, "crit", "c", 90, "Critical (>=) threshold level")
+	c.Option.Float64Var(&opts.swap.Warning, "swap-warn", 0, "Warning threshold for swap usage % (0 disables)")
+	c.Option.Float64Var(&opts.swap.Critical, "swap-crit", 0, "Critical threshold for swap usage % (0 disables)")
+	c.Option.Float64Var(&opts.swapRate.Warning, "swap-rate-warn", 0, "Warning threshold for swap-in + swap-out pages per second (0 disables)")
+	c.Option.Float64Var(&opts.swapRate.Critical, "swap-rate-crit", 0, "Critical threshold for swap-in + swap-out pages per second (0 disables)")
+	c.Option.IntVarP(&opts.sleep, "sleep", "s", 1, "Sleep time for sampling the swap rate from /proc/vmstat")
+	c.Option.Float64Var(&opts.psiSome.Warning, "psi-some-warn", 0, "Warning threshold for memory pressure (some) % from /proc/pressure/memory (0 disables)")
+	c.Option.Float64Var(&opts.psiSome.Critical, "psi-some-crit", 0, "Critical threshold for memory pressure (some) % from /proc/pressure/memory (0 disables)")
+	c.Option.Float64Var(&opts.psiFull.Warning, "psi-full-warn", 0, "Warning threshold for memory pressure (full) % from /proc/pressure/memory (0 disables)")
+	c.Option.Float64Var(&opts.psiFull.Critical, "psi-full-crit", 0, "Critical threshold for memory pressure (full) % from /proc/pressure/memory (0 disables)")
+	c.Option.StringVar(&opts.psiWindow, "psi-window", "avg10", "Pressure average the PSI thresholds apply to (avg10|avg60)")
 	c.Init()
 
-	memTotal, memAvailable, err := memoryUsage()
+	if opts.psiWindow != "avg10" && opts.psiWindow != "avg60" {
+		c.Error(fmt.Errorf("invalid --psi-window %q (expected avg10 or avg60)", opts.psiWindow))
+		return
+	}
+
+	info, err := readMeminfo("/proc/meminfo")
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	level, message := evaluate(memTotal, memAvailable, warn, crit)
-	report(c, level, message)
-}
+	var rate *swapRate
+	if opts.swapRate.Enabled() {
+		sampled, err := sampleSwapRate("/proc/vmstat", opts.sleep)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		rate = &sampled
+	}
 
-// report maps a level (ok|warning|critical) to the matching check result.
-func report(c *check.CheckStruct, level string, message string) {
-	switch level {
-	case "critical":
-		c.Critical(message)
-	case "warning":
-		c.Warning(message)
-	default:
-		c.Ok(message)
+	var pressure map[string]common.PressureStats
+	if opts.psiSome.Enabled() || opts.psiFull.Enabled() {
+		pressure, err = common.GetPressure("memory")
+		if err != nil {
+			c.Error(err)
+			return
+		}
 	}
+
+	level, message := evaluateAll(info, rate, pressure, warn, crit, opts)
+	c.Report(level, message)
 }
 
 // evaluate computes the memory usage percentage and returns the level
 // (ok|warning|critical) together with the formatted output and perfdata.
 func evaluate(memTotal, memAvailable float64, warn, crit int) (string, string) {
-	usage := 100.0 - (100.0 * memAvailable / memTotal)
+	output, perf := formatMemory(memTotal, memAvailable, warn, crit)
+	return memoryLevel(memTotal, memAvailable, warn, crit), output + " | " + perf
+}
 
-	message := fmt.Sprintf("%.2f%% MemTotal:%.2fMB MemAvailable:%.2fMB | mem_usage=%.2f%%;%d;%d mem_available=%.2fMB",
-		usage, memTotal, memAvailable, usage, warn, crit, memAvailable)
+// memoryLevel decides the level of the memory usage against the thresholds.
+func memoryLevel(memTotal, memAvailable float64, warn, crit int) string {
+	usage := 100.0 - (100.0 * memAvailable / memTotal)
 
 	switch {
 	case usage >= float64(crit):
-		return "critical", message
+		return "critical"
 	case usage >= float64(warn):
-		return "warning", message
+		return "warning"
 	default:
-		return "ok", message
+		return "ok"
 	}
 }
 
-func memoryUsage() (float64, float64, error) {
-	return parseMeminfo("/proc/meminfo")
+// formatMemory returns the memory usage output and perfdata.
+func formatMemory(memTotal, memAvailable float64, warn, crit int) (string, string) {
+	usage := 100.0 - (100.0 * memAvailable / memTotal)
+
+	output := fmt.Sprintf("%.2f%% MemTotal:%.2fMB MemAvailable:%.2fMB", usage, memTotal, memAvailable)
+	perf := fmt.Sprintf("mem_usage=%.2f%%;%d;%d mem_available=%.2fMB", usage, warn, crit, memAvailable)
+	return output, perf
+}
+
+// evaluateAll extends evaluate with the swap usage, swap rate, HugePages and
+// memory pressure values. rate is nil unless the swap rate is sampled and
+// pressure is nil unless PSI is enabled. The overall level is the worst of all
+// enabled checks.
+func evaluateAll(info meminfo, rate *swapRate, pressure map[string]common.PressureStats, warn, crit int, opts options) (string, string) {
+	output, perf := formatMemory(info.MemTotal, info.MemAvailable, warn, crit)
+	outputs := []string{output}
+	perfs := []string{perf}
+	levels := []string{memoryLevel(info.MemTotal, info.MemAvailable, warn, crit)}
+
+	swapUsed := info.SwapTotal - info.SwapFree
+	swapUsage := 0.0
+	if info.SwapTotal > 0 {
+		swapUsage = 100.0 * swapUsed / info.SwapTotal
+		outputs = append(outputs, fmt.Sprintf("Swap:%.2f%% SwapTotal:%.2fMB SwapFree:%.2fMB", swapUsage, info.SwapTotal, info.SwapFree))
+	} else {
+		outputs = append(outputs, "Swap:none")
+	}
+	if opts.swap.Enabled() {
+		level := opts.swap.Level(swapUsage)
+		levels = append(levels, level)
+		if level != "ok" {
+			outputs = append(outputs, fmt.Sprintf("swap usage %.2f%% exceeds %s", swapUsage, level))
+		}
+	}
+	perfs = append(perfs, fmt.Sprintf("swap_usage=%.2f%%;%s swap_used=%.2fMB swap_free=%.2fMB",
+		swapUsage, opts.swap.Perf(), swapUsed, info.SwapFree))
+
+	if rate != nil {
+		total := rate.In + rate.Out
+		level := opts.swapRate.Level(total)
+		levels = append(levels, level)
+		outputs = append(outputs, fmt.Sprintf("SwapIn:%.2f/s SwapOut:%.2f/s", rate.In, rate.Out))
+		if level != "ok" {
+			outputs = append(outputs, fmt.Sprintf("swap rate %.2f pages/s exceeds %s", total, level))
+		}
+		perfs = append(perfs, fmt.Sprintf("swap_in=%.2f swap_out=%.2f swap_rate=%.2f;%s", rate.In, rate.Out, total, opts.swapRate.Perf()))
+	}
+
+	if info.HugePagesTotal > 0 {
+		used := info.HugePagesTotal - info.HugePagesFree
+		outputs = append(outputs, fmt.Sprintf("HugePages:%.0f/%.0f used (rsvd %.0f, surp %.0f, %.0fkB pages)",
+			used, info.HugePagesTotal, info.HugePagesRsvd, info.HugePagesSurp, info.HugepageSize))
+		perfs = append(perfs, fmt.Sprintf("hugepages_total=%.0f hugepages_used=%.0f hugepages_free=%.0f hugepages_rsvd=%.0f hugepages_surp=%.0f",
+			info.HugePagesTotal, used, info.HugePagesFree, info.HugePagesRsvd, info.HugePagesSurp))
+	}
+
+	if pressure != nil {
+		for _, kind := range []struct {
+			name      string
+			threshold check.Threshold
+		}{
+			{"some", opts.psiSome},
+			{"full", opts.psiFull},
+		} {
+			stats, found := pressure[kind.name]
+			if !found {
+				continue
+			}
+			if kind.threshold.Enabled() {
+				value := stats.Avg10
+				if opts.psiWindow == "avg60" {
+					value = stats.Avg60
+				}
+				level := kind.threshold.Level(value)
+				levels = append(levels, level)
+				if level != "ok" {
+					outputs = append(outputs, fmt.Sprintf("memory pressure %s %s %.2f%% exceeds %s", kind.name, opts.psiWindow, value, level))
+				}
+			}
+			perfs = append(perfs, fmt.Sprintf("memory_pressure_%s_avg10=%.2f%% memory_pressure_%s_avg60=%.2f%%",
+				kind.name, stats.Avg10, kind.name, stats.Avg60))
+		}
+	}
+
+	message := fmt.Sprintf("%s | %s", strings.Join(outputs, " "), strings.Join(perfs, " "))
+	return check.WorstLevel(levels...), message
 }
 
 // parseMeminfo reads a meminfo-formatted file and returns total and available
 // memory in MB. Systems without MemAvailable fall back to Buffers + Cached.
 func parseMeminfo(filepath string) (float64, float64, error) {
+	info, err := readMeminfo(filepath)
+	if err != nil {
+		return 0.0, 0.0, err
+	}
+	return info.MemTotal, info.MemAvailable, nil
+}
+
+// readMeminfo reads a meminfo-formatted file. Systems without MemAvailable
+// fall back to Buffers + Cached.
+func readMeminfo(filepath string) (meminfo, error) {
 	var (
-		memTotal     float64
-		memAvailable float64
-		memBuffers   float64
-		memCached    float64
+		info       meminfo
+		memBuffers float64
+		memCached  float64
 	)
 
 	contents, err := os.ReadFile(filepath)
 	if err != nil {
-		return 0.0, 0.0, err
+		return meminfo{}, err
+	}
+
+	fields := map[string]*float64{
+		"MemTotal:":        &info.MemTotal,
+		"MemAvailable:":    &info.MemAvailable,
+		"Buffers:":         &memBuffers,
+		"Cached:":          &memCached,
+		"SwapTotal:":       &info.SwapTotal,
+		"SwapFree:":        &info.SwapFree,
+		"HugePages_Total:": &info.HugePagesTotal,
+		"HugePages_Free:":  &info.HugePagesFree,
+		"HugePages_Rsvd:":  &info.HugePagesRsvd,
+		"HugePages_Surp:":  &info.HugePagesSurp,
+		"Hugepagesize:":    &info.HugepageSize,
 	}
 
 	for _, line := range strings.Split(string(contents), "\n") {
@@ -85,29 +251,90 @@ func parseMeminfo(filepath string) (float64, float64, error) {
 			continue
 		}
 
-		switch stats[0] {
-		case "MemTotal:":
-			memTotal, err = strconv.ParseFloat(stats[1], 64)
-		case "MemAvailable:":
-			memAvailable, err = strconv.ParseFloat(stats[1], 64)
-		case "Buffers:":
-			memBuffers, err = strconv.ParseFloat(stats[1], 64)
-		case "Cached:":
-			memCached, err = strconv.ParseFloat(stats[1], 64)
+		target, found := fields[stats[0]]
+		if !found {
+			continue
 		}
+		*target, err = strconv.ParseFloat(stats[1], 64)
 		if err != nil {
-			return 0.0, 0.0, err
+			return meminfo{}, err
 		}
+	}
+
+	// Deal with systems that don't provide MemAvailable
+	if info.MemAvailable == 0 && (memBuffers != 0 || memCached != 0) {
+		info.MemAvailable = memBuffers + memCached
+	}
 
-		if memTotal > 0.0 && memAvailable > 0.0 {
-			break
+	info.MemTotal /= 1024.0
+	info.MemAvailable /= 1024.0
+	info.SwapTotal /= 1024.0
+	info.SwapFree /= 1024.0
+
+	return info, nil
+}
+
+// parseVmstat reads a vmstat-formatted file ("name value" per line).
+func parseVmstat(filepath string) (map[string]float64, error) {
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]float64{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		stats := strings.Fields(line)
+		if len(stats) != 2 {
+			continue
 		}
+		value, err := strconv.ParseFloat(stats[1], 64)
+		if err != nil {
+			return nil, err
+		}
+		result[stats[0]] = value
 	}
 
-	// Deal with systems that don't provide MemAvailable
-	if memAvailable == 0 && (memBuffers != 0 || memCached != 0) {
-		memAvailable = memBuffers + memCached
+	if _, found := result["pswpin"]; !found {
+		return nil, fmt.Errorf("pswpin not found in %s", filepath)
+	}
+	if _, found := result["pswpout"]; !found {
+		return nil, fmt.Errorf("pswpout not found in %s", filepath)
+	}
+
+	return result, nil
+}
+
+// sampleSwapRate samples the swap counters of a vmstat file twice, sleep
+// seconds apart, and returns the rates in pages per second.
+func sampleSwapRate(filepath string, sleep int) (swapRate, error) {
+	if sleep < 1 {
+		sleep = 1
 	}
 
-	return memTotal / 1024.0, memAvailable / 1024.0, nil
+	before, err := parseVmstat(filepath)
+	if err != nil {
+		return swapRate{}, err
+	}
+
+	time.Sleep(time.Duration(sleep) * time.Second)
+
+	after, err := parseVmstat(filepath)
+	if err != nil {
+		return swapRate{}, err
+	}
+
+	return swapRateBetween(before, after, float64(sleep)), nil
+}
+
+// swapRateBetween computes the swap rates between two vmstat samples taken
+// seconds apart. Counter resets yield a rate of zero.
+func swapRateBetween(before, after map[string]float64, seconds float64) swapRate {
+	delta := func(key string) float64 {
+		d := after[key] - before[key]
+		if d < 0 || seconds <= 0 {
+			return 0
+		}
+		return d / seconds
+	}
+	return swapRate{In: delta("pswpin"), Out: delta("pswpout")}
 }
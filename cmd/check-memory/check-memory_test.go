@@ -6,6 +6,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
 func TestParseMeminfo(t *testing.T) {
@@ -107,13 +108,177 @@ func TestEvaluate(t *testing.T) {
 	}
 }
 
-func TestReport(t *testing.T) {
-	cases := map[string]int{"ok": 0, "warning": 1, "critical": 2, "other": 0}
-	for level, expected := range cases {
-		var got int
-		c := check.New("CheckMemory")
-		c.ExitFn = func(code int) { got = code }
-		report(c, level, "msg")
-		assert.Equal(t, expected, got, "level %q", level)
+func TestReadMeminfo(t *testing.T) {
+	tmpfile, err := os.CreateTemp("", "meminfo-*.txt")
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+	_, err = tmpfile.WriteString("MemTotal:        8388608 kB\nMemAvailable:    4194304 kB\n" +
+		"SwapTotal:       2097152 kB\nSwapFree:        1572864 kB\n" +
+		"HugePages_Total:     512\nHugePages_Free:      128\nHugePages_Rsvd:       16\n" +
+		"HugePages_Surp:        0\nHugepagesize:       2048 kB\n")
+	assert.NoError(t, err)
+	tmpfile.Close()
+
+	info, err := readMeminfo(tmpfile.Name())
+	assert.NoError(t, err)
+	assert.Equal(t, meminfo{
+		MemTotal:       8192,
+		MemAvailable:   4096,
+		SwapTotal:      2048,
+		SwapFree:       1536,
+		HugePagesTotal: 512,
+		HugePagesFree:  128,
+		HugePagesRsvd:  16,
+		HugePagesSurp:  0,
+		HugepageSize:   2048,
+	}, info)
+}
+
+func TestParseVmstat(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedIn    float64
+		expectedOut   float64
+		errorContains string
+	}{
+		{
+			name:        "Standard vmstat",
+			content:     "nr_free_pages 12345\npswpin 100\npswpout 250\npgfault 99999\n",
+			expectedIn:  100,
+			expectedOut: 250,
+		},
+		{
+			name:          "Missing swap counters",
+			content:       "nr_free_pages 12345\n",
+			errorContains: "pswpin not found",
+		},
+		{
+			name:          "Invalid value",
+			content:       "pswpin abc\npswpout 1\n",
+			errorContains: "invalid syntax",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpfile, err := os.CreateTemp("", "vmstat-*.txt")
+			assert.NoError(t, err)
+			defer os.Remove(tmpfile.Name())
+			_, err = tmpfile.WriteString(tt.content)
+			assert.NoError(t, err)
+			tmpfile.Close()
+
+			stats, err := parseVmstat(tmpfile.Name())
+			if tt.errorContains != "" {
+				assert.ErrorContains(t, err, tt.errorContains)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedIn, stats["pswpin"])
+			assert.Equal(t, tt.expectedOut, stats["pswpout"])
+		})
+	}
+}
+
+func TestSwapRateBetween(t *testing.T) {
+	before := map[string]float64{"pswpin": 100, "pswpout": 1000}
+
+	rate := swapRateBetween(before, map[string]float64{"pswpin": 120, "pswpout": 1100}, 2)
+	assert.Equal(t, swapRate{In: 10, Out: 50}, rate)
+
+	// counter reset
+	rate = swapRateBetween(before, map[string]float64{"pswpin": 5, "pswpout": 1000}, 2)
+	assert.Equal(t, swapRate{In: 0, Out: 0}, rate)
+}
+
+func TestEvaluateAll(t *testing.T) {
+	info := meminfo{MemTotal: 1000, MemAvailable: 500, SwapTotal: 1000, SwapFree: 400}
+	hugepages := info
+	hugepages.HugePagesTotal, hugepages.HugePagesFree, hugepages.HugePagesRsvd, hugepages.HugepageSize = 512, 128, 16, 2048
+	noSwap := meminfo{MemTotal: 1000, MemAvailable: 500}
+	pressure := map[string]common.PressureStats{
+		"some": {Avg10: 12.5, Avg60: 4.0},
+		"full": {Avg10: 3.0, Avg60: 1.0},
+	}
+
+	tests := []struct {
+		name           string
+		info           meminfo
+		rate           *swapRate
+		pressure       map[string]common.PressureStats
+		opts           options
+		expectedLevel  string
+		expectContains []string
+	}{
+		{
+			name:           "defaults report swap as perfdata only",
+			info:           info,
+			opts:           options{psiWindow: "avg10"},
+			expectedLevel:  "ok",
+			expectContains: []string{"Swap:60.00%", "swap_usage=60.00%;; swap_used=600.00MB swap_free=400.00MB"},
+		},
+		{
+			name:           "swap usage warning",
+			info:           info,
+			opts:           options{swap: check.Threshold{Warning: 50, Critical: 80}},
+			expectedLevel:  "warning",
+			expectContains: []string{"swap usage 60.00% exceeds warning", "swap_usage=60.00%;50;80"},
+		},
+		{
+			name:           "no swap configured",
+			info:           noSwap,
+			opts:           options{swap: check.Threshold{Warning: 50, Critical: 80}},
+			expectedLevel:  "ok",
+			expectContains: []string{"Swap:none", "swap_usage=0.00%;50;80"},
+		},
+		{
+			name:           "swap rate critical",
+			info:           info,
+			rate:           &swapRate{In: 40, Out: 80},
+			opts:           options{swapRate: check.Threshold{Warning: 50, Critical: 100}},
+			expectedLevel:  "critical",
+			expectContains: []string{"SwapIn:40.00/s SwapOut:80.00/s", "swap rate 120.00 pages/s exceeds critical", "swap_rate=120.00;50;100"},
+		},
+		{
+			name:           "hugepages breakdown",
+			info:           hugepages,
+			expectedLevel:  "ok",
+			expectContains: []string{"HugePages:384/512 used (rsvd 16, surp 0, 2048kB pages)", "hugepages_total=512 hugepages_used=384 hugepages_free=128 hugepages_rsvd=16 hugepages_surp=0"},
+		},
+		{
+			name:           "memory pressure some avg10 warning",
+			info:           info,
+			pressure:       pressure,
+			opts:           options{psiSome: check.Threshold{Warning: 10, Critical: 20}, psiWindow: "avg10"},
+			expectedLevel:  "warning",
+			expectContains: []string{"memory pressure some avg10 12.50% exceeds warning", "memory_pressure_some_avg10=12.50% memory_pressure_some_avg60=4.00%", "memory_pressure_full_avg10=3.00%"},
+		},
+		{
+			name:           "memory pressure full avg60 critical",
+			info:           info,
+			pressure:       pressure,
+			opts:           options{psiFull: check.Threshold{Warning: 0.5, Critical: 1}, psiWindow: "avg60"},
+			expectedLevel:  "critical",
+			expectContains: []string{"memory pressure full avg60 1.00% exceeds critical"},
+		},
+		{
+			name:           "memory usage still wins",
+			info:           meminfo{MemTotal: 100, MemAvailable: 5},
+			opts:           options{swap: check.Threshold{Warning: 50, Critical: 80}},
+			expectedLevel:  "critical",
+			expectContains: []string{"95.00% MemTotal:100.00MB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			level, message := evaluateAll(tt.info, tt.rate, tt.pressure, 80, 90, tt.opts)
+			assert.Equal(t, tt.expectedLevel, level)
+			assert.Contains(t, message, "mem_usage=")
+			for _, s := range tt.expectContains {
+				assert.Contains(t, message, s)
+			}
+		})
 	}
 }
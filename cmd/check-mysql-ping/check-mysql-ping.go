@@ -1,20 +1,31 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"regexp"
+	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
-	"github.com/thomis/sensu-plugins-go/pkg/common"
+	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
+	"github.com/thomis/sensu-plugins-go/pkg/mysql"
 )
 
 var versionRe = regexp.MustCompile(`([0-9\.]+)`)
 
 func main() {
-	var connection common.Connection
+	var (
+		connection  mysql.Connection
+		optionsFile string
+		file        string
+		concurrency int
+		deadline    time.Duration
+		timeout     time.Duration
+	)
 
 	c := check.New("CheckMySQLPing")
 	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "MySQL host to connect to")
@@ -22,9 +33,41 @@ func main() {
 	c.Option.StringVarP(&connection.User, "user", "u", os.Getenv("MYSQL_USER"), "MySQL User")
 	c.Option.StringVarP(&connection.Password, "password", "p", os.Getenv("MYSQL_PASSWORD"), "MySQL user password")
 	c.Option.StringVarP(&connection.Database, "database", "d", "mysql", "MySQL database")
+	c.Option.StringVar(&connection.SSLMode, "ssl-mode", "DISABLED", "SSL mode: "+strings.Join(mysql.SSLModes, ", "))
+	c.Option.StringVar(&connection.SSLCA, "ssl-ca", "", "CA certificate file to verify the server certificate")
+	c.Option.StringVar(&connection.SSLCert, "ssl-cert", "", "Client certificate file")
+	c.Option.StringVar(&connection.SSLKey, "ssl-key", "", "Client private key file")
+	c.Option.StringVar(&optionsFile, "defaults-file", "", "Option file with [client] settings (default: ~/.my.cnf if present)")
+	c.Option.StringVarP(&file, "file", "f", "", "File with connections for batch mode. Line format: label,dsn")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of servers checked concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
 	c.Init()
 
-	version, err := selectVersion(connection)
+	// Batch mode: every server in the file must answer with its version.
+	if len(file) > 0 {
+		connections, err := dbquery.ParseConnectionsFile(file)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		opts := dbquery.BatchOptions{Concurrency: concurrency, Timeout: timeout, Deadline: deadline}
+		status, output := dbquery.RunBatch(connections, opts, dbquery.DatabaseRunner("mysql",
+			func(ctx context.Context, db *sql.DB) (string, string, error) {
+				version, err := queryVersion(ctx, db)
+				return "ok", fmt.Sprint("Server version ", version), err
+			}))
+		c.Report(status, output)
+		return
+	}
+
+	if err := mysql.ApplyOptionFile(&connection, optionsFile, c.Option.Changed); err != nil {
+		c.Error(err)
+		return
+	}
+	connection.ConnectTimeout = timeout
+
+	version, err := selectVersion(connection, timeout)
 	if err != nil {
 		c.Error(err)
 		return
@@ -33,30 +76,31 @@ func main() {
 	c.Ok(fmt.Sprint("Server version ", version))
 }
 
-func selectVersion(connection common.Connection) (string, error) {
-	db, err := sql.Open("mysql", buildSource(connection))
+func selectVersion(connection mysql.Connection, timeout time.Duration) (string, error) {
+	source, err := mysql.DataSource(connection)
+	if err != nil {
+		return "", err
+	}
+	db, err := sql.Open("mysql", source)
 	if err != nil {
 		return "", err
 	}
 	defer db.Close()
 
-	return queryVersion(db)
-}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-// buildSource assembles the go-sql-driver DSN from the connection parameters.
-func buildSource(connection common.Connection) string {
-	return fmt.Sprintf("%s:%s@tcp(%s:%d)/%s",
-		connection.User,
-		connection.Password,
-		connection.Host,
-		connection.Port,
-		connection.Database)
+	version, err := queryVersion(ctx, db)
+	if err != nil && ctx.Err() != nil {
+		return "", fmt.Errorf("timeout reached")
+	}
+	return version, err
 }
 
 // queryVersion reads the server version from an open database handle.
-func queryVersion(db *sql.DB) (string, error) {
+func queryVersion(ctx context.Context, db *sql.DB) (string, error) {
 	var info string
-	if err := db.QueryRow("select version()").Scan(&info); err != nil {
+	if err := db.QueryRowContext(ctx, "select version()").Scan(&info); err != nil {
 		return "", err
 	}
 
@@ -1,21 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
-	"github.com/thomis/sensu-plugins-go/pkg/common"
 )
 
-func TestBuildSource(t *testing.T) {
-	source := buildSource(common.Connection{
-		Host: "db.example.com", Port: 3306, User: "monitor", Password: "secret", Database: "appdb",
-	})
-	assert.Equal(t, "monitor:secret@tcp(db.example.com:3306)/appdb", source)
-}
-
 func TestParseVersion(t *testing.T) {
 	v, err := parseVersion("8.0.23-0ubuntu0.20.04.1")
 	assert.NoError(t, err)
@@ -37,7 +30,7 @@ func TestQueryVersionSuccess(t *testing.T) {
 	mock.ExpectQuery("select version").WillReturnRows(
 		sqlmock.NewRows([]string{"version()"}).AddRow("8.0.23"))
 
-	v, err := queryVersion(db)
+	v, err := queryVersion(context.Background(), db)
 	assert.NoError(t, err)
 	assert.Equal(t, "8.0.23", v)
 }
@@ -49,7 +42,7 @@ func TestQueryVersionError(t *testing.T) {
 
 	mock.ExpectQuery("select version").WillReturnError(fmt.Errorf("connection refused"))
 
-	_, err = queryVersion(db)
+	_, err = queryVersion(context.Background(), db)
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "connection refused")
 }
@@ -1,19 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
-	"github.com/thomis/sensu-plugins-go/pkg/common"
+	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
+	"github.com/thomis/sensu-plugins-go/pkg/mysql"
 )
 
 type session struct {
-	Connection   common.Connection
+	Connection   mysql.Connection
+	OptionsFile  string
 	Critical     string
 	Warning      string
 	CritMin      int64
@@ -21,6 +25,10 @@ type session struct {
 	WarnMin      int64
 	WarnMax      int64
 	ProcessCount int64
+	File         string
+	Concurrency  int
+	Deadline     time.Duration
+	Timeout      time.Duration
 	Check        *check.CheckStruct
 }
 
@@ -39,7 +47,19 @@ func main() {
 		return
 	}
 
-	session.ProcessCount, err = selectProcessCount(session.Connection)
+	// Batch mode: apply the same thresholds to every server in the file.
+	if len(session.File) > 0 {
+		session.batch()
+		return
+	}
+
+	if err = mysql.ApplyOptionFile(&session.Connection, session.OptionsFile, session.Check.Option.Changed); err != nil {
+		session.Check.Error(err)
+		return
+	}
+	session.Connection.ConnectTimeout = session.Timeout
+
+	session.ProcessCount, err = selectProcessCount(session.Connection, session.Timeout)
 	if err != nil {
 		session.Check.Error(err)
 		return
@@ -89,41 +109,90 @@ func (s *session) handleArguments() {
 	s.Check.Option.IntVarP(&s.Connection.Port, "port", "P", 3306, "MySQL tcp port to connect to")
 	s.Check.Option.StringVarP(&s.Connection.User, "user", "u", os.Getenv("MYSQL_USER"), "MySQL User")
 	s.Check.Option.StringVarP(&s.Connection.Password, "password", "p", os.Getenv("MYSQL_PASSWORD"), "MySQL user password")
+	s.Check.Option.StringVar(&s.Connection.SSLMode, "ssl-mode", "DISABLED", "SSL mode: "+strings.Join(mysql.SSLModes, ", "))
+	s.Check.Option.StringVar(&s.Connection.SSLCA, "ssl-ca", "", "CA certificate file to verify the server certificate")
+	s.Check.Option.StringVar(&s.Connection.SSLCert, "ssl-cert", "", "Client certificate file")
+	s.Check.Option.StringVar(&s.Connection.SSLKey, "ssl-key", "", "Client private key file")
+	s.Check.Option.StringVar(&s.OptionsFile, "defaults-file", "", "Option file with [client] settings (default: ~/.my.cnf if present)")
+	s.Check.Option.StringVarP(&s.File, "file", "f", "", "File with connections for batch mode. Line format: label,dsn")
+	s.Check.Option.IntVar(&s.Concurrency, "concurrency", 10, "Maximum number of servers checked concurrently in batch mode")
+	s.Check.Option.DurationVar(&s.Deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	s.Check.Option.DurationVarP(&s.Timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
 	s.Check.Option.StringVarP(&s.Critical, "critical", "c", "", "Critical min:max threshold, max is optional")
 	s.Check.Option.StringVarP(&s.Warning, "warning", "w", "", "Warning min:max threshold, max is optional")
 	s.Check.Init()
 }
 
 func (s *session) report() {
+	level, message := s.evaluate(s.ProcessCount)
+	s.Check.Report(level, message)
+}
+
+// evaluate applies the thresholds to a process count.
+func (s *session) evaluate(count int64) (string, string) {
+	perf := fmt.Sprintf("mysql_processes=%d;%s;%s;0", count, s.Warning, s.Critical)
 	switch {
-	case s.CritMax > 0 && s.ProcessCount >= s.CritMax:
-		s.Check.Critical(fmt.Sprintf("%d MySQL processes exceed threshold of %d | mysql_processes=%d;%s;%s;0", s.ProcessCount, s.CritMax, s.ProcessCount, s.Warning, s.Critical))
-	case s.ProcessCount <= s.CritMin:
-		s.Check.Critical(fmt.Sprintf("%d MySQL processes are below threshold of %d | mysql_processes=%d;%s;%s;0", s.ProcessCount, s.CritMin, s.ProcessCount, s.Warning, s.Critical))
-	case s.WarnMax > 0 && s.ProcessCount >= s.WarnMax:
-		s.Check.Warning(fmt.Sprintf("%d MySQL processes exceed threshold of %d | mysql_processes=%d;%s;%s;0", s.ProcessCount, s.WarnMax, s.ProcessCount, s.Warning, s.Critical))
-	case s.ProcessCount <= s.WarnMin:
-		s.Check.Warning(fmt.Sprintf("%d MySQL processes are below threshold of %d | mysql_processes=%d;%s;%s;0", s.ProcessCount, s.WarnMin, s.ProcessCount, s.Warning, s.Critical))
+	case s.CritMax > 0 && count >= s.CritMax:
+		return "critical", fmt.Sprintf("%d MySQL processes exceed threshold of %d | %s", count, s.CritMax, perf)
+	case count <= s.CritMin:
+		return "critical", fmt.Sprintf("%d MySQL processes are below threshold of %d | %s", count, s.CritMin, perf)
+	case s.WarnMax > 0 && count >= s.WarnMax:
+		return "warning", fmt.Sprintf("%d MySQL processes exceed threshold of %d | %s", count, s.WarnMax, perf)
+	case count <= s.WarnMin:
+		return "warning", fmt.Sprintf("%d MySQL processes are below threshold of %d | %s", count, s.WarnMin, perf)
 	default:
-		s.Check.Ok(fmt.Sprintf("MySQL process Count %d | mysql_processes=%d;%s;%s;0", s.ProcessCount, s.ProcessCount, s.Warning, s.Critical))
+		return "ok", fmt.Sprintf("MySQL process Count %d | %s", count, perf)
+	}
+}
+
+// batch checks the process count of every server in the connections file.
+func (s *session) batch() {
+	connections, err := dbquery.ParseConnectionsFile(s.File)
+	if err != nil {
+		s.Check.Error(err)
+		return
 	}
+
+	opts := dbquery.BatchOptions{Concurrency: s.Concurrency, Timeout: s.Timeout, Deadline: s.Deadline}
+	level, output := dbquery.RunBatch(connections, opts, dbquery.DatabaseRunner("mysql",
+		func(ctx context.Context, db *sql.DB) (string, string, error) {
+			count, err := execProcessCount(ctx, db)
+			if err != nil {
+				return "", "", err
+			}
+			level, message := s.evaluate(count)
+			details, _, _ := strings.Cut(message, " | ")
+			return level, details, nil
+		}))
+
+	s.Check.Report(level, output)
 }
 
-func selectProcessCount(connection common.Connection) (int64, error) {
-	source := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", connection.User, connection.Password, connection.Host, connection.Port, connection.Database)
+func selectProcessCount(connection mysql.Connection, timeout time.Duration) (int64, error) {
+	source, err := mysql.DataSource(connection)
+	if err != nil {
+		return 0, err
+	}
 	db, err := sql.Open("mysql", source)
 	if err != nil {
 		return 0, err
 	}
 	defer db.Close()
 
-	return execProcessCount(db)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	count, err := execProcessCount(ctx, db)
+	if err != nil && ctx.Err() != nil {
+		return 0, fmt.Errorf("timeout reached")
+	}
+	return count, err
 }
 
 // execProcessCount reads the process count from an open database handle.
-func execProcessCount(db *sql.DB) (int64, error) {
+func execProcessCount(ctx context.Context, db *sql.DB) (int64, error) {
 	var count int64
-	if err := db.QueryRow("select count(*) from information_schema.PROCESSLIST").Scan(&count); err != nil {
+	if err := db.QueryRowContext(ctx, "select count(*) from information_schema.PROCESSLIST").Scan(&count); err != nil {
 		return 0, err
 	}
 
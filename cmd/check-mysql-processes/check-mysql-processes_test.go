@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -49,7 +50,7 @@ func TestExecProcessCount(t *testing.T) {
 	mock.ExpectQuery("PROCESSLIST").WillReturnRows(
 		sqlmock.NewRows([]string{"count"}).AddRow(42))
 
-	count, err := execProcessCount(db)
+	count, err := execProcessCount(context.Background(), db)
 	assert.NoError(t, err)
 	assert.Equal(t, int64(42), count)
 }
@@ -61,7 +62,7 @@ func TestExecProcessCountError(t *testing.T) {
 
 	mock.ExpectQuery("PROCESSLIST").WillReturnError(fmt.Errorf("access denied"))
 
-	_, err = execProcessCount(db)
+	_, err = execProcessCount(context.Background(), db)
 	assert.Error(t, err)
 }
 
@@ -100,3 +101,17 @@ func TestReport(t *testing.T) {
 		})
 	}
 }
+
+func TestEvaluate(t *testing.T) {
+	s, _ := newTestSession()
+	s.Warning, s.Critical = "0:200", "0:300"
+	s.CritMax, s.WarnMax = 300, 200
+
+	level, message := s.evaluate(42)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "MySQL process Count 42 | mysql_processes=42;0:200;0:300;0", message)
+
+	level, message = s.evaluate(210)
+	assert.Equal(t, "warning", level)
+	assert.Equal(t, "210 MySQL processes exceed threshold of 200 | mysql_processes=210;0:200;0:300;0", message)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
+	"github.com/thomis/sensu-plugins-go/pkg/mysql"
+)
+
+func main() {
+	var (
+		connection  mysql.Connection
+		optionsFile string
+		query       string
+		queryFile   string
+		file        string
+		concurrency int
+		deadline    time.Duration
+		timeout     time.Duration
+	)
+
+	c := check.New("check-mysql-query")
+	c.Option.SortFlags = false
+	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "MySQL host to connect to")
+	c.Option.IntVarP(&connection.Port, "port", "P", 3306, "MySQL tcp port to connect to")
+	c.Option.StringVarP(&connection.User, "user", "u", os.Getenv("MYSQL_USER"), "MySQL User")
+	c.Option.StringVarP(&connection.Password, "password", "p", os.Getenv("MYSQL_PASSWORD"), "MySQL user password")
+	c.Option.StringVarP(&connection.Database, "database", "d", "mysql", "MySQL database")
+	c.Option.StringVar(&connection.SSLMode, "ssl-mode", "DISABLED", "SSL mode: "+strings.Join(mysql.SSLModes, ", "))
+	c.Option.StringVar(&connection.SSLCA, "ssl-ca", "", "CA certificate file to verify the server certificate")
+	c.Option.StringVar(&connection.SSLCert, "ssl-cert", "", "Client certificate file")
+	c.Option.StringVar(&connection.SSLKey, "ssl-key", "", "Client private key file")
+	c.Option.StringVar(&optionsFile, "defaults-file", "", "Option file with [client] settings (default: ~/.my.cnf if present)")
+	c.Option.StringVarP(&query, "query", "q", "", "Inline query returning two values: status (ok|warn|warning|error) and message")
+	c.Option.StringVar(&queryFile, "query-file", "", "File containing the query (alternative to -q)")
+	c.Option.StringVarP(&file, "file", "f", "", "File with connections for batch mode. Line format: label,dsn")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of connections queried concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
+	c.Init()
+
+	// Resolving the query text is a configuration concern; failures here are
+	// usage errors (exit 3) rather than a database problem.
+	stmt, err := dbquery.ReadQuery(query, queryFile)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Batch mode: run the same query against every connection in the file.
+	if len(file) > 0 {
+		connections, err := dbquery.ParseConnectionsFile(file)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		opts := dbquery.BatchOptions{Concurrency: concurrency, Timeout: timeout, Deadline: deadline}
+		status, output := dbquery.RunBatch(connections, opts, dbquery.DatabaseRunner("mysql",
+			func(ctx context.Context, db *sql.DB) (string, string, error) {
+				return execQuery(ctx, db, stmt)
+			}))
+		c.Report(status, output)
+		return
+	}
+
+	source, err := dataSource(connection, optionsFile, c.Option.Changed, timeout)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	status, message, err := runQuery(source, stmt, timeout)
+	report(c, status, message, err)
+}
+
+// dataSource fills the connection from the option file, where the command
+// line and the environment win, before the connect timeout is applied and the
+// DSN is built. Batch mode takes the DSNs from the connections file instead.
+func dataSource(connection mysql.Connection, optionsFile string, given func(name string) bool, timeout time.Duration) (string, error) {
+	if err := mysql.ApplyOptionFile(&connection, optionsFile, given); err != nil {
+		return "", err
+	}
+	connection.ConnectTimeout = timeout
+
+	return mysql.DataSource(connection)
+}
+
+// report exits with the status returned by the query. A failed connection
+// or query is critical; an unrecognized status is treated as a
+// usage/contract error (exit 3).
+func report(c *check.CheckStruct, status, message string, err error) {
+	if err != nil {
+		c.Critical(err.Error())
+		return
+	}
+
+	status, err = dbquery.NormalizeStatus(status)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Report(status, message)
+}
+
+// runQuery connects to MySQL and executes the statement with execQuery.
+func runQuery(source string, stmt string, timeout time.Duration) (string, string, error) {
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return "", "", err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return execQuery(ctx, db, stmt)
+}
+
+// execQuery runs the statement against an open database handle with
+// dbquery.ExecQuery, which also covers procedures handing the result back in
+// @status and @message. It is separated from connection handling so it can be
+// tested with a mocked database.
+func execQuery(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+	return dbquery.ExecQuery(ctx, db, stmt)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+	"github.com/thomis/sensu-plugins-go/pkg/mysql"
+)
+
+func TestExecQuerySuccess(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status", "message"}).AddRow("warn", "replica lagging"))
+	status, message, err := execQuery(context.Background(), db, "select status, message from health")
+	require.NoError(t, err)
+	assert.Equal(t, "warn", status)
+	assert.Equal(t, "replica lagging", message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecQueryCall(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("CALL health_check(@status, @message)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT @status, @message").WillReturnRows(
+		sqlmock.NewRows([]string{"@status", "@message"}).AddRow("error", "replication stopped"))
+	status, message, err := execQuery(context.Background(), db, "CALL health_check(@status, @message)")
+	require.NoError(t, err)
+	assert.Equal(t, "error", status)
+	assert.Equal(t, "replication stopped", message)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecQueryError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status", "message"}))
+	_, _, err = execQuery(context.Background(), db, "select status, message from health")
+	assert.ErrorContains(t, err, "no rows")
+
+	mock.ExpectQuery("select").WillReturnError(fmt.Errorf("Error 1146: Table 'mysql.missing' doesn't exist"))
+	_, _, err = execQuery(context.Background(), db, "select status, message from missing")
+	assert.ErrorContains(t, err, "doesn't exist")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReport(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   string
+		err      error
+		expected int
+	}{
+		{"ok", "ok", nil, 0},
+		{"warning", "WARN", nil, 1},
+		{"critical", "error", nil, 2},
+		{"query failed", "", fmt.Errorf("connection refused"), 2},
+		{"unrecognized status", "bogus", nil, 3},
+		{"empty status", "", nil, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code := -1
+			c := check.New("test")
+			c.ExitFn = func(c int) { code = c }
+			report(c, tt.status, "message", tt.err)
+			assert.Equal(t, tt.expected, code)
+		})
+	}
+}
+
+func TestDataSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my.cnf")
+	require.NoError(t, os.WriteFile(path, []byte("[client]\nuser=monitor\npassword=secret\nhost=db.example.com\nport=3307\n"), 0o600))
+	none := func(string) bool { return false }
+
+	connection := mysql.Connection{Connection: common.Connection{Host: "localhost", Port: 3306, Database: "mysql"}}
+	source, err := dataSource(connection, path, none, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "monitor:secret@tcp(db.example.com:3307)/mysql?timeout=5s", source)
+
+	// Options given on the command line and the user from the environment
+	// win over the option file.
+	connection.User = "admin"
+	source, err = dataSource(connection, path, func(name string) bool { return name == "host" }, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, "admin:secret@tcp(localhost:3307)/mysql?timeout=5s", source)
+
+	// The option file is applied before the DSN is built, so its settings are
+	// validated as well.
+	require.NoError(t, os.WriteFile(path, []byte("[client]\nssl-mode=bogus\n"), 0o600))
+	_, err = dataSource(connection, path, none, 5*time.Second)
+	assert.ErrorContains(t, err, `invalid ssl-mode "bogus"`)
+
+	_, err = dataSource(connection, filepath.Join(t.TempDir(), "missing"), none, 5*time.Second)
+	assert.Error(t, err)
+}
+
+func TestRunQueryConnectionError(t *testing.T) {
+	// A listener that is closed right away leaves a port nobody answers on.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := listener.Addr().String()
+	require.NoError(t, listener.Close())
+
+	_, _, err = runQuery("monitor:secret@tcp("+address+")/mysql?timeout=1s", "select 'ok', 'fine'", time.Second)
+	assert.Error(t, err)
+}
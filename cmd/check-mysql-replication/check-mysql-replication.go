@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/mysql"
+)
+
+// parseError is the MySQL error number of a syntax error, returned by
+// servers older than 8.0.22 for SHOW REPLICA STATUS.
+const parseError = 1064
+
+// renames translate the column names of SHOW SLAVE STATUS to those of SHOW
+// REPLICA STATUS.
+var renames = strings.NewReplacer("Slave", "Replica", "Master", "Source")
+
+type options struct {
+	lag     check.Threshold
+	pending check.Threshold
+	gaps    check.Threshold
+}
+
+// channel is one row of SHOW REPLICA STATUS, keyed by the column names of
+// MySQL 8.0.22 and later. NULL columns are left out.
+type channel map[string]string
+
+func main() {
+	var (
+		connection  mysql.Connection
+		opts        options
+		optionsFile string
+		timeout     time.Duration
+	)
+
+	c := check.New("CheckMySQLReplication")
+	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "MySQL host to connect to")
+	c.Option.IntVarP(&connection.Port, "port", "P", 3306, "MySQL tcp port to connect to")
+	c.Option.StringVarP(&connection.User, "user", "u", os.Getenv("MYSQL_USER"), "MySQL User")
+	c.Option.StringVarP(&connection.Password, "password", "p", os.Getenv("MYSQL_PASSWORD"), "MySQL user password")
+	c.Option.StringVar(&connection.SSLMode, "ssl-mode", "DISABLED", "SSL mode: "+strings.Join(mysql.SSLModes, ", "))
+	c.Option.StringVar(&connection.SSLCA, "ssl-ca", "", "CA certificate file to verify the server certificate")
+	c.Option.StringVar(&connection.SSLCert, "ssl-cert", "", "Client certificate file")
+	c.Option.StringVar(&connection.SSLKey, "ssl-key", "", "Client private key file")
+	c.Option.StringVar(&optionsFile, "defaults-file", "", "Option file with [client] settings (default: ~/.my.cnf if present)")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout")
+	c.Option.Float64Var(&opts.lag.Warning, "lag-warn", 0, "Warning if the replica is at least this many seconds behind the source (0 disables)")
+	c.Option.Float64Var(&opts.lag.Critical, "lag-crit", 0, "Critical if the replica is at least this many seconds behind the source (0 disables)")
+	c.Option.Float64Var(&opts.pending.Warning, "pending-warn", 0, "Warning if at least this many retrieved transactions are not executed yet (0 disables)")
+	c.Option.Float64Var(&opts.pending.Critical, "pending-crit", 0, "Critical if at least this many retrieved transactions are not executed yet (0 disables)")
+	c.Option.Float64Var(&opts.gaps.Warning, "gaps-warn", 0, "Warning if at least this many transactions are missing in the executed GTID set (0 disables)")
+	c.Option.Float64Var(&opts.gaps.Critical, "gaps-crit", 0, "Critical if at least this many transactions are missing in the executed GTID set (0 disables)")
+	c.Init()
+
+	if err := mysql.ApplyOptionFile(&connection, optionsFile, c.Option.Changed); err != nil {
+		c.Error(err)
+		return
+	}
+	connection.ConnectTimeout = timeout
+
+	channels, err := selectReplicaStatus(connection, timeout)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	level, message := evaluate(channels, opts)
+	c.Report(level, message)
+}
+
+func selectReplicaStatus(connection mysql.Connection, timeout time.Duration) ([]channel, error) {
+	source, err := mysql.DataSource(connection)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	channels, err := replicaStatus(ctx, db)
+	if err != nil && ctx.Err() != nil {
+		return nil, fmt.Errorf("timeout reached")
+	}
+	return channels, err
+}
+
+// replicaStatus reads SHOW REPLICA STATUS, falling back to SHOW SLAVE STATUS
+// on servers that do not know the statement yet. There is one row per
+// replication channel and none if the server is not a replica.
+func replicaStatus(ctx context.Context, db *sql.DB) ([]channel, error) {
+	rows, err := db.QueryContext(ctx, "SHOW REPLICA STATUS")
+	var mysqlErr *driver.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == parseError {
+		rows, err = db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	channels := []channel{}
+	for rows.Next() {
+		values := make([]sql.NullString, len(columns))
+		targets := make([]any, len(columns))
+		for i := range values {
+			targets[i] = &values[i]
+		}
+		if err := rows.Scan(targets...); err != nil {
+			return nil, err
+		}
+
+		ch := channel{}
+		for i, column := range columns {
+			if values[i].Valid {
+				ch[renames.Replace(column)] = values[i].String
+			}
+		}
+		channels = append(channels, ch)
+	}
+	return channels, rows.Err()
+}
+
+// evaluate checks the replication threads, the lag and the GTID sets of
+// every channel.
+func evaluate(channels []channel, opts options) (string, string) {
+	if len(channels) == 0 {
+		return "critical", "Server is not configured as a replica"
+	}
+
+	levels := []string{}
+	details := []string{}
+	problems := []string{}
+	perfs := []string{}
+
+	for _, ch := range channels {
+		name := ch["Channel_Name"]
+		prefix := ""
+		suffix := ""
+		if len(name) > 0 {
+			prefix = fmt.Sprintf("channel %s ", name)
+			suffix = "_" + check.PerfLabel(name)
+		}
+
+		apply := func(threshold check.Threshold, value float64, description string) {
+			level := threshold.Level(value)
+			levels = append(levels, level)
+			if level != "ok" {
+				problems = append(problems, fmt.Sprintf("%s%s, %s", prefix, description, level))
+			}
+		}
+		fail := func(problem string) {
+			levels = append(levels, "critical")
+			problems = append(problems, prefix+problem)
+		}
+
+		detail := fmt.Sprintf("%sreplica of %s:%s", prefix, ch["Source_Host"], ch["Source_Port"])
+
+		for _, thread := range []string{"IO", "SQL"} {
+			if running := ch["Replica_"+thread+"_Running"]; running != "Yes" {
+				problem := fmt.Sprintf("%s thread is %s", thread, threadState(running))
+				if e := ch["Last_"+thread+"_Error"]; len(e) > 0 {
+					problem += ": " + e
+				}
+				fail(problem)
+			}
+		}
+
+		if lag, err := strconv.ParseFloat(ch["Seconds_Behind_Source"], 64); err == nil {
+			detail += fmt.Sprintf(", %gs behind", lag)
+			apply(opts.lag, lag, fmt.Sprintf("%gs behind source", lag))
+			perfs = append(perfs, fmt.Sprintf("mysql_replication_lag%s=%gs;%s;0;", suffix, lag, opts.lag.Perf()))
+		}
+
+		if len(ch["Retrieved_Gtid_Set"]) > 0 || len(ch["Executed_Gtid_Set"]) > 0 {
+			retrieved, err := parseGTIDSet(ch["Retrieved_Gtid_Set"])
+			if err != nil {
+				fail(fmt.Sprintf("retrieved GTID set: %s", err))
+				retrieved = gtidSet{}
+			}
+			executed, err := parseGTIDSet(ch["Executed_Gtid_Set"])
+			if err != nil {
+				fail(fmt.Sprintf("executed GTID set: %s", err))
+				executed = gtidSet{}
+			}
+
+			pending := missing(retrieved, executed)
+			gap := gaps(executed)
+			apply(opts.pending, float64(pending), fmt.Sprintf("%d retrieved transactions not executed", pending))
+			apply(opts.gaps, float64(gap), fmt.Sprintf("%d transactions missing in the executed GTID set", gap))
+			perfs = append(perfs,
+				fmt.Sprintf("mysql_gtid_pending%s=%d;%s;0;", suffix, pending, opts.pending.Perf()),
+				fmt.Sprintf("mysql_gtid_gaps%s=%d;%s;0;", suffix, gap, opts.gaps.Perf()),
+			)
+		}
+
+		details = append(details, detail)
+	}
+
+	output := strings.Join(details, ", ")
+	output = strings.ToUpper(output[:1]) + output[1:]
+	if len(problems) > 0 {
+		output += ": " + strings.Join(problems, ", ")
+	}
+	if len(perfs) > 0 {
+		output += " | " + strings.Join(perfs, " ")
+	}
+	return check.WorstLevel(levels...), output
+}
+
+// threadState describes the Replica_IO_Running and Replica_SQL_Running
+// values other than Yes.
+func threadState(running string) string {
+	switch running {
+	case "No":
+		return "stopped"
+	case "":
+		return "unknown"
+	default:
+		return strings.ToLower(running)
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+const sourceUUID = "3e11fa47-71ca-11e1-9e33-c80aa9429562"
+
+func healthy() channel {
+	return channel{
+		"Source_Host":           "db1.example.com",
+		"Source_Port":           "3306",
+		"Replica_IO_Running":    "Yes",
+		"Replica_SQL_Running":   "Yes",
+		"Seconds_Behind_Source": "3",
+		"Retrieved_Gtid_Set":    sourceUUID + ":1-120",
+		"Executed_Gtid_Set":     sourceUUID + ":1-115",
+		"Channel_Name":          "",
+	}
+}
+
+func TestParseGTIDSet(t *testing.T) {
+	set, err := parseGTIDSet("3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5:11-18:6-8,\n2174b383-5441-11e8-b90a-c80aa9429562:1:tag:1-3")
+	require.NoError(t, err)
+	assert.Equal(t, gtidSet{
+		sourceUUID:                                 {{1, 8}, {11, 18}},
+		"2174b383-5441-11e8-b90a-c80aa9429562":     {{1, 1}},
+		"2174b383-5441-11e8-b90a-c80aa9429562:tag": {{1, 3}},
+	}, set)
+
+	set, err = parseGTIDSet("")
+	assert.NoError(t, err)
+	assert.Empty(t, set)
+
+	for _, text := range []string{sourceUUID, sourceUUID + ":5-1", sourceUUID + ":1-x"} {
+		_, err = parseGTIDSet(text)
+		assert.Error(t, err, text)
+	}
+}
+
+func TestMissingAndGaps(t *testing.T) {
+	retrieved, _ := parseGTIDSet(sourceUUID + ":1-120")
+	executed, _ := parseGTIDSet(sourceUUID + ":1-100:103-115")
+	assert.Equal(t, uint64(7), missing(retrieved, executed))
+	assert.Equal(t, uint64(0), missing(executed, retrieved))
+	assert.Equal(t, uint64(2), gaps(executed))
+	assert.Equal(t, uint64(0), gaps(retrieved))
+}
+
+func TestReplicaStatus(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Source_Host", "Replica_IO_Running", "Seconds_Behind_Source"}).
+			AddRow("db1", "Yes", nil))
+
+	channels, err := replicaStatus(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, []channel{{"Source_Host": "db1", "Replica_IO_Running": "Yes"}}, channels)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplicaStatusFallback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnError(&driver.MySQLError{Number: parseError, Message: "You have an error in your SQL syntax"})
+	mock.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Master_Host", "Slave_IO_Running", "Slave_SQL_Running", "Seconds_Behind_Master"}).
+			AddRow("db1", "Yes", "No", "7"))
+
+	channels, err := replicaStatus(context.Background(), db)
+	require.NoError(t, err)
+	assert.Equal(t, []channel{{
+		"Source_Host": "db1", "Replica_IO_Running": "Yes", "Replica_SQL_Running": "No", "Seconds_Behind_Source": "7",
+	}}, channels)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReplicaStatusError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SHOW REPLICA STATUS").WillReturnError(fmt.Errorf("Access denied; you need the REPLICATION CLIENT privilege"))
+
+	_, err = replicaStatus(context.Background(), db)
+	assert.ErrorContains(t, err, "REPLICATION CLIENT")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEvaluateHealthy(t *testing.T) {
+	level, message := evaluate([]channel{healthy()}, options{lag: check.Threshold{Warning: 60, Critical: 300}})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Replica of db1.example.com:3306, 3s behind | mysql_replication_lag=3s;60;300;0; mysql_gtid_pending=5;;;0; mysql_gtid_gaps=0;;;0;", message)
+}
+
+func TestEvaluateNotReplica(t *testing.T) {
+	level, message := evaluate([]channel{}, options{})
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "Server is not configured as a replica", message)
+}
+
+func TestEvaluateStoppedThreads(t *testing.T) {
+	ch := healthy()
+	ch["Replica_IO_Running"] = "Connecting"
+	ch["Last_IO_Error"] = "error connecting to source 'repl@db1.example.com:3306'"
+	ch["Replica_SQL_Running"] = "No"
+	delete(ch, "Seconds_Behind_Source")
+
+	level, message := evaluate([]channel{ch}, options{})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "IO thread is connecting: error connecting to source 'repl@db1.example.com:3306', SQL thread is stopped")
+	assert.NotContains(t, message, "mysql_replication_lag")
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	ch := healthy()
+	ch["Seconds_Behind_Source"] = "90"
+	ch["Executed_Gtid_Set"] = sourceUUID + ":1-100:103-115"
+	opts := options{
+		lag:     check.Threshold{Warning: 60, Critical: 300},
+		pending: check.Threshold{Warning: 5, Critical: 100},
+		gaps:    check.Threshold{Critical: 1},
+	}
+
+	level, message := evaluate([]channel{ch}, opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "90s behind source, warning")
+	assert.Contains(t, message, "7 retrieved transactions not executed, warning")
+	assert.Contains(t, message, "2 transactions missing in the executed GTID set, critical")
+	assert.Contains(t, message, "mysql_gtid_gaps=2;;1;0;")
+
+	ch["Executed_Gtid_Set"] = "garbage"
+	level, message = evaluate([]channel{ch}, options{})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "executed GTID set: invalid GTID set element")
+}
+
+func TestEvaluateChannels(t *testing.T) {
+	east := healthy()
+	east["Channel_Name"] = "east"
+	west := healthy()
+	west["Channel_Name"] = "west dc"
+	west["Source_Host"] = "db2.example.com"
+	west["Seconds_Behind_Source"] = "400"
+	delete(west, "Retrieved_Gtid_Set")
+	delete(west, "Executed_Gtid_Set")
+
+	level, message := evaluate([]channel{east, west}, options{lag: check.Threshold{Warning: 60, Critical: 300}})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "Channel east replica of db1.example.com:3306, 3s behind, channel west dc replica of db2.example.com:3306, 400s behind")
+	assert.Contains(t, message, "channel west dc 400s behind source, critical")
+	assert.Contains(t, message, "mysql_replication_lag_east=3s;60;300;0;")
+	assert.Contains(t, message, "mysql_replication_lag_west_dc=400s;60;300;0;")
+	assert.NotContains(t, message, "mysql_gtid_pending_west_dc")
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// interval is an inclusive range of transaction numbers.
+type interval struct {
+	start uint64
+	end   uint64
+}
+
+// gtidSet maps a source, the server UUID followed by the tag if any, to its
+// sorted and merged transaction intervals.
+type gtidSet map[string][]interval
+
+// parseGTIDSet parses a set like "uuid:1-100:105,uuid2:1-5". Elements that
+// do not start with a digit are tags (MySQL 8.3 and later) that apply to
+// the intervals following them.
+func parseGTIDSet(text string) (gtidSet, error) {
+	set := gtidSet{}
+	for _, element := range strings.Split(text, ",") {
+		element = strings.TrimSpace(element)
+		if len(element) == 0 {
+			continue
+		}
+		parts := strings.Split(element, ":")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid GTID set element %q", element)
+		}
+		uuid := strings.ToLower(parts[0])
+		source := uuid
+		for _, part := range parts[1:] {
+			if len(part) == 0 || part[0] < '0' || part[0] > '9' {
+				source = uuid + ":" + part
+				continue
+			}
+			start, end, found := strings.Cut(part, "-")
+			if !found {
+				end = start
+			}
+			first, err := strconv.ParseUint(start, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid GTID interval %q", part)
+			}
+			last, err := strconv.ParseUint(end, 10, 64)
+			if err != nil || last < first {
+				return nil, fmt.Errorf("invalid GTID interval %q", part)
+			}
+			set[source] = append(set[source], interval{first, last})
+		}
+	}
+
+	for source, intervals := range set {
+		set[source] = merge(intervals)
+	}
+	return set, nil
+}
+
+// merge sorts intervals and joins overlapping and adjacent ones.
+func merge(intervals []interval) []interval {
+	slices.SortFunc(intervals, func(a, b interval) int {
+		switch {
+		case a.start < b.start:
+			return -1
+		case a.start > b.start:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	merged := []interval{}
+	for _, i := range intervals {
+		last := len(merged) - 1
+		if last >= 0 && i.start <= merged[last].end+1 {
+			merged[last].end = max(merged[last].end, i.end)
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
+
+// missing counts the transactions of set that are not in other, e.g. the
+// retrieved transactions that were not executed yet.
+func missing(set, other gtidSet) uint64 {
+	count := uint64(0)
+	for source, intervals := range set {
+		for _, i := range intervals {
+			count += i.end - i.start + 1
+			for _, o := range other[source] {
+				start, end := max(i.start, o.start), min(i.end, o.end)
+				if start <= end {
+					count -= end - start + 1
+				}
+			}
+		}
+	}
+	return count
+}
+
+// gaps counts the transactions missing between the intervals of each
+// source, e.g. transactions skipped by the applier.
+func gaps(set gtidSet) uint64 {
+	count := uint64(0)
+	for _, intervals := range set {
+		for n := 1; n < len(intervals); n++ {
+			count += intervals[n].start - intervals[n-1].end - 1
+		}
+	}
+	return count
+}
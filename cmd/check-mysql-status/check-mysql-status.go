@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/mysql"
+	"github.com/thomis/sensu-plugins-go/pkg/state"
+)
+
+type options struct {
+	connections check.Threshold
+	aborted     check.Threshold
+	hitRatio    check.Threshold
+	lockWaits   check.Threshold
+}
+
+// values are the rows of SHOW GLOBAL STATUS or SHOW GLOBAL VARIABLES.
+type values map[string]string
+
+// Int returns a value as a number, reporting whether it is present.
+func (v values) Int(name string) (int64, bool) {
+	n, err := strconv.ParseInt(v[name], 10, 64)
+	return n, err == nil
+}
+
+// counters are the status counters kept between runs. Uptime going down
+// means the server restarted and its counters start from zero.
+type counters struct {
+	Time                   time.Time `json:"time"`
+	Uptime                 int64     `json:"uptime"`
+	AbortedConnects        int64     `json:"aborted_connects"`
+	RowLockWaits           int64     `json:"row_lock_waits"`
+	BufferPoolReads        int64     `json:"buffer_pool_reads"`
+	BufferPoolReadRequests int64     `json:"buffer_pool_read_requests"`
+}
+
+func main() {
+	var (
+		connection  mysql.Connection
+		opts        options
+		optionsFile string
+		timeout     time.Duration
+		stateFile   string
+	)
+
+	c := check.New("CheckMySQLStatus")
+	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "MySQL host to connect to")
+	c.Option.IntVarP(&connection.Port, "port", "P", 3306, "MySQL tcp port to connect to")
+	c.Option.StringVarP(&connection.User, "user", "u", os.Getenv("MYSQL_USER"), "MySQL User")
+	c.Option.StringVarP(&connection.Password, "password", "p", os.Getenv("MYSQL_PASSWORD"), "MySQL user password")
+	c.Option.StringVar(&connection.SSLMode, "ssl-mode", "DISABLED", "SSL mode: "+strings.Join(mysql.SSLModes, ", "))
+	c.Option.StringVar(&connection.SSLCA, "ssl-ca", "", "CA certificate file to verify the server certificate")
+	c.Option.StringVar(&connection.SSLCert, "ssl-cert", "", "Client certificate file")
+	c.Option.StringVar(&connection.SSLKey, "ssl-key", "", "Client private key file")
+	c.Option.StringVar(&optionsFile, "defaults-file", "", "Option file with [client] settings (default: ~/.my.cnf if present)")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout")
+	c.Option.Float64Var(&opts.connections.Warning, "connections-warn", 0, "Warning if Threads_connected is at least this % of max_connections (0 disables)")
+	c.Option.Float64Var(&opts.connections.Critical, "connections-crit", 0, "Critical if Threads_connected is at least this % of max_connections (0 disables)")
+	c.Option.Float64Var(&opts.aborted.Warning, "aborted-warn", 0, "Warning if at least this many connection attempts were aborted since the last run (0 disables)")
+	c.Option.Float64Var(&opts.aborted.Critical, "aborted-crit", 0, "Critical if at least this many connection attempts were aborted since the last run (0 disables)")
+	c.Option.Float64Var(&opts.hitRatio.Warning, "hit-ratio-warn", 0, "Warning if the InnoDB buffer pool hit ratio is below this % (0 disables)")
+	c.Option.Float64Var(&opts.hitRatio.Critical, "hit-ratio-crit", 0, "Critical if the InnoDB buffer pool hit ratio is below this % (0 disables)")
+	c.Option.Float64Var(&opts.lockWaits.Warning, "lock-waits-warn", 0, "Warning if at least this many InnoDB row lock waits happened since the last run (0 disables)")
+	c.Option.Float64Var(&opts.lockWaits.Critical, "lock-waits-crit", 0, "Critical if at least this many InnoDB row lock waits happened since the last run (0 disables)")
+	c.Option.StringVar(&stateFile, "state-file", "", "File keeping the counters of the previous run (default: derived from host and port in the temp directory)")
+	c.Init()
+
+	if err := mysql.ApplyOptionFile(&connection, optionsFile, c.Option.Changed); err != nil {
+		c.Error(err)
+		return
+	}
+	connection.ConnectTimeout = timeout
+
+	status, variables, err := selectStatus(connection, timeout)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if len(stateFile) == 0 {
+		stateFile = state.DefaultFile("check-mysql-status", connection.Host+":"+strconv.Itoa(connection.Port))
+	}
+	var saved counters
+	if err := state.Load(stateFile, &saved); err != nil {
+		c.Error(fmt.Errorf("invalid state file %s: %w", stateFile, err))
+		return
+	}
+	var previous *counters
+	if !saved.Time.IsZero() {
+		previous = &saved
+	}
+	current := countersOf(status, time.Now())
+	if err := state.Save(stateFile, current); err != nil {
+		c.Error(fmt.Errorf("failed to write state file %s: %w", stateFile, err))
+		return
+	}
+
+	level, message := evaluate(status, variables, previous, current, opts)
+	c.Report(level, message)
+}
+
+func selectStatus(connection mysql.Connection, timeout time.Duration) (values, values, error) {
+	source, err := mysql.DataSource(connection)
+	if err != nil {
+		return nil, nil, err
+	}
+	db, err := sql.Open("mysql", source)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	status, err := queryValues(ctx, db, "SHOW GLOBAL STATUS")
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, nil, fmt.Errorf("timeout reached")
+		}
+		return nil, nil, err
+	}
+	variables, err := queryValues(ctx, db, "SHOW GLOBAL VARIABLES WHERE Variable_name IN ('max_connections', 'version')")
+	if err != nil && ctx.Err() != nil {
+		return nil, nil, fmt.Errorf("timeout reached")
+	}
+	return status, variables, err
+}
+
+// queryValues reads the name/value rows of a SHOW statement.
+func queryValues(ctx context.Context, db *sql.DB, query string) (values, error) {
+	rows, err := db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := values{}
+	for rows.Next() {
+		var name string
+		var value sql.NullString
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		result[name] = value.String
+	}
+	return result, rows.Err()
+}
+
+func countersOf(status values, now time.Time) counters {
+	uptime, _ := status.Int("Uptime")
+	aborted, _ := status.Int("Aborted_connects")
+	waits, _ := status.Int("Innodb_row_lock_waits")
+	reads, _ := status.Int("Innodb_buffer_pool_reads")
+	requests, _ := status.Int("Innodb_buffer_pool_read_requests")
+	return counters{
+		Time:                   now,
+		Uptime:                 uptime,
+		AbortedConnects:        aborted,
+		RowLockWaits:           waits,
+		BufferPoolReads:        reads,
+		BufferPoolReadRequests: requests,
+	}
+}
+
+// evaluate applies the thresholds to the status and variables. Aborted
+// connects and row lock waits are compared to the previous run and left out
+// on the first run and after a restart. The buffer pool hit ratio covers the
+// time since the previous run, or since the server started if there is none.
+func evaluate(status, variables values, previous *counters, current counters, opts options) (string, string) {
+	levels := []string{}
+	details := []string{"MySQL server"}
+	if version := variables["version"]; len(version) > 0 {
+		details[0] = "Server version " + version
+	}
+	problems := []string{}
+	perfs := []string{}
+
+	record := func(level string, description string) {
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, fmt.Sprintf("%s, %s", description, level))
+		}
+	}
+
+	if connected, ok := status.Int("Threads_connected"); ok {
+		maxConnections, _ := variables.Int("max_connections")
+		details = append(details, fmt.Sprintf("%d of %d connections", connected, maxConnections))
+		perfs = append(perfs, fmt.Sprintf("mysql_connections=%d;;;0;%d", connected, maxConnections))
+		if maxConnections > 0 {
+			used := float64(connected) / float64(maxConnections) * 100
+			record(opts.connections.Level(used), fmt.Sprintf("%.1f%% of max_connections used", used))
+			perfs = append(perfs, fmt.Sprintf("mysql_connections_used=%.1f%%;%s;0;100", used, opts.connections.Perf()))
+		}
+	}
+
+	restarted := previous == nil || current.Uptime < previous.Uptime ||
+		current.AbortedConnects < previous.AbortedConnects || current.RowLockWaits < previous.RowLockWaits ||
+		current.BufferPoolReads < previous.BufferPoolReads || current.BufferPoolReadRequests < previous.BufferPoolReadRequests
+
+	reads, requests := current.BufferPoolReads, current.BufferPoolReadRequests
+	if !restarted {
+		reads -= previous.BufferPoolReads
+		requests -= previous.BufferPoolReadRequests
+	}
+	if requests > 0 {
+		ratio := (1 - float64(reads)/float64(requests)) * 100
+		details = append(details, fmt.Sprintf("buffer pool hit ratio %.2f%%", ratio))
+		record(opts.hitRatio.MinLevel(ratio), fmt.Sprintf("buffer pool hit ratio %.2f%%", ratio))
+		perfs = append(perfs, fmt.Sprintf("mysql_buffer_pool_hit_ratio=%.2f%%;%s;0;100", ratio, opts.hitRatio.Perf()))
+	}
+
+	if !restarted {
+		aborted := current.AbortedConnects - previous.AbortedConnects
+		waits := current.RowLockWaits - previous.RowLockWaits
+		record(opts.aborted.Level(float64(aborted)), fmt.Sprintf("%d aborted connects", aborted))
+		record(opts.lockWaits.Level(float64(waits)), fmt.Sprintf("%d row lock waits", waits))
+		perfs = append(perfs,
+			fmt.Sprintf("mysql_aborted_connects=%d;%s;0;", aborted, opts.aborted.Perf()),
+			fmt.Sprintf("mysql_row_lock_waits=%d;%s;0;", waits, opts.lockWaits.Perf()),
+		)
+	}
+
+	if waiting, ok := status.Int("Innodb_row_lock_current_waits"); ok {
+		perfs = append(perfs, fmt.Sprintf("mysql_row_lock_current_waits=%d;;;0;", waiting))
+	}
+
+	output := strings.Join(details, ", ")
+	if len(problems) > 0 {
+		output += ": " + strings.Join(problems, ", ")
+	}
+	if len(perfs) > 0 {
+		output += " | " + strings.Join(perfs, " ")
+	}
+	return check.WorstLevel(levels...), output
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+var now = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+var variables = values{"max_connections": "200", "version": "8.0.36"}
+
+func status() values {
+	return values{
+		"Uptime":                           "86400",
+		"Threads_connected":                "50",
+		"Aborted_connects":                 "12",
+		"Innodb_row_lock_waits":            "40",
+		"Innodb_row_lock_current_waits":    "1",
+		"Innodb_buffer_pool_reads":         "1000",
+		"Innodb_buffer_pool_read_requests": "1000000",
+	}
+}
+
+func TestQueryValues(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("SHOW GLOBAL STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Variable_name", "Value"}).
+			AddRow("Threads_connected", "50").
+			AddRow("Ssl_cipher", nil))
+
+	result, err := queryValues(context.Background(), db, "SHOW GLOBAL STATUS")
+	require.NoError(t, err)
+	assert.Equal(t, values{"Threads_connected": "50", "Ssl_cipher": ""}, result)
+	n, ok := result.Int("Threads_connected")
+	assert.True(t, ok)
+	assert.Equal(t, int64(50), n)
+	_, ok = result.Int("Ssl_cipher")
+	assert.False(t, ok)
+
+	mock.ExpectQuery("SHOW GLOBAL VARIABLES").WillReturnError(fmt.Errorf("access denied"))
+	_, err = queryValues(context.Background(), db, "SHOW GLOBAL VARIABLES")
+	assert.Error(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCountersOf(t *testing.T) {
+	assert.Equal(t, counters{
+		Time:                   now,
+		Uptime:                 86400,
+		AbortedConnects:        12,
+		RowLockWaits:           40,
+		BufferPoolReads:        1000,
+		BufferPoolReadRequests: 1000000,
+	}, countersOf(status(), now))
+}
+
+func TestEvaluateFirstRun(t *testing.T) {
+	s := status()
+	level, message := evaluate(s, variables, nil, countersOf(s, now), options{connections: check.Threshold{Warning: 80, Critical: 95}})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Server version 8.0.36, 50 of 200 connections, buffer pool hit ratio 99.90% | "+
+		"mysql_connections=50;;;0;200 mysql_connections_used=25.0%;80;95;0;100 mysql_buffer_pool_hit_ratio=99.90%;;;0;100 mysql_row_lock_current_waits=1;;;0;", message)
+}
+
+func TestEvaluateSincePreviousRun(t *testing.T) {
+	previous := countersOf(status(), now.Add(-time.Minute))
+	s := status()
+	s["Uptime"] = "86460"
+	s["Threads_connected"] = "190"
+	s["Aborted_connects"] = "20"
+	s["Innodb_row_lock_waits"] = "140"
+	s["Innodb_buffer_pool_reads"] = "6000"
+	s["Innodb_buffer_pool_read_requests"] = "1100000"
+	opts := options{
+		connections: check.Threshold{Warning: 80, Critical: 95},
+		aborted:     check.Threshold{Warning: 5, Critical: 50},
+		hitRatio:    check.Threshold{Warning: 99, Critical: 90},
+		lockWaits:   check.Threshold{Warning: 10, Critical: 100},
+	}
+
+	level, message := evaluate(s, variables, &previous, countersOf(s, now), opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "95.0% of max_connections used, critical")
+	assert.Contains(t, message, "buffer pool hit ratio 95.00%, warning")
+	assert.Contains(t, message, "8 aborted connects, warning")
+	assert.Contains(t, message, "100 row lock waits, critical")
+	assert.Contains(t, message, "mysql_aborted_connects=8;5;50;0; mysql_row_lock_waits=100;10;100;0;")
+}
+
+func TestEvaluateRestart(t *testing.T) {
+	previous := countersOf(status(), now.Add(-time.Minute))
+	s := status()
+	s["Uptime"] = "30"
+	s["Aborted_connects"] = "0"
+
+	level, message := evaluate(s, variables, &previous, countersOf(s, now), options{aborted: check.Threshold{Warning: 1}})
+	assert.Equal(t, "ok", level)
+	assert.NotContains(t, message, "mysql_aborted_connects")
+	assert.Contains(t, message, "buffer pool hit ratio 99.90%")
+}
+
+func TestEvaluateMissingValues(t *testing.T) {
+	level, message := evaluate(values{}, values{}, nil, counters{}, options{hitRatio: check.Threshold{Critical: 90}})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "MySQL server", message)
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strconv"
@@ -11,38 +10,113 @@ import (
 	"time"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/nginx"
+	"github.com/thomis/sensu-plugins-go/pkg/state"
 )
 
+// sample is the stub_status page as saved between runs.
+type sample struct {
+	Time   time.Time        `json:"time"`
+	Status nginx.StubStatus `json:"status"`
+}
+
 func main() {
 	var (
 		url         string
 		pidFile     string
 		timeout     int
 		checkStatus bool
+		active      check.Threshold
+		dropped     check.Threshold
+		stateFile   string
 	)
 
 	c := check.New("CheckNGINX")
 	c.Option.StringVarP(&url, "url", "u", "http://localhost/nginx-status", "NGINX status page URL")
-	c.Option.StringVarP(&pidFile, "pidFile", "p", "/var/run/nginx.pid", "NGINX PID File")
+	c.Option.StringVarP(&pidFile, "pidFile", "p", "/var/run/nginx.pid", "NGINX PID File (empty skips the process check)")
 	c.Option.IntVarP(&timeout, "timeout", "t", 15, "NGINX status page check timeout")
 	c.Option.BoolVarP(&checkStatus, "checkStatus", "c", false, "Check NGINX status page")
+	c.Option.Float64Var(&active.Warning, "active-warn", 0, "Warning if active connections are at least this (0 disables)")
+	c.Option.Float64Var(&active.Critical, "active-crit", 0, "Critical if active connections are at least this (0 disables)")
+	c.Option.Float64Var(&dropped.Warning, "drop-warn", 0, "Warning if at least this many connections were dropped since the last run (0 disables)")
+	c.Option.Float64Var(&dropped.Critical, "drop-crit", 0, "Critical if at least this many connections were dropped since the last run (0 disables)")
+	c.Option.StringVar(&stateFile, "state-file", "", "File keeping the previous sample for rates (default: derived from the URL in the temp directory)")
 	c.Init()
 
-	processStatus, processErr := checkProcessRunning(pidFile)
-	if !processStatus {
-		c.Critical(fmt.Sprintf("%v", processErr))
+	if len(pidFile) > 0 {
+		processStatus, processErr := checkProcessRunning(pidFile)
+		if !processStatus {
+			c.Critical(fmt.Sprintf("%v", processErr))
+			return
+		}
 	}
 
-	if checkStatus {
-		connections, statusErr := nginxStatus(url, timeout)
-		if statusErr != nil {
-			c.Critical(fmt.Sprintf("%v", statusErr))
-		}
+	if !checkStatus && !active.Enabled() && !dropped.Enabled() {
+		c.Ok("OK")
+		return
+	}
 
-		c.Ok(fmt.Sprintf("connections = %d | nginx_connections=%d", connections, connections))
+	current, statusErr := nginxStatus(url, timeout)
+	if statusErr != nil {
+		c.Critical(fmt.Sprintf("%v", statusErr))
+		return
+	}
+
+	if len(stateFile) == 0 {
+		stateFile = state.DefaultFile("check-nginx", url)
+	}
+	now := time.Now()
+	var previous *sample
+	var saved sample
+	if err := state.Load(stateFile, &saved); err != nil {
+		c.Error(fmt.Errorf("invalid state file %s: %w", stateFile, err))
+		return
+	}
+	if !saved.Time.IsZero() {
+		previous = &saved
+	}
+	if err := state.Save(stateFile, sample{Time: now, Status: current}); err != nil {
+		c.Error(fmt.Errorf("failed to write state file %s: %w", stateFile, err))
+		return
 	}
-	c.Ok("OK")
 
+	level, message := evaluate(previous, sample{Time: now, Status: current}, active, dropped)
+	c.Report(level, message)
+}
+
+// evaluate applies the thresholds to the current sample. Request rate and
+// dropped connections need a previous sample and are left out on the first
+// run and after NGINX was restarted.
+func evaluate(previous *sample, current sample, active, dropped check.Threshold) (string, string) {
+	status := current.Status
+	levels := []string{active.Level(float64(status.Active))}
+	details := []string{fmt.Sprintf("connections = %d", status.Active)}
+	perf := []string{
+		fmt.Sprintf("nginx_connections=%d;%s;0;", status.Active, active.Perf()),
+		fmt.Sprintf("nginx_reading=%d", status.Reading),
+		fmt.Sprintf("nginx_writing=%d", status.Writing),
+		fmt.Sprintf("nginx_waiting=%d", status.Waiting),
+	}
+
+	if previous != nil {
+		seconds := current.Time.Sub(previous.Time).Seconds()
+		if rates, ok := nginx.StubStatusRates(previous.Status, status, seconds); ok {
+			levels = append(levels, dropped.Level(float64(rates.Dropped)))
+			details = append(details, fmt.Sprintf("requests = %.2f/s", rates.Requests), fmt.Sprintf("dropped = %d", rates.Dropped))
+			perf = append(perf,
+				fmt.Sprintf("nginx_requests_per_second=%.2f", rates.Requests),
+				fmt.Sprintf("nginx_dropped=%d;%s;0;", rates.Dropped, dropped.Perf()),
+			)
+		}
+	}
+
+	perf = append(perf,
+		fmt.Sprintf("nginx_accepts=%d", status.Accepts),
+		fmt.Sprintf("nginx_handled=%d", status.Handled),
+		fmt.Sprintf("nginx_requests=%d", status.Requests),
+	)
+
+	return check.WorstLevel(levels...), strings.Join(details, ", ") + " | " + strings.Join(perf, " ")
 }
 
 func checkProcessRunning(pidFile string) (bool, error) {
@@ -52,7 +126,7 @@ func checkProcessRunning(pidFile string) (bool, error) {
 		return false, fmt.Errorf("failed to read PID file %s, error: %s", pidFile, err)
 	}
 
-	pid, err := strconv.ParseInt(strings.TrimRight(string(pidLine), "\n"), 10, 64)
+	pid, err := strconv.ParseInt(strings.TrimSpace(string(pidLine)), 10, 64)
 	if err != nil {
 		return false, fmt.Errorf("failed to determine PID from PID file %s, error: %s", pidFile, err)
 	}
@@ -66,47 +140,12 @@ func checkProcessRunning(pidFile string) (bool, error) {
 	if signalErr == nil {
 		return true, nil
 	} else {
-		return false, fmt.Errorf("failed to find process for PID %d, error: %s", pid, err)
+		return false, fmt.Errorf("failed to find process for PID %d, error: %s", pid, signalErr)
 	}
 
 }
 
-func nginxStatus(url string, timeout int) (int64, error) {
-
-	http.DefaultClient.Timeout = time.Duration(timeout) * time.Second
-
-	request, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return -1, err
-	}
-
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return -1, err
-	}
-
-	if response.StatusCode != 200 {
-		return -1, fmt.Errorf("received HTTP status code %v from %s", response.StatusCode, url)
-	}
-
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return -1, err
-	}
-	defer response.Body.Close()
-
-	/*  Body should be similar to:
-
-	    Active connections: 43
-	    server accepts handled requests
-	    7368 7368 10993
-	    Reading: 0 Writing: 5 Waiting: 38 */
-
-	lines := strings.Split(string(body), "\n")
-	connections, err := strconv.ParseInt(strings.Fields(lines[0])[2], 10, 64)
-	if err != nil {
-		return -1, err
-	}
-
-	return connections, nil
+func nginxStatus(url string, timeout int) (nginx.StubStatus, error) {
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+	return nginx.GetStubStatus(client, url)
 }
@@ -7,8 +7,11 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/nginx"
 )
 
 func TestCheckProcessRunningSelf(t *testing.T) {
@@ -49,9 +52,11 @@ func TestNginxStatus(t *testing.T) {
 	}))
 	defer server.Close()
 
-	connections, err := nginxStatus(server.URL, 5)
+	status, err := nginxStatus(server.URL, 5)
 	assert.NoError(t, err)
-	assert.Equal(t, int64(43), connections)
+	assert.Equal(t, uint64(43), status.Active)
+	assert.Equal(t, uint64(10993), status.Requests)
+	assert.Equal(t, uint64(38), status.Waiting)
 }
 
 func TestNginxStatusNon200(t *testing.T) {
@@ -63,3 +68,39 @@ func TestNginxStatusNon200(t *testing.T) {
 	_, err := nginxStatus(server.URL, 5)
 	assert.Error(t, err)
 }
+
+func TestNginxStatusMalformed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>Welcome to nginx!</html>\n")
+	}))
+	defer server.Close()
+
+	_, err := nginxStatus(server.URL, 5)
+	assert.Error(t, err)
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	previous := &sample{Time: now.Add(-10 * time.Second), Status: nginx.StubStatus{Active: 5, Accepts: 100, Handled: 100, Requests: 1000}}
+	current := sample{Time: now, Status: nginx.StubStatus{Active: 43, Accepts: 160, Handled: 155, Requests: 1500, Writing: 5, Waiting: 38}}
+
+	level, message := evaluate(nil, current, check.Threshold{}, check.Threshold{})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "connections = 43 | nginx_connections=43;;;0; nginx_reading=0 nginx_writing=5 nginx_waiting=38 nginx_accepts=160 nginx_handled=155 nginx_requests=1500", message)
+
+	level, message = evaluate(previous, current, check.Threshold{Warning: 40, Critical: 50}, check.Threshold{Warning: 1, Critical: 10})
+	assert.Equal(t, "warning", level)
+	assert.Equal(t, "connections = 43, requests = 50.00/s, dropped = 5 | nginx_connections=43;40;50;0; nginx_reading=0 nginx_writing=5 nginx_waiting=38 nginx_requests_per_second=50.00 nginx_dropped=5;1;10;0; nginx_accepts=160 nginx_handled=155 nginx_requests=1500", message)
+
+	level, _ = evaluate(previous, current, check.Threshold{}, check.Threshold{Critical: 5})
+	assert.Equal(t, "critical", level)
+
+	level, _ = evaluate(previous, current, check.Threshold{Critical: 43}, check.Threshold{})
+	assert.Equal(t, "critical", level)
+
+	// counters reset after a restart: no rates, no drop threshold
+	restarted := sample{Time: now, Status: nginx.StubStatus{Active: 1, Accepts: 3, Handled: 1, Requests: 3}}
+	level, message = evaluate(previous, restarted, check.Threshold{}, check.Threshold{Critical: 1})
+	assert.Equal(t, "ok", level)
+	assert.NotContains(t, message, "nginx_dropped")
+}
@@ -6,7 +6,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/godror/godror"
+	_ "github.com/godror/godror"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
 	"github.com/thomis/sensu-plugins-go/pkg/oracle"
@@ -14,13 +14,17 @@ import (
 
 func main() {
 	var (
-		username  string
-		password  string
-		database  string
-		query     string
-		queryFile string
-		file      string
-		timeout   time.Duration
+		username    string
+		password    string
+		database    string
+		query       string
+		queryFile   string
+		file        string
+		concurrency int
+		deadline    time.Duration
+		timeout     time.Duration
+		multiRow    bool
+		metrics     dbquery.MetricOptions
 	)
 
 	c := check.New("check-oracle-query")
@@ -30,8 +34,15 @@ func main() {
 	c.Option.StringVarP(&database, "database", "d", "", "Database name")
 	c.Option.StringVarP(&query, "query", "q", "", "Inline query returning two values: status (ok|warn|warning|error) and message")
 	c.Option.StringVar(&queryFile, "query-file", "", "File containing the query (alternative to -q)")
+	c.Option.StringVar(&metrics.Mode, "numeric", "", "Numeric mode: the query returns one row of numeric columns (columns) or label,value rows (rows) checked against --warn and --crit")
+	c.Option.Float64VarP(&metrics.Threshold.Warning, "warn", "w", 0, "Numeric mode: warning if a value reaches this threshold (0 disables)")
+	c.Option.Float64VarP(&metrics.Threshold.Critical, "crit", "c", 0, "Numeric mode: critical if a value reaches this threshold (0 disables)")
+	c.Option.BoolVar(&metrics.Below, "below", false, "Numeric mode: alert when a value falls below the thresholds instead")
+	c.Option.BoolVar(&multiRow, "multi-row", false, "Multi-row mode: every row is a result with the columns [label,] status, message")
 	c.Option.StringVarP(&file, "file", "f", "", "File with connection strings for batch mode. Line format: label,username/password@database")
-	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of connections queried concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
 	c.Init()
 
 	// Resolving the query text is a configuration concern; failures here are
@@ -42,20 +53,48 @@ func main() {
 		return
 	}
 
+	numeric := len(metrics.Mode) > 0
+	if numeric && multiRow {
+		c.Error(fmt.Errorf("provide either --numeric or --multi-row, not both"))
+		return
+	}
+	if numeric {
+		if err := dbquery.ValidateNumericMode(metrics.Mode); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	exec := execQuery
+	switch {
+	case multiRow:
+		exec = func(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+			status, output, err := dbquery.ExecRows(ctx, db, stmt)
+			return status, output, oracle.ExtractOracleError(err)
+		}
+	case numeric:
+		exec = func(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+			level, message, err := dbquery.ExecMetrics(ctx, db, stmt, metrics)
+			return level, message, oracle.ExtractOracleError(err)
+		}
+	}
+
 	// Batch mode: run the same query against every connection in the file.
 	if len(file) > 0 {
-		status, output, err := batchQuery(oracle.FileParams{File: file, Timeout: timeout}, stmt, runQuery)
+		connections, err := batchConnections(file)
 		if err != nil {
-			c.Critical(err.Error())
+			c.Error(err)
 			return
 		}
-		report(c, status, output)
+		opts := dbquery.BatchOptions{Concurrency: concurrency, Timeout: timeout, Deadline: deadline}
+		status, output := dbquery.RunBatch(connections, opts, dbquery.DatabaseRunner("godror", dbquery.BatchCheck(exec, stmt, numeric, multiRow)))
+		c.Report(status, output)
 		return
 	}
 
 	// Single connection mode.
 	connection := oracle.Connection{Username: username, Password: password, Database: database, Timeout: timeout}
-	status, message, err := runQuery(connection, stmt)
+	status, message, err := runQuery(connection, stmt, exec)
 	if err != nil {
 		c.Critical(err.Error())
 		return
@@ -67,91 +106,36 @@ func main() {
 		return
 	}
 
-	report(c, status, message)
-}
-
-// report maps a normalized status (ok|warning|critical) to the matching check
-// result and exit code.
-func report(c *check.CheckStruct, status string, output string) {
-	switch status {
-	case "ok":
-		c.Ok(output)
-	case "warning":
-		c.Warning(output)
-	default:
-		c.Critical(output)
-	}
+	c.Report(status, message)
 }
 
-// queryRunner executes the statement against a single connection. main wires in
-// runQuery; tests inject a fake to exercise the batch orchestration without a
-// database.
-type queryRunner func(connection oracle.Connection, stmt string) (string, string, error)
-
-// batchQuery runs the statement against all connections in the file concurrently
-// and reduces the per-connection outcomes to a single overall result
-// (worst-status-wins). A connection or query failure, or an unrecognized status,
-// counts as critical for that connection.
-func batchQuery(fileParams oracle.FileParams, stmt string, run queryRunner) (string, string, error) {
-	connections, err := oracle.ParseConnectionsFromFile(fileParams)
+// batchConnections reads the connections file of batch mode. The label of a
+// connection names its user and database, and its DSN is the godror data
+// source.
+func batchConnections(file string) ([]dbquery.Connection, error) {
+	connections, err := oracle.ParseConnectionsFromFile(oracle.FileParams{File: file})
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-
-	// Buffered so stragglers can send and exit even after an overall timeout,
-	// avoiding leaked goroutines.
-	channel := make(chan dbquery.QueryOutcome, len(*connections))
-	for _, c := range *connections {
-		go func(c oracle.Connection) {
-			outcome := dbquery.QueryOutcome{Label: fmt.Sprintf("%s (%s@%s)", c.Label, c.Username, c.Database)}
-
-			status, message, err := run(c, stmt)
-			switch {
-			case err != nil:
-				outcome.Status = "critical"
-				outcome.Message = err.Error()
-			default:
-				normalized, nerr := dbquery.NormalizeStatus(status)
-				if nerr != nil {
-					outcome.Status = "critical"
-					outcome.Message = nerr.Error()
-				} else {
-					outcome.Status = normalized
-					outcome.Message = message
-				}
-			}
-
-			channel <- outcome
-		}(c)
+	if len(*connections) == 0 {
+		return nil, fmt.Errorf("no connections found in [%s]", file)
 	}
 
-	total := len(*connections)
-	outcomes := make([]dbquery.QueryOutcome, 0, total)
-	timeout := time.After(fileParams.Timeout)
-
-	for i := 0; i < total; i++ {
-		select {
-		case outcome := <-channel:
-			outcomes = append(outcomes, outcome)
-		case <-timeout:
-			return "", "", fmt.Errorf("timeout reached while running query on [%d] connections", total)
-		}
+	result := make([]dbquery.Connection, 0, len(*connections))
+	for _, c := range *connections {
+		result = append(result, dbquery.Connection{
+			Label: fmt.Sprintf("%s (%s@%s)", c.Label, c.Username, c.Database),
+			DSN:   oracle.DataSource(c),
+		})
 	}
-
-	status, output := dbquery.AggregateQueryOutcomes(outcomes)
-	return status, output, nil
+	return result, nil
 }
 
-// runQuery connects to the database and executes the statement against a single
-// connection.
-func runQuery(connection oracle.Connection, stmt string) (string, string, error) {
-	params := godror.ConnectionParams{}
-	params.Username = connection.Username
-	params.Password = godror.NewPassword(connection.Password)
-	params.Timezone = time.UTC
-	params.ConnectString = connection.Database
-
-	db, err := sql.Open("godror", params.StringWithPassword())
+// runQuery connects to the database and executes the statement with exec against
+// a single connection.
+func runQuery(connection oracle.Connection, stmt string,
+	exec func(ctx context.Context, db *sql.DB, stmt string) (string, string, error)) (string, string, error) {
+	db, err := sql.Open("godror", oracle.DataSource(connection))
 	if err != nil {
 		return "", "", oracle.ExtractOracleError(err)
 	}
@@ -160,43 +144,15 @@ func runQuery(connection oracle.Connection, stmt string) (string, string, error)
 	ctx, cancel := context.WithTimeout(context.Background(), connection.Timeout)
 	defer cancel()
 
-	return execQuery(ctx, db, stmt)
+	return exec(ctx, db, stmt)
 }
 
-// execQuery runs the resolved statement against an open database handle. A plain
-// SQL statement is expected to return a single row with two columns (status,
-// message); a PL/SQL block is executed with two OUT bind variables (:status,
-// :message). It is separated from connection handling so it can be tested with a
-// mocked database.
+// execQuery runs the resolved statement against an open database handle with
+// dbquery.ExecQuery: a plain SQL statement is expected to return a single row
+// with two columns (status, message); a PL/SQL block is executed with two OUT
+// bind variables (:status, :message). It is separated from connection handling
+// so it can be tested with a mocked database.
 func execQuery(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
-	var (
-		status  string
-		message string
-	)
-
-	if dbquery.IsPLSQL(stmt) {
-		_, err := db.ExecContext(ctx, stmt,
-			sql.Named("status", sql.Out{Dest: &status}),
-			sql.Named("message", sql.Out{Dest: &message}))
-		if err != nil {
-			if ctx.Err() != nil {
-				return "", "", fmt.Errorf("timeout reached")
-			}
-			return "", "", oracle.ExtractOracleError(err)
-		}
-		return status, message, nil
-	}
-
-	err := db.QueryRowContext(ctx, stmt).Scan(&status, &message)
-	if err != nil {
-		if ctx.Err() != nil {
-			return "", "", fmt.Errorf("timeout reached")
-		}
-		if err == sql.ErrNoRows {
-			return "", "", fmt.Errorf("query returned no rows (expected one row with two columns: status, message)")
-		}
-		return "", "", oracle.ExtractOracleError(err)
-	}
-
-	return status, message, nil
+	status, message, err := dbquery.ExecQuery(ctx, db, stmt)
+	return status, message, oracle.ExtractOracleError(err)
 }
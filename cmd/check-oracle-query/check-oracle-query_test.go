@@ -9,7 +9,7 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
-	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
 	"github.com/thomis/sensu-plugins-go/pkg/oracle"
 )
 
@@ -25,92 +25,60 @@ func writeConnectionsFile(t *testing.T, content string) (string, func()) {
 	return f.Name(), func() { os.Remove(f.Name()) }
 }
 
-func TestBatchQueryWorstStatusWins(t *testing.T) {
+func TestBatchConnections(t *testing.T) {
 	file, cleanup := writeConnectionsFile(t,
-		"prod,okuser/pass@DB1\nstage,warnuser/pass@DB2\ndr,failuser/pass@DB3\n")
+		"# comment\nprod,okuser/pass@DB1\nstage,warnuser/pass@//stage-host:1521/DB2\n")
 	defer cleanup()
 
-	run := func(c oracle.Connection, stmt string) (string, string, error) {
-		switch c.Username {
-		case "okuser":
-			return "ok", "fine", nil
-		case "warnuser":
-			return "warn", "busy", nil
-		default:
-			return "", "", fmt.Errorf("ORA-12541: TNS no listener")
-		}
-	}
-
-	status, output, err := batchQuery(oracle.FileParams{File: file, Timeout: 5 * time.Second}, "select 1", run)
+	connections, err := batchConnections(file)
 	assert.Nil(t, err)
-	assert.Equal(t, "critical", status)
-	assert.Contains(t, output, "1 critical, 1 warning, 1 ok (of 3)")
-	assert.Contains(t, output, "stage (warnuser@DB2): WARNING busy")
-	assert.Contains(t, output, "dr (failuser@DB3): CRITICAL ORA-12541")
+	assert.Equal(t, 2, len(connections))
+	assert.Equal(t, "prod (okuser@DB1)", connections[0].Label)
+	assert.Equal(t, oracle.DataSource(oracle.Connection{Username: "okuser", Password: "pass", Database: "DB1"}), connections[0].DSN)
+	assert.Equal(t, "stage (warnuser@//stage-host:1521/DB2)", connections[1].Label)
 }
 
-func TestBatchQueryAllOk(t *testing.T) {
-	file, cleanup := writeConnectionsFile(t, "a,u1/p@DB1\nb,u2/p@DB2\n")
-	defer cleanup()
-
-	run := func(c oracle.Connection, stmt string) (string, string, error) {
-		return "ok", "fine", nil
-	}
-
-	status, output, err := batchQuery(oracle.FileParams{File: file, Timeout: 5 * time.Second}, "select 1", run)
-	assert.Nil(t, err)
-	assert.Equal(t, "ok", status)
-	assert.Contains(t, output, "0 critical, 0 warning, 2 ok (of 2)")
-}
-
-func TestBatchQueryUnknownStatusIsCritical(t *testing.T) {
-	file, cleanup := writeConnectionsFile(t, "a,u1/p@DB1\n")
-	defer cleanup()
-
-	run := func(c oracle.Connection, stmt string) (string, string, error) {
-		return "weird", "??", nil
-	}
-
-	status, _, err := batchQuery(oracle.FileParams{File: file, Timeout: 5 * time.Second}, "select 1", run)
-	assert.Nil(t, err)
-	assert.Equal(t, "critical", status)
-}
-
-func TestBatchQueryParseError(t *testing.T) {
+func TestBatchConnectionsErrors(t *testing.T) {
 	file, cleanup := writeConnectionsFile(t, "this is not a valid connection line\n")
 	defer cleanup()
+	_, err := batchConnections(file)
+	assert.NotNil(t, err)
 
-	run := func(c oracle.Connection, stmt string) (string, string, error) {
-		return "ok", "fine", nil
-	}
-
-	_, _, err := batchQuery(oracle.FileParams{File: file, Timeout: 5 * time.Second}, "select 1", run)
+	empty, cleanupEmpty := writeConnectionsFile(t, "# nothing\n")
+	defer cleanupEmpty()
+	_, err = batchConnections(empty)
 	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no connections found")
 }
 
-func TestBatchQueryTimeout(t *testing.T) {
-	file, cleanup := writeConnectionsFile(t, "a,u1/p@DB1\n")
+func TestBatchWorstStatusWins(t *testing.T) {
+	file, cleanup := writeConnectionsFile(t,
+		"prod,okuser/pass@DB1\nstage,warnuser/pass@DB2\ndr,failuser/pass@DB3\nslow,slowuser/pass@DB4\n")
 	defer cleanup()
 
-	run := func(c oracle.Connection, stmt string) (string, string, error) {
-		time.Sleep(200 * time.Millisecond)
-		return "ok", "fine", nil
-	}
-
-	_, _, err := batchQuery(oracle.FileParams{File: file, Timeout: time.Millisecond}, "select 1", run)
-	assert.NotNil(t, err)
-	assert.Contains(t, err.Error(), "timeout")
-}
+	connections, err := batchConnections(file)
+	assert.Nil(t, err)
 
-func TestReport(t *testing.T) {
-	cases := map[string]int{"ok": 0, "warning": 1, "critical": 2, "anything-else": 2}
-	for status, expected := range cases {
-		var got int
-		c := check.New("check-oracle-query")
-		c.ExitFn = func(code int) { got = code }
-		report(c, status, "msg")
-		assert.Equal(t, expected, got, "status %q", status)
+	run := func(ctx context.Context, c dbquery.Connection) (string, string, error) {
+		switch c.Label {
+		case "prod (okuser@DB1)":
+			return "ok", "fine", nil
+		case "stage (warnuser@DB2)":
+			return "warn", "busy", nil
+		case "slow (slowuser@DB4)":
+			<-ctx.Done()
+			return "", "", ctx.Err()
+		default:
+			return "", "", fmt.Errorf("ORA-12541: TNS no listener")
+		}
 	}
+
+	status, output := dbquery.RunBatch(connections, dbquery.BatchOptions{Concurrency: 2, Timeout: 50 * time.Millisecond, Deadline: 5 * time.Second}, run)
+	assert.Equal(t, "critical", status)
+	assert.Contains(t, output, "2 critical, 1 warning, 1 ok (of 4)")
+	assert.Contains(t, output, "stage (warnuser@DB2): WARNING busy")
+	assert.Contains(t, output, "dr (failuser@DB3): CRITICAL ORA-12541")
+	assert.Contains(t, output, "slow (slowuser@DB4): CRITICAL timeout reached")
 }
 
 func TestExecQuerySQLSuccess(t *testing.T) {
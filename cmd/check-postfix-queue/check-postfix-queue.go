@@ -2,61 +2,41 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/postfix"
 )
 
+// check-postfix-queue is deprecated in favour of check-postfix, which checks
+// all queues with per-queue thresholds: check-postfix -q deferred -w 5 -c 10.
 func main() {
 	var (
 		queue string
+		spool string
 		warn  int
 		crit  int
 	)
 
 	c := check.New("CheckPostfixQueue")
 	c.Option.StringVarP(&queue, "queue", "q", "deferred", "Postfix queue to check")
+	c.Option.StringVar(&spool, "spool", postfix.DefaultSpool, "Postfix queue directory")
 	c.Option.IntVarP(&warn, "warn", "w", 5, "Warning threshold")
 	c.Option.IntVarP(&crit, "crit", "c", 10, "Critical threshold")
 	c.Init()
 
-	queueDir := fmt.Sprintf("/var/spool/postfix/%s", queue)
-
-	if _, err := os.Stat(queueDir); os.IsNotExist(err) || os.IsPermission(err) {
-		c.Error(fmt.Errorf("cannot access queue directory %s: %v", queueDir, err))
-	}
-
-	queueLength, err := mailQueue(queueDir)
+	stats, err := postfix.ReadQueue(spool, queue)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
+	message := fmt.Sprintf("%d messages in the postfix mail queue", stats.Count)
 	switch {
-	case queueLength > crit:
-		c.Critical(fmt.Sprintf("%d messages in the postfix mail queue", queueLength))
-	case queueLength > warn:
-		c.Warning(fmt.Sprintf("%d messages in the postfix mail queue", queueLength))
+	case stats.Count > crit:
+		c.Critical(message)
+	case stats.Count > warn:
+		c.Warning(message)
 	default:
-		c.Ok(fmt.Sprintf("%d messages in the postfix mail queue", queueLength))
+		c.Ok(message)
 	}
 }
-
-func mailQueue(path string) (int, error) {
-
-	var files []string
-
-	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
-			return nil
-		}
-		files = append(files, path)
-		return nil
-	})
-
-	if err != nil {
-		panic(err)
-	}
-
-	return len(files), nil
-}
@@ -1,57 +1,328 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"os/exec"
-	"strconv"
+	"io/fs"
+	"math"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/postfix"
 )
 
+// options holds the thresholds. Message count limits alert when a queue holds
+// more messages; a limit below 0 is disabled.
+type options struct {
+	warn      int
+	crit      int
+	queueWarn map[string]int
+	queueCrit map[string]int
+	age       check.Threshold
+	top       int
+}
+
+// count is the number of deferred recipients for a domain or reason.
+type count struct {
+	Name  string
+	Count int
+}
+
+// breakdown groups the deferred recipients reported by postqueue.
+type breakdown struct {
+	Domains []count
+	Reasons []count
+	Err     error
+}
+
 func main() {
 	var (
-		path string
-		warn int
-		crit int
+		spool     string
+		queues    string
+		postqueue string
+		mailq     string
+		opts      options
 	)
 
 	c := check.New("CheckPostfix")
-	c.Option.StringVarP(&path, "path", "p", "/usr/bin/mailq", "PATH")
-	c.Option.IntVarP(&warn, "warn", "w", 5, "WARN")
-	c.Option.IntVarP(&crit, "crit", "c", 10, "CRIT")
+	c.Option.StringVar(&spool, "spool", postfix.DefaultSpool, "Postfix queue directory")
+	c.Option.StringVarP(&queues, "queue", "q", strings.Join(postfix.Queues, ","), "Comma-separated queues to check")
+	c.Option.IntVarP(&opts.warn, "warn", "w", 5, "Warning if more messages are queued in total (-1 disables)")
+	c.Option.IntVarP(&opts.crit, "crit", "c", 10, "Critical if more messages are queued in total (-1 disables)")
+	c.Option.StringToIntVar(&opts.queueWarn, "queue-warn", map[string]int{}, "Warning if a queue holds more messages, e.g. deferred=50,hold=0")
+	c.Option.StringToIntVar(&opts.queueCrit, "queue-crit", map[string]int{}, "Critical if a queue holds more messages, e.g. deferred=200,hold=10")
+	c.Option.Float64Var(&opts.age.Warning, "age-warn", 0, "Warning threshold for the age of the oldest message in seconds (0 disables)")
+	c.Option.Float64Var(&opts.age.Critical, "age-crit", 0, "Critical threshold for the age of the oldest message in seconds (0 disables)")
+	c.Option.StringVar(&postqueue, "postqueue", "/usr/sbin/postqueue", "postqueue binary used to break deferred mail down by domain and reason (empty disables)")
+	c.Option.IntVar(&opts.top, "top", 3, "Number of deferred domains and reasons shown")
+	c.Option.StringVarP(&mailq, "path", "p", "", "PATH")
+	c.Option.MarkDeprecated("path", "mailq is no longer used, the queues are read directly")
 	c.Init()
 
-	queue, err := mailQueue(path)
+	selected, err := parseQueues(queues, opts)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
-	switch {
-	case queue > crit:
-		c.Critical(fmt.Sprintf("%d messages in the postfix mail queue\n", queue))
-	case queue > warn:
-		c.Warning(fmt.Sprintf("%d messages in the postfix mail queue\n", queue))
-	default:
-		c.Ok(fmt.Sprintf("%d messages in the postfix mail queue\n", queue))
+	usePostqueue := len(postqueue) > 0 && postfix.Available(postqueue)
+
+	stats, err := readQueues(spool, selected)
+	var messages []postfix.Message
+	var postqueueErr error
+	if err != nil {
+		// the spool is only readable by root and postfix, postqueue by everyone
+		if !errors.Is(err, fs.ErrPermission) || !usePostqueue {
+			c.Error(err)
+			return
+		}
+		if messages, err = postfix.Postqueue(postqueue); err != nil {
+			c.Error(err)
+			return
+		}
+		stats = queueStats(messages, selected)
+	} else if usePostqueue && queueCount(stats, "deferred") > 0 {
+		messages, postqueueErr = postfix.Postqueue(postqueue)
+	}
+
+	var details *breakdown
+	if usePostqueue && queueCount(stats, "deferred") > 0 {
+		details = deferredBreakdown(messages, opts.top)
+		details.Err = postqueueErr
 	}
+
+	level, message := evaluate(stats, details, opts, time.Now())
+	c.Report(level, message)
 }
 
-func mailQueue(path string) (int, error) {
-	var queue int
+// parseQueues validates the selected queues and the queues of the per-queue
+// thresholds.
+func parseQueues(queues string, opts options) ([]string, error) {
+	known := map[string]bool{}
+	for _, queue := range postfix.Queues {
+		known[queue] = true
+	}
 
-	cmd := path + " | egrep '[0-9]+ Kbytes in [0-9]+ Request|Mail queue is empty'"
-	out, err := exec.Command("bash", "-c", cmd).Output()
-	if err != nil {
-		return queue, err
+	selected := []string{}
+	for _, queue := range strings.Split(queues, ",") {
+		queue = strings.TrimSpace(queue)
+		if len(queue) == 0 {
+			continue
+		}
+		if !known[queue] {
+			return nil, fmt.Errorf("unknown queue %q (expected one of %s)", queue, strings.Join(postfix.Queues, ", "))
+		}
+		selected = append(selected, queue)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no queue selected")
 	}
 
-	result := string(out)
-	if result == "Mail queue is empty\n" {
-		queue = 0
-	} else {
-		queue, _ = strconv.Atoi(strings.Split(result, " ")[4])
+	for _, limits := range []map[string]int{opts.queueWarn, opts.queueCrit} {
+		for queue := range limits {
+			if !known[queue] {
+				return nil, fmt.Errorf("unknown queue %q in thresholds", queue)
+			}
+		}
 	}
 
-	return queue, nil
+	return selected, nil
+}
+
+// readQueues reads the selected queues from the spool.
+func readQueues(spool string, queues []string) ([]postfix.QueueStats, error) {
+	stats := []postfix.QueueStats{}
+	for _, queue := range queues {
+		s, err := postfix.ReadQueue(spool, queue)
+		if err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, nil
+}
+
+// queueStats counts the postqueue messages of the selected queues.
+func queueStats(messages []postfix.Message, queues []string) []postfix.QueueStats {
+	stats := []postfix.QueueStats{}
+	for _, queue := range queues {
+		s := postfix.QueueStats{Name: queue}
+		for _, m := range messages {
+			if m.QueueName != queue {
+				continue
+			}
+			s.Count++
+			arrival := time.Unix(m.ArrivalTime, 0)
+			if s.Oldest.IsZero() || arrival.Before(s.Oldest) {
+				s.Oldest = arrival
+			}
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
+
+func queueCount(stats []postfix.QueueStats, queue string) int {
+	for _, s := range stats {
+		if s.Name == queue {
+			return s.Count
+		}
+	}
+	return 0
+}
+
+// deferredBreakdown counts the recipients of deferred messages by domain and
+// by reason and returns the top ones.
+func deferredBreakdown(messages []postfix.Message, top int) *breakdown {
+	domains := map[string]int{}
+	reasons := map[string]int{}
+	for _, m := range messages {
+		if m.QueueName != "deferred" {
+			continue
+		}
+		for _, r := range m.Recipients {
+			domain := strings.ToLower(r.Address[strings.LastIndex(r.Address, "@")+1:])
+			domains[domain]++
+			if len(r.DelayReason) > 0 {
+				reasons[reasonSummary(r.DelayReason)]++
+			}
+		}
+	}
+	return &breakdown{Domains: topCounts(domains, top), Reasons: topCounts(reasons, top)}
+}
+
+// reasonSummary shortens a delay reason to its cause, dropping the host and
+// the SMTP command, so the same cause on different hosts is grouped:
+//
+//	connect to mx.example.org[192.0.2.25]:25: Connection timed out
+//
+// becomes "Connection timed out".
+func reasonSummary(reason string) string {
+	if i := strings.LastIndex(reason, " (in reply to "); i > 0 {
+		reason = reason[:i]
+	}
+	if i := strings.LastIndex(reason, ": "); i >= 0 {
+		reason = reason[i+2:]
+	}
+	return strings.TrimSpace(reason)
+}
+
+// topCounts returns the n largest counts, ties in name order.
+func topCounts(counts map[string]int, n int) []count {
+	result := []count{}
+	for name, c := range counts {
+		result = append(result, count{name, c})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Name < result[j].Name
+	})
+	if n >= 0 && len(result) > n {
+		result = result[:n]
+	}
+	return result
+}
+
+// evaluate compares the total and per-queue message counts and the age of the
+// oldest message against the thresholds. The overall level is the worst of
+// all checks.
+func evaluate(stats []postfix.QueueStats, details *breakdown, opts options, now time.Time) (string, string) {
+	total := 0
+	var oldest time.Time
+	queues := []string{}
+	perfs := []string{}
+	exceeded := []string{}
+	levels := []string{}
+
+	for _, s := range stats {
+		total += s.Count
+		if !s.Oldest.IsZero() && (oldest.IsZero() || s.Oldest.Before(oldest)) {
+			oldest = s.Oldest
+		}
+		queues = append(queues, fmt.Sprintf("%s=%d", s.Name, s.Count))
+
+		warn, hasWarn := opts.queueWarn[s.Name]
+		crit, hasCrit := opts.queueCrit[s.Name]
+		if !hasWarn {
+			warn = -1
+		}
+		if !hasCrit {
+			crit = -1
+		}
+		level := countLevel(s.Count, warn, crit)
+		levels = append(levels, level)
+		if level != "ok" {
+			exceeded = append(exceeded, fmt.Sprintf("%s queue has %d message(s), %s", s.Name, s.Count, level))
+		}
+		perfs = append(perfs, fmt.Sprintf("%s=%d;%s;%s", s.Name, s.Count, formatCount(warn), formatCount(crit)))
+	}
+
+	levels = append(levels, countLevel(total, opts.warn, opts.crit))
+	output := fmt.Sprintf("%d messages in the postfix mail queue (%s)", total, strings.Join(queues, " "))
+	perfs = append([]string{fmt.Sprintf("total=%d;%s;%s", total, formatCount(opts.warn), formatCount(opts.crit))}, perfs...)
+
+	age := 0.0
+	if !oldest.IsZero() {
+		age = math.Max(0, now.Sub(oldest).Seconds())
+		output += fmt.Sprintf(", oldest %s", (time.Duration(age) * time.Second).String())
+	}
+	if opts.age.Enabled() {
+		level := opts.age.Level(age)
+		levels = append(levels, level)
+		if level != "ok" {
+			exceeded = append(exceeded, fmt.Sprintf("oldest message exceeds %s", level))
+		}
+	}
+	perfs = append(perfs, fmt.Sprintf("oldest=%.0fs;%s", age, opts.age.Perf()))
+
+	if len(exceeded) > 0 {
+		output += ": " + strings.Join(exceeded, ", ")
+	}
+
+	if details != nil {
+		switch {
+		case details.Err != nil:
+			output += fmt.Sprintf("; no deferred details: %s", details.Err)
+		case len(details.Domains) > 0:
+			output += "; deferred by domain " + formatCounts(details.Domains)
+			if len(details.Reasons) > 0 {
+				output += ", by reason " + formatCounts(details.Reasons)
+			}
+		}
+	}
+
+	message := fmt.Sprintf("%s | %s", output, strings.Join(perfs, " "))
+	return check.WorstLevel(levels...), message
+}
+
+// countLevel alerts when count is above a limit; limits below 0 are disabled.
+func countLevel(count, warn, crit int) string {
+	switch {
+	case crit >= 0 && count > crit:
+		return "critical"
+	case warn >= 0 && count > warn:
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+func formatCounts(counts []count) string {
+	parts := []string{}
+	for _, c := range counts {
+		parts = append(parts, fmt.Sprintf("%s=%d", c.Name, c.Count))
+	}
+	return strings.Join(parts, " ")
+}
+
+// formatCount renders a count limit for perfdata, leaving disabled ones empty.
+func formatCount(limit int) string {
+	if limit < 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", limit)
 }
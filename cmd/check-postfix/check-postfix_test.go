@@ -0,0 +1,136 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/postfix"
+)
+
+var now = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func testOptions() options {
+	return options{warn: 5, crit: 10, queueWarn: map[string]int{}, queueCrit: map[string]int{}, top: 3}
+}
+
+func TestParseQueues(t *testing.T) {
+	opts := testOptions()
+	queues, err := parseQueues("deferred, hold,", opts)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"deferred", "hold"}, queues)
+
+	_, err = parseQueues("deferred,bounce", opts)
+	assert.Error(t, err)
+
+	_, err = parseQueues(" , ", opts)
+	assert.Error(t, err)
+
+	opts.queueCrit["corrupt"] = 1
+	_, err = parseQueues("deferred", opts)
+	assert.Error(t, err)
+}
+
+func TestReadQueues(t *testing.T) {
+	spool := t.TempDir()
+	for _, queue := range postfix.Queues {
+		require.NoError(t, os.MkdirAll(filepath.Join(spool, queue, "A"), 0o700))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(spool, "deferred", "A", "A1B2C3"), nil, 0o600))
+	require.NoError(t, os.WriteFile(filepath.Join(spool, "active", "D4E5F6"), nil, 0o600))
+
+	stats, err := readQueues(spool, []string{"active", "deferred", "hold"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, queueCount(stats, "active"))
+	assert.Equal(t, 1, queueCount(stats, "deferred"))
+	assert.Equal(t, 0, queueCount(stats, "hold"))
+	assert.Equal(t, 0, queueCount(stats, "incoming"))
+
+	_, err = readQueues(filepath.Join(spool, "missing"), []string{"active"})
+	assert.Error(t, err)
+}
+
+func messages() []postfix.Message {
+	return []postfix.Message{
+		{QueueName: "deferred", ArrivalTime: now.Add(-3 * time.Hour).Unix(), Recipients: []postfix.Recipient{
+			{Address: "alice@Gmail.com", DelayReason: "connect to gmail-smtp-in.l.google.com[142.250.1.26]:25: Connection timed out"},
+			{Address: "bob@example.org", DelayReason: "host mx.example.org[192.0.2.25] said: 451 4.7.1 Greylisted (in reply to RCPT TO command)"},
+		}},
+		{QueueName: "deferred", ArrivalTime: now.Add(-time.Hour).Unix(), Recipients: []postfix.Recipient{
+			{Address: "carol@gmail.com", DelayReason: "connect to gmail-smtp-in.l.google.com[142.250.1.27]:25: Connection timed out"},
+		}},
+		{QueueName: "active", ArrivalTime: now.Add(-time.Minute).Unix(), Recipients: []postfix.Recipient{{Address: "dave@example.net"}}},
+		{QueueName: "hold", ArrivalTime: now.Add(-48 * time.Hour).Unix()},
+	}
+}
+
+func TestQueueStats(t *testing.T) {
+	stats := queueStats(messages(), []string{"active", "deferred", "incoming"})
+	assert.Equal(t, []postfix.QueueStats{
+		{Name: "active", Count: 1, Oldest: time.Unix(now.Add(-time.Minute).Unix(), 0)},
+		{Name: "deferred", Count: 2, Oldest: time.Unix(now.Add(-3*time.Hour).Unix(), 0)},
+		{Name: "incoming"},
+	}, stats)
+}
+
+func TestDeferredBreakdown(t *testing.T) {
+	details := deferredBreakdown(messages(), 3)
+	assert.Equal(t, []count{{"gmail.com", 2}, {"example.org", 1}}, details.Domains)
+	assert.Equal(t, []count{{"Connection timed out", 2}, {"451 4.7.1 Greylisted", 1}}, details.Reasons)
+
+	details = deferredBreakdown(messages(), 1)
+	assert.Equal(t, []count{{"gmail.com", 2}}, details.Domains)
+}
+
+func TestReasonSummary(t *testing.T) {
+	assert.Equal(t, "Connection refused", reasonSummary("delivery temporarily suspended: connect to mx.example.com[192.0.2.1]:25: Connection refused"))
+	assert.Equal(t, "Host not found, try again", reasonSummary("Host or domain name not found. Name service error for name=example.invalid type=MX: Host not found, try again"))
+	assert.Equal(t, "lost connection", reasonSummary("lost connection"))
+}
+
+func TestEvaluate(t *testing.T) {
+	stats := []postfix.QueueStats{
+		{Name: "active", Count: 1, Oldest: now.Add(-time.Minute)},
+		{Name: "deferred", Count: 2, Oldest: now.Add(-3 * time.Hour)},
+		{Name: "hold", Count: 1, Oldest: now.Add(-48 * time.Hour)},
+	}
+
+	level, message := evaluate(stats[:2], nil, testOptions(), now)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "3 messages in the postfix mail queue (active=1 deferred=2), oldest 3h0m0s | total=3;5;10 active=1;; deferred=2;; oldest=10800s;;", message)
+
+	opts := testOptions()
+	opts.queueWarn["hold"] = 0
+	opts.queueCrit["deferred"] = 1
+	opts.age = check.Threshold{Warning: 3600, Critical: 86400}
+	level, message = evaluate(stats, deferredBreakdown(messages(), 3), opts, now)
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "4 messages in the postfix mail queue (active=1 deferred=2 hold=1), oldest 48h0m0s: "+
+		"deferred queue has 2 message(s), critical, hold queue has 1 message(s), warning, oldest message exceeds critical; "+
+		"deferred by domain gmail.com=2 example.org=1, by reason Connection timed out=2 451 4.7.1 Greylisted=1 | "+
+		"total=4;5;10 active=1;; deferred=2;;1 hold=1;0; oldest=172800s;3600;86400", message)
+
+	opts = testOptions()
+	opts.warn = -1
+	opts.crit = 3
+	level, message = evaluate(stats, &breakdown{Err: assert.AnError}, opts, now)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "; no deferred details: ")
+	assert.Contains(t, message, "total=4;;3 ")
+
+	level, message = evaluate([]postfix.QueueStats{{Name: "deferred"}}, nil, testOptions(), now)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "0 messages in the postfix mail queue (deferred=0) | total=0;5;10 deferred=0;; oldest=0s;;", message)
+}
+
+func TestCountLevel(t *testing.T) {
+	assert.Equal(t, "ok", countLevel(5, 5, 10))
+	assert.Equal(t, "warning", countLevel(6, 5, 10))
+	assert.Equal(t, "critical", countLevel(11, 5, 10))
+	assert.Equal(t, "critical", countLevel(1, -1, 0))
+	assert.Equal(t, "ok", countLevel(100, -1, -1))
+}
@@ -4,20 +4,27 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
-	"github.com/thomis/sensu-plugins-go/pkg/common"
 	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
+	"github.com/thomis/sensu-plugins-go/pkg/postgres"
 )
 
 func main() {
 	var (
-		connection common.Connection
-		query      string
-		queryFile  string
-		timeout    time.Duration
+		connection  postgres.Connection
+		query       string
+		queryFile   string
+		file        string
+		concurrency int
+		deadline    time.Duration
+		timeout     time.Duration
+		multiRow    bool
+		metrics     dbquery.MetricOptions
 	)
 
 	c := check.New("check-postgres-query")
@@ -27,9 +34,21 @@ func main() {
 	c.Option.StringVarP(&connection.User, "user", "u", "", "User")
 	c.Option.StringVarP(&connection.Password, "password", "p", "", "Password")
 	c.Option.StringVarP(&connection.Database, "database", "d", "test", "Database")
+	c.Option.StringVar(&connection.SSLMode, "sslmode", "disable", "SSL mode: "+strings.Join(postgres.SSLModes, ", "))
+	c.Option.StringVar(&connection.SSLRootCert, "sslrootcert", "", "CA certificate file to verify the server certificate")
+	c.Option.StringVar(&connection.SSLCert, "sslcert", "", "Client certificate file")
+	c.Option.StringVar(&connection.SSLKey, "sslkey", "", "Client private key file")
 	c.Option.StringVarP(&query, "query", "q", "", "Inline query returning two values: status (ok|warn|warning|error) and message")
 	c.Option.StringVar(&queryFile, "query-file", "", "File containing the query (alternative to -q)")
-	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout")
+	c.Option.StringVar(&metrics.Mode, "numeric", "", "Numeric mode: the query returns one row of numeric columns (columns) or label,value rows (rows) checked against --warn and --crit")
+	c.Option.Float64VarP(&metrics.Threshold.Warning, "warn", "w", 0, "Numeric mode: warning if a value reaches this threshold (0 disables)")
+	c.Option.Float64VarP(&metrics.Threshold.Critical, "crit", "c", 0, "Numeric mode: critical if a value reaches this threshold (0 disables)")
+	c.Option.BoolVar(&metrics.Below, "below", false, "Numeric mode: alert when a value falls below the thresholds instead")
+	c.Option.BoolVar(&multiRow, "multi-row", false, "Multi-row mode: every row is a result with the columns [label,] status, message")
+	c.Option.StringVarP(&file, "file", "f", "", "File with connections for batch mode. Line format: label,dsn")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of connections queried concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
 	c.Init()
 
 	// Resolving the query text is a configuration concern; failures here are
@@ -40,46 +59,68 @@ func main() {
 		return
 	}
 
-	status, message, err := runQuery(connection, stmt, timeout)
+	numeric := len(metrics.Mode) > 0
+	if numeric && multiRow {
+		c.Error(fmt.Errorf("provide either --numeric or --multi-row, not both"))
+		return
+	}
+	if numeric {
+		if err := dbquery.ValidateNumericMode(metrics.Mode); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	exec := execQuery
+	switch {
+	case multiRow:
+		exec = dbquery.ExecRows
+	case numeric:
+		exec = func(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+			return dbquery.ExecMetrics(ctx, db, stmt, metrics)
+		}
+	}
+
+	// Batch mode: run the same query against every connection in the file.
+	if len(file) > 0 {
+		connections, err := dbquery.ParseConnectionsFile(file)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		opts := dbquery.BatchOptions{Concurrency: concurrency, Timeout: timeout, Deadline: deadline}
+		status, output := dbquery.RunBatch(connections, opts, dbquery.DatabaseRunner("postgres", dbquery.BatchCheck(exec, stmt, numeric, multiRow)))
+		c.Report(status, output)
+		return
+	}
+
+	if err := postgres.ValidateSSLMode(connection.SSLMode); err != nil {
+		c.Error(err)
+		return
+	}
+	connection.ConnectTimeout = int(math.Ceil(timeout.Seconds()))
+
+	status, message, err := runQuery(connection, stmt, timeout, exec)
 	if err != nil {
 		c.Critical(err.Error())
 		return
 	}
 
-	// The query decides the outcome; an unrecognized status is treated as a
-	// usage/contract error (exit 3).
+	// The query (or the thresholds in numeric mode) decides the outcome; an
+	// unrecognized status is treated as a usage/contract error (exit 3).
 	status, err = dbquery.NormalizeStatus(status)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	report(c, status, message)
-}
-
-// report maps a normalized status (ok|warning|critical) to the matching check
-// result and exit code.
-func report(c *check.CheckStruct, status string, output string) {
-	switch status {
-	case "ok":
-		c.Ok(output)
-	case "warning":
-		c.Warning(output)
-	default:
-		c.Critical(output)
-	}
+	c.Report(status, message)
 }
 
-// runQuery connects to PostgreSQL and executes the statement.
-func runQuery(connection common.Connection, stmt string, timeout time.Duration) (string, string, error) {
-	source := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		connection.Host,
-		connection.Port,
-		connection.User,
-		connection.Password,
-		connection.Database)
-
-	db, err := sql.Open("postgres", source)
+// runQuery connects to PostgreSQL and executes the statement with exec.
+func runQuery(connection postgres.Connection, stmt string, timeout time.Duration,
+	exec func(ctx context.Context, db *sql.DB, stmt string) (string, string, error)) (string, string, error) {
+	db, err := sql.Open("postgres", postgres.DataSource(connection))
 	if err != nil {
 		return "", "", err
 	}
@@ -88,28 +129,13 @@ func runQuery(connection common.Connection, stmt string, timeout time.Duration)
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
-	return execQuery(ctx, db, stmt)
+	return exec(ctx, db, stmt)
 }
 
 // execQuery runs the statement against an open database handle. The statement is
-// expected to return a single row with two columns (status, message). It is
-// separated from connection handling so it can be tested with a mocked database.
+// expected to return a single row with two columns (status, message); a CALL of
+// a procedure with INOUT parameters returns them as such a row. It is separated
+// from connection handling so it can be tested with a mocked database.
 func execQuery(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
-	var (
-		status  string
-		message string
-	)
-
-	err := db.QueryRowContext(ctx, stmt).Scan(&status, &message)
-	if err != nil {
-		if ctx.Err() != nil {
-			return "", "", fmt.Errorf("timeout reached")
-		}
-		if err == sql.ErrNoRows {
-			return "", "", fmt.Errorf("query returned no rows (expected one row with two columns: status, message)")
-		}
-		return "", "", err
-	}
-
-	return status, message, nil
+	return dbquery.ExecQuery(ctx, db, stmt)
 }
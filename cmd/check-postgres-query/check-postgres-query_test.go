@@ -7,20 +7,8 @@ import (
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
-	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
-func TestReport(t *testing.T) {
-	cases := map[string]int{"ok": 0, "warning": 1, "critical": 2, "anything-else": 2}
-	for status, expected := range cases {
-		var got int
-		c := check.New("check-postgres-query")
-		c.ExitFn = func(code int) { got = code }
-		report(c, status, "msg")
-		assert.Equal(t, expected, got, "status %q", status)
-	}
-}
-
 func TestExecQuerySuccess(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.Nil(t, err)
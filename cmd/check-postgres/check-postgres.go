@@ -1,19 +1,57 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"math"
 	"regexp"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
-	"github.com/thomis/sensu-plugins-go/pkg/common"
+	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
+	"github.com/thomis/sensu-plugins-go/pkg/postgres"
 )
 
 var versionRe = regexp.MustCompile(`PostgreSQL ([0-9\.]+)`)
 
+// wraparoundLimit is the transaction ID age at which PostgreSQL stops
+// accepting writes to prevent wraparound.
+const wraparoundLimit = 1 << 31
+
+type options struct {
+	connections  check.Threshold
+	lagBytes     check.Threshold
+	lagSeconds   check.Threshold
+	transaction  check.Threshold
+	idle         check.Threshold
+	locks        check.Threshold
+	wraparound   check.Threshold
+	size         check.Threshold
+	deadTuples   check.Threshold
+	minTuples    int64
+	lagBytesWarn string
+	lagBytesCrit string
+	sizeWarn     string
+	sizeCrit     string
+}
+
+// replicationEnabled tells whether a replication lag threshold is set.
+func (o options) replicationEnabled() bool {
+	return o.lagBytes.Enabled() || o.lagSeconds.Enabled()
+}
+
 func main() {
-	var connection common.Connection
+	var (
+		connection  postgres.Connection
+		opts        options
+		file        string
+		concurrency int
+		deadline    time.Duration
+		timeout     time.Duration
+	)
 
 	c := check.New("CheckPostgres")
 	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "HOST")
@@ -21,43 +59,121 @@ func main() {
 	c.Option.StringVarP(&connection.User, "user", "u", "", "USER")
 	c.Option.StringVarP(&connection.Password, "password", "p", "", "PASSWORD")
 	c.Option.StringVarP(&connection.Database, "database", "d", "test", "DATABASE")
+	c.Option.StringVar(&connection.SSLMode, "sslmode", "disable", "SSL mode: "+strings.Join(postgres.SSLModes, ", "))
+	c.Option.StringVar(&connection.SSLRootCert, "sslrootcert", "", "CA certificate file to verify the server certificate")
+	c.Option.StringVar(&connection.SSLCert, "sslcert", "", "Client certificate file")
+	c.Option.StringVar(&connection.SSLKey, "sslkey", "", "Client private key file")
+	c.Option.StringVarP(&file, "file", "f", "", "File with connections for batch mode. Line format: label,dsn")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of servers checked concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
+	c.Option.Float64Var(&opts.connections.Warning, "connections-warn", 0, "Warning if at least this % of max_connections is used (0 disables)")
+	c.Option.Float64Var(&opts.connections.Critical, "connections-crit", 0, "Critical if at least this % of max_connections is used (0 disables)")
+	c.Option.StringVar(&opts.lagBytesWarn, "lag-bytes-warn", "", "Warning if the replication lag is at least this size, e.g. 16M (empty disables)")
+	c.Option.StringVar(&opts.lagBytesCrit, "lag-bytes-crit", "", "Critical if the replication lag is at least this size, e.g. 1G (empty disables)")
+	c.Option.Float64Var(&opts.lagSeconds.Warning, "lag-seconds-warn", 0, "Warning if the replication lag is at least this many seconds (0 disables)")
+	c.Option.Float64Var(&opts.lagSeconds.Critical, "lag-seconds-crit", 0, "Critical if the replication lag is at least this many seconds (0 disables)")
+	c.Option.Float64Var(&opts.transaction.Warning, "transaction-warn", 0, "Warning if a transaction runs for at least this many seconds (0 disables)")
+	c.Option.Float64Var(&opts.transaction.Critical, "transaction-crit", 0, "Critical if a transaction runs for at least this many seconds (0 disables)")
+	c.Option.Float64Var(&opts.idle.Warning, "idle-warn", 0, "Warning if at least this many sessions are idle in transaction (0 disables)")
+	c.Option.Float64Var(&opts.idle.Critical, "idle-crit", 0, "Critical if at least this many sessions are idle in transaction (0 disables)")
+	c.Option.Float64Var(&opts.locks.Warning, "locks-warn", 0, "Warning if at least this many sessions wait for a lock (0 disables)")
+	c.Option.Float64Var(&opts.locks.Critical, "locks-crit", 0, "Critical if at least this many sessions wait for a lock (0 disables)")
+	c.Option.Float64Var(&opts.wraparound.Warning, "wraparound-warn", 0, "Warning if the oldest transaction ID reached this % of the wraparound limit (0 disables)")
+	c.Option.Float64Var(&opts.wraparound.Critical, "wraparound-crit", 0, "Critical if the oldest transaction ID reached this % of the wraparound limit (0 disables)")
+	c.Option.StringVar(&opts.sizeWarn, "size-warn", "", "Warning if the database is at least this size, e.g. 100G (empty disables)")
+	c.Option.StringVar(&opts.sizeCrit, "size-crit", "", "Critical if the database is at least this size, e.g. 500G (empty disables)")
+	c.Option.Float64Var(&opts.deadTuples.Warning, "dead-tuples-warn", 0, "Warning if a table has at least this % of dead tuples (0 disables)")
+	c.Option.Float64Var(&opts.deadTuples.Critical, "dead-tuples-crit", 0, "Critical if a table has at least this % of dead tuples (0 disables)")
+	c.Option.Int64Var(&opts.minTuples, "dead-tuples-min", 10000, "Only consider tables with at least this many tuples for the dead tuple ratio")
 	c.Init()
 
-	version, err := selectVersion(connection)
+	if err := parseOptions(&opts); err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Batch mode: apply the same thresholds to every server in the file.
+	if len(file) > 0 {
+		connections, err := dbquery.ParseConnectionsFile(file)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		batch := dbquery.BatchOptions{Concurrency: concurrency, Timeout: timeout, Deadline: deadline}
+		level, output := dbquery.RunBatch(connections, batch, dbquery.DatabaseRunner("postgres",
+			func(ctx context.Context, db *sql.DB) (string, string, error) {
+				s, err := collect(ctx, db, opts)
+				if err != nil {
+					return "", "", err
+				}
+				level, message := evaluate(s, opts)
+				details, _, _ := strings.Cut(message, " | ")
+				return level, details, nil
+			}))
+		c.Report(level, output)
+		return
+	}
+
+	if err := postgres.ValidateSSLMode(connection.SSLMode); err != nil {
+		c.Error(err)
+		return
+	}
+	connection.ConnectTimeout = int(math.Ceil(timeout.Seconds()))
+
+	s, err := collectStats(connection, timeout, opts)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	c.Ok(fmt.Sprint("Server version ", version))
+	level, message := evaluate(s, opts)
+	c.Report(level, message)
 }
 
-func selectVersion(connection common.Connection) (string, error) {
-	db, err := sql.Open("postgres", buildSource(connection))
+// parseOptions parses the size thresholds.
+func parseOptions(opts *options) error {
+	sizes := []struct {
+		value  string
+		target *float64
+	}{
+		{opts.lagBytesWarn, &opts.lagBytes.Warning},
+		{opts.lagBytesCrit, &opts.lagBytes.Critical},
+		{opts.sizeWarn, &opts.size.Warning},
+		{opts.sizeCrit, &opts.size.Critical},
+	}
+	for _, s := range sizes {
+		size, err := check.ParseBytes(s.value)
+		if err != nil {
+			return err
+		}
+		*s.target = float64(size)
+	}
+	return nil
+}
+
+func collectStats(connection postgres.Connection, timeout time.Duration, opts options) (stats, error) {
+	db, err := sql.Open("postgres", postgres.DataSource(connection))
 	if err != nil {
-		return "", err
+		return stats{}, err
 	}
 	defer db.Close()
 
-	return queryVersion(db)
-}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
 
-// buildSource assembles the lib/pq connection string from the connection
-// parameters.
-func buildSource(connection common.Connection) string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		connection.Host,
-		connection.Port,
-		connection.User,
-		connection.Password,
-		connection.Database)
+	s, err := collect(ctx, db, opts)
+	if err != nil && ctx.Err() != nil {
+		return s, fmt.Errorf("timeout reached")
+	}
+	return s, err
 }
 
 // queryVersion reads the server version from an open database handle. It is
 // separated from connection handling so it can be tested with a mocked database.
-func queryVersion(db *sql.DB) (string, error) {
+func queryVersion(ctx context.Context, db *sql.DB) (string, error) {
 	var info string
-	if err := db.QueryRow("select version()").Scan(&info); err != nil {
+	if err := db.QueryRowContext(ctx, "select version()").Scan(&info); err != nil {
 		return "", err
 	}
 
@@ -73,3 +189,86 @@ func parseVersion(info string) (string, error) {
 
 	return matches[1], nil
 }
+
+// evaluate applies the enabled thresholds to the collected values. The
+// output lists the version and the values of the enabled thresholds only, as
+// collect runs no other queries.
+func evaluate(s stats, opts options) (string, string) {
+	summary := []string{"Server version " + s.Version}
+	levels := []string{}
+	problems := []string{}
+	perfs := []string{}
+	apply := func(threshold check.Threshold, value float64, problem string, perf string) {
+		if !threshold.Enabled() {
+			return
+		}
+		level := threshold.Level(value)
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, fmt.Sprintf("%s, %s", problem, level))
+		}
+		perfs = append(perfs, perf)
+	}
+
+	if opts.replicationEnabled() {
+		role := "primary"
+		if s.Standby {
+			role = "standby"
+		} else if s.Replication.Replicas > 0 {
+			role = fmt.Sprintf("primary with %d standbys", s.Replication.Replicas)
+		}
+		summary = append(summary, role)
+	}
+
+	if opts.connections.Enabled() {
+		summary = append(summary, fmt.Sprintf("%d of %d connections", s.Connections, s.MaxConnections))
+		perfs = append(perfs, fmt.Sprintf("pg_connections=%d;;;0;%d", s.Connections, s.MaxConnections))
+	}
+	connections := 0.0
+	if s.MaxConnections > 0 {
+		connections = float64(s.Connections) / float64(s.MaxConnections) * 100
+	}
+	apply(opts.connections, connections, fmt.Sprintf("%.1f%% of max_connections used", connections),
+		fmt.Sprintf("pg_connections_used=%.1f%%;%s;0;100", connections, opts.connections.Perf()))
+
+	if s.Standby || s.Replication.Replicas > 0 {
+		apply(opts.lagBytes, s.Replication.LagBytes, fmt.Sprintf("replication lag %s", check.FormatBytes(uint64(s.Replication.LagBytes))),
+			fmt.Sprintf("pg_replication_lag_bytes=%.0fB;%s;0;", s.Replication.LagBytes, opts.lagBytes.Perf()))
+		apply(opts.lagSeconds, s.Replication.LagSeconds, fmt.Sprintf("replication lag %s", formatSeconds(s.Replication.LagSeconds)),
+			fmt.Sprintf("pg_replication_lag_seconds=%.1fs;%s;0;", s.Replication.LagSeconds, opts.lagSeconds.Perf()))
+	}
+
+	apply(opts.transaction, s.LongestXact, fmt.Sprintf("transaction running for %s", formatSeconds(s.LongestXact)),
+		fmt.Sprintf("pg_longest_transaction=%.1fs;%s;0;", s.LongestXact, opts.transaction.Perf()))
+	apply(opts.idle, float64(s.IdleInXact), fmt.Sprintf("%d sessions idle in transaction (longest %s)", s.IdleInXact, formatSeconds(s.LongestIdle)),
+		fmt.Sprintf("pg_idle_in_transaction=%d;%s;0;", s.IdleInXact, opts.idle.Perf()))
+	apply(opts.locks, float64(s.BlockedLocks), fmt.Sprintf("%d sessions waiting for locks", s.BlockedLocks),
+		fmt.Sprintf("pg_blocked_locks=%d;%s;0;", s.BlockedLocks, opts.locks.Perf()))
+
+	wraparound := float64(s.Wraparound.Age) / wraparoundLimit * 100
+	apply(opts.wraparound, wraparound, fmt.Sprintf("database %s at %.1f%% of transaction ID wraparound", s.Wraparound.Database, wraparound),
+		fmt.Sprintf("pg_wraparound=%.1f%%;%s;0;100", wraparound, opts.wraparound.Perf()))
+
+	if opts.size.Enabled() {
+		summary = append(summary, "database "+check.FormatBytes(uint64(s.DatabaseSize)))
+	}
+	apply(opts.size, float64(s.DatabaseSize), fmt.Sprintf("database size %s", check.FormatBytes(uint64(s.DatabaseSize))),
+		fmt.Sprintf("pg_database_size=%dB;%s;0;", s.DatabaseSize, opts.size.Perf()))
+	apply(opts.deadTuples, s.DeadTuples.Percent, fmt.Sprintf("table %s has %.1f%% dead tuples", s.DeadTuples.Table, s.DeadTuples.Percent),
+		fmt.Sprintf("pg_dead_tuples=%.1f%%;%s;0;100", s.DeadTuples.Percent, opts.deadTuples.Perf()))
+
+	output := strings.Join(summary, ", ")
+	if len(problems) > 0 {
+		output += ": " + strings.Join(problems, ", ")
+	}
+	if len(perfs) > 0 {
+		output += " | " + strings.Join(perfs, " ")
+	}
+
+	return check.WorstLevel(levels...), output
+}
+
+// formatSeconds renders seconds as a short duration, e.g. "1h2m3s".
+func formatSeconds(seconds float64) string {
+	return (time.Duration(seconds) * time.Second).String()
+}
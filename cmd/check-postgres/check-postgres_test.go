@@ -1,50 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/stretchr/testify/assert"
-	"github.com/thomis/sensu-plugins-go/pkg/common"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
-func TestBuildSource(t *testing.T) {
-	tests := []struct {
-		name       string
-		connection common.Connection
-		expected   string
-	}{
-		{
-			name: "Standard connection",
-			connection: common.Connection{
-				Host: "localhost", Port: 5432, User: "testuser", Password: "testpass", Database: "testdb",
-			},
-			expected: "host=localhost port=5432 user=testuser password=testpass dbname=testdb sslmode=disable",
-		},
-		{
-			name: "Connection with special characters",
-			connection: common.Connection{
-				Host: "db.example.com", Port: 5433, User: "user@domain", Password: "p@ss!word", Database: "my-db",
-			},
-			expected: "host=db.example.com port=5433 user=user@domain password=p@ss!word dbname=my-db sslmode=disable",
-		},
-		{
-			name: "Connection with empty password",
-			connection: common.Connection{
-				Host: "localhost", Port: 5432, User: "postgres", Password: "", Database: "postgres",
-			},
-			expected: "host=localhost port=5432 user=postgres password= dbname=postgres sslmode=disable",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			assert.Equal(t, tt.expected, buildSource(tt.connection))
-		})
-	}
-}
-
 func TestParseVersion(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -81,7 +47,7 @@ func TestQueryVersionSuccess(t *testing.T) {
 		AddRow("PostgreSQL 13.1 on x86_64-pc-linux-gnu, compiled by gcc")
 	mock.ExpectQuery("select version").WillReturnRows(rows)
 
-	version, err := queryVersion(db)
+	version, err := queryVersion(context.Background(), db)
 	assert.Nil(t, err)
 	assert.Equal(t, "13.1", version)
 	assert.Nil(t, mock.ExpectationsWereMet())
@@ -94,7 +60,7 @@ func TestQueryVersionQueryError(t *testing.T) {
 
 	mock.ExpectQuery("select version").WillReturnError(fmt.Errorf("connection refused"))
 
-	_, err = queryVersion(db)
+	_, err = queryVersion(context.Background(), db)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "connection refused")
 }
@@ -107,7 +73,171 @@ func TestQueryVersionUnparseable(t *testing.T) {
 	rows := sqlmock.NewRows([]string{"version"}).AddRow("Some other database 1.2.3")
 	mock.ExpectQuery("select version").WillReturnRows(rows)
 
-	_, err = queryVersion(db)
+	_, err = queryVersion(context.Background(), db)
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "could not parse")
 }
+
+// allThresholds enables every threshold, so collect runs every health query.
+func allThresholds() options {
+	high := check.Threshold{Warning: 1e12, Critical: 1e13}
+	return options{
+		connections: high, lagBytes: high, lagSeconds: high, transaction: high, idle: high,
+		locks: high, wraparound: high, size: high, deadTuples: high, minTuples: 10000,
+	}
+}
+
+// expectStats sets up the health queries of a primary with two standbys.
+func expectStats(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("select version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("PostgreSQL 16.2 on x86_64-pc-linux-gnu"))
+	mock.ExpectQuery("current_setting\\('max_connections'\\)").WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(42, 100))
+	mock.ExpectQuery("pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"recovery"}).AddRow(false))
+	mock.ExpectQuery("from pg_stat_replication").WillReturnRows(sqlmock.NewRows([]string{"count", "bytes", "seconds"}).AddRow(2, 33554432.0, 4.5))
+	mock.ExpectQuery("now\\(\\) - xact_start").WillReturnRows(sqlmock.NewRows([]string{"seconds"}).AddRow(75.2))
+	mock.ExpectQuery("state in \\('idle in transaction'").WillReturnRows(sqlmock.NewRows([]string{"count", "seconds"}).AddRow(3, 620.0))
+	mock.ExpectQuery("from pg_locks where not granted").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+	mock.ExpectQuery("age\\(datfrozenxid\\)").WillReturnRows(sqlmock.NewRows([]string{"datname", "age"}).AddRow("orders", 429496729))
+	mock.ExpectQuery("pg_database_size").WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(1610612736))
+	mock.ExpectQuery("nullif\\(n_live_tup \\+ n_dead_tup, 0\\)").WithArgs(10000).WillReturnRows(sqlmock.NewRows([]string{"table", "dead", "live"}).AddRow("public.events", 25000, 75000))
+}
+
+func TestCollectPrimary(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+	expectStats(mock)
+
+	s, err := collect(context.Background(), db, allThresholds())
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.Equal(t, primary(), s)
+}
+
+func TestCollectStandby(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("PostgreSQL 16.2 on x86_64-pc-linux-gnu"))
+	mock.ExpectQuery("max_connections").WillReturnRows(sqlmock.NewRows([]string{"count", "max"}).AddRow(5, 100))
+	mock.ExpectQuery("pg_is_in_recovery").WillReturnRows(sqlmock.NewRows([]string{"recovery"}).AddRow(true))
+	mock.ExpectQuery("pg_last_wal_receive_lsn").WillReturnRows(sqlmock.NewRows([]string{"bytes", "seconds"}).AddRow(1024.0, 12.0))
+	mock.ExpectQuery("xact_start").WillReturnRows(sqlmock.NewRows([]string{"seconds"}).AddRow(0.0))
+	mock.ExpectQuery("idle in transaction").WillReturnRows(sqlmock.NewRows([]string{"count", "seconds"}).AddRow(0, 0.0))
+	mock.ExpectQuery("pg_locks").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+	mock.ExpectQuery("datfrozenxid").WillReturnRows(sqlmock.NewRows([]string{"datname", "age"}).AddRow("postgres", 1000))
+	mock.ExpectQuery("pg_database_size").WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(8000000))
+	mock.ExpectQuery("pg_stat_user_tables").WillReturnRows(sqlmock.NewRows([]string{"table", "dead", "live"}))
+
+	s, err := collect(context.Background(), db, allThresholds())
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet())
+	assert.True(t, s.Standby)
+	assert.Equal(t, replication{LagBytes: 1024, LagSeconds: 12}, s.Replication)
+	assert.Equal(t, deadTuples{}, s.DeadTuples)
+}
+
+func TestCollectEnabledOnly(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	// Without thresholds only the version is read, as on servers before 10.
+	mock.ExpectQuery("select version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("PostgreSQL 9.6.24 on x86_64-pc-linux-gnu"))
+	s, err := collect(context.Background(), db, options{})
+	assert.NoError(t, err)
+	assert.Equal(t, stats{Version: "9.6.24"}, s)
+
+	mock.ExpectQuery("select version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("PostgreSQL 16.2"))
+	mock.ExpectQuery("pg_locks").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectQuery("pg_database_size").WillReturnRows(sqlmock.NewRows([]string{"size"}).AddRow(8000000))
+	s, err = collect(context.Background(), db, options{locks: check.Threshold{Warning: 5}, size: check.Threshold{Critical: 1e9}})
+	assert.NoError(t, err)
+	assert.Equal(t, stats{Version: "16.2", BlockedLocks: 4, DatabaseSize: 8000000}, s)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCollectError(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select version").WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow("PostgreSQL 16.2"))
+	mock.ExpectQuery("max_connections").WillReturnError(fmt.Errorf("permission denied"))
+
+	_, err = collect(context.Background(), db, allThresholds())
+	assert.EqualError(t, err, "permission denied")
+}
+
+func primary() stats {
+	return stats{
+		Version:        "16.2",
+		Connections:    42,
+		MaxConnections: 100,
+		Replication:    replication{Replicas: 2, LagBytes: 33554432, LagSeconds: 4.5},
+		LongestXact:    75.2,
+		IdleInXact:     3,
+		LongestIdle:    620,
+		BlockedLocks:   1,
+		Wraparound:     wraparound{Database: "orders", Age: 429496729},
+		DatabaseSize:   1610612736,
+		DeadTuples:     deadTuples{Table: "public.events", Dead: 25000, Live: 75000, Percent: 25},
+	}
+}
+
+func TestEvaluateDefaults(t *testing.T) {
+	level, message := evaluate(stats{Version: "16.2"}, options{})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Server version 16.2", message)
+
+	level, message = evaluate(primary(), allThresholds())
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Server version 16.2, primary with 2 standbys, 42 of 100 connections, database 1.50GiB | pg_connections=42;;;0;100 "+
+		"pg_connections_used=42.0%;1000000000000;10000000000000;0;100 pg_replication_lag_bytes=33554432B;1000000000000;10000000000000;0; "+
+		"pg_replication_lag_seconds=4.5s;1000000000000;10000000000000;0; pg_longest_transaction=75.2s;1000000000000;10000000000000;0; "+
+		"pg_idle_in_transaction=3;1000000000000;10000000000000;0; pg_blocked_locks=1;1000000000000;10000000000000;0; "+
+		"pg_wraparound=20.0%;1000000000000;10000000000000;0;100 pg_database_size=1610612736B;1000000000000;10000000000000;0; "+
+		"pg_dead_tuples=25.0%;1000000000000;10000000000000;0;100", message)
+
+	opts := options{lagSeconds: check.Threshold{Warning: 30}}
+	s := primary()
+	s.Replication = replication{}
+	_, message = evaluate(s, opts)
+	assert.Equal(t, "Server version 16.2, primary", message)
+
+	s.Standby = true
+	_, message = evaluate(s, opts)
+	assert.Equal(t, "Server version 16.2, standby | pg_replication_lag_seconds=0.0s;30;;0;", message)
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	opts := options{lagBytesWarn: "16M", lagBytesCrit: "1G", sizeWarn: "1G", sizeCrit: "2G"}
+	require.NoError(t, parseOptions(&opts))
+	opts.connections = check.Threshold{Warning: 80, Critical: 90}
+	opts.lagSeconds = check.Threshold{Warning: 30}
+	opts.transaction = check.Threshold{Warning: 60, Critical: 600}
+	opts.idle = check.Threshold{Warning: 5}
+	opts.locks = check.Threshold{Warning: 5}
+	opts.wraparound = check.Threshold{Warning: 50, Critical: 75}
+	opts.deadTuples = check.Threshold{Warning: 20, Critical: 50}
+
+	level, message := evaluate(primary(), opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, ": replication lag 32.00MiB, warning, transaction running for 1m15s, warning, database size 1.50GiB, warning, table public.events has 25.0% dead tuples, warning |")
+	assert.Contains(t, message, "pg_replication_lag_bytes=33554432B;16777216;1073741824;0;")
+	assert.Contains(t, message, "pg_database_size=1610612736B;1073741824;2147483648;0;")
+
+	s := primary()
+	s.Connections = 95
+	s.BlockedLocks = 12
+	s.IdleInXact = 7
+	s.Wraparound.Age = 1700000000
+	level, message = evaluate(s, opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "95.0% of max_connections used, critical")
+	assert.Contains(t, message, "12 sessions waiting for locks, warning")
+	assert.Contains(t, message, "7 sessions idle in transaction (longest 10m20s), warning")
+	assert.Contains(t, message, "database orders at 79.2% of transaction ID wraparound, critical")
+
+	assert.Error(t, parseOptions(&options{sizeWarn: "lots"}))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+)
+
+// stats are the values the health checks look at.
+type stats struct {
+	Version        string
+	Connections    int
+	MaxConnections int
+	Standby        bool
+	Replication    replication
+	LongestXact    float64
+	IdleInXact     int
+	LongestIdle    float64
+	BlockedLocks   int
+	Wraparound     wraparound
+	DatabaseSize   int64
+	DeadTuples     deadTuples
+}
+
+// replication is the lag of a standby behind its primary, or the largest
+// lag of the standbys of a primary. Replicas counts the standbys streaming
+// from a primary.
+type replication struct {
+	Replicas   int
+	LagBytes   float64
+	LagSeconds float64
+}
+
+// wraparound is the database with the oldest transaction ID.
+type wraparound struct {
+	Database string
+	Age      int64
+}
+
+// deadTuples is the table with the highest share of dead tuples.
+type deadTuples struct {
+	Table   string
+	Dead    int64
+	Live    int64
+	Percent float64
+}
+
+const (
+	connectionsQuery = `select (select count(*) from pg_stat_activity where backend_type = 'client backend'), current_setting('max_connections')::int`
+	recoveryQuery    = `select pg_is_in_recovery()`
+	standbyQuery     = `select coalesce(pg_wal_lsn_diff(pg_last_wal_receive_lsn(), pg_last_wal_replay_lsn()), 0),
+		case when pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() then 0
+		else coalesce(extract(epoch from now() - pg_last_xact_replay_timestamp()), 0) end`
+	primaryQuery = `select count(*), coalesce(max(pg_wal_lsn_diff(pg_current_wal_lsn(), replay_lsn)), 0),
+		coalesce(max(extract(epoch from replay_lag)), 0) from pg_stat_replication`
+	transactionsQuery = `select coalesce(max(extract(epoch from now() - xact_start)), 0) from pg_stat_activity
+		where backend_type = 'client backend' and state not in ('idle', 'idle in transaction', 'idle in transaction (aborted)') and xact_start is not null`
+	idleQuery = `select count(*), coalesce(max(extract(epoch from now() - state_change)), 0) from pg_stat_activity
+		where state in ('idle in transaction', 'idle in transaction (aborted)')`
+	locksQuery      = `select count(distinct pid) from pg_locks where not granted`
+	wraparoundQuery = `select datname, age(datfrozenxid) from pg_database order by 2 desc limit 1`
+	sizeQuery       = `select pg_database_size(current_database())`
+	deadTuplesQuery = `select schemaname || '.' || relname, n_dead_tup, n_live_tup from pg_stat_user_tables
+		where n_live_tup + n_dead_tup >= $1 order by n_dead_tup::float / nullif(n_live_tup + n_dead_tup, 0) desc nulls last limit 1`
+)
+
+// collect reads the server version and runs the health queries of the
+// enabled thresholds only, so a plain connectivity check works with any
+// server version.
+func collect(ctx context.Context, db *sql.DB, opts options) (stats, error) {
+	var s stats
+	var err error
+
+	if s.Version, err = queryVersion(ctx, db); err != nil {
+		return s, err
+	}
+
+	queries := []struct {
+		enabled bool
+		run     func() error
+	}{
+		{opts.connections.Enabled(), func() error {
+			return db.QueryRowContext(ctx, connectionsQuery).Scan(&s.Connections, &s.MaxConnections)
+		}},
+		{opts.replicationEnabled(), func() error {
+			if err := db.QueryRowContext(ctx, recoveryQuery).Scan(&s.Standby); err != nil {
+				return err
+			}
+			if s.Standby {
+				return db.QueryRowContext(ctx, standbyQuery).Scan(&s.Replication.LagBytes, &s.Replication.LagSeconds)
+			}
+			return db.QueryRowContext(ctx, primaryQuery).Scan(&s.Replication.Replicas, &s.Replication.LagBytes, &s.Replication.LagSeconds)
+		}},
+		{opts.transaction.Enabled(), func() error {
+			return db.QueryRowContext(ctx, transactionsQuery).Scan(&s.LongestXact)
+		}},
+		{opts.idle.Enabled(), func() error {
+			return db.QueryRowContext(ctx, idleQuery).Scan(&s.IdleInXact, &s.LongestIdle)
+		}},
+		{opts.locks.Enabled(), func() error {
+			return db.QueryRowContext(ctx, locksQuery).Scan(&s.BlockedLocks)
+		}},
+		{opts.wraparound.Enabled(), func() error {
+			return db.QueryRowContext(ctx, wraparoundQuery).Scan(&s.Wraparound.Database, &s.Wraparound.Age)
+		}},
+		{opts.size.Enabled(), func() error {
+			return db.QueryRowContext(ctx, sizeQuery).Scan(&s.DatabaseSize)
+		}},
+		{opts.deadTuples.Enabled(), func() error {
+			err := db.QueryRowContext(ctx, deadTuplesQuery, opts.minTuples).Scan(&s.DeadTuples.Table, &s.DeadTuples.Dead, &s.DeadTuples.Live)
+			switch {
+			case err == sql.ErrNoRows:
+				return nil
+			case err == nil && s.DeadTuples.Dead+s.DeadTuples.Live > 0:
+				s.DeadTuples.Percent = float64(s.DeadTuples.Dead) / float64(s.DeadTuples.Dead+s.DeadTuples.Live) * 100
+			}
+			return err
+		}},
+	}
+	for _, q := range queries {
+		if !q.enabled {
+			continue
+		}
+		if err = q.run(); err != nil {
+			return s, err
+		}
+	}
+	return s, nil
+}
@@ -2,73 +2,179 @@ package main
 
 import (
 	"fmt"
-	"os"
-	"regexp"
+	"strings"
 
-	"github.com/shirou/gopsutil/v4/process"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
+// options holds the thresholds on the matched processes. Resource thresholds
+// of zero are disabled.
+type options struct {
+	count     check.Range
+	zombies   check.Threshold
+	cpu       check.Threshold
+	rss       check.Threshold
+	fds       check.Threshold
+	threads   check.Threshold
+	age       check.Threshold
+	aggregate bool
+}
+
 func main() {
-	var pattern string
+	var (
+		pattern string
+		users   string
+		exe     string
+		ppid    int
+		sleep   int
+		opts    options
+	)
 
 	c := check.New("CheckProcess")
-	c.Option.StringVarP(&pattern, "regexp_pattern", "p", "a_process_name", "PATTERN")
+	c.Option.StringVarP(&pattern, "regexp_pattern", "p", "", "PATTERN matched against the command line")
+	c.Option.StringVarP(&users, "user", "u", "", "Only processes of these users (comma-separated)")
+	c.Option.StringVarP(&exe, "exe", "e", "", "Only processes with exactly this executable name")
+	c.Option.IntVar(&ppid, "ppid", 0, "Only children of this parent PID")
+	c.Option.IntVar(&opts.count.WarnMin, "warn-min", 0, "Warning if fewer processes match (0 disables)")
+	c.Option.IntVar(&opts.count.WarnMax, "warn-max", -1, "Warning if more processes match (-1 disables)")
+	c.Option.IntVar(&opts.count.CritMin, "crit-min", 1, "Critical if fewer processes match (0 disables)")
+	c.Option.IntVar(&opts.count.CritMax, "crit-max", -1, "Critical if more processes match (-1 disables)")
+	c.Option.Float64Var(&opts.zombies.Warning, "zombie-warn", 0, "Warning threshold for matching zombie processes (0 disables)")
+	c.Option.Float64Var(&opts.zombies.Critical, "zombie-crit", 0, "Critical threshold for matching zombie processes (0 disables)")
+	c.Option.Float64Var(&opts.cpu.Warning, "cpu-warn", 0, "Warning threshold for CPU % (0 disables)")
+	c.Option.Float64Var(&opts.cpu.Critical, "cpu-crit", 0, "Critical threshold for CPU % (0 disables)")
+	c.Option.Float64Var(&opts.rss.Warning, "rss-warn", 0, "Warning threshold for resident memory in MB (0 disables)")
+	c.Option.Float64Var(&opts.rss.Critical, "rss-crit", 0, "Critical threshold for resident memory in MB (0 disables)")
+	c.Option.Float64Var(&opts.fds.Warning, "fds-warn", 0, "Warning threshold for open file descriptors (0 disables)")
+	c.Option.Float64Var(&opts.fds.Critical, "fds-crit", 0, "Critical threshold for open file descriptors (0 disables)")
+	c.Option.Float64Var(&opts.threads.Warning, "threads-warn", 0, "Warning threshold for threads (0 disables)")
+	c.Option.Float64Var(&opts.threads.Critical, "threads-crit", 0, "Critical threshold for threads (0 disables)")
+	c.Option.Float64Var(&opts.age.Warning, "age-warn", 0, "Warning threshold for process age in seconds (0 disables)")
+	c.Option.Float64Var(&opts.age.Critical, "age-crit", 0, "Critical threshold for process age in seconds (0 disables)")
+	c.Option.BoolVarP(&opts.aggregate, "aggregate", "a", false, "Apply the resource thresholds to the sum over all matches instead of every process")
+	c.Option.IntVarP(&sleep, "sleep", "s", 1, "Sleep time for sampling CPU usage")
 	c.Init()
 
-	count, err := countProcess(pattern)
+	f, err := newFilter(pattern, users, exe, ppid)
 	if err != nil {
 		c.Error(err)
 		return
 	}
 
-	level, message := describe(pattern, count)
-	report(c, level, message)
-}
-
-// report maps a level (ok|critical) to the matching check result.
-func report(c *check.CheckStruct, level string, message string) {
-	switch level {
-	case "critical":
-		c.Critical(message)
-	default:
-		c.Ok(message)
+	processes, err := findProcesses(f, opts.cpu.Enabled(), sleep)
+	if err != nil {
+		c.Error(err)
+		return
 	}
+
+	level, message := evaluate(processes, f.String(), opts)
+	c.Report(level, message)
 }
 
 // describe turns a match count into a level and message.
-func describe(pattern string, count int) (string, string) {
-	if count == 0 {
-		return "critical", fmt.Sprintf("Unable to find process [%s]", pattern)
+func describe(pattern string, count int, r check.Range) (string, string) {
+	level := r.Level(count)
+	switch {
+	case count == 0 && level != "ok":
+		return level, fmt.Sprintf("Unable to find process [%s]", pattern)
+	case level != "ok":
+		return level, fmt.Sprintf("Process [%s]: %d occurence(s), expected %s", pattern, count, r.Expected(level))
 	}
 	return "ok", fmt.Sprintf("Process [%s]: %d occurence(s)", pattern, count)
 }
 
-func countProcess(pattern string) (int, error) {
-	count := 0
+// resource is one thresholded per-process value.
+type resource struct {
+	name      string
+	unit      string
+	format    string
+	threshold check.Threshold
+	value     func(procInfo) (float64, bool)
+	// useMax aggregates the maximum instead of the sum
+	useMax bool
+}
 
-	re, err := regexp.Compile(pattern)
-	if err != nil {
-		return count, err
+func resources(opts options) []resource {
+	return []resource{
+		{"cpu", "%", "%.1f", opts.cpu, func(p procInfo) (float64, bool) { return p.CPU, true }, false},
+		{"rss", "MB", "%.1f", opts.rss, func(p procInfo) (float64, bool) { return p.RSS, true }, false},
+		{"fds", "", "%.0f", opts.fds, func(p procInfo) (float64, bool) { return float64(p.FDs), p.FDs >= 0 }, false},
+		{"threads", "", "%.0f", opts.threads, func(p procInfo) (float64, bool) { return float64(p.Threads), true }, false},
+		{"age", "s", "%.0f", opts.age, func(p procInfo) (float64, bool) { return p.Age, true }, true},
 	}
+}
 
-	processes, err := process.Processes()
-	if err != nil {
-		return count, err
+// evaluate checks the process count, the zombies among the matches and the
+// resource thresholds of the running processes. The overall level is the worst
+// of all checks.
+func evaluate(processes []procInfo, pattern string, opts options) (string, string) {
+	running := []procInfo{}
+	zombies := 0
+	for _, p := range processes {
+		if p.Zombie {
+			zombies++
+			continue
+		}
+		running = append(running, p)
 	}
 
-	pid := os.Getpid()
+	level, output := describe(pattern, len(running), opts.count)
+	levels := []string{level}
+	outputs := []string{output}
+	perfs := []string{
+		fmt.Sprintf("processes=%d;%s", len(running), opts.count.Perf()),
+		fmt.Sprintf("zombies=%d;%s", zombies, opts.zombies.Perf()),
+	}
 
-	for _, process := range processes {
-		if int32(pid) == process.Pid {
-			continue
+	if opts.zombies.Enabled() {
+		level := opts.zombies.Level(float64(zombies))
+		levels = append(levels, level)
+		if level != "ok" {
+			outputs = append(outputs, fmt.Sprintf("%d zombie(s) exceeds %s", zombies, level))
 		}
-		cmdLine, _ := process.Cmdline()
-		if re.Match([]byte(cmdLine)) {
-			fmt.Printf(" - (%d) %s\n", process.Pid, cmdLine)
-			count += 1
+	}
+
+	for _, r := range resources(opts) {
+		total, known := 0.0, false
+		for _, p := range running {
+			value, ok := r.value(p)
+			if !ok {
+				continue
+			}
+			known = true
+			if r.useMax {
+				total = max(total, value)
+			} else {
+				total += value
+			}
+
+			if !opts.aggregate && r.threshold.Enabled() {
+				level := r.threshold.Level(value)
+				levels = append(levels, level)
+				if level != "ok" {
+					outputs = append(outputs, fmt.Sprintf("pid %d (%s) %s=%s%s exceeds %s", p.PID, p.Name, r.name, fmt.Sprintf(r.format, value), r.unit, level))
+				}
+			}
+		}
+
+		if opts.aggregate && r.threshold.Enabled() && known {
+			level := r.threshold.Level(total)
+			levels = append(levels, level)
+			if level != "ok" {
+				outputs = append(outputs, fmt.Sprintf("total %s=%s%s exceeds %s", r.name, fmt.Sprintf(r.format, total), r.unit, level))
+			}
+		}
+
+		// CPU usage is only sampled with CPU thresholds
+		if known && (r.name != "cpu" || r.threshold.Enabled()) {
+			limits := ";"
+			if opts.aggregate {
+				limits = r.threshold.Perf()
+			}
+			perfs = append(perfs, fmt.Sprintf("%s=%s%s;%s", r.name, fmt.Sprintf(r.format, total), r.unit, limits))
 		}
 	}
 
-	return count, nil
+	message := fmt.Sprintf("%s | %s", strings.Join(outputs, " "), strings.Join(perfs, " "))
+	return check.WorstLevel(levels...), message
 }
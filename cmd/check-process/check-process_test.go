@@ -1,42 +1,141 @@
 package main
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
-func TestCountProcessInvalidPattern(t *testing.T) {
-	_, err := countProcess("[invalid(")
+var defaultRange = check.Range{WarnMax: -1, CritMin: 1, CritMax: -1}
+
+func TestNewFilter(t *testing.T) {
+	_, err := newFilter("[invalid(", "", "", 0)
+	assert.Error(t, err)
+
+	_, err = newFilter("", " ", "", 0)
 	assert.Error(t, err)
+
+	f, err := newFilter("nginx", "www-data, root", "nginx", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"www-data", "root"}, f.Users)
+	assert.Equal(t, "nginx exe=nginx user=www-data,root ppid=1", f.String())
+}
+
+func TestFilterMatch(t *testing.T) {
+	worker := procInfo{PID: 12, PPID: 1, Name: "nginx", User: "www-data", Cmdline: "nginx: worker process"}
+	zombie := procInfo{PID: 13, PPID: 1, Name: "nginx", User: "www-data", Zombie: true}
+
+	cases := []struct {
+		pattern, users, exe string
+		ppid                int
+		match               bool
+	}{
+		{"worker", "", "", 0, true},
+		{"master", "", "", 0, false},
+		{"", "root,www-data", "", 0, true},
+		{"", "root", "", 0, false},
+		{"", "", "nginx", 0, true},
+		{"", "", "ngin", 0, false},
+		{"", "", "", 1, true},
+		{"", "", "", 2, false},
+		{"^nginx$", "", "", 0, false},
+	}
+	for _, tc := range cases {
+		f, err := newFilter(tc.pattern, tc.users, tc.exe, tc.ppid)
+		require.NoError(t, err)
+		assert.Equal(t, tc.match, f.match(worker), "%+v", tc)
+	}
+
+	// without a command line the pattern applies to the name
+	f, _ := newFilter("^nginx$", "", "", 0)
+	assert.True(t, f.match(zombie))
 }
 
-func TestCountProcessNoMatch(t *testing.T) {
+func TestFindProcessesNoMatch(t *testing.T) {
 	// A pattern that is extremely unlikely to match any running process. This
 	// still exercises the full scan (process list, pid skip, cmdline, match).
-	count, err := countProcess("zzz_unlikely_process_name_xyz_123")
+	f, err := newFilter("zzz_unlikely_process_name_xyz_123", "", "", 0)
+	require.NoError(t, err)
+	processes, err := findProcesses(f, false, 1)
 	assert.NoError(t, err)
-	assert.Equal(t, 0, count)
+	assert.Equal(t, 0, len(processes))
 }
 
 func TestDescribe(t *testing.T) {
-	level, message := describe("nginx", 0)
+	level, message := describe("nginx", 0, defaultRange)
 	assert.Equal(t, "critical", level)
 	assert.Contains(t, message, "Unable to find process [nginx]")
 
-	level, message = describe("nginx", 3)
+	level, message = describe("nginx", 3, defaultRange)
 	assert.Equal(t, "ok", level)
 	assert.Contains(t, message, "3 occurence(s)")
+
+	r := check.Range{WarnMin: 2, WarnMax: 4, CritMin: 1, CritMax: 8}
+	cases := map[int]string{0: "critical", 1: "warning", 2: "ok", 4: "ok", 5: "warning", 9: "critical"}
+	for count, expected := range cases {
+		level, _ := describe("nginx", count, r)
+		assert.Equal(t, expected, level, "count %d", count)
+	}
+
+	_, message = describe("nginx", 5, r)
+	assert.Contains(t, message, "5 occurence(s), expected 2..4")
+
+	// absence of a process
+	level, message = describe("telnetd", 1, check.Range{WarnMax: -1, CritMax: 0})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "expected at most 0")
+	level, _ = describe("telnetd", 0, check.Range{WarnMax: -1, CritMax: 0})
+	assert.Equal(t, "ok", level)
 }
 
-func TestReport(t *testing.T) {
-	cases := map[string]int{"ok": 0, "critical": 2, "other": 0}
-	for level, expected := range cases {
-		var got int
-		c := check.New("CheckProcess")
-		c.ExitFn = func(code int) { got = code }
-		report(c, level, "msg")
-		assert.Equal(t, expected, got, "level %q", level)
+func TestEvaluate(t *testing.T) {
+	processes := []procInfo{
+		{PID: 10, Name: "java", CPU: 80, RSS: 900, FDs: 120, Threads: 40, Age: 3600},
+		{PID: 11, Name: "java", CPU: 30, RSS: 300, FDs: -1, Threads: 10, Age: 60},
+		{PID: 12, Name: "java", Zombie: true},
 	}
+
+	opts := options{count: defaultRange}
+	level, message := evaluate(processes, "java", opts)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Process [java]: 2 occurence(s) | processes=2;;1: zombies=1;; rss=1200.0MB;; fds=120;; threads=50;; age=3600s;;", message)
+
+	opts.zombies = check.Threshold{Warning: 1}
+	opts.rss = check.Threshold{Warning: 500, Critical: 1000}
+	opts.cpu = check.Threshold{Warning: 50}
+	level, message = evaluate(processes, "java", opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "1 zombie(s) exceeds warning")
+	assert.Contains(t, message, "pid 10 (java) rss=900.0MB exceeds warning")
+	assert.Contains(t, message, "pid 10 (java) cpu=80.0% exceeds warning")
+	assert.NotContains(t, message, "pid 11")
+	assert.Contains(t, message, "cpu=110.0%;;")
+
+	opts.aggregate = true
+	level, message = evaluate(processes, "java", opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "total rss=1200.0MB exceeds critical")
+	assert.Contains(t, message, "total cpu=110.0% exceeds warning")
+	assert.Contains(t, message, "rss=1200.0MB;500;1000")
+
+	opts = options{count: defaultRange, age: check.Threshold{Warning: 600, Critical: 7200}, fds: check.Threshold{Critical: 100}, aggregate: true}
+	level, message = evaluate(processes, "java", opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "total age=3600s exceeds warning")
+	assert.Contains(t, message, "total fds=120 exceeds critical")
+
+	// only zombies left
+	level, message = evaluate(processes[2:], "java", options{count: defaultRange})
+	assert.Equal(t, "critical", level)
+	assert.True(t, strings.HasPrefix(message, "Unable to find process [java] |"))
+}
+
+func TestCPUPercent(t *testing.T) {
+	assert.InDelta(t, 50.0, cpuPercent(10, 11, 2), 0.001)
+	assert.InDelta(t, 200.0, cpuPercent(10, 14, 2), 0.001)
+	assert.Equal(t, 0.0, cpuPercent(10, 9, 2))
+	assert.Equal(t, 0.0, cpuPercent(10, 11, 0))
 }
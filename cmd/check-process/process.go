@@ -0,0 +1,221 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+)
+
+// filter selects the processes to check. Empty fields match everything.
+type filter struct {
+	Pattern *regexp.Regexp
+	Users   []string
+	Exe     string
+	PPID    int32
+}
+
+// procInfo is the data of one matched process. FDs is -1 when the open file
+// descriptors cannot be read, which is common for processes of other users.
+type procInfo struct {
+	PID     int32
+	PPID    int32
+	Name    string
+	User    string
+	Cmdline string
+	Zombie  bool
+	CPU     float64
+	RSS     float64
+	FDs     int
+	Threads int
+	Age     float64
+}
+
+// newFilter compiles the pattern and splits the comma-separated user list.
+func newFilter(pattern, users, exe string, ppid int) (filter, error) {
+	f := filter{Exe: exe, PPID: int32(ppid)}
+
+	if len(pattern) > 0 {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return f, err
+		}
+		f.Pattern = re
+	}
+
+	for _, user := range strings.Split(users, ",") {
+		if user = strings.TrimSpace(user); len(user) > 0 {
+			f.Users = append(f.Users, user)
+		}
+	}
+
+	if f.Pattern == nil && len(f.Users) == 0 && len(f.Exe) == 0 && f.PPID == 0 {
+		return f, fmt.Errorf("at least one of --regexp_pattern, --user, --exe or --ppid is required")
+	}
+	return f, nil
+}
+
+// String describes the filter for the check output.
+func (f filter) String() string {
+	parts := []string{}
+	if f.Pattern != nil {
+		parts = append(parts, f.Pattern.String())
+	}
+	if len(f.Exe) > 0 {
+		parts = append(parts, "exe="+f.Exe)
+	}
+	if len(f.Users) > 0 {
+		parts = append(parts, "user="+strings.Join(f.Users, ","))
+	}
+	if f.PPID > 0 {
+		parts = append(parts, fmt.Sprintf("ppid=%d", f.PPID))
+	}
+	return strings.Join(parts, " ")
+}
+
+// match reports whether a process passes the filter. The pattern is matched
+// against the command line, or the name for processes without one such as
+// kernel threads and zombies.
+func (f filter) match(info procInfo) bool {
+	if f.PPID > 0 && info.PPID != f.PPID {
+		return false
+	}
+	if len(f.Exe) > 0 && info.Name != f.Exe {
+		return false
+	}
+	if len(f.Users) > 0 {
+		found := false
+		for _, user := range f.Users {
+			if user == info.User {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if f.Pattern != nil {
+		subject := info.Cmdline
+		if len(subject) == 0 {
+			subject = info.Name
+		}
+		if !f.Pattern.MatchString(subject) {
+			return false
+		}
+	}
+	return true
+}
+
+// findProcesses returns the processes matching the filter, excluding the check
+// itself. With sampleCPU the CPU usage is measured over sleep seconds.
+func findProcesses(f filter, sampleCPU bool, sleep int) ([]procInfo, error) {
+	processes, err := process.Processes()
+	if err != nil {
+		return nil, err
+	}
+
+	pid := int32(os.Getpid())
+	now := time.Now()
+
+	matched := []*process.Process{}
+	result := []procInfo{}
+	for _, p := range processes {
+		if p.Pid == pid {
+			continue
+		}
+		info, ok := identify(p)
+		if !ok || !f.match(info) {
+			continue
+		}
+		inspect(p, &info, now)
+		matched = append(matched, p)
+		result = append(result, info)
+	}
+
+	if sampleCPU {
+		sampleCPUUsage(matched, result, sleep)
+	}
+
+	return result, nil
+}
+
+// identify reads the attributes the filter matches on. Processes that exit
+// while being read are skipped.
+func identify(p *process.Process) (procInfo, bool) {
+	name, err := p.Name()
+	if err != nil {
+		return procInfo{}, false
+	}
+
+	info := procInfo{PID: p.Pid, Name: name, FDs: -1}
+	info.PPID, _ = p.Ppid()
+	info.User, _ = p.Username()
+	info.Cmdline, _ = p.Cmdline()
+	return info, true
+}
+
+// inspect reads the state and resource usage of a matched process. Values
+// that cannot be read are left at their defaults.
+func inspect(p *process.Process, info *procInfo, now time.Time) {
+	if status, err := p.Status(); err == nil {
+		for _, s := range status {
+			if s == process.Zombie {
+				info.Zombie = true
+			}
+		}
+	}
+	if mem, err := p.MemoryInfo(); err == nil {
+		info.RSS = float64(mem.RSS) / 1024 / 1024
+	}
+	if fds, err := p.NumFDs(); err == nil {
+		info.FDs = int(fds)
+	}
+	if threads, err := p.NumThreads(); err == nil {
+		info.Threads = int(threads)
+	}
+	if created, err := p.CreateTime(); err == nil {
+		info.Age = now.Sub(time.UnixMilli(created)).Seconds()
+	}
+}
+
+// sampleCPUUsage sets the CPU usage of every process from two readings of its
+// CPU times, sleep seconds apart. 100% is one fully used core.
+func sampleCPUUsage(processes []*process.Process, infos []procInfo, sleep int) {
+	if sleep < 1 {
+		sleep = 1
+	}
+
+	before := make([]float64, len(processes))
+	for i, p := range processes {
+		before[i] = cpuSeconds(p)
+	}
+
+	time.Sleep(time.Duration(sleep) * time.Second)
+
+	for i, p := range processes {
+		if after := cpuSeconds(p); after >= 0 && before[i] >= 0 {
+			infos[i].CPU = cpuPercent(before[i], after, float64(sleep))
+		}
+	}
+}
+
+// cpuSeconds returns the user and system time of a process, -1 if unknown.
+func cpuSeconds(p *process.Process) float64 {
+	times, err := p.Times()
+	if err != nil {
+		return -1
+	}
+	return times.User + times.System
+}
+
+// cpuPercent converts the CPU seconds used during an interval to a percentage.
+func cpuPercent(before, after, seconds float64) float64 {
+	if seconds <= 0 || after < before {
+		return 0
+	}
+	return (after - before) / seconds * 100
+}
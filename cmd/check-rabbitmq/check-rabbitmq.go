@@ -1,84 +1,272 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
-	"net/http"
+	"fmt"
 	"net/url"
-	"strconv"
-	"time"
+	"regexp"
+	"slices"
+	"strings"
 
 	"github.com/thomis/sensu-plugins-go/pkg/check"
 )
 
-type alivenessStruct struct {
-	Status string
+type options struct {
+	ready       check.Threshold
+	unacked     check.Threshold
+	consumers   check.Threshold
+	utilisation check.Threshold
+	fd          check.Threshold
+	allVhosts   bool
 }
 
-type connection struct {
-	Host     string
-	Port     int
-	Vhost    string
-	User     string
-	Password string
-	Timeout  int
+// namedHealth is the result of one management API health check.
+type namedHealth struct {
+	Name   string
+	Result healthResult
 }
 
+var healthChecks = []string{"alarms", "local-alarms", "virtual-hosts"}
+
 func main() {
 	var (
-		connection connection
+		conn          connection
+		opts          options
+		checks        []string
+		listeners     []int
+		queuePatterns []string
+		nodes         bool
 	)
 
 	c := check.New("CheckRabbitMQ")
-	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "HOST")
-	c.Option.IntVarP(&connection.Port, "port", "P", 15672, "PORT")
-	c.Option.StringVarP(&connection.Vhost, "vhost", "v", "%2F", "VHOST")
-	c.Option.StringVarP(&connection.User, "user", "u", "guest", "USER")
-	c.Option.StringVarP(&connection.Password, "password", "p", "guest", "PASSWORD")
-	c.Option.IntVarP(&connection.Timeout, "timeout", "t", 10, "TIMEOUT")
+	c.Option.StringVarP(&conn.Host, "host", "h", "localhost", "HOST")
+	c.Option.IntVarP(&conn.Port, "port", "P", 15672, "PORT")
+	c.Option.StringVarP(&conn.Vhost, "vhost", "v", "%2F", "VHOST of the checked queues, URL-encoded or not (empty for all)")
+	c.Option.StringVarP(&conn.User, "user", "u", "guest", "USER")
+	c.Option.StringVarP(&conn.Password, "password", "p", "guest", "PASSWORD")
+	c.Option.IntVarP(&conn.Timeout, "timeout", "t", 10, "TIMEOUT")
+	c.Option.StringVar(&conn.Scheme, "scheme", "http", "http or https")
+	c.Option.BoolVarP(&conn.Insecure, "insecure", "k", false, "INSECURE (skips peer certificate validation)")
+	c.Option.StringVar(&conn.CACert, "ca-cert", "", "CA certificate file (PEM) to verify the server certificate")
+	c.Option.StringSliceVar(&checks, "health", []string{"alarms", "virtual-hosts"}, "Health checks to run: "+strings.Join(healthChecks, ", ")+" (empty for none)")
+	c.Option.IntSliceVar(&listeners, "port-listener", nil, "Check that these ports have an active listener, e.g. 5672")
+	c.Option.StringSliceVarP(&queuePatterns, "queue", "q", nil, "Check the queues whose names match these regular expressions")
+	c.Option.Float64Var(&opts.ready.Warning, "ready-warn", 0, "Warning if a queue has at least this many ready messages (0 disables)")
+	c.Option.Float64Var(&opts.ready.Critical, "ready-crit", 0, "Critical if a queue has at least this many ready messages (0 disables)")
+	c.Option.Float64Var(&opts.unacked.Warning, "unacked-warn", 0, "Warning if a queue has at least this many unacknowledged messages (0 disables)")
+	c.Option.Float64Var(&opts.unacked.Critical, "unacked-crit", 0, "Critical if a queue has at least this many unacknowledged messages (0 disables)")
+	c.Option.Float64Var(&opts.consumers.Warning, "consumers-warn", 0, "Warning if a queue has less than this many consumers (0 disables)")
+	c.Option.Float64Var(&opts.consumers.Critical, "consumers-crit", 0, "Critical if a queue has less than this many consumers (0 disables)")
+	c.Option.Float64Var(&opts.utilisation.Warning, "utilisation-warn", 0, "Warning if the consumer utilisation of a queue is below this % (0 disables)")
+	c.Option.Float64Var(&opts.utilisation.Critical, "utilisation-crit", 0, "Critical if the consumer utilisation of a queue is below this % (0 disables)")
+	c.Option.BoolVar(&nodes, "nodes", false, "Check that all nodes are running without memory or disk alarms")
+	c.Option.Float64Var(&opts.fd.Warning, "fd-warn", 0, "Warning if a node uses at least this % of its file descriptors (0 disables)")
+	c.Option.Float64Var(&opts.fd.Critical, "fd-crit", 0, "Critical if a node uses at least this % of its file descriptors (0 disables)")
 	c.Init()
 
-	status, err := alivenessTest(connection)
+	if conn.Scheme != "http" && conn.Scheme != "https" {
+		c.Error(fmt.Errorf("invalid scheme %q, use http or https", conn.Scheme))
+		return
+	}
+	for _, name := range checks {
+		if !slices.Contains(healthChecks, name) {
+			c.Error(fmt.Errorf("invalid health check %q, use %s", name, strings.Join(healthChecks, ", ")))
+			return
+		}
+	}
+	vhost, err := url.PathUnescape(conn.Vhost)
+	if err != nil {
+		c.Error(fmt.Errorf("invalid vhost %q: %w", conn.Vhost, err))
+		return
+	}
+	opts.allVhosts = len(vhost) == 0
+	patterns, err := compile(queuePatterns)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
-	switch status {
-	case "ok":
-		c.Ok("RabbitMQ server is alive")
-	default:
-		c.Warning("Object Not Found")
+	client, err := newClient(conn)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	results := []namedHealth{}
+	for _, name := range checks {
+		result, err := client.health(name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		results = append(results, namedHealth{Name: name, Result: result})
+	}
+	for _, port := range listeners {
+		name := fmt.Sprintf("port-listener/%d", port)
+		result, err := client.health(name)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		results = append(results, namedHealth{Name: name, Result: result})
 	}
+
+	var selected []queue
+	if len(patterns) > 0 {
+		queues, err := client.queues(vhost)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		selected = selectQueues(queues, patterns)
+	}
+
+	var nodeList []node
+	if nodes || opts.fd.Enabled() {
+		if nodeList, err = client.nodes(); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	level, message := evaluate(results, selected, nodeList, opts)
+	c.Report(level, message)
 }
 
-func alivenessTest(connection connection) (string, error) {
-	var aliveness alivenessStruct
-	http.DefaultClient.Timeout = time.Duration(connection.Timeout) * time.Second
+func compile(expressions []string) ([]*regexp.Regexp, error) {
+	if len(expressions) == 0 {
+		return nil, nil
+	}
+	patterns := []*regexp.Regexp{}
+	for _, expression := range expressions {
+		re, err := regexp.Compile(expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid queue pattern %q: %w", expression, err)
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
 
-	request := &http.Request{
-		Method: "GET",
-		URL: &url.URL{
-			Host:   connection.Host + ":" + strconv.Itoa(connection.Port),
-			Scheme: "http",
-			Opaque: "/api/aliveness-test/" + connection.Vhost,
-		},
-		Header: http.Header{
-			"User-Agent": {"godoc-example/0.1"},
-		},
+// selectQueues keeps the queues whose name matches one of the patterns.
+func selectQueues(queues []queue, patterns []*regexp.Regexp) []queue {
+	selected := []queue{}
+	for _, q := range queues {
+		for _, re := range patterns {
+			if re.MatchString(q.Name) {
+				selected = append(selected, q)
+				break
+			}
+		}
 	}
-	request.SetBasicAuth(connection.User, connection.Password)
+	return selected
+}
 
-	response, err := http.DefaultClient.Do(request)
-	if err != nil {
-		return "", err
+// evaluate combines the health check results, the selected queues (nil
+// unless queue patterns are given) and the nodes (nil unless node checks are
+// enabled).
+func evaluate(results []namedHealth, queues []queue, nodes []node, opts options) (string, string) {
+	levels := []string{}
+	details := []string{}
+	problems := []string{}
+	perfs := []string{}
+	apply := func(level string, problem string) {
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, fmt.Sprintf("%s, %s", problem, level))
+		}
 	}
 
-	body, err := io.ReadAll(response.Body)
-	if err != nil {
-		return "", err
+	for _, r := range results {
+		if r.Result.Status == "ok" {
+			details = append(details, r.Name+" ok")
+			continue
+		}
+		reason := r.Result.Reason
+		if len(reason) == 0 {
+			reason = "status " + r.Result.Status
+		}
+		levels = append(levels, "critical")
+		problems = append(problems, fmt.Sprintf("%s failed: %s", r.Name, reason))
 	}
-	defer response.Body.Close()
 
-	json.Unmarshal(body, &aliveness)
-	return aliveness.Status, nil
+	if queues != nil {
+		details = append(details, fmt.Sprintf("%d queues", len(queues)))
+		if len(queues) == 0 {
+			apply("critical", "no matching queue")
+		}
+		for _, q := range queues {
+			name := q.Name
+			if opts.allVhosts {
+				name = strings.TrimSuffix(q.Vhost, "/") + "/" + q.Name
+			}
+			label := check.PerfLabel(name)
+
+			apply(opts.ready.Level(float64(q.MessagesReady)), fmt.Sprintf("queue %s has %d ready messages", name, q.MessagesReady))
+			apply(opts.unacked.Level(float64(q.MessagesUnacked)), fmt.Sprintf("queue %s has %d unacknowledged messages", name, q.MessagesUnacked))
+			apply(opts.consumers.MinLevel(float64(q.Consumers)), fmt.Sprintf("queue %s has %d consumers", name, q.Consumers))
+			perfs = append(perfs,
+				fmt.Sprintf("rabbitmq_ready_%s=%d;%s;0;", label, q.MessagesReady, opts.ready.Perf()),
+				fmt.Sprintf("rabbitmq_unacked_%s=%d;%s;0;", label, q.MessagesUnacked, opts.unacked.Perf()),
+				fmt.Sprintf("rabbitmq_consumers_%s=%d;%s;0;", label, q.Consumers, opts.consumers.Perf()),
+			)
+
+			if utilisation, ok := q.utilisation(); ok {
+				apply(opts.utilisation.MinLevel(utilisation), fmt.Sprintf("queue %s consumer utilisation at %.0f%%", name, utilisation))
+				perfs = append(perfs, fmt.Sprintf("rabbitmq_utilisation_%s=%.0f%%;%s;0;100", label, utilisation, opts.utilisation.Perf()))
+			}
+		}
+	}
+
+	if nodes != nil {
+		details = append(details, fmt.Sprintf("%d nodes", len(nodes)))
+		for _, n := range nodes {
+			if !n.Running {
+				apply("critical", fmt.Sprintf("node %s is not running", n.Name))
+				continue
+			}
+			if n.MemAlarm {
+				apply("critical", fmt.Sprintf("node %s has a memory alarm", n.Name))
+			}
+			if n.DiskFreeAlarm {
+				apply("critical", fmt.Sprintf("node %s has a disk alarm", n.Name))
+			}
+			label := check.PerfLabel(n.Name)
+			if n.FDTotal > 0 {
+				used := float64(n.FDUsed) / float64(n.FDTotal) * 100
+				apply(opts.fd.Level(used), fmt.Sprintf("node %s uses %.1f%% of its file descriptors", n.Name, used))
+				perfs = append(perfs, fmt.Sprintf("rabbitmq_fd_used_%s=%.1f%%;%s;0;100", label, used, opts.fd.Perf()))
+			}
+			perfs = append(perfs,
+				fmt.Sprintf("rabbitmq_mem_used_%s=%dB;;;0;%d", label, n.MemUsed, n.MemLimit),
+				fmt.Sprintf("rabbitmq_disk_free_%s=%dB", label, n.DiskFree),
+			)
+		}
+	}
+
+	output := "RabbitMQ"
+	if len(details) > 0 {
+		output += " " + strings.Join(details, ", ")
+	}
+	if len(problems) > 0 {
+		output += ": " + strings.Join(problems, ", ")
+	}
+	if len(perfs) > 0 {
+		output += " | " + strings.Join(perfs, " ")
+	}
+	return check.WorstLevel(levels...), output
+}
+
+// utilisation returns the consumer capacity or utilisation in percent, if
+// the queue has consumers.
+func (q queue) utilisation() (float64, bool) {
+	switch {
+	case q.Consumers == 0:
+		return 0, false
+	case q.ConsumerCapacity != nil:
+		return *q.ConsumerCapacity * 100, true
+	case q.ConsumerUtilisation != nil:
+		return *q.ConsumerUtilisation * 100, true
+	default:
+		return 0, false
+	}
 }
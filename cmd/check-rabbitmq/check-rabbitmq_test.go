@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// fakeBroker serves the management API with the fixtures. The local alarms
+// and port 5671 checks fail.
+func fakeBroker(t *testing.T) connection {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		if user != "monitor" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"not_authorized","reason":"Login failed"}`))
+			return
+		}
+		switch r.URL.EscapedPath() {
+		case "/api/health/checks/alarms", "/api/health/checks/virtual-hosts", "/api/health/checks/port-listener/5672":
+			w.Write([]byte(`{"status":"ok"}`))
+		case "/api/health/checks/local-alarms":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"failed","reason":"There are alarms in effect in the cluster","alarms":[{"node":"rabbit@mq-2","resource":"memory"}]}`))
+		case "/api/health/checks/port-listener/5671":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"status":"failed","reason":"No active listener","missing":5671,"ports":[5672,15672]}`))
+		case "/api/queues/%2F", "/api/queues":
+			assert.Contains(t, r.URL.Query().Get("columns"), "consumer_capacity")
+			serveFile(t, w, "testdata/queues.json")
+		case "/api/nodes":
+			serveFile(t, w, "testdata/nodes.json")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"Object Not Found","reason":"Not Found"}`))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	address, _ := url.Parse(server.URL)
+	port, _ := strconv.Atoi(address.Port())
+	return connection{Scheme: "http", Host: address.Hostname(), Port: port, User: "monitor", Password: "secret", Timeout: 1}
+}
+
+func serveFile(t *testing.T, w http.ResponseWriter, file string) {
+	contents, err := os.ReadFile(file)
+	require.NoError(t, err)
+	w.Write(contents)
+}
+
+func TestClient(t *testing.T) {
+	client, err := newClient(fakeBroker(t))
+	require.NoError(t, err)
+
+	result, err := client.health("alarms")
+	assert.NoError(t, err)
+	assert.Equal(t, healthResult{Status: "ok"}, result)
+
+	result, err = client.health("port-listener/5671")
+	assert.NoError(t, err)
+	assert.Equal(t, healthResult{Status: "failed", Reason: "No active listener"}, result)
+
+	_, err = client.health("unknown")
+	assert.EqualError(t, err, "received HTTP status code 404 from /api/health/checks/unknown: Not Found")
+
+	queues, err := client.queues("/")
+	assert.NoError(t, err)
+	assert.Len(t, queues, 4)
+	assert.Nil(t, queues[1].ConsumerUtilisation)
+	assert.Equal(t, 0.45, *queues[0].ConsumerCapacity)
+
+	queues, err = client.queues("")
+	assert.NoError(t, err)
+	assert.Len(t, queues, 4)
+
+	nodes, err := client.nodes()
+	assert.NoError(t, err)
+	assert.Len(t, nodes, 3)
+	assert.True(t, nodes[1].MemAlarm)
+
+	conn := fakeBroker(t)
+	conn.Password = "guest"
+	client, _ = newClient(conn)
+	_, err = client.health("alarms")
+	assert.EqualError(t, err, "received HTTP status code 401 from /api/health/checks/alarms: Login failed")
+}
+
+func TestNewClient(t *testing.T) {
+	client, err := newClient(connection{Scheme: "https", Host: "mq.example.com", Port: 15671, Insecure: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "https://mq.example.com:15671", client.base)
+
+	_, err = newClient(connection{Scheme: "https", Host: "localhost", Port: 15671, CACert: "testdata/queues.json"})
+	assert.ErrorContains(t, err, "no certificates")
+}
+
+func readQueues(t *testing.T) []queue {
+	contents, err := os.ReadFile("testdata/queues.json")
+	require.NoError(t, err)
+	var queues []queue
+	require.NoError(t, json.Unmarshal(contents, &queues))
+	return queues
+}
+
+func TestSelectQueues(t *testing.T) {
+	patterns, err := compile([]string{"^orders", "^emails$"})
+	require.NoError(t, err)
+	selected := selectQueues(readQueues(t), patterns)
+	assert.Len(t, selected, 3)
+	assert.Equal(t, "emails", selected[2].Name)
+
+	patterns, _ = compile([]string{"^none$"})
+	assert.Equal(t, []queue{}, selectQueues(readQueues(t), patterns))
+
+	patterns, err = compile(nil)
+	assert.NoError(t, err)
+	assert.Nil(t, patterns)
+
+	_, err = compile([]string{"("})
+	assert.Error(t, err)
+}
+
+func TestEvaluateHealth(t *testing.T) {
+	results := []namedHealth{
+		{Name: "alarms", Result: healthResult{Status: "ok"}},
+		{Name: "virtual-hosts", Result: healthResult{Status: "ok"}},
+	}
+	level, message := evaluate(results, nil, nil, options{})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "RabbitMQ alarms ok, virtual-hosts ok", message)
+
+	results = append(results,
+		namedHealth{Name: "port-listener/5671", Result: healthResult{Status: "failed", Reason: "No active listener"}},
+		namedHealth{Name: "local-alarms", Result: healthResult{Status: "failed"}},
+	)
+	level, message = evaluate(results, nil, nil, options{})
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "RabbitMQ alarms ok, virtual-hosts ok: port-listener/5671 failed: No active listener, local-alarms failed: status failed", message)
+}
+
+func TestEvaluateQueues(t *testing.T) {
+	patterns, _ := compile([]string{"."})
+	queues := selectQueues(readQueues(t), patterns)
+
+	level, message := evaluate(nil, queues, nil, options{})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "RabbitMQ 4 queues | rabbitmq_ready_orders=1200;;;0; rabbitmq_unacked_orders=15;;;0; rabbitmq_consumers_orders=2;;;0; rabbitmq_utilisation_orders=45%;;;0;100 rabbitmq_ready_orders.retry=3;;;0; rabbitmq_unacked_orders.retry=0;;;0; rabbitmq_consumers_orders.retry=0;;;0; rabbitmq_ready_emails=0;;;0; rabbitmq_unacked_emails=0;;;0; rabbitmq_consumers_emails=1;;;0; rabbitmq_utilisation_emails=100%;;;0;100 rabbitmq_ready_audit_log=10;;;0; rabbitmq_unacked_audit_log=0;;;0; rabbitmq_consumers_audit_log=1;;;0; rabbitmq_utilisation_audit_log=100%;;;0;100", message)
+
+	opts := options{ready: check.Threshold{Warning: 1000, Critical: 5000}, consumers: check.Threshold{Critical: 1}}
+	level, message = evaluate(nil, queues, nil, opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "RabbitMQ 4 queues: queue orders has 1200 ready messages, warning, queue orders.retry has 0 consumers, critical |")
+
+	opts = options{unacked: check.Threshold{Warning: 10}, utilisation: check.Threshold{Warning: 50, Critical: 20}}
+	level, message = evaluate(nil, queues, nil, opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "queue orders has 15 unacknowledged messages, warning, queue orders consumer utilisation at 45%, warning |")
+
+	opts = options{allVhosts: true, ready: check.Threshold{Warning: 1000}}
+	_, message = evaluate(nil, []queue{queues[0], {Name: "orders", Vhost: "shop", MessagesReady: 1500}}, nil, opts)
+	assert.Contains(t, message, "queue /orders has 1200 ready messages, warning, queue shop/orders has 1500 ready messages, warning")
+	assert.Contains(t, message, "rabbitmq_ready__orders=1200;1000;;0;")
+	assert.Contains(t, message, "rabbitmq_ready_shop_orders=1500;1000;;0;")
+
+	level, message = evaluate(nil, []queue{}, nil, options{})
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "RabbitMQ 0 queues: no matching queue, critical", message)
+}
+
+func TestEvaluateNodes(t *testing.T) {
+	contents, err := os.ReadFile("testdata/nodes.json")
+	require.NoError(t, err)
+	var nodes []node
+	require.NoError(t, json.Unmarshal(contents, &nodes))
+
+	level, message := evaluate(nil, nil, nodes[:1], options{})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "RabbitMQ 1 nodes | rabbitmq_fd_used_rabbit_mq-1=0.1%;;;0;100 rabbitmq_mem_used_rabbit_mq-1=157286400B;;;0;3298534883 rabbitmq_disk_free_rabbit_mq-1=42949672960B", message)
+
+	level, message = evaluate(nil, nil, nodes, options{fd: check.Threshold{Warning: 80, Critical: 95}})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "RabbitMQ 3 nodes: node rabbit@mq-2 has a memory alarm, critical, node rabbit@mq-2 uses 87.9% of its file descriptors, warning, node rabbit@mq-3 is not running, critical |")
+}
+
+func TestQueueUtilisation(t *testing.T) {
+	half, full := 0.5, 1.0
+	cases := []struct {
+		q        queue
+		expected float64
+		ok       bool
+	}{
+		{queue{Consumers: 1, ConsumerCapacity: &half, ConsumerUtilisation: &full}, 50, true},
+		{queue{Consumers: 1, ConsumerUtilisation: &full}, 100, true},
+		{queue{Consumers: 1}, 0, false},
+		{queue{Consumers: 0, ConsumerCapacity: &half}, 0, false},
+	}
+	for _, tc := range cases {
+		value, ok := tc.q.utilisation()
+		assert.Equal(t, tc.expected, value)
+		assert.Equal(t, tc.ok, ok)
+	}
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+type connection struct {
+	Scheme   string
+	Host     string
+	Port     int
+	Vhost    string
+	User     string
+	Password string
+	Insecure bool
+	CACert   string
+	Timeout  int
+}
+
+type client struct {
+	base       string
+	connection connection
+	http       *http.Client
+}
+
+// healthResult is the response of a /api/health/checks endpoint. A failed
+// check answers with 503 and a reason.
+type healthResult struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// queue holds the columns of /api/queues the check uses. Consumer capacity
+// replaced consumer utilisation in RabbitMQ 3.12; both are nil without
+// consumers.
+type queue struct {
+	Name                string   `json:"name"`
+	Vhost               string   `json:"vhost"`
+	MessagesReady       int      `json:"messages_ready"`
+	MessagesUnacked     int      `json:"messages_unacknowledged"`
+	Consumers           int      `json:"consumers"`
+	ConsumerUtilisation *float64 `json:"consumer_utilisation"`
+	ConsumerCapacity    *float64 `json:"consumer_capacity"`
+}
+
+// node holds the fields of /api/nodes the check uses.
+type node struct {
+	Name          string `json:"name"`
+	Running       bool   `json:"running"`
+	MemAlarm      bool   `json:"mem_alarm"`
+	DiskFreeAlarm bool   `json:"disk_free_alarm"`
+	FDUsed        int    `json:"fd_used"`
+	FDTotal       int    `json:"fd_total"`
+	MemUsed       uint64 `json:"mem_used"`
+	MemLimit      uint64 `json:"mem_limit"`
+	DiskFree      uint64 `json:"disk_free"`
+	DiskFreeLimit uint64 `json:"disk_free_limit"`
+}
+
+func newClient(c connection) (*client, error) {
+	httpClient, err := common.NewHTTPClient(time.Duration(c.Timeout)*time.Second, c.Insecure, c.CACert)
+	if err != nil {
+		return nil, err
+	}
+
+	return &client{
+		base:       c.Scheme + "://" + net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		connection: c,
+		http:       httpClient,
+	}, nil
+}
+
+// get requests path and decodes the JSON response into v. Status codes in
+// accept besides 200 are decoded as well.
+func (c *client) get(path string, v interface{}, accept ...int) error {
+	request, err := http.NewRequest("GET", c.base+path, nil)
+	if err != nil {
+		return err
+	}
+	request.SetBasicAuth(c.connection.User, c.connection.Password)
+
+	response, err := c.http.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK && !slices.Contains(accept, response.StatusCode) {
+		return fmt.Errorf("received HTTP status code %d from %s%s", response.StatusCode, path, errorReason(body))
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// errorReason extracts the reason of a management API error response.
+func errorReason(body []byte) string {
+	var response struct {
+		Reason string `json:"reason"`
+	}
+	if json.Unmarshal(body, &response) != nil || len(response.Reason) == 0 {
+		return ""
+	}
+	return ": " + response.Reason
+}
+
+// health runs a health check such as "alarms" or "port-listener/5672".
+func (c *client) health(check string) (healthResult, error) {
+	var result healthResult
+	err := c.get("/api/health/checks/"+check, &result, http.StatusServiceUnavailable)
+	return result, err
+}
+
+// queues lists the queues of a vhost, or of all vhosts for an empty vhost.
+func (c *client) queues(vhost string) ([]queue, error) {
+	path := "/api/queues"
+	if len(vhost) > 0 {
+		path += "/" + url.PathEscape(vhost)
+	}
+	path += "?columns=name,vhost,messages_ready,messages_unacknowledged,consumers,consumer_utilisation,consumer_capacity"
+
+	var queues []queue
+	err := c.get(path, &queues)
+	return queues, err
+}
+
+func (c *client) nodes() ([]node, error) {
+	var nodes []node
+	err := c.get("/api/nodes", &nodes)
+	return nodes, err
+}
@@ -2,60 +2,270 @@ package main
 
 import (
 	"fmt"
-	"regexp"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/gomodule/redigo/redis"
 	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/redis"
+	"github.com/thomis/sensu-plugins-go/pkg/state"
 )
 
+type options struct {
+	key      string
+	value    string
+	memory   check.Threshold
+	clients  check.Threshold
+	rejected check.Threshold
+	evicted  check.Threshold
+	lag      check.Threshold
+	masterIO check.Threshold
+	latency  check.Threshold
+}
+
+// counters are the INFO counters kept between runs. RunID changes when the
+// server restarts and its counters start from zero.
+type counters struct {
+	Time     time.Time `json:"time"`
+	RunID    string    `json:"run_id"`
+	Rejected int64     `json:"rejected_connections"`
+	Evicted  int64     `json:"evicted_keys"`
+}
+
 func main() {
 	var (
-		host  string
-		port  int
-		key   string
-		value string
+		connection     redis.Options
+		opts           options
+		connectTimeout int
+		readTimeout    int
+		stateFile      string
 	)
 
 	c := check.New("CheckRedis")
-	c.Option.StringVarP(&host, "host", "h", "localhost", "HOST")
-	c.Option.IntVarP(&port, "port", "P", 6379, "PORT")
-	c.Option.StringVarP(&key, "key", "k", "role", "KEY")
-	c.Option.StringVarP(&value, "value", "v", "master", "VALUE")
+	c.Option.StringVarP(&connection.Host, "host", "h", "localhost", "HOST")
+	c.Option.IntVarP(&connection.Port, "port", "P", 6379, "PORT")
+	c.Option.StringVar(&connection.Username, "user", "", "ACL username (Redis 6 and later)")
+	c.Option.StringVarP(&connection.Password, "password", "a", os.Getenv("REDISCLI_AUTH"), "Password")
+	c.Option.BoolVar(&connection.TLS, "tls", false, "Connect with TLS")
+	c.Option.BoolVar(&connection.TLSInsecure, "tls-insecure", false, "Skip verification of the server certificate")
+	c.Option.StringVar(&connection.TLSCA, "tls-ca", "", "CA certificate file (PEM) to verify the server certificate")
+	c.Option.StringVar(&connection.TLSCert, "tls-cert", "", "Client certificate file (PEM)")
+	c.Option.StringVar(&connection.TLSKey, "tls-key", "", "Client private key file (PEM)")
+	c.Option.StringVar(&connection.TLSServerName, "tls-server-name", "", "Server name to verify (default: host)")
+	c.Option.IntVar(&connectTimeout, "connect-timeout", 5, "Connect timeout in seconds")
+	c.Option.IntVar(&readTimeout, "read-timeout", 5, "Read timeout in seconds")
+	c.Option.StringVarP(&opts.key, "key", "k", "role", "INFO field to compare (empty disables)")
+	c.Option.StringVarP(&opts.value, "value", "v", "master", "Expected value of the INFO field")
+	c.Option.Float64Var(&opts.memory.Warning, "memory-warn", 0, "Warning if used_memory is at least this % of maxmemory (0 disables)")
+	c.Option.Float64Var(&opts.memory.Critical, "memory-crit", 0, "Critical if used_memory is at least this % of maxmemory (0 disables)")
+	c.Option.Float64Var(&opts.clients.Warning, "clients-warn", 0, "Warning if connected_clients is at least this (0 disables)")
+	c.Option.Float64Var(&opts.clients.Critical, "clients-crit", 0, "Critical if connected_clients is at least this (0 disables)")
+	c.Option.Float64Var(&opts.rejected.Warning, "rejected-warn", 0, "Warning if at least this many connections were rejected since the last run (0 disables)")
+	c.Option.Float64Var(&opts.rejected.Critical, "rejected-crit", 0, "Critical if at least this many connections were rejected since the last run (0 disables)")
+	c.Option.Float64Var(&opts.evicted.Warning, "evicted-warn", 0, "Warning if at least this many keys were evicted since the last run (0 disables)")
+	c.Option.Float64Var(&opts.evicted.Critical, "evicted-crit", 0, "Critical if at least this many keys were evicted since the last run (0 disables)")
+	c.Option.Float64Var(&opts.lag.Warning, "lag-warn", 0, "Warning on a master if a replica acknowledged at least this many seconds ago (0 disables)")
+	c.Option.Float64Var(&opts.lag.Critical, "lag-crit", 0, "Critical on a master if a replica acknowledged at least this many seconds ago (0 disables)")
+	c.Option.Float64Var(&opts.masterIO.Warning, "master-io-warn", 0, "Warning on a replica if the last I/O with the master was at least this many seconds ago (0 disables)")
+	c.Option.Float64Var(&opts.masterIO.Critical, "master-io-crit", 0, "Critical on a replica if the last I/O with the master was at least this many seconds ago (0 disables)")
+	c.Option.Float64Var(&opts.latency.Warning, "latency-warn", 0, "Warning if PING takes at least this many milliseconds (0 disables)")
+	c.Option.Float64Var(&opts.latency.Critical, "latency-crit", 0, "Critical if PING takes at least this many milliseconds (0 disables)")
+	c.Option.StringVar(&stateFile, "state-file", "", "File keeping the counters of the previous run (default: derived from host and port in the temp directory)")
 	c.Init()
 
-	info, err := redisInfo(host, port, key)
+	connection.ConnectTimeout = time.Duration(connectTimeout) * time.Second
+	connection.ReadTimeout = time.Duration(readTimeout) * time.Second
+
+	conn, err := redis.Dial(connection)
+	if err != nil {
+		c.Critical(fmt.Sprintf("failed to connect to %s:%d: %s", connection.Host, connection.Port, err))
+		return
+	}
+	defer conn.Close()
+
+	latency, err := redis.Ping(conn)
+	if err != nil {
+		c.Critical(fmt.Sprintf("PING failed: %s", err))
+		return
+	}
+
+	info, err := redis.GetInfo(conn)
 	if err != nil {
 		c.Error(err)
+		return
 	}
 
-	if info == value {
-		c.Ok(fmt.Sprintf("Redis %s is %s", key, info))
-	} else {
-		c.Warning(fmt.Sprintf("Redis %s is %s", key, info))
+	var cluster redis.Info
+	if info["cluster_enabled"] == "1" {
+		if cluster, err = redis.GetClusterInfo(conn); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	if len(stateFile) == 0 {
+		stateFile = state.DefaultFile("check-redis", connection.Host+":"+strconv.Itoa(connection.Port))
+	}
+	var saved counters
+	if err := state.Load(stateFile, &saved); err != nil {
+		c.Error(fmt.Errorf("invalid state file %s: %w", stateFile, err))
+		return
 	}
+	var previous *counters
+	if !saved.Time.IsZero() {
+		previous = &saved
+	}
+	current := countersOf(info, time.Now())
+	if err := state.Save(stateFile, current); err != nil {
+		c.Error(fmt.Errorf("failed to write state file %s: %w", stateFile, err))
+		return
+	}
+
+	level, message := evaluate(info, cluster, latency, previous, current, opts)
+	c.Report(level, message)
 }
 
-func redisInfo(host string, port int, key string) (string, error) {
-	var info string
+func countersOf(info redis.Info, now time.Time) counters {
+	rejected, _ := info.Int("rejected_connections")
+	evicted, _ := info.Int("evicted_keys")
+	return counters{Time: now, RunID: info["run_id"], Rejected: rejected, Evicted: evicted}
+}
 
-	client, err := redis.Dial("tcp", host+":"+strconv.Itoa(port))
-	if err != nil {
-		return info, err
+// evaluate applies the thresholds to INFO, CLUSTER INFO (nil unless cluster
+// mode is enabled) and the PING latency. Rejected connections and evictions
+// are compared to the previous run and left out on the first run and after
+// a restart. A replica only knows how long ago it last heard from its master,
+// which grows up to repl-ping-replica-period (10s by default) on an idle
+// master, so it is reported as such and not as replication lag. A master
+// reports the age of the oldest replica acknowledgement, sent every second.
+func evaluate(info, cluster redis.Info, latency time.Duration, previous *counters, current counters, opts options) (string, string) {
+	levels := []string{}
+	details := []string{}
+	problems := []string{}
+	perfs := []string{}
+
+	apply := func(threshold check.Threshold, value float64, description string) {
+		level := threshold.Level(value)
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, fmt.Sprintf("%s, %s", description, level))
+		}
+	}
+	fail := func(problem string) {
+		levels = append(levels, "critical")
+		problems = append(problems, problem)
 	}
-	defer client.Close()
 
-	result, err := redis.String(client.Do("INFO"))
-	if err != nil {
-		return info, err
+	// Sentinel INFO has no role field, so the default comparison of role
+	// against master is skipped there unless the field exists.
+	_, found := info[opts.key]
+	if len(opts.key) > 0 && (found || info["redis_mode"] != "sentinel") {
+		value := info[opts.key]
+		details = append(details, fmt.Sprintf("Redis %s is %s", opts.key, value))
+		if value != opts.value {
+			levels = append(levels, "warning")
+			problems = append(problems, fmt.Sprintf("%s is not %s", opts.key, opts.value))
+		}
+	} else {
+		details = append(details, fmt.Sprintf("Redis %s %s", info["redis_version"], roleOf(info)))
+	}
+
+	milliseconds := float64(latency.Microseconds()) / 1000
+	details = append(details, fmt.Sprintf("ping %.2f ms", milliseconds))
+	apply(opts.latency, milliseconds, fmt.Sprintf("ping took %.2f ms", milliseconds))
+	perfs = append(perfs, fmt.Sprintf("redis_ping=%.3fms;%s;0;", milliseconds, opts.latency.Perf()))
+
+	if clients, ok := info.Int("connected_clients"); ok {
+		details = append(details, fmt.Sprintf("%d clients", clients))
+		apply(opts.clients, float64(clients), fmt.Sprintf("%d connected clients", clients))
+		perfs = append(perfs, fmt.Sprintf("redis_connected_clients=%d;%s;0;", clients, opts.clients.Perf()))
 	}
 
-	re := regexp.MustCompile(key + ":(.+)")
-	match := re.FindStringSubmatch(result)
-	if len(match) > 0 {
-		info = strings.TrimRight(match[1], "\r")
+	if used, ok := info.Int("used_memory"); ok {
+		perfs = append(perfs, fmt.Sprintf("redis_used_memory=%dB", used))
+		if max, ok := info.Int("maxmemory"); ok && max > 0 {
+			percent := float64(used) / float64(max) * 100
+			details = append(details, fmt.Sprintf("memory %.1f%% of maxmemory", percent))
+			apply(opts.memory, percent, fmt.Sprintf("memory at %.1f%% of maxmemory", percent))
+			perfs = append(perfs, fmt.Sprintf("redis_memory_used=%.1f%%;%s;0;100", percent, opts.memory.Perf()))
+		}
 	}
 
-	return info, nil
+	if previous != nil && previous.RunID == current.RunID && current.Rejected >= previous.Rejected && current.Evicted >= previous.Evicted {
+		rejected := current.Rejected - previous.Rejected
+		evicted := current.Evicted - previous.Evicted
+		apply(opts.rejected, float64(rejected), fmt.Sprintf("%d connections rejected", rejected))
+		apply(opts.evicted, float64(evicted), fmt.Sprintf("%d keys evicted", evicted))
+		perfs = append(perfs,
+			fmt.Sprintf("redis_rejected_connections=%d;%s;0;", rejected, opts.rejected.Perf()),
+			fmt.Sprintf("redis_evicted_keys=%d;%s;0;", evicted, opts.evicted.Perf()),
+		)
+	}
+
+	switch info["role"] {
+	case "slave":
+		if status := info["master_link_status"]; status != "up" {
+			fail(fmt.Sprintf("master link to %s:%s is %s", info["master_host"], info["master_port"], status))
+		} else if idle, ok := info.Int("master_last_io_seconds_ago"); ok {
+			details = append(details, fmt.Sprintf("last master I/O %ds ago", idle))
+			apply(opts.masterIO, float64(idle), fmt.Sprintf("last master I/O %ds ago", idle))
+			perfs = append(perfs, fmt.Sprintf("redis_master_last_io=%ds;%s;0;", idle, opts.masterIO.Perf()))
+		}
+	case "master":
+		replicas := info.Numbered("slave")
+		if len(replicas) > 0 {
+			worst := int64(0)
+			for _, name := range replicas {
+				replica := info.Fields(name)
+				if state := replica["state"]; state != "online" {
+					levels = append(levels, "warning")
+					problems = append(problems, fmt.Sprintf("replica %s:%s is %s", replica["ip"], replica["port"], state))
+				}
+				if lag, err := strconv.ParseInt(replica["lag"], 10, 64); err == nil && lag > worst {
+					worst = lag
+				}
+			}
+			details = append(details, fmt.Sprintf("%d replicas", len(replicas)))
+			apply(opts.lag, float64(worst), fmt.Sprintf("replica acknowledged %ds ago", worst))
+			perfs = append(perfs, fmt.Sprintf("redis_replica_lag=%ds;%s;0;", worst, opts.lag.Perf()))
+		}
+	}
+
+	if info["redis_mode"] == "sentinel" {
+		for _, name := range info.Numbered("master") {
+			master := info.Fields(name)
+			if status := master["status"]; status != "ok" {
+				fail(fmt.Sprintf("sentinel master %s at %s is %s", master["name"], master["address"], status))
+			}
+		}
+	}
+
+	if cluster != nil {
+		if status := cluster["cluster_state"]; status != "ok" {
+			fail(fmt.Sprintf("cluster state is %s", status))
+		}
+		if failed, ok := cluster.Int("cluster_slots_fail"); ok && failed > 0 {
+			fail(fmt.Sprintf("%d cluster slots failed", failed))
+		}
+	}
+
+	output := strings.Join(details, ", ")
+	if len(problems) > 0 {
+		output += ": " + strings.Join(problems, ", ")
+	}
+	return check.WorstLevel(levels...), output + " | " + strings.Join(perfs, " ")
+}
+
+// roleOf describes the role of the server, including the Sentinel and
+// Cluster modes.
+func roleOf(info redis.Info) string {
+	switch {
+	case info["redis_mode"] == "sentinel":
+		return "sentinel"
+	case info["redis_mode"] == "cluster":
+		return "cluster " + info["role"]
+	default:
+		return info["role"]
+	}
 }
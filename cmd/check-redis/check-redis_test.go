@@ -0,0 +1,175 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/redis"
+)
+
+var now = time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+
+func master() redis.Info {
+	return redis.Info{
+		"redis_version":        "7.2.4",
+		"redis_mode":           "standalone",
+		"run_id":               "abc",
+		"role":                 "master",
+		"connected_clients":    "12",
+		"used_memory":          "471859200",
+		"maxmemory":            "1073741824",
+		"rejected_connections": "3",
+		"evicted_keys":         "87",
+		"slave0":               "ip=10.0.0.2,port=6379,state=online,offset=5012,lag=0",
+		"slave1":               "ip=10.0.0.3,port=6379,state=online,offset=4980,lag=3",
+	}
+}
+
+func defaults() options {
+	return options{key: "role", value: "master"}
+}
+
+func TestEvaluateDefaults(t *testing.T) {
+	level, message := evaluate(master(), nil, 410*time.Microsecond, nil, countersOf(master(), now), defaults())
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "Redis role is master, ping 0.41 ms, 12 clients, memory 43.9% of maxmemory, 2 replicas | redis_ping=0.410ms;;;0; redis_connected_clients=12;;;0; redis_used_memory=471859200B redis_memory_used=43.9%;;;0;100 redis_replica_lag=3s;;;0;", message)
+}
+
+func TestEvaluateKey(t *testing.T) {
+	opts := defaults()
+	opts.value = "slave"
+	level, message := evaluate(master(), nil, time.Millisecond, nil, countersOf(master(), now), opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "Redis role is master, ping 1.00 ms, 12 clients, memory 43.9% of maxmemory, 2 replicas: role is not slave |")
+
+	opts.key = ""
+	level, message = evaluate(master(), nil, time.Millisecond, nil, countersOf(master(), now), opts)
+	assert.Equal(t, "ok", level)
+	assert.Contains(t, message, "Redis 7.2.4 master, ping")
+}
+
+func TestEvaluateThresholds(t *testing.T) {
+	opts := defaults()
+	opts.memory = check.Threshold{Warning: 40, Critical: 90}
+	opts.clients = check.Threshold{Warning: 100, Critical: 200}
+	opts.latency = check.Threshold{Warning: 5, Critical: 50}
+	opts.lag = check.Threshold{Warning: 10, Critical: 30}
+
+	level, message := evaluate(master(), nil, time.Millisecond, nil, countersOf(master(), now), opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, ": memory at 43.9% of maxmemory, warning |")
+	assert.Contains(t, message, "redis_memory_used=43.9%;40;90;0;100")
+
+	level, message = evaluate(master(), nil, 60*time.Millisecond, nil, countersOf(master(), now), opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "ping took 60.00 ms, critical")
+
+	opts.lag = check.Threshold{Warning: 2}
+	level, message = evaluate(master(), nil, time.Millisecond, nil, countersOf(master(), now), opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "replica acknowledged 3s ago, warning")
+
+	// no maxmemory: no memory threshold
+	info := master()
+	info["maxmemory"] = "0"
+	opts = defaults()
+	opts.memory = check.Threshold{Critical: 1}
+	level, message = evaluate(info, nil, time.Millisecond, nil, countersOf(info, now), opts)
+	assert.Equal(t, "ok", level)
+	assert.NotContains(t, message, "redis_memory_used=")
+}
+
+func TestEvaluateCounters(t *testing.T) {
+	opts := defaults()
+	opts.rejected = check.Threshold{Warning: 1, Critical: 10}
+	opts.evicted = check.Threshold{Warning: 100, Critical: 1000}
+
+	previous := counters{Time: now.Add(-time.Minute), RunID: "abc", Rejected: 1, Evicted: 0}
+	level, message := evaluate(master(), nil, time.Millisecond, &previous, countersOf(master(), now), opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "2 connections rejected, warning")
+	assert.Contains(t, message, "redis_rejected_connections=2;1;10;0; redis_evicted_keys=87;100;1000;0;")
+
+	opts.evicted = check.Threshold{Critical: 50}
+	level, message = evaluate(master(), nil, time.Millisecond, &previous, countersOf(master(), now), opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "87 keys evicted, critical")
+
+	// restart: counters are not compared
+	previous.RunID = "def"
+	level, message = evaluate(master(), nil, time.Millisecond, &previous, countersOf(master(), now), opts)
+	assert.Equal(t, "ok", level)
+	assert.NotContains(t, message, "redis_evicted_keys")
+}
+
+func TestEvaluateReplica(t *testing.T) {
+	replica := redis.Info{
+		"redis_version":              "7.2.4",
+		"run_id":                     "abc",
+		"role":                       "slave",
+		"master_host":                "10.0.0.1",
+		"master_port":                "6379",
+		"master_link_status":         "up",
+		"master_last_io_seconds_ago": "12",
+	}
+	opts := options{key: "role", value: "slave", masterIO: check.Threshold{Warning: 10, Critical: 60}, lag: check.Threshold{Warning: 1}}
+
+	level, message := evaluate(replica, nil, time.Millisecond, nil, countersOf(replica, now), opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "last master I/O 12s ago: last master I/O 12s ago, warning")
+	assert.Contains(t, message, "redis_master_last_io=12s;10;60;0;")
+
+	replica["master_link_status"] = "down"
+	level, message = evaluate(replica, nil, time.Millisecond, nil, countersOf(replica, now), opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "master link to 10.0.0.1:6379 is down")
+	assert.NotContains(t, message, "redis_master_last_io")
+
+	info := master()
+	info["slave1"] = "ip=10.0.0.3,port=6379,state=wait_bgsave,offset=0,lag=0"
+	level, message = evaluate(info, nil, time.Millisecond, nil, countersOf(info, now), defaults())
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "replica 10.0.0.3:6379 is wait_bgsave")
+}
+
+func TestEvaluateSentinel(t *testing.T) {
+	info := redis.Info{
+		"redis_version":     "7.2.4",
+		"redis_mode":        "sentinel",
+		"connected_clients": "3",
+		"master0":           "name=mymaster,status=ok,address=10.0.0.1:6379,slaves=2,sentinels=3",
+	}
+	opts := defaults()
+
+	level, message := evaluate(info, nil, time.Millisecond, nil, countersOf(info, now), opts)
+	assert.Equal(t, "ok", level)
+	assert.Contains(t, message, "Redis 7.2.4 sentinel, ping")
+
+	info["master1"] = "name=cache,status=odown,address=10.0.0.9:6379,slaves=0,sentinels=3"
+	level, message = evaluate(info, nil, time.Millisecond, nil, countersOf(info, now), opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "sentinel master cache at 10.0.0.9:6379 is odown")
+
+	opts.key, opts.value = "redis_mode", "sentinel"
+	delete(info, "master1")
+	level, message = evaluate(info, nil, time.Millisecond, nil, countersOf(info, now), opts)
+	assert.Equal(t, "ok", level)
+	assert.Contains(t, message, "Redis redis_mode is sentinel, ping")
+}
+
+func TestEvaluateCluster(t *testing.T) {
+	info := master()
+	info["redis_mode"] = "cluster"
+	info["cluster_enabled"] = "1"
+	opts := options{}
+
+	level, message := evaluate(info, redis.Info{"cluster_state": "ok", "cluster_slots_fail": "0"}, time.Millisecond, nil, countersOf(info, now), opts)
+	assert.Equal(t, "ok", level)
+	assert.Contains(t, message, "Redis 7.2.4 cluster master")
+
+	level, message = evaluate(info, redis.Info{"cluster_state": "fail", "cluster_slots_fail": "12"}, time.Millisecond, nil, countersOf(info, now), opts)
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "cluster state is fail, 12 cluster slots failed")
+}
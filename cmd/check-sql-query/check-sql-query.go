@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/dbquery"
+	_ "modernc.org/sqlite"
+)
+
+func main() {
+	var (
+		dsn         string
+		query       string
+		queryFile   string
+		file        string
+		concurrency int
+		deadline    time.Duration
+		timeout     time.Duration
+	)
+
+	c := check.New("check-sql-query")
+	c.Option.SortFlags = false
+	c.Option.StringVar(&dsn, "dsn", os.Getenv("SQL_DSN"), "Data source name; the scheme (postgres, mysql, oracle, sqlite) selects the driver")
+	c.Option.StringVarP(&query, "query", "q", "", "Inline query returning two values: status (ok|warn|warning|error) and message")
+	c.Option.StringVar(&queryFile, "query-file", "", "File containing the query (alternative to -q)")
+	c.Option.StringVarP(&file, "file", "f", "", "File with connections for batch mode. Line format: label,dsn")
+	c.Option.IntVar(&concurrency, "concurrency", 10, "Maximum number of connections queried concurrently in batch mode")
+	c.Option.DurationVar(&deadline, "deadline", 60*time.Second, "Overall deadline for batch mode")
+	c.Option.DurationVarP(&timeout, "timeout", "T", 30*time.Second, "Timeout (per connection in batch mode)")
+	c.Init()
+
+	// Resolving the query text is a configuration concern; failures here are
+	// usage errors (exit 3) rather than a database problem.
+	stmt, err := dbquery.ReadQuery(query, queryFile)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// Batch mode: run the same query against every connection in the file,
+	// each with the driver of its own DSN scheme.
+	if len(file) > 0 {
+		connections, err := dbquery.ParseConnectionsFile(file)
+		if err != nil {
+			c.Error(err)
+			return
+		}
+		opts := dbquery.BatchOptions{Concurrency: concurrency, Timeout: timeout, Deadline: deadline}
+		status, output := dbquery.RunBatch(connections, opts, batchRunner(stmt))
+		c.Report(status, output)
+		return
+	}
+
+	if len(dsn) == 0 {
+		c.Error(fmt.Errorf("no DSN provided (use --dsn, $SQL_DSN or a connections file with -f)"))
+		return
+	}
+	driver, source, err := parseDSN(dsn)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	status, message, err := runQuery(driver, source, stmt, timeout)
+	if err != nil {
+		c.Critical(err.Error())
+		return
+	}
+
+	// The query decides the outcome; an unrecognized status is treated as a
+	// usage/contract error (exit 3).
+	status, err = dbquery.NormalizeStatus(status)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Report(status, message)
+}
+
+// batchRunner returns a dbquery.Runner that opens each connection with the
+// driver selected by its DSN scheme. An unsupported scheme fails only that
+// connection.
+func batchRunner(stmt string) dbquery.Runner {
+	return func(ctx context.Context, connection dbquery.Connection) (string, string, error) {
+		driver, source, err := parseDSN(connection.DSN)
+		if err != nil {
+			return "", "", err
+		}
+		connection.DSN = source
+
+		return dbquery.DatabaseRunner(driver, func(ctx context.Context, db *sql.DB) (string, string, error) {
+			return execQuery(ctx, db, stmt)
+		})(ctx, connection)
+	}
+}
+
+// runQuery opens the data source with the given driver and executes the
+// statement.
+func runQuery(driver string, source string, stmt string, timeout time.Duration) (string, string, error) {
+	db, err := sql.Open(driver, source)
+	if err != nil {
+		return "", "", oracleError(err)
+	}
+	defer db.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	return execQuery(ctx, db, stmt)
+}
+
+// execQuery runs the statement with dbquery.ExecQuery, so PL/SQL blocks and
+// MySQL procedure calls work as in the database specific checks, and reduces
+// Oracle errors to their ORA code and message.
+func execQuery(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+	status, message, err := dbquery.ExecQuery(ctx, db, stmt)
+	return status, message, oracleError(err)
+}
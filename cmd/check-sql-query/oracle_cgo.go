@@ -0,0 +1,17 @@
+//go:build cgo
+
+package main
+
+import (
+	_ "github.com/godror/godror"
+	"github.com/thomis/sensu-plugins-go/pkg/oracle"
+)
+
+// oracleSupported reports whether the godror driver is built in. It needs cgo
+// and the Oracle client libraries.
+const oracleSupported = true
+
+// oracleError reduces Oracle errors to their ORA code and message.
+func oracleError(err error) error {
+	return oracle.ExtractOracleError(err)
+}
@@ -0,0 +1,12 @@
+//go:build !cgo
+
+package main
+
+// oracleSupported is false in static builds: the godror driver needs cgo, so
+// oracle:// DSNs are rejected.
+const oracleSupported = false
+
+// oracleError returns err unchanged, as no Oracle errors can occur.
+func oracleError(err error) error {
+	return err
+}
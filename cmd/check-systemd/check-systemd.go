@@ -0,0 +1,288 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+	"github.com/thomis/sensu-plugins-go/pkg/state"
+)
+
+// options holds how unit states are rated.
+type options struct {
+	failedOnly    bool
+	inactiveLevel string
+	restarts      check.Threshold
+}
+
+// unit is the state of one checked unit. Restarts is the growth of NRestarts
+// since the previous run, -1 for units that are not services.
+type unit struct {
+	Name        string
+	ActiveState string
+	SubState    string
+	Result      string
+	Loaded      bool
+	NRestarts   int64
+	Restarts    int64
+}
+
+func main() {
+	var (
+		units     string
+		stateFile string
+		opts      options
+	)
+
+	c := check.New("CheckSystemd")
+	c.Option.StringVarP(&units, "unit", "u", "", "Comma-separated unit names or glob patterns, e.g. nginx,postgresql@*")
+	c.Option.BoolVarP(&opts.failedOnly, "failed", "f", false, "Check all failed units instead of --unit")
+	c.Option.StringVar(&opts.inactiveLevel, "inactive", "critical", "Level for inactive units (ok|warning|critical)")
+	c.Option.Float64Var(&opts.restarts.Warning, "restart-warn", 0, "Warning threshold for service restarts since the previous run (0 disables)")
+	c.Option.Float64Var(&opts.restarts.Critical, "restart-crit", 0, "Critical threshold for service restarts since the previous run (0 disables)")
+	c.Option.StringVar(&stateFile, "state-file", "", "File keeping the restart counters between runs (default: derived from the checked units in the temp directory)")
+	c.Init()
+
+	patterns := unitPatterns(units)
+	if len(patterns) == 0 && !opts.failedOnly {
+		c.Error(fmt.Errorf("either --unit or --failed is required"))
+		return
+	}
+	switch opts.inactiveLevel {
+	case "ok", "warning", "critical":
+	default:
+		c.Error(fmt.Errorf("invalid --inactive %q (expected ok, warning or critical)", opts.inactiveLevel))
+		return
+	}
+
+	bus, err := newSystemBus()
+	if err != nil {
+		c.Error(err)
+		return
+	}
+	defer bus.Close()
+
+	if len(stateFile) == 0 {
+		stateFile = state.DefaultFile("check-systemd", append(patterns, strconv.FormatBool(opts.failedOnly))...)
+	}
+	counters := loadState(stateFile)
+
+	result, err := collect(bus, patterns, opts.failedOnly, counters)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if opts.restarts.Enabled() {
+		if err := saveState(stateFile, counters, result); err != nil {
+			c.Error(err)
+			return
+		}
+	}
+
+	level, message := evaluate(result, opts)
+	c.Report(level, message)
+}
+
+// unitPatterns splits the --unit list. Like systemctl, names without a unit
+// type get ".service" appended.
+func unitPatterns(units string) []string {
+	patterns := []string{}
+	for _, name := range strings.Split(units, ",") {
+		name = strings.TrimSpace(name)
+		if len(name) == 0 {
+			continue
+		}
+		if !strings.Contains(name, ".") && !isGlob(name) {
+			name += ".service"
+		}
+		patterns = append(patterns, name)
+	}
+	return patterns
+}
+
+func isGlob(pattern string) bool {
+	return strings.ContainsAny(pattern, "*?[")
+}
+
+// collect lists the units and reads the result and restart counter of every
+// service. Named units that systemd has not loaded are reported as inactive.
+// previous holds the restart counters of the last run.
+func collect(bus systemdBus, patterns []string, failedOnly bool, previous map[string]int64) ([]unit, error) {
+	var states []string
+	if failedOnly {
+		states = []string{"failed"}
+	}
+
+	statuses, err := bus.ListUnitsByPatterns(states, patterns)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []unit{}
+	found := map[string]bool{}
+	for _, s := range statuses {
+		if s.LoadState == "not-found" {
+			continue
+		}
+		found[s.Name] = true
+
+		u := unit{Name: s.Name, ActiveState: s.ActiveState, SubState: s.SubState, Loaded: true, NRestarts: -1, Restarts: -1}
+		iface := unitInterface(s.Name)
+
+		if s.ActiveState == "failed" && len(iface) > 0 {
+			if v, err := bus.UnitProperty(s.Path, propertyPrefix+iface+".Result"); err == nil {
+				u.Result, _ = v.Value().(string)
+			}
+		}
+
+		if iface == "Service" {
+			if v, err := bus.UnitProperty(s.Path, propertyPrefix+"Service.NRestarts"); err == nil {
+				if n, ok := v.Value().(uint32); ok {
+					u.NRestarts = int64(n)
+					u.Restarts = restartGrowth(previous, s.Name, u.NRestarts)
+				}
+			}
+		}
+
+		result = append(result, u)
+	}
+
+	if !failedOnly {
+		for _, pattern := range patterns {
+			if !isGlob(pattern) && !found[pattern] {
+				result = append(result, unit{Name: pattern, ActiveState: "inactive", SubState: "dead", NRestarts: -1, Restarts: -1})
+			}
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// unitInterface returns the D-Bus interface of a unit type, e.g. "Service" for
+// "nginx.service".
+func unitInterface(name string) string {
+	switch name[strings.LastIndex(name, ".")+1:] {
+	case "service":
+		return "Service"
+	case "socket":
+		return "Socket"
+	case "mount":
+		return "Mount"
+	case "automount":
+		return "Automount"
+	case "swap":
+		return "Swap"
+	case "timer":
+		return "Timer"
+	case "path":
+		return "Path"
+	default:
+		return ""
+	}
+}
+
+// restartGrowth returns the restarts since the previous run. The first run
+// and counters that went backwards, e.g. after a reboot, count as zero.
+func restartGrowth(previous map[string]int64, name string, restarts int64) int64 {
+	last, found := previous[name]
+	if !found || restarts < last {
+		return 0
+	}
+	return restarts - last
+}
+
+// evaluate rates every unit: failed units and services restarting in a loop
+// are critical, inactive units use the --inactive level and restart growth is
+// compared against the thresholds.
+func evaluate(units []unit, opts options) (string, string) {
+	if len(units) == 0 {
+		if opts.failedOnly {
+			return "ok", "no failed units | failed=0"
+		}
+		return "critical", "no units match | units=0"
+	}
+
+	problems := []string{}
+	levels := []string{}
+	counts := map[string]int{}
+	perfs := []string{}
+
+	for _, u := range units {
+		level := "ok"
+		state := u.ActiveState
+		switch {
+		case u.ActiveState == "failed":
+			level = "critical"
+			if len(u.Result) > 0 && u.Result != "success" {
+				state = fmt.Sprintf("failed (%s)", u.Result)
+			}
+		case u.ActiveState == "activating" && u.SubState == "auto-restart":
+			level = "critical"
+			state = "restarting"
+		case u.ActiveState == "inactive":
+			level = opts.inactiveLevel
+			if !u.Loaded {
+				state = "inactive (not loaded)"
+			}
+		}
+		counts[u.ActiveState]++
+
+		if u.Restarts >= 0 && opts.restarts.Enabled() {
+			restartLevel := opts.restarts.Level(float64(u.Restarts))
+			if restartLevel != "ok" {
+				state = fmt.Sprintf("%s, %d restart(s)", state, u.Restarts)
+			}
+			level = check.WorstLevel(level, restartLevel)
+		}
+		if u.NRestarts >= 0 {
+			perfs = append(perfs, fmt.Sprintf("%s_restarts=%d", u.Name, u.NRestarts))
+		}
+
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, fmt.Sprintf("%s %s", u.Name, state))
+		}
+	}
+
+	summary := fmt.Sprintf("%d unit(s) active", counts["active"])
+	if opts.failedOnly {
+		summary = fmt.Sprintf("%d failed unit(s)", len(units))
+	}
+	if len(problems) > 0 {
+		summary = fmt.Sprintf("%s: %s", summary, strings.Join(problems, ", "))
+	}
+
+	perfs = append([]string{
+		fmt.Sprintf("units=%d", len(units)),
+		fmt.Sprintf("active=%d", counts["active"]),
+		fmt.Sprintf("failed=%d", counts["failed"]),
+		fmt.Sprintf("inactive=%d", counts["inactive"]),
+	}, perfs...)
+
+	return check.WorstLevel(levels...), fmt.Sprintf("%s | %s", summary, strings.Join(perfs, " "))
+}
+
+// loadState reads the restart counters of the previous run. A missing or
+// unreadable file starts from scratch.
+func loadState(path string) map[string]int64 {
+	counters := map[string]int64{}
+	if err := state.Load(path, &counters); err != nil {
+		return map[string]int64{}
+	}
+	return counters
+}
+
+// saveState stores the restart counters of the checked services, keeping the
+// counters of other units so several checks can share one file.
+func saveState(path string, counters map[string]int64, units []unit) error {
+	for _, u := range units {
+		if u.NRestarts >= 0 {
+			counters[u.Name] = u.NRestarts
+		}
+	}
+	return state.Save(path, counters)
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// fakeBus serves a fixed unit list and properties keyed by object path and
+// property name.
+type fakeBus struct {
+	units      []unitStatus
+	properties map[dbus.ObjectPath]map[string]interface{}
+	err        error
+	calls      [][]string
+}
+
+func (f *fakeBus) ListUnitsByPatterns(states []string, patterns []string) ([]unitStatus, error) {
+	f.calls = append(f.calls, append(append([]string{}, states...), patterns...))
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	result := []unitStatus{}
+	for _, u := range f.units {
+		if !contains(states, u.ActiveState) && len(states) > 0 {
+			continue
+		}
+		matched := len(patterns) == 0
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, u.Name); ok {
+				matched = true
+			}
+		}
+		if matched {
+			result = append(result, u)
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeBus) UnitProperty(p dbus.ObjectPath, property string) (dbus.Variant, error) {
+	value, found := f.properties[p][property]
+	if !found {
+		return dbus.Variant{}, errors.New("unknown property")
+	}
+	return dbus.MakeVariant(value), nil
+}
+
+func (f *fakeBus) Close() error {
+	return nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func newFakeBus() *fakeBus {
+	return &fakeBus{
+		units: []unitStatus{
+			{Name: "nginx.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/u/nginx"},
+			{Name: "postgresql@15-main.service", LoadState: "loaded", ActiveState: "active", SubState: "running", Path: "/u/pg15"},
+			{Name: "postgresql@16-main.service", LoadState: "loaded", ActiveState: "failed", SubState: "failed", Path: "/u/pg16"},
+			{Name: "worker.service", LoadState: "loaded", ActiveState: "activating", SubState: "auto-restart", Path: "/u/worker"},
+			{Name: "backup.timer", LoadState: "loaded", ActiveState: "failed", SubState: "failed", Path: "/u/backup"},
+			{Name: "ghost.service", LoadState: "not-found", ActiveState: "inactive", SubState: "dead", Path: "/u/ghost"},
+		},
+		properties: map[dbus.ObjectPath]map[string]interface{}{
+			"/u/nginx":  {"org.freedesktop.systemd1.Service.NRestarts": uint32(5)},
+			"/u/pg15":   {"org.freedesktop.systemd1.Service.NRestarts": uint32(0)},
+			"/u/pg16":   {"org.freedesktop.systemd1.Service.NRestarts": uint32(1), "org.freedesktop.systemd1.Service.Result": "exit-code"},
+			"/u/worker": {"org.freedesktop.systemd1.Service.NRestarts": uint32(42)},
+			"/u/backup": {"org.freedesktop.systemd1.Timer.Result": "resources"},
+		},
+	}
+}
+
+func TestUnitPatterns(t *testing.T) {
+	assert.Equal(t, []string{"nginx.service", "postgresql@*", "sshd.socket"}, unitPatterns("nginx, postgresql@*,,sshd.socket"))
+	assert.Empty(t, unitPatterns(""))
+}
+
+func TestCollect(t *testing.T) {
+	bus := newFakeBus()
+	units, err := collect(bus, []string{"nginx.service", "postgresql@*", "missing.service", "ghost.service"}, false, map[string]int64{"nginx.service": 3})
+	require.NoError(t, err)
+	assert.Equal(t, []unit{
+		{Name: "ghost.service", ActiveState: "inactive", SubState: "dead", NRestarts: -1, Restarts: -1},
+		{Name: "missing.service", ActiveState: "inactive", SubState: "dead", NRestarts: -1, Restarts: -1},
+		{Name: "nginx.service", ActiveState: "active", SubState: "running", Loaded: true, NRestarts: 5, Restarts: 2},
+		{Name: "postgresql@15-main.service", ActiveState: "active", SubState: "running", Loaded: true, NRestarts: 0, Restarts: 0},
+		{Name: "postgresql@16-main.service", ActiveState: "failed", SubState: "failed", Result: "exit-code", Loaded: true, NRestarts: 1, Restarts: 0},
+	}, units)
+
+	units, err = collect(bus, nil, true, map[string]int64{})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"failed"}, bus.calls[1])
+	assert.Equal(t, 2, len(units))
+	assert.Equal(t, unit{Name: "backup.timer", ActiveState: "failed", SubState: "failed", Result: "resources", Loaded: true, NRestarts: -1, Restarts: -1}, units[0])
+
+	bus.err = errors.New("access denied")
+	_, err = collect(bus, nil, true, nil)
+	assert.Error(t, err)
+}
+
+func TestRestartGrowth(t *testing.T) {
+	previous := map[string]int64{"a.service": 3}
+	assert.Equal(t, int64(2), restartGrowth(previous, "a.service", 5))
+	assert.Equal(t, int64(0), restartGrowth(previous, "a.service", 1))
+	assert.Equal(t, int64(0), restartGrowth(previous, "b.service", 7))
+}
+
+func TestEvaluate(t *testing.T) {
+	opts := options{inactiveLevel: "critical"}
+
+	level, message := evaluate([]unit{
+		{Name: "nginx.service", ActiveState: "active", SubState: "running", Loaded: true, NRestarts: 5, Restarts: 2},
+		{Name: "sshd.socket", ActiveState: "active", SubState: "listening", Loaded: true, NRestarts: -1, Restarts: -1},
+	}, opts)
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "2 unit(s) active | units=2 active=2 failed=0 inactive=0 nginx.service_restarts=5", message)
+
+	opts.restarts = check.Threshold{Warning: 1, Critical: 3}
+	level, message = evaluate([]unit{
+		{Name: "nginx.service", ActiveState: "active", Loaded: true, NRestarts: 5, Restarts: 2},
+	}, opts)
+	assert.Equal(t, "warning", level)
+	assert.Contains(t, message, "nginx.service active, 2 restart(s)")
+
+	units := []unit{
+		{Name: "cron.service", ActiveState: "inactive", SubState: "dead", Loaded: true, NRestarts: 0, Restarts: 0},
+		{Name: "db.service", ActiveState: "failed", Result: "exit-code", Loaded: true, NRestarts: 0, Restarts: 0},
+		{Name: "worker.service", ActiveState: "activating", SubState: "auto-restart", Loaded: true, NRestarts: 42, Restarts: 0},
+		{Name: "typo.service", ActiveState: "inactive", SubState: "dead", NRestarts: -1, Restarts: -1},
+	}
+	level, message = evaluate(units, options{inactiveLevel: "critical"})
+	assert.Equal(t, "critical", level)
+	assert.Contains(t, message, "0 unit(s) active: cron.service inactive, db.service failed (exit-code), worker.service restarting, typo.service inactive (not loaded)")
+	assert.Contains(t, message, "units=4 active=0 failed=1 inactive=2")
+
+	level, _ = evaluate(units[:1], options{inactiveLevel: "warning"})
+	assert.Equal(t, "warning", level)
+	level, _ = evaluate(units[:1], options{inactiveLevel: "ok"})
+	assert.Equal(t, "ok", level)
+
+	level, message = evaluate(units[1:2], options{failedOnly: true})
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "1 failed unit(s): db.service failed (exit-code) | units=1 active=0 failed=1 inactive=0 db.service_restarts=0", message)
+
+	level, message = evaluate(nil, options{failedOnly: true})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "no failed units | failed=0", message)
+
+	level, _ = evaluate(nil, options{})
+	assert.Equal(t, "critical", level)
+}
+
+func TestState(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	assert.Empty(t, loadState(file))
+
+	require.NoError(t, saveState(file, map[string]int64{"other.service": 9}, []unit{
+		{Name: "nginx.service", NRestarts: 5},
+		{Name: "sshd.socket", NRestarts: -1},
+	}))
+	assert.Equal(t, map[string]int64{"other.service": 9, "nginx.service": 5}, loadState(file))
+
+	require.NoError(t, os.WriteFile(file, []byte("{"), 0o644))
+	assert.Empty(t, loadState(file))
+
+	assert.Error(t, saveState(filepath.Join(file, "missing", "state.json"), map[string]int64{}, nil))
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	systemdDest    = "org.freedesktop.systemd1"
+	systemdPath    = dbus.ObjectPath("/org/freedesktop/systemd1")
+	managerIface   = "org.freedesktop.systemd1.Manager"
+	propertyPrefix = "org.freedesktop.systemd1."
+)
+
+// unitStatus is one entry of the systemd manager's unit list.
+type unitStatus struct {
+	Name        string
+	Description string
+	LoadState   string
+	ActiveState string
+	SubState    string
+	Following   string
+	Path        dbus.ObjectPath
+	JobID       uint32
+	JobType     string
+	JobPath     dbus.ObjectPath
+}
+
+// systemdBus is the part of the systemd D-Bus API the check uses, so tests can
+// replace the system bus with a fake.
+type systemdBus interface {
+	// ListUnitsByPatterns returns the loaded units in one of states (all if
+	// empty) whose names match one of the glob patterns (all if empty).
+	ListUnitsByPatterns(states []string, patterns []string) ([]unitStatus, error)
+	// UnitProperty returns a property of a unit object, e.g.
+	// "org.freedesktop.systemd1.Service.NRestarts".
+	UnitProperty(path dbus.ObjectPath, property string) (dbus.Variant, error)
+	Close() error
+}
+
+// systemBus talks to systemd over the D-Bus system bus.
+type systemBus struct {
+	conn *dbus.Conn
+}
+
+func newSystemBus() (*systemBus, error) {
+	conn, err := dbus.ConnectSystemBus()
+	if err != nil {
+		return nil, err
+	}
+	return &systemBus{conn: conn}, nil
+}
+
+func (b *systemBus) ListUnitsByPatterns(states []string, patterns []string) ([]unitStatus, error) {
+	var units []unitStatus
+	err := b.conn.Object(systemdDest, systemdPath).
+		Call(managerIface+".ListUnitsByPatterns", 0, states, patterns).
+		Store(&units)
+	return units, err
+}
+
+func (b *systemBus) UnitProperty(path dbus.ObjectPath, property string) (dbus.Variant, error) {
+	return b.conn.Object(systemdDest, path).GetProperty(property)
+}
+
+func (b *systemBus) Close() error {
+	return b.conn.Close()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+	"github.com/thomis/sensu-plugins-go/pkg/metrics"
+)
+
+func main() {
+	var (
+		sleep   int
+		include string
+		exclude string
+	)
+
+	m := metrics.New("")
+	m.Option.IntVarP(&sleep, "sleep", "s", 1, "SLEEP")
+	m.Option.StringVarP(&include, "include", "i", "", "Only report devices matching this regular expression")
+	m.Option.StringVarP(&exclude, "exclude", "x", `^(loop|ram|fd)\d+$`, "Skip devices matching this regular expression")
+	m.Init()
+
+	includeRe, err := common.CompileFilter(include)
+	if err != nil {
+		m.Error(fmt.Errorf("invalid --include: %w", err))
+		return
+	}
+	excludeRe, err := common.CompileFilter(exclude)
+	if err != nil {
+		m.Error(fmt.Errorf("invalid --exclude: %w", err))
+		return
+	}
+
+	devices, err := common.SampleDiskIO(sleep)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+
+	for _, d := range common.SelectDiskIO(devices, includeRe, excludeRe) {
+
+		prefix := "disk_io." + strings.ReplaceAll(d.Name, "/", "_") + "."
+		m.Scheme(prefix + "read_iops").Print(d.ReadIOPS)
+		m.Scheme(prefix + "write_iops").Print(d.WriteIOPS)
+		m.Scheme(prefix + "read_bytes").Print(d.ReadBytes)
+		m.Scheme(prefix + "write_bytes").Print(d.WriteBytes)
+		m.Scheme(prefix + "read_await").Print(d.ReadAwait)
+		m.Scheme(prefix + "write_await").Print(d.WriteAwait)
+		m.Scheme(prefix + "await").Print(d.Await)
+		m.Scheme(prefix + "util").Print(d.Util)
+	}
+}
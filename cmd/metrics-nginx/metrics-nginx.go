@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/metrics"
+	"github.com/thomis/sensu-plugins-go/pkg/nginx"
+)
+
+type metric struct {
+	name  string
+	value float64
+}
+
+func main() {
+	var (
+		url     string
+		timeout int
+		sleep   int
+	)
+
+	m := metrics.New("")
+	m.Option.StringVarP(&url, "url", "u", "http://localhost/nginx-status", "NGINX status page URL")
+	m.Option.IntVarP(&timeout, "timeout", "t", 15, "NGINX status page timeout in seconds")
+	m.Option.IntVarP(&sleep, "sleep", "s", 1, "SLEEP")
+	m.Init()
+
+	if sleep < 1 {
+		sleep = 1
+	}
+	client := &http.Client{Timeout: time.Duration(timeout) * time.Second}
+
+	before, err := nginx.GetStubStatus(client, url)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+
+	time.Sleep(time.Duration(sleep) * time.Second)
+
+	after, err := nginx.GetStubStatus(client, url)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+
+	for _, v := range metricsOf(before, after, float64(sleep)) {
+		m.Scheme("nginx." + v.name).Print(v.value)
+	}
+}
+
+// metricsOf lists the gauges and counters of the second sample, followed by
+// the rates between both unless NGINX was restarted in between.
+func metricsOf(before, after nginx.StubStatus, seconds float64) []metric {
+	list := []metric{
+		{"active", float64(after.Active)},
+		{"reading", float64(after.Reading)},
+		{"writing", float64(after.Writing)},
+		{"waiting", float64(after.Waiting)},
+		{"accepts", float64(after.Accepts)},
+		{"handled", float64(after.Handled)},
+		{"requests", float64(after.Requests)},
+	}
+	if rates, ok := nginx.StubStatusRates(before, after, seconds); ok {
+		list = append(list,
+			metric{"requests_per_second", rates.Requests},
+			metric{"accepts_per_second", rates.Accepts},
+			metric{"dropped", float64(rates.Dropped)},
+		)
+	}
+	return list
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/metrics"
+	"github.com/thomis/sensu-plugins-go/pkg/redis"
+)
+
+type metric struct {
+	name  string
+	value float64
+}
+
+var keyspace = regexp.MustCompile(`^db\d+$`)
+
+func main() {
+	var (
+		connection     redis.Options
+		connectTimeout int
+		readTimeout    int
+		scheme         string
+		sections       []string
+	)
+
+	m := metrics.New("")
+	m.Option.StringVarP(&connection.Host, "host", "h", "localhost", "HOST")
+	m.Option.IntVarP(&connection.Port, "port", "P", 6379, "PORT")
+	m.Option.StringVar(&connection.Username, "user", "", "ACL username (Redis 6 and later)")
+	m.Option.StringVarP(&connection.Password, "password", "a", os.Getenv("REDISCLI_AUTH"), "Password")
+	m.Option.BoolVar(&connection.TLS, "tls", false, "Connect with TLS")
+	m.Option.BoolVar(&connection.TLSInsecure, "tls-insecure", false, "Skip verification of the server certificate")
+	m.Option.StringVar(&connection.TLSCA, "tls-ca", "", "CA certificate file (PEM) to verify the server certificate")
+	m.Option.StringVar(&connection.TLSCert, "tls-cert", "", "Client certificate file (PEM)")
+	m.Option.StringVar(&connection.TLSKey, "tls-key", "", "Client private key file (PEM)")
+	m.Option.StringVar(&connection.TLSServerName, "tls-server-name", "", "Server name to verify (default: host)")
+	m.Option.IntVar(&connectTimeout, "connect-timeout", 5, "Connect timeout in seconds")
+	m.Option.IntVar(&readTimeout, "read-timeout", 5, "Read timeout in seconds")
+	m.Option.StringVarP(&scheme, "scheme", "s", "redis", "Metric name prefix")
+	m.Option.StringSliceVar(&sections, "section", nil, "Only report these INFO sections, e.g. memory,stats (default: the default INFO sections)")
+	m.Init()
+
+	connection.ConnectTimeout = time.Duration(connectTimeout) * time.Second
+	connection.ReadTimeout = time.Duration(readTimeout) * time.Second
+
+	conn, err := redis.Dial(connection)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	latency, err := redis.Ping(conn)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+
+	info, err := redis.GetInfo(conn, sections...)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+
+	m.Scheme(scheme + ".ping_ms").Print(float64(latency.Microseconds()) / 1000)
+	for _, v := range metricsOf(info) {
+		m.Scheme(scheme + "." + v.name).Print(v.value)
+	}
+}
+
+// metricsOf lists the numeric INFO fields by name, the keys, expires and
+// average TTL of each database as keyspace.<db>.<field> and the replication
+// link as master_link_up on replicas.
+func metricsOf(info redis.Info) []metric {
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	list := []metric{}
+	for _, name := range names {
+		if keyspace.MatchString(name) {
+			fields := info.Fields(name)
+			for _, field := range []string{"keys", "expires", "avg_ttl"} {
+				if value, err := strconv.ParseFloat(fields[field], 64); err == nil {
+					list = append(list, metric{"keyspace." + name + "." + field, value})
+				}
+			}
+			continue
+		}
+		if value, ok := info.Float(name); ok {
+			list = append(list, metric{name, value})
+		}
+	}
+
+	if status, ok := info["master_link_status"]; ok {
+		up := 0.0
+		if status == "up" {
+			up = 1
+		}
+		list = append(list, metric{"master_link_up", up})
+	}
+	return list
+}
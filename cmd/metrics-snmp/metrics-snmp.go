@@ -1,8 +1,9 @@
 package main
 
 import (
-	"os/exec"
-	"strconv"
+	"errors"
+	"fmt"
+	"net"
 	"strings"
 	"sync"
 	"time"
@@ -12,72 +13,95 @@ import (
 
 func main() {
 	var (
-		hosts     string
-		community string
-		sleep     int
-		wg        sync.WaitGroup
+		hosts  string
+		sleep  int
+		config string
+		opts   options
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
 	)
 
 	m := metrics.New("")
 	m.Option.StringVarP(&hosts, "hosts", "h", "127.0.0.1", "HOSTS")
-	m.Option.StringVarP(&community, "community", "c", "public", "COMMUNITY")
+	m.Option.StringVarP(&opts.Community, "community", "c", "public", "COMMUNITY")
 	m.Option.IntVarP(&sleep, "sleep", "s", 1, "SLEEP")
+	m.Option.StringVarP(&opts.Version, "version", "v", "2c", "SNMP version (2c|3)")
+	m.Option.IntVarP(&opts.Port, "port", "p", 161, "PORT")
+	m.Option.DurationVar(&opts.Timeout, "timeout", 5*time.Second, "Timeout per request")
+	m.Option.IntVar(&opts.Retries, "retries", 1, "Retries per request")
+	m.Option.StringVarP(&opts.User, "user", "u", "", "SNMPv3 user")
+	m.Option.StringVarP(&opts.SecurityLevel, "security-level", "l", "authPriv", "SNMPv3 security level (noAuthNoPriv|authNoPriv|authPriv)")
+	m.Option.StringVarP(&opts.AuthProtocol, "auth-protocol", "a", "SHA", "SNMPv3 auth protocol (MD5|SHA|SHA224|SHA256|SHA384|SHA512)")
+	m.Option.StringVarP(&opts.AuthPassword, "auth-password", "A", "", "SNMPv3 auth password")
+	m.Option.StringVarP(&opts.PrivProtocol, "priv-protocol", "x", "AES", "SNMPv3 privacy protocol (DES|AES|AES192|AES256|AES192C|AES256C)")
+	m.Option.StringVarP(&opts.PrivPassword, "priv-password", "X", "", "SNMPv3 privacy password")
+	m.Option.StringVarP(&opts.Context, "context", "n", "", "SNMPv3 context name")
+	m.Option.StringVar(&opts.Label, "label", "name", "Interface label (name|alias|index); alias falls back to ifName")
+	m.Option.StringVarP(&config, "config", "f", "", "JSON file with additional OIDs to poll")
 	m.Init()
 
+	cfg, err := loadConfig(config)
+	if err != nil {
+		m.Error(err)
+		return
+	}
+
 	for _, host := range strings.Split(hosts, ",") {
 		wg.Add(1)
 
 		go func(host string) {
-			var port string
+			defer wg.Done()
 
-			beforeTraffics, err := snmpWalk(host, community)
+			result, err := poll(host, opts, cfg, time.Duration(sleep)*time.Second)
 			if err != nil {
-				wg.Done()
+				mu.Lock()
+				failed = append(failed, fmt.Errorf("%s: %w", host, err))
+				mu.Unlock()
 				return
 			}
 
-			time.Sleep(time.Duration(sleep) * time.Second)
-
-			afterTraffics, err := snmpWalk(host, community)
-			if err != nil {
-				wg.Done()
-				return
+			hostname := host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				hostname = h
 			}
-
-			tmp := metrics.New("").Hostname(host)
-			for i := range beforeTraffics[0] {
-				port = strconv.Itoa(i + 1)
-				tmp.Scheme("snmp.rx_bytes." + port).Print(float64(afterTraffics[0][i] - beforeTraffics[0][i]))
-				tmp.Scheme("snmp.tx_bytes." + port).Print(float64(afterTraffics[1][i] - beforeTraffics[1][i]))
+			tmp := metrics.New("").Hostname(hostname)
+			for _, r := range result {
+				tmp.Scheme("snmp." + r.Name).Print(r.Value)
 			}
-
-			wg.Done()
-		}(host)
+		}(strings.TrimSpace(host))
 	}
 
 	wg.Wait()
+
+	// The hosts that answered are still emitted before the run fails.
+	if len(failed) > 0 {
+		m.Error(errors.Join(failed...))
+	}
 }
 
-func snmpWalk(host string, community string) ([2][]int64, error) {
-	var traffic int64
-	var traffics [2][]int64
+// poll samples a host twice, interval apart, and returns the metrics.
+func poll(host string, opts options, cfg oidConfig, interval time.Duration) ([]metric, error) {
+	client, err := newClient(host, opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := client.Connect(); err != nil {
+		return nil, err
+	}
+	defer client.Conn.Close()
 
-	for i, oid := range []string{"1.3.6.1.2.1.2.2.1.10", "1.3.6.1.2.1.2.2.1.16"} {
-		out, err := exec.Command("snmpwalk", "-v", "2c", "-c", community, host, oid).Output()
-		if err != nil {
-			return traffics, err
-		}
+	before, err := sample(client, cfg, opts.Label)
+	if err != nil {
+		return nil, err
+	}
 
-		lines := strings.Split(strings.TrimRight(string(out), "\n"), "\n")
-		for _, line := range lines {
-			traffic, err = strconv.ParseInt(strings.Fields(line)[3], 10, 64)
-			if err != nil {
-				return traffics, err
-			}
+	time.Sleep(interval)
 
-			traffics[i] = append(traffics[i], traffic)
-		}
+	after, err := sample(client, cfg, opts.Label)
+	if err != nil {
+		return nil, err
 	}
 
-	return traffics, nil
+	return deltas(before, after), nil
 }
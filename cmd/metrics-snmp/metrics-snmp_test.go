@@ -0,0 +1,438 @@
+package main
+
+import (
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// agent is a minimal in-process SNMP agent answering Get, GetNext and GetBulk
+// requests from a fixed table. With usm set it speaks SNMPv3, otherwise v2c.
+type agent struct {
+	conn      net.PacketConn
+	community string
+	usm       *gosnmp.UsmSecurityParameters
+
+	mu    sync.Mutex
+	table []gosnmp.SnmpPDU
+}
+
+const agentEngineID = "\x80\x00\x1f\x88\x80sensu-test"
+
+func newAgent(t *testing.T, table []gosnmp.SnmpPDU, usm *gosnmp.UsmSecurityParameters) *agent {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+
+	a := &agent{conn: conn, community: "public", usm: usm}
+	a.set(table)
+	if usm != nil {
+		usm.AuthoritativeEngineID = agentEngineID
+		usm.AuthoritativeEngineBoots = 1
+		usm.AuthoritativeEngineTime = 1
+		require.Nil(t, usm.InitSecurityKeys())
+	}
+
+	go a.serve()
+	t.Cleanup(func() { conn.Close() })
+	return a
+}
+
+func (a *agent) address() string {
+	return a.conn.LocalAddr().String()
+}
+
+// set replaces the table, e.g. to advance counters between two samples.
+func (a *agent) set(table []gosnmp.SnmpPDU) {
+	sorted := append([]gosnmp.SnmpPDU{}, table...)
+	sort.Slice(sorted, func(i, j int) bool { return oidLess(sorted[i].Name, sorted[j].Name) })
+
+	a.mu.Lock()
+	a.table = sorted
+	a.mu.Unlock()
+}
+
+func (a *agent) serve() {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := a.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if response := a.handle(append([]byte{}, buf[:n]...)); response != nil {
+			a.conn.WriteTo(response, addr)
+		}
+	}
+}
+
+func (a *agent) handle(request []byte) []byte {
+	decoder := &gosnmp.GoSNMP{Version: gosnmp.Version2c, Community: a.community, Logger: gosnmp.NewLogger(nil)}
+	if a.usm != nil {
+		decoder.Version = gosnmp.Version3
+		decoder.SecurityModel = gosnmp.UserSecurityModel
+		decoder.MsgFlags = gosnmp.AuthPriv
+		decoder.SecurityParameters = a.usm.Copy()
+	}
+
+	packet, err := decoder.SnmpDecodePacket(request)
+	if err != nil {
+		return nil
+	}
+
+	response := &gosnmp.SnmpPacket{
+		Version:   packet.Version,
+		Community: packet.Community,
+		PDUType:   gosnmp.GetResponse,
+		RequestID: packet.RequestID,
+	}
+
+	if packet.Version == gosnmp.Version3 {
+		response.MsgID = packet.MsgID
+		response.SecurityModel = gosnmp.UserSecurityModel
+		response.ContextEngineID = agentEngineID
+		response.ContextName = packet.ContextName
+		response.MsgFlags = packet.MsgFlags &^ gosnmp.Reportable
+		response.SecurityParameters = a.usm.Copy()
+
+		// engine discovery
+		if packet.SecurityParameters.(*gosnmp.UsmSecurityParameters).AuthoritativeEngineID == "" {
+			response.PDUType = gosnmp.Report
+			response.MsgFlags = gosnmp.NoAuthNoPriv
+			response.SecurityParameters = &gosnmp.UsmSecurityParameters{
+				AuthoritativeEngineID:    agentEngineID,
+				AuthoritativeEngineBoots: 1,
+				AuthoritativeEngineTime:  1,
+				Logger:                   gosnmp.NewLogger(nil),
+			}
+			response.Variables = []gosnmp.SnmpPDU{{Name: ".1.3.6.1.6.3.15.1.1.4.0", Type: gosnmp.Counter32, Value: uint32(1)}}
+			out, _ := response.MarshalMsg()
+			return out
+		}
+	} else if packet.Community != a.community {
+		return nil
+	}
+
+	switch packet.PDUType {
+	case gosnmp.GetRequest:
+		for _, v := range packet.Variables {
+			response.Variables = append(response.Variables, a.get(v.Name))
+		}
+	case gosnmp.GetNextRequest:
+		for _, v := range packet.Variables {
+			response.Variables = append(response.Variables, a.next(v.Name))
+		}
+	case gosnmp.GetBulkRequest:
+		for _, v := range packet.Variables {
+			name := v.Name
+			for i := uint32(0); i < packet.MaxRepetitions; i++ {
+				pdu := a.next(name)
+				response.Variables = append(response.Variables, pdu)
+				if pdu.Type == gosnmp.EndOfMibView {
+					break
+				}
+				name = pdu.Name
+			}
+		}
+	default:
+		return nil
+	}
+
+	out, err := response.MarshalMsg()
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func (a *agent) get(name string) gosnmp.SnmpPDU {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, pdu := range a.table {
+		if pdu.Name == name {
+			return pdu
+		}
+	}
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.NoSuchObject}
+}
+
+func (a *agent) next(name string) gosnmp.SnmpPDU {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, pdu := range a.table {
+		if oidLess(name, pdu.Name) {
+			return pdu
+		}
+	}
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.EndOfMibView}
+}
+
+// oidLess compares two OIDs arc by arc.
+func oidLess(a, b string) bool {
+	x := strings.Split(strings.TrimPrefix(a, "."), ".")
+	y := strings.Split(strings.TrimPrefix(b, "."), ".")
+	for i := 0; i < len(x) && i < len(y); i++ {
+		m, n := new(big.Int), new(big.Int)
+		m.SetString(x[i], 10)
+		n.SetString(y[i], 10)
+		if c := m.Cmp(n); c != 0 {
+			return c < 0
+		}
+	}
+	return len(x) < len(y)
+}
+
+func octets(name string, value string) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.OctetString, Value: []byte(value)}
+}
+
+func counter64(name string, value uint64) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.Counter64, Value: value}
+}
+
+func counter32(name string, value uint32) gosnmp.SnmpPDU {
+	return gosnmp.SnmpPDU{Name: name, Type: gosnmp.Counter32, Value: value}
+}
+
+// interfaceTable returns two interfaces, the second without an alias, with
+// the given counters.
+func interfaceTable(rx1, tx1, rx2, tx2 uint64) []gosnmp.SnmpPDU {
+	return []gosnmp.SnmpPDU{
+		octets(".1.3.6.1.2.1.31.1.1.1.1.1", "Gi0/1"),
+		octets(".1.3.6.1.2.1.31.1.1.1.1.2", "Gi0/2"),
+		counter64(".1.3.6.1.2.1.31.1.1.1.6.1", rx1),
+		counter64(".1.3.6.1.2.1.31.1.1.1.6.2", rx2),
+		counter64(".1.3.6.1.2.1.31.1.1.1.10.1", tx1),
+		counter64(".1.3.6.1.2.1.31.1.1.1.10.2", tx2),
+		octets(".1.3.6.1.2.1.31.1.1.1.18.1", "uplink core"),
+		{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: uint32(4242)},
+	}
+}
+
+func testOptions() options {
+	return options{Version: "2c", Port: 161, Community: "public", Timeout: time.Second, Retries: 0, Label: "name"}
+}
+
+func sampleAgent(t *testing.T, a *agent, opts options, cfg oidConfig) []reading {
+	client, err := newClient(a.address(), opts)
+	require.Nil(t, err)
+	require.Nil(t, client.Connect())
+	defer client.Conn.Close()
+
+	readings, err := sample(client, cfg, opts.Label)
+	require.Nil(t, err)
+	return readings
+}
+
+func TestSampleInterfaces(t *testing.T) {
+	a := newAgent(t, interfaceTable(1000, 2000, 10, 20), nil)
+
+	before := sampleAgent(t, a, testOptions(), oidConfig{})
+	a.set(interfaceTable(1500, 2100, 10, 20))
+	after := sampleAgent(t, a, testOptions(), oidConfig{})
+
+	assert.Equal(t, []metric{
+		{"rx_bytes.Gi0_1", 500},
+		{"tx_bytes.Gi0_1", 100},
+		{"rx_bytes.Gi0_2", 0},
+		{"tx_bytes.Gi0_2", 0},
+	}, deltas(before, after))
+
+	opts := testOptions()
+	opts.Label = "alias"
+	names := []string{}
+	for _, r := range sampleAgent(t, a, opts, oidConfig{}) {
+		names = append(names, r.Name)
+	}
+	assert.Equal(t, []string{"rx_bytes.uplink_core", "tx_bytes.uplink_core", "rx_bytes.Gi0_2", "tx_bytes.Gi0_2"}, names)
+
+	opts.Label = "index"
+	assert.Equal(t, "rx_bytes.1", sampleAgent(t, a, opts, oidConfig{})[0].Name)
+}
+
+func TestSampleFallsBackTo32BitCounters(t *testing.T) {
+	a := newAgent(t, []gosnmp.SnmpPDU{
+		counter32(".1.3.6.1.2.1.2.2.1.10.1", 4294967000),
+		counter32(".1.3.6.1.2.1.2.2.1.16.1", 10),
+	}, nil)
+
+	before := sampleAgent(t, a, testOptions(), oidConfig{})
+	a.set([]gosnmp.SnmpPDU{
+		counter32(".1.3.6.1.2.1.2.2.1.10.1", 704),
+		counter32(".1.3.6.1.2.1.2.2.1.16.1", 30),
+	})
+	after := sampleAgent(t, a, testOptions(), oidConfig{})
+
+	assert.Equal(t, []metric{{"rx_bytes.1", 1000}, {"tx_bytes.1", 20}}, deltas(before, after))
+}
+
+func TestSampleCustomOIDs(t *testing.T) {
+	table := append(interfaceTable(0, 0, 0, 0),
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.9.9.109.1.1.1.1.8.1", Type: gosnmp.Gauge32, Value: uint(12)},
+		gosnmp.SnmpPDU{Name: ".1.3.6.1.4.1.9.9.109.1.1.1.1.8.7", Type: gosnmp.Gauge32, Value: uint(34)},
+	)
+	a := newAgent(t, table, nil)
+
+	disabled := false
+	cfg := oidConfig{
+		Interfaces: &disabled,
+		OIDs: []customOID{
+			{Name: "uptime", OID: "1.3.6.1.2.1.1.3.0"},
+			{Name: "cpu", OID: "1.3.6.1.4.1.9.9.109.1.1.1.1.8", Walk: true},
+			{Name: "missing", OID: "1.3.6.1.2.1.1.99.0"},
+		},
+	}
+	readings := sampleAgent(t, a, testOptions(), cfg)
+
+	assert.Equal(t, []metric{{"uptime", 4242}, {"cpu.1", 12}, {"cpu.7", 34}}, deltas(nil, readings))
+}
+
+func TestSampleV3AuthPriv(t *testing.T) {
+	a := newAgent(t, interfaceTable(1000, 2000, 10, 20), &gosnmp.UsmSecurityParameters{
+		UserName:                 "monitor",
+		AuthenticationProtocol:   gosnmp.SHA,
+		AuthenticationPassphrase: "authsecret",
+		PrivacyProtocol:          gosnmp.AES,
+		PrivacyPassphrase:        "privsecret",
+		Logger:                   gosnmp.NewLogger(nil),
+	})
+
+	opts := testOptions()
+	opts.Version = "3"
+	opts.User = "monitor"
+	opts.SecurityLevel = "authPriv"
+	opts.AuthProtocol = "sha"
+	opts.AuthPassword = "authsecret"
+	opts.PrivProtocol = "aes"
+	opts.PrivPassword = "privsecret"
+
+	readings := sampleAgent(t, a, opts, oidConfig{})
+	require.Equal(t, 4, len(readings))
+	assert.Equal(t, "rx_bytes.Gi0_1", readings[0].Name)
+	assert.Equal(t, int64(1000), readings[0].Value.Int64())
+}
+
+func TestDeltas(t *testing.T) {
+	max64 := new(big.Int).SetUint64(^uint64(0))
+	before := []reading{
+		{Name: "c32", Type: gosnmp.Counter32, Value: big.NewInt(4294967290)},
+		{Name: "c64", Type: gosnmp.Counter64, Value: max64},
+		{Name: "steady", Type: gosnmp.Counter64, Value: big.NewInt(7)},
+		{Name: "changed", Type: gosnmp.Counter32, Value: big.NewInt(5)},
+	}
+	after := []reading{
+		{Name: "c32", Type: gosnmp.Counter32, Value: big.NewInt(4)},
+		{Name: "c64", Type: gosnmp.Counter64, Value: big.NewInt(9)},
+		{Name: "steady", Type: gosnmp.Counter64, Value: big.NewInt(7)},
+		{Name: "changed", Type: gosnmp.Counter64, Value: big.NewInt(50)},
+		{Name: "new", Type: gosnmp.Counter64, Value: big.NewInt(1)},
+		{Name: "gauge", Type: gosnmp.Gauge32, Value: big.NewInt(3)},
+	}
+
+	assert.Equal(t, []metric{
+		{"c32", 10},
+		{"c64", 10},
+		{"steady", 0},
+		{"gauge", 3},
+	}, deltas(before, after))
+}
+
+func TestInterfaceLabels(t *testing.T) {
+	labels := interfaceLabels(
+		[]string{"1", "2", "3", "4"},
+		map[string]string{"1": "eth0", "2": "eth0", "3": "Po1.100"},
+		map[string]string{"3": "  "},
+	)
+	assert.Equal(t, map[string]string{"1": "eth0", "2": "eth0_2", "3": "Po1_100", "4": "4"}, labels)
+}
+
+func TestNewClient(t *testing.T) {
+	opts := testOptions()
+	client, err := newClient("192.0.2.1:1161", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "192.0.2.1", client.Target)
+	assert.Equal(t, uint16(1161), client.Port)
+	assert.Equal(t, gosnmp.Version2c, client.Version)
+
+	client, err = newClient("192.0.2.1", opts)
+	assert.Nil(t, err)
+	assert.Equal(t, uint16(161), client.Port)
+
+	_, err = newClient("192.0.2.1:snmp", opts)
+	assert.NotNil(t, err)
+
+	opts.Version = "1"
+	_, err = newClient("192.0.2.1", opts)
+	assert.NotNil(t, err)
+}
+
+func TestUsmParameters(t *testing.T) {
+	opts := options{User: "monitor", SecurityLevel: "authPriv", AuthProtocol: "sha256", AuthPassword: "authsecret", PrivProtocol: "AES256", PrivPassword: "privsecret"}
+	usm, flags, err := usmParameters(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, gosnmp.AuthPriv, flags)
+	assert.Equal(t, gosnmp.SHA256, usm.AuthenticationProtocol)
+	assert.Equal(t, gosnmp.AES256, usm.PrivacyProtocol)
+
+	opts.SecurityLevel = "authNoPriv"
+	usm, flags, err = usmParameters(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, gosnmp.AuthNoPriv, flags)
+	assert.Equal(t, gosnmp.NoPriv, usm.PrivacyProtocol)
+
+	opts.SecurityLevel = "noAuthNoPriv"
+	usm, flags, err = usmParameters(opts)
+	assert.Nil(t, err)
+	assert.Equal(t, gosnmp.NoAuthNoPriv, flags)
+	assert.Equal(t, gosnmp.NoAuth, usm.AuthenticationProtocol)
+
+	for _, broken := range []options{
+		{SecurityLevel: "authPriv"},
+		{User: "monitor", SecurityLevel: "secure"},
+		{User: "monitor", SecurityLevel: "authNoPriv", AuthProtocol: "sha3", AuthPassword: "authsecret"},
+		{User: "monitor", SecurityLevel: "authNoPriv", AuthProtocol: "sha", AuthPassword: "short"},
+		{User: "monitor", SecurityLevel: "authPriv", AuthProtocol: "sha", AuthPassword: "authsecret", PrivProtocol: "3des", PrivPassword: "privsecret"},
+		{User: "monitor", SecurityLevel: "authPriv", AuthProtocol: "sha", AuthPassword: "authsecret", PrivProtocol: "aes"},
+	} {
+		_, _, err := usmParameters(broken)
+		assert.NotNil(t, err, "%+v", broken)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	cfg, err := loadConfig("")
+	assert.Nil(t, err)
+	assert.True(t, cfg.interfacesEnabled())
+
+	cfg, err = loadConfig("../../config/metrics-snmp.json")
+	assert.Nil(t, err)
+	assert.True(t, cfg.interfacesEnabled())
+	assert.Equal(t, "1.3.6.1.2.1.1.3.0", cfg.OIDs[0].OID)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "snmp.json")
+	require.Nil(t, os.WriteFile(path, []byte(`{"interfaces": false, "oids": [{"name": "uptime", "oid": ".1.3.6.1.2.1.1.3.0"}]}`), 0o644))
+	cfg, err = loadConfig(path)
+	assert.Nil(t, err)
+	assert.False(t, cfg.interfacesEnabled())
+	assert.Equal(t, "1.3.6.1.2.1.1.3.0", cfg.OIDs[0].OID)
+
+	require.Nil(t, os.WriteFile(path, []byte(`{"oids": [{"name": "uptime"}]}`), 0o644))
+	_, err = loadConfig(path)
+	assert.NotNil(t, err)
+
+	require.Nil(t, os.WriteFile(path, []byte(`{"oids": `), 0o644))
+	_, err = loadConfig(path)
+	assert.NotNil(t, err)
+
+	_, err = loadConfig(filepath.Join(dir, "missing.json"))
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,432 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// Interface OIDs of IF-MIB. The 64-bit ifHC* counters of ifXTable are
+// preferred; the 32-bit ifTable counters are only used when a device does not
+// implement ifXTable.
+const (
+	oidIfName        = "1.3.6.1.2.1.31.1.1.1.1"
+	oidIfAlias       = "1.3.6.1.2.1.31.1.1.1.18"
+	oidIfHCInOctets  = "1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCOutOctets = "1.3.6.1.2.1.31.1.1.1.10"
+	oidIfInOctets    = "1.3.6.1.2.1.2.2.1.10"
+	oidIfOutOctets   = "1.3.6.1.2.1.2.2.1.16"
+)
+
+// options holds the connection settings shared by all polled hosts.
+type options struct {
+	Version       string
+	Port          int
+	Community     string
+	Timeout       time.Duration
+	Retries       int
+	User          string
+	SecurityLevel string
+	AuthProtocol  string
+	AuthPassword  string
+	PrivProtocol  string
+	PrivPassword  string
+	Context       string
+	Label         string
+}
+
+// oidConfig is the optional JSON config file listing additional OIDs:
+//
+//	{"interfaces": true, "oids": [{"name": "uptime", "oid": "1.3.6.1.2.1.1.3.0"}]}
+//
+// An entry with "walk" set polls the whole subtree and appends the index of
+// every row to the metric name.
+type oidConfig struct {
+	Interfaces *bool       `json:"interfaces"`
+	OIDs       []customOID `json:"oids"`
+}
+
+type customOID struct {
+	Name string `json:"name"`
+	OID  string `json:"oid"`
+	Walk bool   `json:"walk"`
+}
+
+// reading is one numeric value of a sample. Counters are turned into the
+// increase between two samples, all other types are reported as is.
+type reading struct {
+	Name  string
+	Type  gosnmp.Asn1BER
+	Value *big.Int
+}
+
+// metric is a value ready to print.
+type metric struct {
+	Name  string
+	Value float64
+}
+
+var authProtocols = map[string]gosnmp.SnmpV3AuthProtocol{
+	"MD5":    gosnmp.MD5,
+	"SHA":    gosnmp.SHA,
+	"SHA224": gosnmp.SHA224,
+	"SHA256": gosnmp.SHA256,
+	"SHA384": gosnmp.SHA384,
+	"SHA512": gosnmp.SHA512,
+}
+
+var privProtocols = map[string]gosnmp.SnmpV3PrivProtocol{
+	"DES":     gosnmp.DES,
+	"AES":     gosnmp.AES,
+	"AES192":  gosnmp.AES192,
+	"AES256":  gosnmp.AES256,
+	"AES192C": gosnmp.AES192C,
+	"AES256C": gosnmp.AES256C,
+}
+
+// newClient returns an unconnected client for host, which may carry its own
+// ":port".
+func newClient(host string, opts options) (*gosnmp.GoSNMP, error) {
+	port := opts.Port
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port in %q", host)
+		}
+		host, port = h, n
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(port),
+		Timeout:   opts.Timeout,
+		Retries:   opts.Retries,
+		MaxOids:   gosnmp.MaxOids,
+		Transport: "udp",
+	}
+
+	switch opts.Version {
+	case "2c":
+		client.Version = gosnmp.Version2c
+		client.Community = opts.Community
+	case "3":
+		usm, flags, err := usmParameters(opts)
+		if err != nil {
+			return nil, err
+		}
+		client.Version = gosnmp.Version3
+		client.SecurityModel = gosnmp.UserSecurityModel
+		client.MsgFlags = flags
+		client.SecurityParameters = usm
+		client.ContextName = opts.Context
+	default:
+		return nil, fmt.Errorf("unsupported SNMP version %q (expected 2c or 3)", opts.Version)
+	}
+
+	return client, nil
+}
+
+// usmParameters builds the user-based security parameters of an SNMPv3
+// request for the configured security level.
+func usmParameters(opts options) (*gosnmp.UsmSecurityParameters, gosnmp.SnmpV3MsgFlags, error) {
+	if len(opts.User) == 0 {
+		return nil, 0, fmt.Errorf("SNMPv3 requires a user")
+	}
+
+	usm := &gosnmp.UsmSecurityParameters{
+		UserName:               opts.User,
+		AuthenticationProtocol: gosnmp.NoAuth,
+		PrivacyProtocol:        gosnmp.NoPriv,
+	}
+
+	var flags gosnmp.SnmpV3MsgFlags
+	switch opts.SecurityLevel {
+	case "noAuthNoPriv":
+		return usm, gosnmp.NoAuthNoPriv, nil
+	case "authNoPriv":
+		flags = gosnmp.AuthNoPriv
+	case "authPriv":
+		flags = gosnmp.AuthPriv
+	default:
+		return nil, 0, fmt.Errorf("unsupported security level %q (expected noAuthNoPriv, authNoPriv or authPriv)", opts.SecurityLevel)
+	}
+
+	auth, found := authProtocols[strings.ToUpper(opts.AuthProtocol)]
+	if !found {
+		return nil, 0, fmt.Errorf("unsupported auth protocol %q", opts.AuthProtocol)
+	}
+	if len(opts.AuthPassword) < 8 {
+		return nil, 0, fmt.Errorf("the auth password must have at least 8 characters")
+	}
+	usm.AuthenticationProtocol = auth
+	usm.AuthenticationPassphrase = opts.AuthPassword
+
+	if flags == gosnmp.AuthPriv {
+		priv, found := privProtocols[strings.ToUpper(opts.PrivProtocol)]
+		if !found {
+			return nil, 0, fmt.Errorf("unsupported privacy protocol %q", opts.PrivProtocol)
+		}
+		if len(opts.PrivPassword) < 8 {
+			return nil, 0, fmt.Errorf("the privacy password must have at least 8 characters")
+		}
+		usm.PrivacyProtocol = priv
+		usm.PrivacyPassphrase = opts.PrivPassword
+	}
+
+	return usm, flags, nil
+}
+
+// loadConfig reads the OID config file. Without a file only the interface
+// counters are polled.
+func loadConfig(path string) (oidConfig, error) {
+	if len(path) == 0 {
+		return oidConfig{}, nil
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return oidConfig{}, err
+	}
+
+	var cfg oidConfig
+	if err := json.Unmarshal(contents, &cfg); err != nil {
+		return oidConfig{}, fmt.Errorf("invalid config %s: %w", path, err)
+	}
+	for i, o := range cfg.OIDs {
+		if len(o.Name) == 0 || len(o.OID) == 0 {
+			return oidConfig{}, fmt.Errorf("oid entry %d in %s needs a name and an oid", i+1, path)
+		}
+		cfg.OIDs[i].OID = strings.TrimPrefix(o.OID, ".")
+	}
+	return cfg, nil
+}
+
+// interfacesEnabled reports whether the interface counters are polled.
+func (cfg oidConfig) interfacesEnabled() bool {
+	return cfg.Interfaces == nil || *cfg.Interfaces
+}
+
+// sample polls all configured values once.
+func sample(client *gosnmp.GoSNMP, cfg oidConfig, label string) ([]reading, error) {
+	readings := []reading{}
+
+	if cfg.interfacesEnabled() {
+		interfaces, err := interfaceReadings(client, label)
+		if err != nil {
+			return nil, err
+		}
+		readings = append(readings, interfaces...)
+	}
+
+	for _, o := range cfg.OIDs {
+		if o.Walk {
+			pdus, err := client.BulkWalkAll(o.OID)
+			if err != nil {
+				return nil, err
+			}
+			for _, pdu := range pdus {
+				if r, ok := numeric(o.Name+"."+index(pdu.Name, o.OID), pdu); ok {
+					readings = append(readings, r)
+				}
+			}
+			continue
+		}
+
+		packet, err := client.Get([]string{o.OID})
+		if err != nil {
+			return nil, err
+		}
+		for _, pdu := range packet.Variables {
+			if r, ok := numeric(o.Name, pdu); ok {
+				readings = append(readings, r)
+			}
+		}
+	}
+
+	return readings, nil
+}
+
+// interfaceReadings walks the octet counters of all interfaces and labels them
+// by ifName or ifAlias.
+func interfaceReadings(client *gosnmp.GoSNMP, label string) ([]reading, error) {
+	in, err := walk(client, oidIfHCInOctets)
+	if err != nil {
+		return nil, err
+	}
+	outOid := oidIfHCOutOctets
+	if len(in) == 0 {
+		if in, err = walk(client, oidIfInOctets); err != nil {
+			return nil, err
+		}
+		outOid = oidIfOutOctets
+	}
+	out, err := walk(client, outOid)
+	if err != nil {
+		return nil, err
+	}
+
+	names, aliases := map[string]string{}, map[string]string{}
+	if label != "index" {
+		if names, err = walkStrings(client, oidIfName); err != nil {
+			return nil, err
+		}
+		if label == "alias" {
+			if aliases, err = walkStrings(client, oidIfAlias); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	indexes := []string{}
+	for i := range in {
+		indexes = append(indexes, i)
+	}
+	sortIndexes(indexes)
+	labels := interfaceLabels(indexes, names, aliases)
+
+	readings := []reading{}
+	for _, i := range indexes {
+		if r, ok := numeric("rx_bytes."+labels[i], in[i]); ok {
+			readings = append(readings, r)
+		}
+		if pdu, found := out[i]; found {
+			if r, ok := numeric("tx_bytes."+labels[i], pdu); ok {
+				readings = append(readings, r)
+			}
+		}
+	}
+	return readings, nil
+}
+
+// walk returns the rows of a table column keyed by index.
+func walk(client *gosnmp.GoSNMP, oid string) (map[string]gosnmp.SnmpPDU, error) {
+	pdus, err := client.BulkWalkAll(oid)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]gosnmp.SnmpPDU{}
+	for _, pdu := range pdus {
+		if pdu.Type == gosnmp.NoSuchObject || pdu.Type == gosnmp.NoSuchInstance || pdu.Type == gosnmp.EndOfMibView {
+			continue
+		}
+		result[index(pdu.Name, oid)] = pdu
+	}
+	return result, nil
+}
+
+// walkStrings returns the string rows of a table column keyed by index.
+func walkStrings(client *gosnmp.GoSNMP, oid string) (map[string]string, error) {
+	pdus, err := walk(client, oid)
+	if err != nil {
+		return nil, err
+	}
+	result := map[string]string{}
+	for i, pdu := range pdus {
+		if value, ok := pdu.Value.([]byte); ok {
+			result[i] = string(value)
+		}
+	}
+	return result, nil
+}
+
+// index returns the part of oid below root, e.g. "3" for ifName.3.
+func index(oid string, root string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(oid, "."), root+".")
+}
+
+// sortIndexes sorts numeric indexes numerically and others lexically.
+func sortIndexes(indexes []string) {
+	sort.Slice(indexes, func(a, b int) bool {
+		x, errX := strconv.Atoi(indexes[a])
+		y, errY := strconv.Atoi(indexes[b])
+		if errX == nil && errY == nil {
+			return x < y
+		}
+		return indexes[a] < indexes[b]
+	})
+}
+
+var unsafeLabel = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// interfaceLabels returns a Graphite-safe, unique label per index: the alias
+// if present, else the name, else the index itself.
+func interfaceLabels(indexes []string, names, aliases map[string]string) map[string]string {
+	labels := map[string]string{}
+	seen := map[string]bool{}
+	for _, i := range indexes {
+		label := sanitizeLabel(aliases[i])
+		if len(label) == 0 {
+			label = sanitizeLabel(names[i])
+		}
+		if len(label) == 0 {
+			label = i
+		} else if seen[label] {
+			label += "_" + i
+		}
+		seen[label] = true
+		labels[i] = label
+	}
+	return labels
+}
+
+// sanitizeLabel replaces characters Graphite treats specially.
+func sanitizeLabel(label string) string {
+	return strings.Trim(unsafeLabel.ReplaceAllString(label, "_"), "_")
+}
+
+// numeric converts a PDU to a reading; non-numeric values are skipped.
+func numeric(name string, pdu gosnmp.SnmpPDU) (reading, bool) {
+	switch pdu.Type {
+	case gosnmp.Counter32, gosnmp.Counter64, gosnmp.Gauge32, gosnmp.Integer, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		return reading{Name: name, Type: pdu.Type, Value: gosnmp.ToBigInt(pdu.Value)}, true
+	default:
+		return reading{}, false
+	}
+}
+
+// deltas turns two samples into metrics. Counters report their increase,
+// allowing for one wrap at 2^32 (Counter32) or 2^64 (Counter64); counters
+// missing from the first sample are skipped. Other values are taken from the
+// second sample.
+func deltas(before, after []reading) []metric {
+	previous := map[string]reading{}
+	for _, r := range before {
+		previous[r.Name] = r
+	}
+
+	result := []metric{}
+	for _, r := range after {
+		var bits uint
+		switch r.Type {
+		case gosnmp.Counter32:
+			bits = 32
+		case gosnmp.Counter64:
+			bits = 64
+		default:
+			value, _ := new(big.Float).SetInt(r.Value).Float64()
+			result = append(result, metric{Name: r.Name, Value: value})
+			continue
+		}
+
+		last, found := previous[r.Name]
+		if !found || last.Type != r.Type {
+			continue
+		}
+		diff := new(big.Int).Sub(r.Value, last.Value)
+		if diff.Sign() < 0 {
+			diff.Add(diff, new(big.Int).Lsh(big.NewInt(1), bits))
+		}
+		value, _ := new(big.Float).SetInt(diff).Float64()
+		result = append(result, metric{Name: r.Name, Value: value})
+	}
+	return result
+}
@@ -1,85 +1,106 @@
 package main
 
 import (
-	"os"
-	"path"
-	"path/filepath"
-	"strconv"
+	"fmt"
+	"regexp"
 	"strings"
-	"time"
 
+	"github.com/thomis/sensu-plugins-go/pkg/common"
 	"github.com/thomis/sensu-plugins-go/pkg/metrics"
 )
 
+type metric struct {
+	name  string
+	value float64
+}
+
 func main() {
-	var sleep int
+	var (
+		sleep   int
+		include string
+		exclude string
+		total   bool
+	)
 
 	m := metrics.New("")
 	m.Option.IntVarP(&sleep, "sleep", "s", 1, "SLEEP")
+	m.Option.StringVarP(&include, "include", "i", "", "Only report interfaces matching this regular expression")
+	m.Option.StringVarP(&exclude, "exclude", "x", "^lo$", "Skip interfaces matching this regular expression")
+	m.Option.BoolVarP(&total, "total", "t", false, "Also report the sum over all reported interfaces as traffic.total")
 	m.Init()
 
-	traffics, err := trafficsBytes(1)
-	if err == nil {
-		m.Scheme("traffic.rx_bytes").Print(float64(traffics[0]))
-		m.Scheme("traffic.tx_bytes").Print(float64(traffics[1]))
-	}
-}
-
-func trafficsBytes(sleep int) ([]int64, error) {
-	beforeTraffics, err := getTraffics()
+	includeRe, err := common.CompileFilter(include)
 	if err != nil {
-		return []int64{}, err
+		m.Error(fmt.Errorf("invalid --include: %w", err))
+		return
 	}
-
-	time.Sleep(time.Duration(sleep) * time.Second)
-
-	afterTraffics, err := getTraffics()
+	excludeRe, err := common.CompileFilter(exclude)
 	if err != nil {
-		return []int64{}, err
+		m.Error(fmt.Errorf("invalid --exclude: %w", err))
+		return
 	}
 
-	return []int64{
-		afterTraffics[0] - beforeTraffics[0],
-		afterTraffics[1] - beforeTraffics[1],
-	}, nil
-}
-
-func getTraffics() ([]int64, error) {
-	traffics := make([]int64, 2)
-	ifpaths, err := filepath.Glob("/sys/class/net/*")
+	interfaces, err := common.SampleNetIO(sleep)
 	if err != nil {
-		return []int64{}, err
+		m.Error(err)
+		return
 	}
 
-	for _, ifpath := range ifpaths {
-		info, err := os.Stat(ifpath)
-		if err != nil {
-			return []int64{}, err
-		}
-		base := path.Base(ifpath)
+	for _, v := range collect(interfaces, includeRe, excludeRe, total) {
+		m.Scheme(v.name).Print(v.value)
+	}
+}
 
-		if !info.IsDir() || base == "lo" {
+// collect names the rates of the selected interfaces
+// traffic.<interface>.<metric> and adds their sum as traffic.total.<metric>
+// if total is set.
+func collect(interfaces []common.NetIO, include, exclude *regexp.Regexp, total bool) []metric {
+	var result []metric
+	var sum common.NetIO
+	for _, i := range interfaces {
+		if !common.MatchFilters(i.Name, include, exclude) {
 			continue
 		}
 
-		rxBytes, err := os.ReadFile(ifpath + "/statistics/rx_bytes")
-		if err != nil {
-			return []int64{}, err
-		}
-		traffics[0], err = strconv.ParseInt(strings.TrimRight(string(rxBytes), "\n"), 10, 64)
-		if err != nil {
-			return []int64{}, err
+		// VLAN interfaces such as eth0.100 would add a Graphite path level
+		name := strings.ReplaceAll(i.Name, ".", "_")
+		for _, v := range metricsOf(i) {
+			result = append(result, metric{"traffic." + name + "." + v.name, v.value})
 		}
+		sum = add(sum, i)
+	}
 
-		txBytes, err := os.ReadFile(ifpath + "/statistics/tx_bytes")
-		if err != nil {
-			return []int64{}, err
-		}
-		traffics[1], err = strconv.ParseInt(strings.TrimRight(string(txBytes), "\n"), 10, 64)
-		if err != nil {
-			return []int64{}, err
+	if total {
+		for _, v := range metricsOf(sum) {
+			result = append(result, metric{"traffic.total." + v.name, v.value})
 		}
 	}
+	return result
+}
+
+// metricsOf lists the per-second rates of an interface.
+func metricsOf(i common.NetIO) []metric {
+	return []metric{
+		{"rx_bytes", i.RxBytes},
+		{"tx_bytes", i.TxBytes},
+		{"rx_packets", i.RxPackets},
+		{"tx_packets", i.TxPackets},
+		{"rx_errors", i.RxErrors},
+		{"tx_errors", i.TxErrors},
+		{"rx_dropped", i.RxDropped},
+		{"tx_dropped", i.TxDropped},
+	}
+}
 
-	return traffics, nil
+// add sums the rates of two interfaces.
+func add(a, b common.NetIO) common.NetIO {
+	a.RxBytes += b.RxBytes
+	a.TxBytes += b.TxBytes
+	a.RxPackets += b.RxPackets
+	a.TxPackets += b.TxPackets
+	a.RxErrors += b.RxErrors
+	a.TxErrors += b.TxErrors
+	a.RxDropped += b.RxDropped
+	a.TxDropped += b.TxDropped
+	return a
 }
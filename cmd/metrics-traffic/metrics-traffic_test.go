@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func interfaces() []common.NetIO {
+	return []common.NetIO{
+		{Name: "lo", RxBytes: 100, TxBytes: 100},
+		{Name: "eth0", RxBytes: 2048, TxBytes: 1024, RxPackets: 8, TxPackets: 4, RxDropped: 0.5},
+		{Name: "eth0.100", RxBytes: 512, TxBytes: 256, RxErrors: 1},
+	}
+}
+
+func TestCollect(t *testing.T) {
+	exclude, err := common.CompileFilter("^lo$")
+	require.NoError(t, err)
+
+	result := collect(interfaces(), nil, exclude, false)
+	assert.Len(t, result, 16)
+	assert.Equal(t, metric{"traffic.eth0.rx_bytes", 2048}, result[0])
+	assert.Equal(t, metric{"traffic.eth0.rx_dropped", 0.5}, result[6])
+	assert.Equal(t, metric{"traffic.eth0_100.rx_bytes", 512}, result[8])
+	assert.Equal(t, metric{"traffic.eth0_100.rx_errors", 1}, result[12])
+}
+
+func TestCollectIncludeAndTotal(t *testing.T) {
+	include, err := common.CompileFilter(`^eth`)
+	require.NoError(t, err)
+
+	result := collect(interfaces(), include, nil, true)
+	assert.Len(t, result, 24)
+	assert.Equal(t, metric{"traffic.total.rx_bytes", 2560}, result[16])
+	assert.Equal(t, metric{"traffic.total.tx_bytes", 1280}, result[17])
+	assert.Equal(t, metric{"traffic.total.rx_errors", 1}, result[20])
+
+	assert.Empty(t, collect(interfaces(), include, include, false))
+}
@@ -0,0 +1,164 @@
+// Package batch runs the same probe against many targets with a bounded number
+// of workers and an overall deadline. It backs the targets-file mode of the
+// network checks (check-certificate, check-http, check-http-json) and the
+// connections-file mode of the database checks (dbquery.RunBatch); the probe
+// outcomes are reduced with Aggregate.
+package batch
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ReadTargets reads a targets file with one target per line. Empty lines and
+// lines starting with "#" are ignored. A file without any target is an error.
+func ReadTargets(file string) ([]string, error) {
+	readFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer readFile.Close()
+
+	targets := []string{}
+	scanner := bufio.NewScanner(readFile)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		targets = append(targets, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets found in [%s]", file)
+	}
+
+	return targets, nil
+}
+
+// Run calls probe for every target using at most workers concurrent
+// goroutines and returns the results in target order. The context passed to
+// probe is cancelled when the overall deadline is reached; targets that have
+// not completed by then get the result of expired instead. A non-positive
+// workers value runs all targets at once.
+func Run[T any, R any](targets []T, workers int, deadline time.Duration, probe func(context.Context, T) R, expired func(T) R) []R {
+	if workers <= 0 || workers > len(targets) {
+		workers = len(targets)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), deadline)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make([]R, len(targets))
+		done    = make([]bool, len(targets))
+	)
+
+	// Buffered so the producer never blocks; workers stop picking up new
+	// targets once the deadline is reached.
+	jobs := make(chan int, len(targets))
+	for i := range targets {
+		jobs <- i
+	}
+	close(jobs)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if ctx.Err() != nil {
+					return
+				}
+				result := probe(ctx, targets[i])
+
+				mu.Lock()
+				results[i] = result
+				done[i] = true
+				mu.Unlock()
+			}
+		}()
+	}
+
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+	case <-ctx.Done():
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Copy so late-finishing workers cannot modify the returned slice.
+	out := make([]R, len(targets))
+	for i := range targets {
+		if done[i] {
+			out[i] = results[i]
+		} else {
+			out[i] = expired(targets[i])
+		}
+	}
+	return out
+}
+
+// Outcome is the normalized result of a probe of a single target, such as a
+// URL or a database connection. Status is one of "ok", "warning" or
+// "critical".
+type Outcome struct {
+	Label   string
+	Status  string
+	Message string
+}
+
+// Aggregate reduces per-target outcomes to a single overall status
+// (worst-status-wins: critical > warning > ok) and a human-readable report.
+// The report starts with a summary line and lists each non-ok target. Any
+// unrecognized status is treated as critical.
+func Aggregate(outcomes []Outcome) (string, string) {
+	var ok, warning, critical int
+	details := []string{}
+
+	for _, o := range outcomes {
+		switch o.Status {
+		case "ok":
+			ok++
+		case "warning":
+			warning++
+			details = append(details, fmt.Sprintf("- %s: WARNING %s", o.Label, o.Message))
+		default:
+			critical++
+			details = append(details, fmt.Sprintf("- %s: CRITICAL %s", o.Label, o.Message))
+		}
+	}
+
+	summary := fmt.Sprintf("%d critical, %d warning, %d ok (of %d)", critical, warning, ok, len(outcomes))
+	output := summary
+	if len(details) > 0 {
+		output = summary + "\n" + strings.Join(details, "\n")
+	}
+
+	status := "ok"
+	switch {
+	case critical > 0:
+		status = "critical"
+	case warning > 0:
+		status = "warning"
+	}
+
+	return status, output
+}
@@ -0,0 +1,143 @@
+package batch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadTargets(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "targets.txt")
+	os.WriteFile(file, []byte("\n# comment\nexample.com:443\n  api.example.com  \n\n#other.example.com\n"), 0644)
+
+	targets, err := ReadTargets(file)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"example.com:443", "api.example.com"}, targets)
+}
+
+func TestReadTargetsEmpty(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "targets.txt")
+	os.WriteFile(file, []byte("# nothing here\n"), 0644)
+
+	_, err := ReadTargets(file)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no targets found")
+}
+
+func TestReadTargetsMissingFile(t *testing.T) {
+	_, err := ReadTargets(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.NotNil(t, err)
+}
+
+func TestRunPreservesOrder(t *testing.T) {
+	targets := []int{5, 1, 4, 2, 3}
+	results := Run(targets, 2, time.Second,
+		func(ctx context.Context, n int) int {
+			time.Sleep(time.Duration(n) * time.Millisecond)
+			return n * 10
+		},
+		func(n int) int { return -1 })
+
+	assert.Equal(t, []int{50, 10, 40, 20, 30}, results)
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	var running, peak int32
+	targets := make([]int, 20)
+
+	Run(targets, 3, time.Second,
+		func(ctx context.Context, _ int) bool {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return true
+		},
+		func(int) bool { return false })
+
+	assert.LessOrEqual(t, atomic.LoadInt32(&peak), int32(3))
+	assert.Greater(t, atomic.LoadInt32(&peak), int32(1))
+}
+
+func TestRunDeadline(t *testing.T) {
+	targets := []string{"fast", "slow", "queued"}
+
+	start := time.Now()
+	results := Run(targets, 2, 50*time.Millisecond,
+		func(ctx context.Context, target string) string {
+			if target == "fast" {
+				return "ok"
+			}
+			<-ctx.Done()
+			time.Sleep(20 * time.Millisecond)
+			return "late"
+		},
+		func(target string) string { return "expired " + target })
+
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+	assert.Equal(t, "ok", results[0])
+	assert.Equal(t, "expired slow", results[1])
+	assert.Equal(t, "expired queued", results[2])
+}
+
+func TestRunNoTargets(t *testing.T) {
+	results := Run([]string{}, 4, time.Second,
+		func(ctx context.Context, s string) string { return s },
+		func(s string) string { return s })
+	assert.Empty(t, results)
+}
+
+func TestAggregateAllOk(t *testing.T) {
+	status, output := Aggregate([]Outcome{
+		{Label: "a", Status: "ok", Message: "fine"},
+		{Label: "b", Status: "ok", Message: "fine"},
+	})
+	assert.Equal(t, "ok", status)
+	assert.Equal(t, "0 critical, 0 warning, 2 ok (of 2)", output)
+}
+
+func TestAggregateWarningWins(t *testing.T) {
+	status, output := Aggregate([]Outcome{
+		{Label: "a", Status: "ok", Message: "fine"},
+		{Label: "b (u@db)", Status: "warning", Message: "busy"},
+	})
+	assert.Equal(t, "warning", status)
+	assert.Contains(t, output, "0 critical, 1 warning, 1 ok")
+	assert.Contains(t, output, "- b (u@db): WARNING busy")
+}
+
+func TestAggregateCriticalWins(t *testing.T) {
+	status, output := Aggregate([]Outcome{
+		{Label: "a", Status: "warning", Message: "busy"},
+		{Label: "b", Status: "critical", Message: "down"},
+		{Label: "c", Status: "ok", Message: "fine"},
+	})
+	assert.Equal(t, "critical", status)
+	assert.Contains(t, output, "1 critical, 1 warning, 1 ok (of 3)")
+	assert.Contains(t, output, "- b: CRITICAL down")
+	assert.Contains(t, output, "- a: WARNING busy")
+}
+
+func TestAggregateUnknownStatusIsCritical(t *testing.T) {
+	status, output := Aggregate([]Outcome{
+		{Label: "a", Status: "", Message: "connection failed"},
+	})
+	assert.Equal(t, "critical", status)
+	assert.Contains(t, output, "- a: CRITICAL connection failed")
+}
+
+func TestAggregateEmpty(t *testing.T) {
+	status, output := Aggregate([]Outcome{})
+	assert.Equal(t, "ok", status)
+	assert.Equal(t, "0 critical, 0 warning, 0 ok (of 0)", output)
+}
@@ -0,0 +1,52 @@
+package check
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var byteUnits = []string{"K", "M", "G", "T", "P"}
+
+// ParseBytes parses a size such as "512", "100M", "10G" or "1.5TiB" using
+// binary units. An empty string is zero.
+func ParseBytes(value string) (uint64, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	number := strings.TrimRight(strings.ToUpper(value), "IB")
+	multiplier := 1.0
+	for i, unit := range byteUnits {
+		if strings.HasSuffix(number, unit) {
+			number = strings.TrimSuffix(number, unit)
+			multiplier = math.Pow(1024, float64(i+1))
+			break
+		}
+	}
+
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return uint64(size * multiplier), nil
+}
+
+// FormatBytes renders a size with a binary unit, e.g. "1.50GiB".
+func FormatBytes(size uint64) string {
+	value := float64(size)
+	if value < 1024 {
+		return fmt.Sprintf("%dB", size)
+	}
+	unit := ""
+	for _, u := range byteUnits {
+		if value < 1024 {
+			break
+		}
+		value /= 1024
+		unit = u
+	}
+	return fmt.Sprintf("%.2f%siB", value, unit)
+}
@@ -0,0 +1,36 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBytes(t *testing.T) {
+	cases := map[string]uint64{
+		"":       0,
+		"512":    512,
+		"2K":     2048,
+		"100M":   100 * 1024 * 1024,
+		"10G":    10 * 1024 * 1024 * 1024,
+		"10GB":   10 * 1024 * 1024 * 1024,
+		"1.5TiB": 1536 * 1024 * 1024 * 1024,
+		"1p":     1024 * 1024 * 1024 * 1024 * 1024,
+	}
+	for value, expected := range cases {
+		size, err := ParseBytes(value)
+		assert.Nil(t, err, "value %q", value)
+		assert.Equal(t, expected, size, "value %q", value)
+	}
+
+	for _, invalid := range []string{"G", "-1G", "ten"} {
+		_, err := ParseBytes(invalid)
+		assert.NotNil(t, err, "value %q", invalid)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", FormatBytes(512))
+	assert.Equal(t, "1.50KiB", FormatBytes(1536))
+	assert.Equal(t, "25.00GiB", FormatBytes(25*1024*1024*1024))
+}
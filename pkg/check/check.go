@@ -3,6 +3,8 @@ package check
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"strconv"
 
 	"github.com/spf13/pflag"
 )
@@ -45,3 +47,93 @@ func (c CheckStruct) Error(err error) {
 	fmt.Println(c.Name, "ERROR:", err)
 	c.ExitFn(3)
 }
+
+// Threshold holds the warning and critical levels of a value where a higher
+// value is worse. A level of zero is disabled.
+type Threshold struct {
+	Warning  float64
+	Critical float64
+}
+
+// Enabled reports whether at least one of the levels is set.
+func (t Threshold) Enabled() bool {
+	return t.Warning > 0 || t.Critical > 0
+}
+
+// Level returns "critical", "warning" or "ok" for value.
+func (t Threshold) Level(value float64) string {
+	switch {
+	case t.Critical > 0 && value >= t.Critical:
+		return "critical"
+	case t.Warning > 0 && value >= t.Warning:
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// WorstLevel returns the most severe of the given levels
+// (critical > warning > ok).
+func WorstLevel(levels ...string) string {
+	worst := "ok"
+	for _, level := range levels {
+		switch level {
+		case "critical":
+			return "critical"
+		case "warning":
+			worst = "warning"
+		}
+	}
+	return worst
+}
+
+// Report exits with the result matching level: "ok", "warning" or
+// "critical". Any other level is reported as critical, so an unexpected
+// level never hides a problem.
+func (c CheckStruct) Report(level string, output string) {
+	switch level {
+	case "ok":
+		c.Ok(output)
+	case "warning":
+		c.Warning(output)
+	default:
+		c.Critical(output)
+	}
+}
+
+// MinLevel returns "critical", "warning" or "ok" for value when the levels
+// are minimums, i.e. a lower value is worse.
+func (t Threshold) MinLevel(value float64) string {
+	switch {
+	case t.Critical > 0 && value < t.Critical:
+		return "critical"
+	case t.Warning > 0 && value < t.Warning:
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// Perf renders the levels as the warn;crit fields of a perfdata entry,
+// leaving disabled ones empty.
+func (t Threshold) Perf() string {
+	return FormatLimit(t.Warning) + ";" + FormatLimit(t.Critical)
+}
+
+// FormatLimit renders a level for perfdata without an exponent, leaving a
+// disabled one empty.
+func FormatLimit(limit float64) string {
+	if limit <= 0 {
+		return ""
+	}
+	return strconv.FormatFloat(limit, 'f', -1, 64)
+}
+
+var unsafeLabel = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// PerfLabel makes a name, such as a queue or node name, safe for a perfdata
+// label by replacing every other character than letters, digits, "_", "."
+// and "-" with "_".
+func PerfLabel(name string) string {
+	return unsafeLabel.ReplaceAllString(name, "_")
+}
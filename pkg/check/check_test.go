@@ -65,3 +65,60 @@ func TestEror(t *testing.T) {
 	check.Error(fmt.Errorf("whatever"))
 	assert.Equal(t, 3, value)
 }
+
+func TestThreshold(t *testing.T) {
+	threshold := Threshold{Warning: 80, Critical: 90}
+	assert.True(t, threshold.Enabled())
+	assert.Equal(t, "ok", threshold.Level(79.9))
+	assert.Equal(t, "warning", threshold.Level(80))
+	assert.Equal(t, "critical", threshold.Level(90))
+
+	warnOnly := Threshold{Warning: 5}
+	assert.True(t, warnOnly.Enabled())
+	assert.Equal(t, "warning", warnOnly.Level(500))
+
+	disabled := Threshold{}
+	assert.False(t, disabled.Enabled())
+	assert.Equal(t, "ok", disabled.Level(1000))
+}
+
+func TestWorstLevel(t *testing.T) {
+	assert.Equal(t, "ok", WorstLevel())
+	assert.Equal(t, "ok", WorstLevel("ok", "ok"))
+	assert.Equal(t, "warning", WorstLevel("ok", "warning", "ok"))
+	assert.Equal(t, "critical", WorstLevel("warning", "critical", "ok"))
+}
+
+func TestReport(t *testing.T) {
+	cases := map[string]int{"ok": 0, "warning": 1, "critical": 2, "anything-else": 2}
+	for level, expected := range cases {
+		var got int
+		check := New("something")
+		check.ExitFn = func(code int) { got = code }
+		check.Report(level, "whatever")
+		assert.Equal(t, expected, got, "level %q", level)
+	}
+}
+
+func TestThresholdMinLevel(t *testing.T) {
+	threshold := Threshold{Warning: 10, Critical: 5}
+	assert.Equal(t, "critical", threshold.MinLevel(4.9))
+	assert.Equal(t, "warning", threshold.MinLevel(5))
+	assert.Equal(t, "ok", threshold.MinLevel(10))
+	assert.Equal(t, "ok", Threshold{}.MinLevel(0))
+}
+
+func TestThresholdPerf(t *testing.T) {
+	assert.Equal(t, "80;90", Threshold{Warning: 80, Critical: 90}.Perf())
+	assert.Equal(t, "2.5;", Threshold{Warning: 2.5}.Perf())
+	assert.Equal(t, ";1073741824", Threshold{Critical: 1 << 30}.Perf())
+	assert.Equal(t, ";", Threshold{}.Perf())
+}
+
+func TestPerfLabel(t *testing.T) {
+	assert.Equal(t, "orders.retry", PerfLabel("orders.retry"))
+	assert.Equal(t, "es-data-1", PerfLabel("es-data-1"))
+	assert.Equal(t, "_vhost_orders", PerfLabel("/vhost/orders"))
+	assert.Equal(t, "node_1_a_b", PerfLabel("node 1=a'b"))
+	assert.Equal(t, "rabbit_mq-1__", PerfLabel("rabbit@mq-1 ä"))
+}
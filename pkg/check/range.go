@@ -0,0 +1,60 @@
+package check
+
+import "fmt"
+
+// Range holds the expected bounds of a count, such as the number of matching
+// processes or files. A minimum of 0 and a maximum below 0 are disabled.
+type Range struct {
+	WarnMin int
+	WarnMax int
+	CritMin int
+	CritMax int
+}
+
+// Level returns "critical", "warning" or "ok" for count.
+func (r Range) Level(count int) string {
+	switch {
+	case (r.CritMin > 0 && count < r.CritMin) || (r.CritMax >= 0 && count > r.CritMax):
+		return "critical"
+	case (r.WarnMin > 0 && count < r.WarnMin) || (r.WarnMax >= 0 && count > r.WarnMax):
+		return "warning"
+	default:
+		return "ok"
+	}
+}
+
+// Expected renders the bounds of a level, e.g. "2..4" or "at least 1".
+func (r Range) Expected(level string) string {
+	min, max := r.WarnMin, r.WarnMax
+	if level == "critical" {
+		min, max = r.CritMin, r.CritMax
+	}
+	switch {
+	case min > 0 && max >= 0:
+		return fmt.Sprintf("%d..%d", min, max)
+	case max >= 0:
+		return fmt.Sprintf("at most %d", max)
+	default:
+		return fmt.Sprintf("at least %d", min)
+	}
+}
+
+// Perf renders the bounds as the warn;crit fields of a perfdata entry in
+// Nagios range syntax, leaving disabled ones empty.
+func (r Range) Perf() string {
+	return formatRange(r.WarnMin, r.WarnMax) + ";" + formatRange(r.CritMin, r.CritMax)
+}
+
+// formatRange renders one pair of bounds in Nagios range syntax.
+func formatRange(min, max int) string {
+	switch {
+	case min > 0 && max >= 0:
+		return fmt.Sprintf("%d:%d", min, max)
+	case max >= 0:
+		return fmt.Sprintf("%d", max)
+	case min > 0:
+		return fmt.Sprintf("%d:", min)
+	default:
+		return ""
+	}
+}
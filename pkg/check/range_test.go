@@ -0,0 +1,42 @@
+package check
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRangeLevel(t *testing.T) {
+	r := Range{WarnMin: 2, WarnMax: 4, CritMin: 1, CritMax: 8}
+	cases := map[int]string{0: "critical", 1: "warning", 2: "ok", 4: "ok", 5: "warning", 8: "warning", 9: "critical"}
+	for count, expected := range cases {
+		assert.Equal(t, expected, r.Level(count), "count %d", count)
+	}
+
+	absent := Range{WarnMax: -1, CritMax: 0}
+	assert.Equal(t, "ok", absent.Level(0))
+	assert.Equal(t, "critical", absent.Level(1))
+
+	disabled := Range{WarnMax: -1, CritMax: -1}
+	assert.Equal(t, "ok", disabled.Level(1000))
+}
+
+func TestRangeExpected(t *testing.T) {
+	r := Range{WarnMin: 2, WarnMax: 4, CritMin: 1, CritMax: -1}
+	assert.Equal(t, "2..4", r.Expected("warning"))
+	assert.Equal(t, "at least 1", r.Expected("critical"))
+	assert.Equal(t, "at most 0", Range{WarnMax: -1, CritMax: 0}.Expected("critical"))
+}
+
+func TestRangePerf(t *testing.T) {
+	assert.Equal(t, "2:4;1:", Range{WarnMin: 2, WarnMax: 4, CritMin: 1, CritMax: -1}.Perf())
+	assert.Equal(t, ";0", Range{WarnMax: -1, CritMax: 0}.Perf())
+	assert.Equal(t, ";", Range{WarnMax: -1, CritMax: -1}.Perf())
+}
+
+func TestFormatRange(t *testing.T) {
+	assert.Equal(t, "", formatRange(0, -1))
+	assert.Equal(t, "1:", formatRange(1, -1))
+	assert.Equal(t, "0", formatRange(0, 0))
+	assert.Equal(t, "2:4", formatRange(2, 4))
+}
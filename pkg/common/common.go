@@ -1,9 +1,17 @@
 package common
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Connection struct {
@@ -33,3 +41,655 @@ func GetStats() ([]float64, error) {
 
 	return result, nil
 }
+
+// CPUStats holds the jiffies of one "cpu" line of /proc/stat. Name is "cpu"
+// for the aggregate line and "cpuN" for a single core; Values follow the
+// kernel order user, nice, system, idle, iowait, irq, softirq, steal, guest,
+// guest_nice.
+type CPUStats struct {
+	Name   string
+	Values []float64
+}
+
+// GetCPUStats returns the aggregate and per-core CPU lines of /proc/stat.
+func GetCPUStats() ([]CPUStats, error) {
+	return ParseCPUStats("/proc/stat")
+}
+
+// ParseCPUStats reads a /proc/stat formatted file and returns all lines
+// starting with "cpu", the aggregate line first.
+func ParseCPUStats(filepath string) ([]CPUStats, error) {
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []CPUStats{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		stats := CPUStats{Name: fields[0], Values: make([]float64, len(fields)-1)}
+		for i, field := range fields[1:] {
+			stats.Values[i], err = strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, stats)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no cpu lines found in %s", filepath)
+	}
+
+	return result, nil
+}
+
+// PressureStats holds one line ("some" or "full") of a pressure stall
+// information (PSI) file. The averages are percentages of wall time over the
+// last 10, 60 and 300 seconds; Total is the cumulative stall time in
+// microseconds.
+type PressureStats struct {
+	Avg10  float64
+	Avg60  float64
+	Avg300 float64
+	Total  float64
+}
+
+// GetPressure returns the pressure stall information of a resource ("cpu",
+// "memory" or "io") from /proc/pressure, keyed by "some" and "full".
+func GetPressure(resource string) (map[string]PressureStats, error) {
+	return ParsePressure("/proc/pressure/" + resource)
+}
+
+// ParsePressure reads a PSI formatted file such as /proc/pressure/cpu:
+//
+//	some avg10=0.00 avg60=0.00 avg300=0.00 total=0
+//	full avg10=0.00 avg60=0.00 avg300=0.00 total=0
+func ParsePressure(filepath string) (map[string]PressureStats, error) {
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]PressureStats{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		stats := PressureStats{}
+		for _, field := range fields[1:] {
+			key, value, found := strings.Cut(field, "=")
+			if !found {
+				return nil, fmt.Errorf("malformed pressure field %q in %s", field, filepath)
+			}
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "avg10":
+				stats.Avg10 = v
+			case "avg60":
+				stats.Avg60 = v
+			case "avg300":
+				stats.Avg300 = v
+			case "total":
+				stats.Total = v
+			}
+		}
+		result[fields[0]] = stats
+	}
+
+	if _, ok := result["some"]; !ok {
+		return nil, fmt.Errorf("no pressure data found in %s", filepath)
+	}
+
+	return result, nil
+}
+
+// Mount is one entry of /proc/self/mountinfo. Options are the per-mount
+// options, SuperOptions those of the filesystem (superblock).
+type Mount struct {
+	ID           int
+	Major        int
+	Minor        int
+	Root         string
+	MountPoint   string
+	Options      []string
+	FSType       string
+	Device       string
+	SuperOptions []string
+}
+
+// HasOption reports whether the per-mount options contain option.
+func (m Mount) HasOption(option string) bool {
+	return containsOption(m.Options, option)
+}
+
+// HasSuperOption reports whether the superblock options contain option.
+func (m Mount) HasSuperOption(option string) bool {
+	return containsOption(m.SuperOptions, option)
+}
+
+func containsOption(options []string, option string) bool {
+	for _, o := range options {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// GetMounts returns the mounts of the current process from
+// /proc/self/mountinfo.
+func GetMounts() ([]Mount, error) {
+	return ParseMountinfo("/proc/self/mountinfo")
+}
+
+// ParseMountinfo reads a mountinfo formatted file:
+//
+//	36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+//
+// Octal escapes (e.g. "\040" for a space) in paths are decoded.
+func ParseMountinfo(filepath string) ([]Mount, error) {
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	mounts := []Mount{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		// The optional fields end with a single "-" separator.
+		separator := -1
+		for i := 6; i < len(fields); i++ {
+			if fields[i] == "-" {
+				separator = i
+				break
+			}
+		}
+		if len(fields) < 6 || separator < 0 || len(fields) < separator+3 {
+			return nil, fmt.Errorf("malformed mountinfo line %q in %s", line, filepath)
+		}
+
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		major, minor, found := strings.Cut(fields[2], ":")
+		if !found {
+			return nil, fmt.Errorf("malformed device number %q in %s", fields[2], filepath)
+		}
+		mount := Mount{
+			ID:         id,
+			Root:       unescapeMountPath(fields[3]),
+			MountPoint: unescapeMountPath(fields[4]),
+			Options:    strings.Split(fields[5], ","),
+			FSType:     fields[separator+1],
+			Device:     unescapeMountPath(fields[separator+2]),
+		}
+		if mount.Major, err = strconv.Atoi(major); err != nil {
+			return nil, err
+		}
+		if mount.Minor, err = strconv.Atoi(minor); err != nil {
+			return nil, err
+		}
+		if len(fields) > separator+3 {
+			mount.SuperOptions = strings.Split(fields[separator+3], ",")
+		}
+		mounts = append(mounts, mount)
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountPath decodes the "\ooo" octal escapes the kernel uses for
+// spaces, tabs, newlines and backslashes in mountinfo paths.
+func unescapeMountPath(path string) string {
+	if !strings.Contains(path, `\`) {
+		return path
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+4 <= len(path) {
+			if v, err := strconv.ParseUint(path[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(path[i])
+	}
+	return b.String()
+}
+
+// DiskStats holds the counters of one /proc/diskstats line. Sectors are 512
+// bytes regardless of the device; times are in milliseconds.
+type DiskStats struct {
+	Major           int
+	Minor           int
+	Name            string
+	ReadsCompleted  float64
+	ReadsMerged     float64
+	SectorsRead     float64
+	ReadTime        float64
+	WritesCompleted float64
+	WritesMerged    float64
+	SectorsWritten  float64
+	WriteTime       float64
+	InFlight        float64
+	IOTime          float64
+	WeightedIOTime  float64
+}
+
+// GetDiskStats returns the block device counters of /proc/diskstats.
+func GetDiskStats() ([]DiskStats, error) {
+	return ParseDiskStats("/proc/diskstats")
+}
+
+// ParseDiskStats reads a diskstats formatted file. Only the first eleven
+// counters are used; the discard and flush counters of newer kernels are
+// ignored.
+func ParseDiskStats(filepath string) ([]DiskStats, error) {
+	contents, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []DiskStats{}
+	for _, line := range strings.Split(string(contents), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 14 {
+			return nil, fmt.Errorf("malformed diskstats line %q in %s", line, filepath)
+		}
+
+		stats := DiskStats{Name: fields[2]}
+		if stats.Major, err = strconv.Atoi(fields[0]); err != nil {
+			return nil, err
+		}
+		if stats.Minor, err = strconv.Atoi(fields[1]); err != nil {
+			return nil, err
+		}
+
+		counters := []*float64{
+			&stats.ReadsCompleted, &stats.ReadsMerged, &stats.SectorsRead, &stats.ReadTime,
+			&stats.WritesCompleted, &stats.WritesMerged, &stats.SectorsWritten, &stats.WriteTime,
+			&stats.InFlight, &stats.IOTime, &stats.WeightedIOTime,
+		}
+		for i, counter := range counters {
+			if *counter, err = strconv.ParseFloat(fields[3+i], 64); err != nil {
+				return nil, err
+			}
+		}
+		result = append(result, stats)
+	}
+
+	return result, nil
+}
+
+// DiskIO holds the rates of a block device between two DiskStats samples.
+// Bytes are per second, awaits in milliseconds per request and Util the
+// percentage of time the device was busy.
+type DiskIO struct {
+	Name       string
+	ReadIOPS   float64
+	WriteIOPS  float64
+	ReadBytes  float64
+	WriteBytes float64
+	ReadAwait  float64
+	WriteAwait float64
+	Await      float64
+	Util       float64
+}
+
+// DiskIORates computes the rates between two samples taken seconds apart, in
+// the order of after. Devices missing from before (e.g. hot-plugged) are
+// skipped and counters that went backwards count as zero.
+func DiskIORates(before, after []DiskStats, seconds float64) []DiskIO {
+	previous := map[string]DiskStats{}
+	for _, stats := range before {
+		previous[stats.Name] = stats
+	}
+
+	result := []DiskIO{}
+	if seconds <= 0 {
+		return result
+	}
+
+	for _, current := range after {
+		last, found := previous[current.Name]
+		if !found {
+			continue
+		}
+		delta := func(a, b float64) float64 {
+			if a < b {
+				return 0
+			}
+			return a - b
+		}
+		perRequest := func(time, requests float64) float64 {
+			if requests == 0 {
+				return 0
+			}
+			return time / requests
+		}
+
+		reads := delta(current.ReadsCompleted, last.ReadsCompleted)
+		writes := delta(current.WritesCompleted, last.WritesCompleted)
+		readTime := delta(current.ReadTime, last.ReadTime)
+		writeTime := delta(current.WriteTime, last.WriteTime)
+
+		io := DiskIO{
+			Name:       current.Name,
+			ReadIOPS:   reads / seconds,
+			WriteIOPS:  writes / seconds,
+			ReadBytes:  delta(current.SectorsRead, last.SectorsRead) * 512 / seconds,
+			WriteBytes: delta(current.SectorsWritten, last.SectorsWritten) * 512 / seconds,
+			ReadAwait:  perRequest(readTime, reads),
+			WriteAwait: perRequest(writeTime, writes),
+			Await:      perRequest(readTime+writeTime, reads+writes),
+			Util:       100 * delta(current.IOTime, last.IOTime) / (seconds * 1000),
+		}
+		if io.Util > 100 {
+			io.Util = 100
+		}
+		result = append(result, io)
+	}
+
+	return result
+}
+
+// SampleDiskIO samples /proc/diskstats twice, sleep seconds (at least one)
+// apart, and returns the rates of every device.
+func SampleDiskIO(sleep int) ([]DiskIO, error) {
+	if sleep < 1 {
+		sleep = 1
+	}
+
+	before, err := GetDiskStats()
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(time.Duration(sleep) * time.Second)
+
+	after, err := GetDiskStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return DiskIORates(before, after, float64(sleep)), nil
+}
+
+// SelectDiskIO keeps the devices whose name passes MatchFilters.
+func SelectDiskIO(devices []DiskIO, include, exclude *regexp.Regexp) []DiskIO {
+	result := []DiskIO{}
+	for _, d := range devices {
+		if MatchFilters(d.Name, include, exclude) {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// CompileFilter compiles an include or exclude expression of device or
+// interface names; an empty expression yields nil.
+func CompileFilter(expression string) (*regexp.Regexp, error) {
+	if len(expression) == 0 {
+		return nil, nil
+	}
+	return regexp.Compile(expression)
+}
+
+// MatchFilters reports whether name matches include (if set) and does not
+// match exclude (if set).
+func MatchFilters(name string, include, exclude *regexp.Regexp) bool {
+	if include != nil && !include.MatchString(name) {
+		return false
+	}
+	return exclude == nil || !exclude.MatchString(name)
+}
+
+// NetStats holds the state and counters of one network interface from
+// /sys/class/net.
+type NetStats struct {
+	Name      string
+	Flags     uint64
+	OperState string
+	RxBytes   float64
+	TxBytes   float64
+	RxPackets float64
+	TxPackets float64
+	RxErrors  float64
+	TxErrors  float64
+	RxDropped float64
+	TxDropped float64
+}
+
+// AdminUp reports whether the interface is administratively up (IFF_UP).
+func (s NetStats) AdminUp() bool {
+	return s.Flags&0x1 != 0
+}
+
+// LinkDown reports whether an administratively up interface has lost its
+// link. Interfaces that report an "unknown" state, such as lo or many
+// tunnels, are not considered down.
+func (s NetStats) LinkDown() bool {
+	return s.AdminUp() && (s.OperState == "down" || s.OperState == "lowerlayerdown" || s.OperState == "notpresent")
+}
+
+// GetNetStats returns the network interfaces of /sys/class/net.
+func GetNetStats() ([]NetStats, error) {
+	return ParseNetStats("/sys/class/net")
+}
+
+// ParseNetStats reads the interfaces of a /sys/class/net formatted directory,
+// sorted by name. Interfaces that disappear while they are read, such as the
+// veth pair of a stopped container, are skipped.
+func ParseNetStats(dir string) ([]NetStats, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	result := []NetStats{}
+	for _, entry := range entries {
+		ifpath := dir + "/" + entry.Name()
+		// Interfaces are symlinks into /sys/devices; skip regular files such
+		// as bonding_masters.
+		if info, err := os.Stat(ifpath); err != nil || !info.IsDir() {
+			continue
+		}
+
+		stats, err := readNetStats(ifpath, entry.Name())
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, stats)
+	}
+
+	return result, nil
+}
+
+// readNetStats reads the flags, state and counters of the interface
+// directory ifpath.
+func readNetStats(ifpath, name string) (NetStats, error) {
+	readValue := func(path string) (string, error) {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(contents)), nil
+	}
+
+	stats := NetStats{Name: name}
+
+	flags, err := readValue(ifpath + "/flags")
+	if err != nil {
+		return NetStats{}, err
+	}
+	if stats.Flags, err = strconv.ParseUint(strings.TrimPrefix(flags, "0x"), 16, 64); err != nil {
+		return NetStats{}, err
+	}
+	if stats.OperState, err = readValue(ifpath + "/operstate"); err != nil {
+		return NetStats{}, err
+	}
+
+	counters := []struct {
+		file  string
+		value *float64
+	}{
+		{"rx_bytes", &stats.RxBytes},
+		{"tx_bytes", &stats.TxBytes},
+		{"rx_packets", &stats.RxPackets},
+		{"tx_packets", &stats.TxPackets},
+		{"rx_errors", &stats.RxErrors},
+		{"tx_errors", &stats.TxErrors},
+		{"rx_dropped", &stats.RxDropped},
+		{"tx_dropped", &stats.TxDropped},
+	}
+	for _, counter := range counters {
+		value, err := readValue(ifpath + "/statistics/" + counter.file)
+		if err != nil {
+			return NetStats{}, err
+		}
+		if *counter.value, err = strconv.ParseFloat(value, 64); err != nil {
+			return NetStats{}, err
+		}
+	}
+
+	return stats, nil
+}
+
+// NetIO holds the per-second rates of a network interface between two
+// NetStats samples, together with its state from the second sample.
+type NetIO struct {
+	Name      string
+	AdminUp   bool
+	LinkDown  bool
+	OperState string
+	RxBytes   float64
+	TxBytes   float64
+	RxPackets float64
+	TxPackets float64
+	RxErrors  float64
+	TxErrors  float64
+	RxDropped float64
+	TxDropped float64
+}
+
+// NetIORates computes the rates between two samples taken seconds apart, in
+// the order of after. Interfaces missing from before are skipped and
+// counters that went backwards count as zero.
+func NetIORates(before, after []NetStats, seconds float64) []NetIO {
+	previous := map[string]NetStats{}
+	for _, stats := range before {
+		previous[stats.Name] = stats
+	}
+
+	result := []NetIO{}
+	if seconds <= 0 {
+		return result
+	}
+
+	for _, current := range after {
+		last, found := previous[current.Name]
+		if !found {
+			continue
+		}
+		rate := func(a, b float64) float64 {
+			if a < b {
+				return 0
+			}
+			return (a - b) / seconds
+		}
+
+		result = append(result, NetIO{
+			Name:      current.Name,
+			AdminUp:   current.AdminUp(),
+			LinkDown:  current.LinkDown(),
+			OperState: current.OperState,
+			RxBytes:   rate(current.RxBytes, last.RxBytes),
+			TxBytes:   rate(current.TxBytes, last.TxBytes),
+			RxPackets: rate(current.RxPackets, last.RxPackets),
+			TxPackets: rate(current.TxPackets, last.TxPackets),
+			RxErrors:  rate(current.RxErrors, last.RxErrors),
+			TxErrors:  rate(current.TxErrors, last.TxErrors),
+			RxDropped: rate(current.RxDropped, last.RxDropped),
+			TxDropped: rate(current.TxDropped, last.TxDropped),
+		})
+	}
+
+	return result
+}
+
+// SampleNetIO samples /sys/class/net twice, sleep seconds (at least one)
+// apart, and returns the rates of every interface.
+func SampleNetIO(sleep int) ([]NetIO, error) {
+	if sleep < 1 {
+		sleep = 1
+	}
+
+	before, err := GetNetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	time.Sleep(time.Duration(sleep) * time.Second)
+
+	after, err := GetNetStats()
+	if err != nil {
+		return nil, err
+	}
+
+	return NetIORates(before, after, float64(sleep)), nil
+}
+
+// SelectNetIO keeps the interfaces whose name passes MatchFilters.
+func SelectNetIO(interfaces []NetIO, include, exclude *regexp.Regexp) []NetIO {
+	result := []NetIO{}
+	for _, i := range interfaces {
+		if MatchFilters(i.Name, include, exclude) {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// NewHTTPClient returns an HTTP client with the given timeout. Its TLS
+// connections skip the certificate verification with insecure, and trust the
+// certificates of the PEM file caCert instead of the system roots if set.
+func NewHTTPClient(timeout time.Duration, insecure bool, caCert string) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: insecure}
+	if len(caCert) > 0 {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	return &http.Client{Transport: transport, Timeout: timeout}, nil
+}
@@ -1,9 +1,16 @@
 package common
 
 import (
+	"encoding/pem"
 	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestGetStats(t *testing.T) {
@@ -19,3 +26,260 @@ func TestGetStats(t *testing.T) {
 	}
 
 }
+
+func TestParseCPUStats(t *testing.T) {
+	stats, err := ParseCPUStats("testdata/stat")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(stats))
+	assert.Equal(t, "cpu", stats[0].Name)
+	assert.Equal(t, "cpu1", stats[2].Name)
+	assert.Equal(t, 10, len(stats[0].Values))
+	assert.Equal(t, 46828483.0, stats[0].Values[3])
+	assert.Equal(t, 600.0, stats[1].Values[7])
+
+	_, err = ParseCPUStats("testdata/pressure_cpu")
+	assert.NotNil(t, err)
+
+	_, err = ParseCPUStats("testdata/missing")
+	assert.NotNil(t, err)
+}
+
+func TestParsePressure(t *testing.T) {
+	pressure, err := ParsePressure("testdata/pressure_cpu")
+	assert.Nil(t, err)
+	assert.Equal(t, PressureStats{Avg10: 1.53, Avg60: 0.87, Avg300: 0.25, Total: 123456789}, pressure["some"])
+	assert.Equal(t, PressureStats{}, pressure["full"])
+
+	_, err = ParsePressure("testdata/stat")
+	assert.NotNil(t, err)
+
+	_, err = ParsePressure("testdata/missing")
+	assert.NotNil(t, err)
+}
+
+func TestParseMountinfo(t *testing.T) {
+	mounts, err := ParseMountinfo("testdata/mountinfo")
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(mounts))
+
+	assert.Equal(t, Mount{
+		ID:           28,
+		Major:        254,
+		Minor:        0,
+		Root:         "/",
+		MountPoint:   "/",
+		Options:      []string{"rw", "relatime"},
+		FSType:       "ext4",
+		Device:       "/dev/vda1",
+		SuperOptions: []string{"rw", "errors=remount-ro"},
+	}, mounts[1])
+
+	data := mounts[2]
+	assert.Equal(t, "/mnt/my data", data.MountPoint)
+	assert.Equal(t, 16, data.Minor)
+	assert.True(t, data.HasOption("rw"))
+	assert.True(t, data.HasSuperOption("ro"))
+	assert.False(t, data.HasSuperOption("rw"))
+
+	assert.Equal(t, "nfs4", mounts[3].FSType)
+	assert.Equal(t, "server:/exports", mounts[3].Device)
+	assert.Equal(t, "/exports", mounts[3].Root)
+
+	_, err = ParseMountinfo("testdata/mountinfo_malformed")
+	assert.NotNil(t, err)
+
+	_, err = ParseMountinfo("testdata/missing")
+	assert.NotNil(t, err)
+}
+
+func TestUnescapeMountPath(t *testing.T) {
+	assert.Equal(t, "/plain", unescapeMountPath("/plain"))
+	assert.Equal(t, "/a b\tc\\d", unescapeMountPath(`/a\040b\011c\134d`))
+	assert.Equal(t, `/trailing\04`, unescapeMountPath(`/trailing\04`))
+	assert.Equal(t, `/not\999octal`, unescapeMountPath(`/not\999octal`))
+}
+
+func TestParseDiskStats(t *testing.T) {
+	stats, err := ParseDiskStats("testdata/diskstats_before")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(stats))
+	assert.Equal(t, DiskStats{
+		Major:           254,
+		Minor:           0,
+		Name:            "vda",
+		ReadsCompleted:  12607,
+		ReadsMerged:     5584,
+		SectorsRead:     1498826,
+		ReadTime:        7118,
+		WritesCompleted: 16283,
+		WritesMerged:    27559,
+		SectorsWritten:  2014824,
+		WriteTime:       12421,
+		InFlight:        0,
+		IOTime:          3788,
+		WeightedIOTime:  20357,
+	}, stats[1])
+	assert.Equal(t, "nvme0n1", stats[3].Name)
+	assert.Equal(t, 700000.0, stats[3].IOTime)
+
+	_, err = ParseDiskStats("testdata/diskstats_malformed")
+	assert.NotNil(t, err)
+
+	_, err = ParseDiskStats("testdata/missing")
+	assert.NotNil(t, err)
+}
+
+func TestDiskIORates(t *testing.T) {
+	before, err := ParseDiskStats("testdata/diskstats_before")
+	assert.Nil(t, err)
+	after, err := ParseDiskStats("testdata/diskstats_after")
+	assert.Nil(t, err)
+
+	rates := DiskIORates(before, after, 2)
+	// sda is missing from the first sample
+	assert.Equal(t, 4, len(rates))
+
+	vda := rates[1]
+	assert.Equal(t, "vda", vda.Name)
+	assert.InDelta(t, 100.0, vda.ReadIOPS, 0.001)            // 200 reads / 2s
+	assert.InDelta(t, 100.0, vda.WriteIOPS, 0.001)           // 200 writes / 2s
+	assert.InDelta(t, 204800*512/2.0, vda.ReadBytes, 0.001)  // 204800 sectors
+	assert.InDelta(t, 409600*512/2.0, vda.WriteBytes, 0.001) // 409600 sectors
+	assert.InDelta(t, 1.0, vda.ReadAwait, 0.001)             // 200ms / 200 reads
+	assert.InDelta(t, 7.0, vda.WriteAwait, 0.001)            // 1400ms / 200 writes
+	assert.InDelta(t, 4.0, vda.Await, 0.001)                 // 1600ms / 400 requests
+	assert.InDelta(t, 50.0, vda.Util, 0.001)                 // 1000ms busy in 2000ms
+
+	// counters that went backwards count as zero
+	assert.Equal(t, DiskIO{Name: "vda1"}, rates[2])
+
+	// idle device with busy time above the interval is capped
+	assert.Equal(t, 0.0, rates[3].Await)
+	assert.Equal(t, 100.0, rates[3].Util)
+
+	assert.Empty(t, DiskIORates(before, after, 0))
+}
+
+func TestSelectDiskIO(t *testing.T) {
+	devices := []DiskIO{{Name: "loop0"}, {Name: "sda"}, {Name: "sda1"}, {Name: "nvme0n1"}, {Name: "ram12"}}
+
+	include, err := CompileFilter("")
+	assert.Nil(t, err)
+	assert.Nil(t, include)
+	exclude, err := CompileFilter(`^(loop|ram|fd)\d+$`)
+	assert.Nil(t, err)
+	assert.Equal(t, []DiskIO{{Name: "sda"}, {Name: "sda1"}, {Name: "nvme0n1"}}, SelectDiskIO(devices, include, exclude))
+
+	assert.Equal(t, []DiskIO{{Name: "sda"}, {Name: "nvme0n1"}},
+		SelectDiskIO(devices, regexp.MustCompile(`^(sd[a-z]|nvme\d+n\d+)$`), nil))
+
+	_, err = CompileFilter("[")
+	assert.NotNil(t, err)
+}
+
+func TestSelectNetIO(t *testing.T) {
+	interfaces := []NetIO{{Name: "lo"}, {Name: "eth0"}, {Name: "eth1"}, {Name: "docker0"}}
+
+	exclude, err := CompileFilter("^lo$")
+	assert.Nil(t, err)
+	assert.Equal(t, []NetIO{{Name: "eth0"}, {Name: "eth1"}, {Name: "docker0"}}, SelectNetIO(interfaces, nil, exclude))
+
+	assert.Equal(t, []NetIO{{Name: "eth0"}, {Name: "eth1"}},
+		SelectNetIO(interfaces, regexp.MustCompile("^eth"), nil))
+}
+
+func TestParseNetStats(t *testing.T) {
+	stats, err := ParseNetStats("testdata/net")
+	assert.Nil(t, err)
+	// veth0 lost its statistics directory while it was read
+	assert.Equal(t, 4, len(stats))
+
+	assert.Equal(t, NetStats{
+		Name:      "eth0",
+		Flags:     0x1003,
+		OperState: "up",
+		RxBytes:   123456789,
+		TxBytes:   987654,
+		RxPackets: 100000,
+		TxPackets: 80000,
+		RxErrors:  3,
+		TxErrors:  0,
+		RxDropped: 12,
+		TxDropped: 1,
+	}, stats[0])
+	assert.True(t, stats[0].AdminUp())
+	assert.False(t, stats[0].LinkDown())
+
+	// eth1 is up without a link, ifb0 administratively down
+	assert.True(t, stats[1].LinkDown())
+	assert.False(t, stats[2].AdminUp())
+	assert.False(t, stats[2].LinkDown())
+	// lo reports an unknown state
+	assert.False(t, stats[3].LinkDown())
+
+	_, err = ParseNetStats("testdata/missing")
+	assert.NotNil(t, err)
+}
+
+func TestNetIORates(t *testing.T) {
+	before := []NetStats{
+		{Name: "eth0", Flags: 0x1003, OperState: "up", RxBytes: 1000, TxBytes: 500, RxPackets: 10, TxPackets: 5, RxErrors: 1, RxDropped: 2},
+		{Name: "eth1", Flags: 0x1003, OperState: "up", RxBytes: 9000},
+	}
+	after := []NetStats{
+		{Name: "eth0", Flags: 0x1003, OperState: "up", RxBytes: 21000, TxBytes: 4500, RxPackets: 30, TxPackets: 15, RxErrors: 5, TxErrors: 2, RxDropped: 2, TxDropped: 4},
+		{Name: "eth1", Flags: 0x1003, OperState: "down", RxBytes: 100},
+		{Name: "wg0", Flags: 0x91, OperState: "unknown", RxBytes: 100},
+	}
+
+	rates := NetIORates(before, after, 2)
+	assert.Equal(t, 2, len(rates))
+	assert.Equal(t, NetIO{
+		Name:      "eth0",
+		AdminUp:   true,
+		OperState: "up",
+		RxBytes:   10000,
+		TxBytes:   2000,
+		RxPackets: 10,
+		TxPackets: 5,
+		RxErrors:  2,
+		TxErrors:  1,
+		TxDropped: 2,
+	}, rates[0])
+
+	// counter reset after the link went down
+	assert.Equal(t, NetIO{Name: "eth1", AdminUp: true, LinkDown: true, OperState: "down"}, rates[1])
+
+	assert.Empty(t, NetIORates(before, after, 0))
+}
+
+func TestNewHTTPClient(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client, err := NewHTTPClient(time.Second, false, "")
+	assert.Nil(t, err)
+	assert.Equal(t, time.Second, client.Timeout)
+	_, err = client.Get(server.URL)
+	assert.NotNil(t, err)
+
+	client, err = NewHTTPClient(time.Second, true, "")
+	assert.Nil(t, err)
+	response, err := client.Get(server.URL)
+	assert.Nil(t, err)
+	response.Body.Close()
+
+	caCert := filepath.Join(t.TempDir(), "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	assert.Nil(t, os.WriteFile(caCert, certificate, 0o600))
+	client, err = NewHTTPClient(time.Second, false, caCert)
+	assert.Nil(t, err)
+	response, err = client.Get(server.URL)
+	assert.Nil(t, err)
+	response.Body.Close()
+
+	_, err = NewHTTPClient(time.Second, false, "testdata/stat")
+	assert.EqualError(t, err, "no certificates found in testdata/stat")
+	_, err = NewHTTPClient(time.Second, false, "testdata/missing.pem")
+	assert.NotNil(t, err)
+}
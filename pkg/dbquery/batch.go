@@ -0,0 +1,140 @@
+package dbquery
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
+)
+
+// Connection is one entry of a connections file: a label for the report and
+// the data source name handed to the database/sql driver.
+type Connection struct {
+	Label string
+	DSN   string
+}
+
+// BatchOptions bound a batch run: at most Concurrency connections are
+// checked at a time, each within Timeout, and all of them within Deadline.
+// A non-positive Concurrency checks all connections at once and a
+// non-positive Timeout leaves only the Deadline.
+type BatchOptions struct {
+	Concurrency int
+	Timeout     time.Duration
+	Deadline    time.Duration
+}
+
+// Runner checks a single connection and returns a status accepted by
+// NormalizeStatus and a message.
+type Runner func(ctx context.Context, connection Connection) (string, string, error)
+
+// ParseConnectionsFile reads a connections file with one "label,dsn" line
+// per connection. The DSN is everything after the first comma, in the format
+// of the driver. Empty lines and lines starting with "#" are ignored; a file
+// without any connection is an error.
+func ParseConnectionsFile(file string) ([]Connection, error) {
+	readFile, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer readFile.Close()
+
+	connections := []Connection{}
+	scanner := bufio.NewScanner(readFile)
+	i := 0
+	for scanner.Scan() {
+		i++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		label, dsn, found := strings.Cut(line, ",")
+		label = strings.TrimSpace(label)
+		dsn = strings.TrimSpace(dsn)
+		if !found || len(label) == 0 || len(dsn) == 0 {
+			return nil, fmt.Errorf("connection on line [%d] does not match pattern [label,dsn]", i)
+		}
+		connections = append(connections, Connection{Label: label, DSN: dsn})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(connections) == 0 {
+		return nil, fmt.Errorf("no connections found in [%s]", file)
+	}
+
+	return connections, nil
+}
+
+// RunBatch checks all connections with run and reduces the outcomes with
+// batch.Aggregate. A failed connection or query, an unrecognized
+// status and a connection that did not complete before the deadline count as
+// critical for that connection.
+func RunBatch(connections []Connection, opts BatchOptions, run Runner) (string, string) {
+	probe := func(ctx context.Context, c Connection) batch.Outcome {
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+			defer cancel()
+		}
+
+		status, message, err := run(ctx, c)
+		if err != nil {
+			if ctx.Err() != nil {
+				return batch.Outcome{Label: c.Label, Status: "critical", Message: "timeout reached"}
+			}
+			return batch.Outcome{Label: c.Label, Status: "critical", Message: err.Error()}
+		}
+
+		normalized, err := NormalizeStatus(status)
+		if err != nil {
+			return batch.Outcome{Label: c.Label, Status: "critical", Message: err.Error()}
+		}
+		return batch.Outcome{Label: c.Label, Status: normalized, Message: message}
+	}
+
+	expired := func(c Connection) batch.Outcome {
+		return batch.Outcome{Label: c.Label, Status: "critical", Message: "deadline reached before the check completed"}
+	}
+
+	return batch.Aggregate(batch.Run(connections, opts.Concurrency, opts.Deadline, probe, expired))
+}
+
+// DatabaseRunner adapts a check of an open database handle to a Runner that
+// opens the DSN of each connection with the named database/sql driver.
+func DatabaseRunner(driver string, check func(ctx context.Context, db *sql.DB) (string, string, error)) Runner {
+	return func(ctx context.Context, connection Connection) (string, string, error) {
+		db, err := sql.Open(driver, connection.DSN)
+		if err != nil {
+			return "", "", err
+		}
+		defer db.Close()
+
+		return check(ctx, db)
+	}
+}
+
+// BatchCheck adapts exec, run with stmt, to the check of one connection of a
+// batch run. In numeric mode the perfdata is dropped, as the perfdata of all
+// connections would end up in the detail lines, and in multi-row mode the
+// rows are nested below the line of their connection.
+func BatchCheck(exec func(ctx context.Context, db *sql.DB, stmt string) (string, string, error), stmt string,
+	numeric, multiRow bool) func(ctx context.Context, db *sql.DB) (string, string, error) {
+	return func(ctx context.Context, db *sql.DB) (string, string, error) {
+		status, message, err := exec(ctx, db, stmt)
+		switch {
+		case numeric:
+			message, _, _ = strings.Cut(message, " | ")
+		case multiRow:
+			message = strings.ReplaceAll(message, "\n", "\n  ")
+		}
+		return status, message, err
+	}
+}
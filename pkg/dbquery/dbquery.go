@@ -1,7 +1,8 @@
 // Package dbquery holds the database-agnostic building blocks shared by the
-// query-style checks (check-oracle-query, check-postgres-query, ...): resolving
-// the query text, mapping a returned status to a Sensu result, and aggregating
-// per-connection outcomes in batch mode.
+// query-style checks (check-oracle-query, check-postgres-query,
+// check-mysql-query and check-sql-query): resolving and executing the query,
+// mapping a returned status to a Sensu result, and running a check against
+// every connection of a connections file in batch mode.
 package dbquery
 
 import (
@@ -70,49 +71,3 @@ func NormalizeStatus(status string) (string, error) {
 		return "", fmt.Errorf("query returned unexpected status %q (expected one of: ok, warn, warning, error)", status)
 	}
 }
-
-// QueryOutcome is the normalized result of running a query against a single
-// connection in batch mode. Status is one of "ok", "warning" or "critical".
-type QueryOutcome struct {
-	Label   string
-	Status  string
-	Message string
-}
-
-// AggregateQueryOutcomes reduces per-connection outcomes to a single overall
-// status (worst-status-wins: critical > warning > ok) and a human-readable
-// report. The report starts with a summary line and lists each non-ok
-// connection. Any unrecognized status is treated as critical.
-func AggregateQueryOutcomes(outcomes []QueryOutcome) (string, string) {
-	var ok, warning, critical int
-	details := []string{}
-
-	for _, o := range outcomes {
-		switch o.Status {
-		case "ok":
-			ok++
-		case "warning":
-			warning++
-			details = append(details, fmt.Sprintf("- %s: WARNING %s", o.Label, o.Message))
-		default:
-			critical++
-			details = append(details, fmt.Sprintf("- %s: CRITICAL %s", o.Label, o.Message))
-		}
-	}
-
-	summary := fmt.Sprintf("%d critical, %d warning, %d ok (of %d)", critical, warning, ok, len(outcomes))
-	output := summary
-	if len(details) > 0 {
-		output = summary + "\n" + strings.Join(details, "\n")
-	}
-
-	status := "ok"
-	switch {
-	case critical > 0:
-		status = "critical"
-	case warning > 0:
-		status = "warning"
-	}
-
-	return status, output
-}
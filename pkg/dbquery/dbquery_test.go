@@ -78,48 +78,3 @@ func TestReadQueryEmptyAfterStrip(t *testing.T) {
 	_, err := ReadQuery(";", "")
 	assert.NotNil(t, err)
 }
-
-func TestAggregateQueryOutcomesAllOk(t *testing.T) {
-	status, output := AggregateQueryOutcomes([]QueryOutcome{
-		{Label: "a", Status: "ok", Message: "fine"},
-		{Label: "b", Status: "ok", Message: "fine"},
-	})
-	assert.Equal(t, "ok", status)
-	assert.Equal(t, "0 critical, 0 warning, 2 ok (of 2)", output)
-}
-
-func TestAggregateQueryOutcomesWarningWins(t *testing.T) {
-	status, output := AggregateQueryOutcomes([]QueryOutcome{
-		{Label: "a", Status: "ok", Message: "fine"},
-		{Label: "b (u@db)", Status: "warning", Message: "busy"},
-	})
-	assert.Equal(t, "warning", status)
-	assert.Contains(t, output, "0 critical, 1 warning, 1 ok")
-	assert.Contains(t, output, "- b (u@db): WARNING busy")
-}
-
-func TestAggregateQueryOutcomesCriticalWins(t *testing.T) {
-	status, output := AggregateQueryOutcomes([]QueryOutcome{
-		{Label: "a", Status: "warning", Message: "busy"},
-		{Label: "b", Status: "critical", Message: "down"},
-		{Label: "c", Status: "ok", Message: "fine"},
-	})
-	assert.Equal(t, "critical", status)
-	assert.Contains(t, output, "1 critical, 1 warning, 1 ok (of 3)")
-	assert.Contains(t, output, "- b: CRITICAL down")
-	assert.Contains(t, output, "- a: WARNING busy")
-}
-
-func TestAggregateQueryOutcomesUnknownStatusIsCritical(t *testing.T) {
-	status, output := AggregateQueryOutcomes([]QueryOutcome{
-		{Label: "a", Status: "", Message: "connection failed"},
-	})
-	assert.Equal(t, "critical", status)
-	assert.Contains(t, output, "- a: CRITICAL connection failed")
-}
-
-func TestAggregateQueryOutcomesEmpty(t *testing.T) {
-	status, output := AggregateQueryOutcomes([]QueryOutcome{})
-	assert.Equal(t, "ok", status)
-	assert.Equal(t, "0 critical, 0 warning, 0 ok (of 0)", output)
-}
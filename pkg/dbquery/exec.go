@@ -0,0 +1,88 @@
+package dbquery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// IsCall reports whether the given statement is a MySQL stored procedure call
+// that hands the result back in the user variables @status and @message, e.g.
+// "CALL health_check(@status, @message)". A CALL without these variables is
+// queried like any other statement and must return a result set.
+func IsCall(query string) bool {
+	q := strings.ToLower(strings.TrimSpace(query))
+	return strings.HasPrefix(q, "call") && strings.Contains(q, "@status") && strings.Contains(q, "@message")
+}
+
+// ExecQuery runs a resolved statement against an open database handle and
+// returns the status and message it produced:
+//
+//   - a PL/SQL block (see IsPLSQL) is executed with the two OUT bind variables
+//     :status and :message,
+//   - a MySQL procedure call (see IsCall) is executed and the user variables
+//     @status and @message are read back on the same session,
+//   - any other statement is expected to return a single row with two columns
+//     (status, message).
+//
+// A cancelled or expired context is reported as "timeout reached"; other
+// errors are returned unchanged so the caller can translate driver errors.
+func ExecQuery(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+	var status, message string
+
+	switch {
+	case IsPLSQL(stmt):
+		_, err := db.ExecContext(ctx, stmt,
+			sql.Named("status", sql.Out{Dest: &status}),
+			sql.Named("message", sql.Out{Dest: &message}))
+		if err != nil {
+			return "", "", queryError(ctx, err)
+		}
+		return status, message, nil
+	case IsCall(stmt):
+		return execCall(ctx, db, stmt)
+	}
+
+	err := db.QueryRowContext(ctx, stmt).Scan(&status, &message)
+	if err != nil {
+		return "", "", queryError(ctx, err)
+	}
+
+	return status, message, nil
+}
+
+// execCall runs a procedure call on a single connection, as user variables
+// only live in the session that set them, and reads @status and @message. A
+// variable the procedure did not set reads as an empty string.
+func execCall(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return "", "", queryError(ctx, err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, stmt); err != nil {
+		return "", "", queryError(ctx, err)
+	}
+
+	var status, message sql.NullString
+	err = conn.QueryRowContext(ctx, "SELECT @status, @message").Scan(&status, &message)
+	if err != nil {
+		return "", "", queryError(ctx, err)
+	}
+
+	return status.String, message.String, nil
+}
+
+// queryError maps an expired context and an empty result to the messages
+// shared by all query checks.
+func queryError(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("timeout reached")
+	}
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("query returned no rows (expected one row with two columns: status, message)")
+	}
+	return err
+}
@@ -0,0 +1,85 @@
+package dbquery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsCall(t *testing.T) {
+	assert.True(t, IsCall("CALL health_check(@status, @message)"))
+	assert.True(t, IsCall("  call app.check(1, @status, @message)"))
+	assert.False(t, IsCall("CALL health_check()"))
+	assert.False(t, IsCall("select @status, @message"))
+}
+
+func TestExecQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status", "message"}).AddRow("ok", "all good"))
+	status, message, err := ExecQuery(context.Background(), db, "select status, message from health")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", status)
+	assert.Equal(t, "all good", message)
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status", "message"}))
+	_, _, err = ExecQuery(context.Background(), db, "select status, message from health")
+	assert.ErrorContains(t, err, "no rows")
+
+	mock.ExpectQuery("select").WillReturnError(fmt.Errorf("relation does not exist"))
+	_, _, err = ExecQuery(context.Background(), db, "select status, message from missing")
+	assert.EqualError(t, err, "relation does not exist")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecQueryCall(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectExec("CALL health_check(@status, @message)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT @status, @message").WillReturnRows(
+		sqlmock.NewRows([]string{"@status", "@message"}).AddRow("warn", "replica lagging"))
+	status, message, err := ExecQuery(context.Background(), db, "CALL health_check(@status, @message)")
+	require.NoError(t, err)
+	assert.Equal(t, "warn", status)
+	assert.Equal(t, "replica lagging", message)
+
+	mock.ExpectExec("CALL health_check(@status, @message)").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery("SELECT @status, @message").WillReturnRows(
+		sqlmock.NewRows([]string{"@status", "@message"}).AddRow(nil, nil))
+	status, message, err = ExecQuery(context.Background(), db, "CALL health_check(@status, @message)")
+	require.NoError(t, err)
+	assert.Empty(t, status)
+	assert.Empty(t, message)
+
+	mock.ExpectExec("CALL health_check(@status, @message)").WillReturnError(fmt.Errorf("PROCEDURE does not exist"))
+	_, _, err = ExecQuery(context.Background(), db, "CALL health_check(@status, @message)")
+	assert.EqualError(t, err, "PROCEDURE does not exist")
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestExecQueryTimeout(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status", "message"}).AddRow("ok", "x"))
+	mock.ExpectExec("begin")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, _, err = ExecQuery(ctx, db, "select status, message from health")
+	assert.EqualError(t, err, "timeout reached")
+	_, _, err = ExecQuery(ctx, db, "begin my_proc(:status, :message); end;")
+	assert.EqualError(t, err, "timeout reached")
+	_, _, err = ExecQuery(ctx, db, "CALL health_check(@status, @message)")
+	assert.EqualError(t, err, "timeout reached")
+}
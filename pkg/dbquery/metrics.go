@@ -0,0 +1,208 @@
+package dbquery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+// Metric is one numeric value returned by a query in numeric mode.
+type Metric struct {
+	Label string
+	Value float64
+}
+
+// The result shapes of the numeric mode.
+const (
+	// NumericColumns reads every column of a single row as a metric named
+	// after the column.
+	NumericColumns = "columns"
+	// NumericRows reads every row of two columns, a label and a value, as a
+	// metric.
+	NumericRows = "rows"
+)
+
+// NumericModes lists the result shapes of the numeric mode.
+var NumericModes = []string{NumericColumns, NumericRows}
+
+// MetricOptions select the result shape of the numeric mode (NumericColumns
+// or NumericRows) and hold the thresholds applied to every metric. With Below
+// set the values must not fall below the thresholds, otherwise they must stay
+// below them. A threshold of zero is disabled.
+type MetricOptions struct {
+	Mode      string
+	Threshold check.Threshold
+	Below     bool
+}
+
+// ValidateNumericMode returns an error unless mode is one of NumericModes.
+func ValidateNumericMode(mode string) error {
+	for _, m := range NumericModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown numeric mode %q (expected one of: %s)", mode, strings.Join(NumericModes, ", "))
+}
+
+// QueryMetrics runs stmt and reads its numeric values in the given shape:
+//
+//   - NumericColumns: every column of the single row is a metric named after
+//     the column, e.g. "select count(*) as stuck_jobs, ... from jobs". Any
+//     number of rows other than one is an error.
+//   - NumericRows: every row has two columns, a label and a value, e.g.
+//     "select queue, count(*) from jobs group by queue". A query without
+//     rows yields no metrics.
+//
+// A NULL or non-numeric value is an error, as is a PL/SQL block or procedure
+// call, which return no result set.
+func QueryMetrics(ctx context.Context, db *sql.DB, stmt string, mode string) ([]Metric, error) {
+	if err := ValidateNumericMode(mode); err != nil {
+		return nil, err
+	}
+	if IsPLSQL(stmt) || IsCall(stmt) {
+		return nil, fmt.Errorf("numeric mode expects a query returning a result set, not a procedure call")
+	}
+
+	rows, err := db.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if mode == NumericRows && len(columns) != 2 {
+		return nil, fmt.Errorf("query returned %d columns (expected label, value)", len(columns))
+	}
+
+	var (
+		metrics []Metric
+		count   int
+	)
+	for rows.Next() {
+		count++
+		if mode == NumericColumns && count > 1 {
+			return nil, fmt.Errorf("query returned more than one row (numeric columns expect a single row, use rows for label, value rows)")
+		}
+
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, queryError(ctx, err)
+		}
+
+		if mode == NumericColumns {
+			if metrics, err = columnMetrics(columns, values); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if !values[0].Valid {
+			return nil, fmt.Errorf("query returned a row without a label")
+		}
+		value, err := parseValue(values[1])
+		if err != nil {
+			return nil, fmt.Errorf("value of [%s] %v", values[0].String, err)
+		}
+		metrics = append(metrics, Metric{Label: values[0].String, Value: value})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+	if mode == NumericColumns && count == 0 {
+		return nil, fmt.Errorf("query returned no rows (numeric columns expect a single row)")
+	}
+
+	return metrics, nil
+}
+
+// columnMetrics turns the columns of a single row into metrics.
+func columnMetrics(columns []string, values []sql.NullString) ([]Metric, error) {
+	metrics := make([]Metric, 0, len(columns))
+	for i, column := range columns {
+		value, err := parseValue(values[i])
+		if err != nil {
+			return nil, fmt.Errorf("column [%s] %v", column, err)
+		}
+		metrics = append(metrics, Metric{Label: column, Value: value})
+	}
+	return metrics, nil
+}
+
+// parseValue parses a numeric column value.
+func parseValue(value sql.NullString) (float64, error) {
+	if !value.Valid {
+		return 0, fmt.Errorf("is NULL")
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(value.String), 64)
+	if err != nil {
+		return 0, fmt.Errorf("is not a number: %q", value.String)
+	}
+	return f, nil
+}
+
+// EvaluateMetrics applies the thresholds to every metric and returns the
+// worst level and a message listing the values, the ones outside the
+// thresholds and a perfdata entry per metric.
+func EvaluateMetrics(metrics []Metric, opts MetricOptions) (string, string) {
+	if len(metrics) == 0 {
+		return "ok", "query returned no values"
+	}
+
+	var (
+		levels   []string
+		details  []string
+		problems []string
+		perfdata []string
+	)
+	for _, m := range metrics {
+		level := opts.Threshold.Level(m.Value)
+		if opts.Below {
+			level = opts.Threshold.MinLevel(m.Value)
+		}
+
+		detail := fmt.Sprintf("%s %s", m.Label, formatNumber(m.Value))
+		details = append(details, detail)
+		levels = append(levels, level)
+		if level != "ok" {
+			problems = append(problems, detail+", "+level)
+		}
+		perfdata = append(perfdata, fmt.Sprintf("%s=%s;%s;;", check.PerfLabel(m.Label), formatNumber(m.Value), opts.Threshold.Perf()))
+	}
+
+	message := strings.Join(details, ", ")
+	if len(problems) > 0 {
+		message += ": " + strings.Join(problems, ", ")
+	}
+
+	return check.WorstLevel(levels...), message + " | " + strings.Join(perfdata, " ")
+}
+
+// ExecMetrics runs stmt in numeric mode. It returns a level and a message
+// like ExecQuery returns a status and message, so the query checks can use
+// either to run a statement.
+func ExecMetrics(ctx context.Context, db *sql.DB, stmt string, opts MetricOptions) (string, string, error) {
+	metrics, err := QueryMetrics(ctx, db, stmt, opts.Mode)
+	if err != nil {
+		return "", "", err
+	}
+
+	level, message := EvaluateMetrics(metrics, opts)
+	return level, message, nil
+}
+
+// formatNumber renders a value without an exponent or trailing zeros.
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,135 @@
+package dbquery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/check"
+)
+
+func TestQueryMetricsColumns(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"stuck_jobs", "failed_jobs", "ratio"}).
+		AddRow("3", 0, " 0.25"))
+	metrics, err := QueryMetrics(context.Background(), db, "select stuck_jobs, failed_jobs, ratio from job_stats", NumericColumns)
+	require.NoError(t, err)
+	assert.Equal(t, []Metric{{"stuck_jobs", 3}, {"failed_jobs", 0}, {"ratio", 0.25}}, metrics)
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"active", "idle"}).AddRow(4, 10))
+	metrics, err = QueryMetrics(context.Background(), db, "select active, idle from sessions", NumericColumns)
+	require.NoError(t, err)
+	assert.Equal(t, []Metric{{"active", 4}, {"idle", 10}}, metrics)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryMetricsRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"queue", "count"}).
+		AddRow("billing", 12).AddRow("mail", "0"))
+	metrics, err := QueryMetrics(context.Background(), db, "select queue, count(*) from jobs group by queue", NumericRows)
+	require.NoError(t, err)
+	assert.Equal(t, []Metric{{"billing", 12}, {"mail", 0}}, metrics)
+
+	// A numeric label is a label, not a value.
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"shard_id", "count"}).
+		AddRow(1, 120).AddRow(2, 80))
+	metrics, err = QueryMetrics(context.Background(), db, "select shard_id, count(*) from jobs group by shard_id", NumericRows)
+	require.NoError(t, err)
+	assert.Equal(t, []Metric{{"1", 120}, {"2", 80}}, metrics)
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"queue", "count"}))
+	metrics, err = QueryMetrics(context.Background(), db, "select queue, count(*) from jobs group by queue", NumericRows)
+	require.NoError(t, err)
+	assert.Empty(t, metrics)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryMetricsErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"stuck_jobs", "oldest"}).AddRow(3, nil))
+	_, err = QueryMetrics(context.Background(), db, "select stuck_jobs, oldest from job_stats", NumericColumns)
+	assert.EqualError(t, err, "column [oldest] is NULL")
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"shard_id", "count"}).
+		AddRow(1, 120).AddRow(2, 80))
+	_, err = QueryMetrics(context.Background(), db, "select shard_id, count(*) from jobs group by shard_id", NumericColumns)
+	assert.ErrorContains(t, err, "query returned more than one row")
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"stuck_jobs"}))
+	_, err = QueryMetrics(context.Background(), db, "select stuck_jobs from job_stats", NumericColumns)
+	assert.ErrorContains(t, err, "query returned no rows")
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"queue", "count", "oldest"}).AddRow("mail", 1, 2))
+	_, err = QueryMetrics(context.Background(), db, "select queue, count, oldest from jobs", NumericRows)
+	assert.EqualError(t, err, "query returned 3 columns (expected label, value)")
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"queue", "count"}).
+		AddRow("billing", 12).AddRow("mail", "many"))
+	_, err = QueryMetrics(context.Background(), db, "select queue, count from jobs", NumericRows)
+	assert.EqualError(t, err, `value of [mail] is not a number: "many"`)
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"queue", "count"}).
+		AddRow("billing", 12).AddRow(nil, 1))
+	_, err = QueryMetrics(context.Background(), db, "select queue, count from jobs", NumericRows)
+	assert.EqualError(t, err, "query returned a row without a label")
+
+	mock.ExpectQuery("select").WillReturnError(fmt.Errorf("relation does not exist"))
+	_, err = QueryMetrics(context.Background(), db, "select count(*) from missing", NumericColumns)
+	assert.EqualError(t, err, "relation does not exist")
+
+	_, err = QueryMetrics(context.Background(), db, "begin my_proc(:status, :message); end;", NumericColumns)
+	assert.ErrorContains(t, err, "not a procedure call")
+
+	_, err = QueryMetrics(context.Background(), db, "select count(*) from jobs", "table")
+	assert.EqualError(t, err, `unknown numeric mode "table" (expected one of: columns, rows)`)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestEvaluateMetrics(t *testing.T) {
+	metrics := []Metric{{"stuck jobs", 3}, {"failed_jobs", 0}, {"backlog", 1500000}}
+
+	level, message := EvaluateMetrics(metrics, MetricOptions{Threshold: check.Threshold{Warning: 1, Critical: 10}})
+	assert.Equal(t, "critical", level)
+	assert.Equal(t, "stuck jobs 3, failed_jobs 0, backlog 1500000: stuck jobs 3, warning, backlog 1500000, critical | "+
+		"stuck_jobs=3;1;10;; failed_jobs=0;1;10;; backlog=1500000;1;10;;", message)
+
+	level, message = EvaluateMetrics(metrics, MetricOptions{Threshold: check.Threshold{Warning: 2.5}, Below: true})
+	assert.Equal(t, "warning", level)
+	assert.Equal(t, "stuck jobs 3, failed_jobs 0, backlog 1500000: failed_jobs 0, warning | "+
+		"stuck_jobs=3;2.5;;; failed_jobs=0;2.5;;; backlog=1500000;2.5;;;", message)
+
+	level, message = EvaluateMetrics(nil, MetricOptions{Threshold: check.Threshold{Critical: 1}})
+	assert.Equal(t, "ok", level)
+	assert.Equal(t, "query returned no values", message)
+}
+
+func TestExecMetrics(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"stuck_jobs"}).AddRow(2))
+	level, message, err := ExecMetrics(context.Background(), db, "select count(*) as stuck_jobs from jobs",
+		MetricOptions{Mode: NumericColumns, Threshold: check.Threshold{Warning: 1, Critical: 5}})
+	require.NoError(t, err)
+	assert.Equal(t, "warning", level)
+	assert.Equal(t, "stuck_jobs 2: stuck_jobs 2, warning | stuck_jobs=2;1;5;;", message)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = ExecMetrics(ctx, db, "select count(*) as stuck_jobs from jobs", MetricOptions{Mode: NumericColumns})
+	assert.EqualError(t, err, "timeout reached")
+}
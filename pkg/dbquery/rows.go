@@ -0,0 +1,83 @@
+package dbquery
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
+)
+
+// QueryRows runs stmt and returns one outcome per row, so a single query can
+// check many objects at once. Every row is an independent result with the
+// columns (status, message) or (label, status, message); rows without a label
+// are named "row <n>". An unrecognized status counts as critical for that row.
+// A PL/SQL block or procedure call returns no rows and is an error.
+func QueryRows(ctx context.Context, db *sql.DB, stmt string) ([]batch.Outcome, error) {
+	if IsPLSQL(stmt) || IsCall(stmt) {
+		return nil, fmt.Errorf("multi-row mode expects a query returning a result set, not a procedure call")
+	}
+
+	rows, err := db.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, queryError(ctx, err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	if len(columns) != 2 && len(columns) != 3 {
+		return nil, fmt.Errorf("query returned %d columns (expected status, message or label, status, message)", len(columns))
+	}
+
+	outcomes := []batch.Outcome{}
+	for n := 1; rows.Next(); n++ {
+		values := make([]sql.NullString, len(columns))
+		dest := make([]any, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, queryError(ctx, err)
+		}
+
+		outcome := batch.Outcome{Label: fmt.Sprintf("row %d", n)}
+		if len(columns) == 3 {
+			if values[0].Valid && len(values[0].String) > 0 {
+				outcome.Label = values[0].String
+			}
+			values = values[1:]
+		}
+
+		status, err := NormalizeStatus(values[0].String)
+		if err != nil {
+			outcome.Status = "critical"
+			outcome.Message = err.Error()
+		} else {
+			outcome.Status = status
+			outcome.Message = values[1].String
+		}
+		outcomes = append(outcomes, outcome)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, queryError(ctx, err)
+	}
+
+	return outcomes, nil
+}
+
+// ExecRows runs stmt in multi-row mode and reduces the rows with
+// batch.Aggregate (worst-status-wins). It returns a status and a
+// report like ExecQuery, so the query checks can use either to run a
+// statement. A query without rows is ok.
+func ExecRows(ctx context.Context, db *sql.DB, stmt string) (string, string, error) {
+	outcomes, err := QueryRows(ctx, db, stmt)
+	if err != nil {
+		return "", "", err
+	}
+
+	status, output := batch.Aggregate(outcomes)
+	return status, output, nil
+}
@@ -0,0 +1,86 @@
+package dbquery
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/batch"
+)
+
+func TestQueryRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"label", "status", "message"}).
+		AddRow("order 41", "ok", "shipped").
+		AddRow("order 42", "WARN", "waiting for payment").
+		AddRow(nil, "error", nil).
+		AddRow("order 44", "bogus", "?"))
+	outcomes, err := QueryRows(context.Background(), db, "select id, status, message from order_checks")
+	require.NoError(t, err)
+	assert.Equal(t, []batch.Outcome{
+		{Label: "order 41", Status: "ok", Message: "shipped"},
+		{Label: "order 42", Status: "warning", Message: "waiting for payment"},
+		{Label: "row 3", Status: "critical", Message: ""},
+		{Label: "order 44", Status: "critical", Message: `query returned unexpected status "bogus" (expected one of: ok, warn, warning, error)`},
+	}, outcomes)
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status", "message"}).
+		AddRow("ok", "a").AddRow("crit", "b"))
+	outcomes, err = QueryRows(context.Background(), db, "select status, message from checks")
+	require.NoError(t, err)
+	assert.Equal(t, []batch.Outcome{{Label: "row 1", Status: "ok", Message: "a"}, {Label: "row 2", Status: "critical", Message: "b"}}, outcomes)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestQueryRowsErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow("ok"))
+	_, err = QueryRows(context.Background(), db, "select status from checks")
+	assert.EqualError(t, err, "query returned 1 columns (expected status, message or label, status, message)")
+
+	mock.ExpectQuery("select").WillReturnError(fmt.Errorf("relation does not exist"))
+	_, err = QueryRows(context.Background(), db, "select status, message from missing")
+	assert.EqualError(t, err, "relation does not exist")
+
+	_, err = QueryRows(context.Background(), db, "CALL health_check(@status, @message)")
+	assert.ErrorContains(t, err, "not a procedure call")
+	assert.NoError(t, mock.ExpectationsWereMet())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = QueryRows(ctx, db, "select status, message from checks")
+	assert.EqualError(t, err, "timeout reached")
+}
+
+func TestExecRows(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"label", "status", "message"}).
+		AddRow("billing", "ok", "3 jobs").
+		AddRow("mail", "warning", "120 jobs queued").
+		AddRow("export", "error", "last run failed"))
+	status, output, err := ExecRows(context.Background(), db, "select queue, status, message from queue_checks")
+	require.NoError(t, err)
+	assert.Equal(t, "critical", status)
+	assert.Equal(t, "1 critical, 1 warning, 1 ok (of 3)\n"+
+		"- mail: WARNING 120 jobs queued\n"+
+		"- export: CRITICAL last run failed", output)
+
+	mock.ExpectQuery("select").WillReturnRows(sqlmock.NewRows([]string{"label", "status", "message"}))
+	status, output, err = ExecRows(context.Background(), db, "select queue, status, message from queue_checks")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", status)
+	assert.Equal(t, "0 critical, 0 warning, 0 ok (of 0)", output)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
@@ -13,6 +13,7 @@ type metricsStruct struct {
 	hostname string
 	scheme   string
 	Option   *pflag.FlagSet
+	ExitFn   func(int)
 }
 
 func New(scheme string) *metricsStruct {
@@ -22,6 +23,7 @@ func New(scheme string) *metricsStruct {
 		hostname: strings.Split(fqdn, ".")[0],
 		scheme:   scheme,
 		Option:   pflag.NewFlagSet(scheme, 1),
+		ExitFn:   os.Exit,
 	}
 
 	return metrics
@@ -44,3 +46,10 @@ func (m metricsStruct) Init() {
 func (m metricsStruct) Print(value float64) {
 	fmt.Printf("%s.%s %f %d\n", m.hostname, m.scheme, value, time.Now().Unix())
 }
+
+// Error writes err to stderr and exits with 3, so the handler does not take
+// a run without metrics for a successful one.
+func (m metricsStruct) Error(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	m.ExitFn(3)
+}
@@ -1,6 +1,7 @@
 package metrics
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -37,3 +38,12 @@ func TestPrint(t *testing.T) {
 	metrics := New("whatever")
 	metrics.Print(100)
 }
+
+func TestError(t *testing.T) {
+	var value int
+	metrics := New("whatever")
+	metrics.ExitFn = func(code int) { value = code }
+
+	metrics.Error(fmt.Errorf("whatever"))
+	assert.Equal(t, 3, value)
+}
@@ -0,0 +1,231 @@
+// Package mysql builds go-sql-driver DSNs with TLS options and option file
+// credentials for the MySQL checks.
+package mysql
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+// SSLModes are the --ssl-mode values of the mysql client.
+var SSLModes = []string{"DISABLED", "PREFERRED", "REQUIRED", "VERIFY_CA", "VERIFY_IDENTITY"}
+
+// Connection adds the TLS settings and the connect timeout (0 uses the
+// driver default) to the common connection parameters.
+type Connection struct {
+	common.Connection
+	SSLMode        string
+	SSLCA          string
+	SSLCert        string
+	SSLKey         string
+	ConnectTimeout time.Duration
+}
+
+// DataSource assembles the go-sql-driver DSN. DISABLED and PREFERRED use
+// the built-in TLS settings of the driver; the other modes register a TLS
+// configuration with the CA and client certificate for the server.
+func DataSource(c Connection) (string, error) {
+	config := driver.NewConfig()
+	config.User = c.User
+	config.Passwd = c.Password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+	config.DBName = c.Database
+	config.Timeout = c.ConnectTimeout
+
+	switch strings.ToUpper(c.SSLMode) {
+	case "", "DISABLED":
+	case "PREFERRED":
+		config.TLSConfig = "preferred"
+	case "REQUIRED", "VERIFY_CA", "VERIFY_IDENTITY":
+		tlsConfig, err := newTLSConfig(c)
+		if err != nil {
+			return "", err
+		}
+		config.TLSConfig = config.Addr
+		if err := driver.RegisterTLSConfig(config.TLSConfig, tlsConfig); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("invalid ssl-mode %q, use one of %s", c.SSLMode, strings.Join(SSLModes, ", "))
+	}
+
+	return config.FormatDSN(), nil
+}
+
+// newTLSConfig verifies nothing for REQUIRED, the certificate chain for
+// VERIFY_CA and also the host name for VERIFY_IDENTITY.
+func newTLSConfig(c Connection) (*tls.Config, error) {
+	config := &tls.Config{ServerName: c.Host}
+
+	if len(c.SSLCA) > 0 {
+		pem, err := os.ReadFile(c.SSLCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.SSLCA)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(c.SSLCert) > 0 || len(c.SSLKey) > 0 {
+		certificate, err := tls.LoadX509KeyPair(c.SSLCert, c.SSLKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	switch strings.ToUpper(c.SSLMode) {
+	case "REQUIRED":
+		config.InsecureSkipVerify = true
+	case "VERIFY_CA":
+		config.InsecureSkipVerify = true
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			return verifyChain(state, config.RootCAs)
+		}
+	}
+	return config, nil
+}
+
+// verifyChain checks the server certificate against the CA without looking
+// at the host name.
+func verifyChain(state tls.ConnectionState, roots *x509.CertPool) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("server sent no certificate")
+	}
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+	for _, certificate := range state.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(certificate)
+	}
+	_, err := state.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// ValidateSSLMode reports an unknown ssl-mode.
+func ValidateSSLMode(mode string) error {
+	for _, m := range SSLModes {
+		if strings.EqualFold(mode, m) {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid ssl-mode %q, use one of %s", mode, strings.Join(SSLModes, ", "))
+}
+
+// DefaultOptionFile is the option file of the current user, ~/.my.cnf.
+func DefaultOptionFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".my.cnf")
+}
+
+// ParseOptionFile reads the [client] group of a MySQL option file. Keys are
+// lower case with dashes, so ssl_ca and ssl-ca are the same option, and
+// quotes around values are removed.
+func ParseOptionFile(r io.Reader) (map[string]string, error) {
+	options := map[string]string{}
+	group := ""
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' || line[0] == '!' {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("invalid group %q", line)
+			}
+			group = strings.ToLower(strings.TrimSpace(line[1 : len(line)-1]))
+			continue
+		}
+		if group != "client" {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+		key = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(key)), "_", "-")
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		options[key] = value
+	}
+	return options, scanner.Err()
+}
+
+// ApplyOptionFile fills the connection from the [client] group of an option
+// file. Settings are taken from the file unless given reports the option of
+// the same name as set on the command line; user and password are also kept
+// when they already have a value, e.g. from the environment. An empty path
+// reads ~/.my.cnf if it exists.
+func ApplyOptionFile(c *Connection, path string, given func(name string) bool) error {
+	optional := len(path) == 0
+	if optional {
+		path = DefaultOptionFile()
+		if len(path) == 0 {
+			return nil
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		if optional && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	options, err := ParseOptionFile(file)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	settings := []struct {
+		name   string
+		target *string
+		keep   bool
+	}{
+		{"user", &c.User, len(c.User) > 0},
+		{"password", &c.Password, len(c.Password) > 0},
+		{"host", &c.Host, false},
+		{"database", &c.Database, false},
+		{"ssl-mode", &c.SSLMode, false},
+		{"ssl-ca", &c.SSLCA, false},
+		{"ssl-cert", &c.SSLCert, false},
+		{"ssl-key", &c.SSLKey, false},
+	}
+	for _, s := range settings {
+		if value, ok := options[s.name]; ok && !s.keep && !given(s.name) {
+			*s.target = value
+		}
+	}
+
+	if value, ok := options["port"]; ok && !given("port") {
+		port, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid port %q", path, value)
+		}
+		c.Port = port
+	}
+	return nil
+}
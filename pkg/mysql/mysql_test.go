@@ -0,0 +1,122 @@
+package mysql
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func TestDataSource(t *testing.T) {
+	connection := Connection{Connection: common.Connection{
+		Host: "db.example.com", Port: 3306, User: "monitor", Password: "secret", Database: "appdb",
+	}}
+	source, err := DataSource(connection)
+	require.NoError(t, err)
+	assert.Equal(t, "monitor:secret@tcp(db.example.com:3306)/appdb", source)
+
+	connection.SSLMode = "disabled"
+	connection.ConnectTimeout = 5 * time.Second
+	source, err = DataSource(connection)
+	require.NoError(t, err)
+	assert.Equal(t, "monitor:secret@tcp(db.example.com:3306)/appdb?timeout=5s", source)
+
+	connection.SSLMode = "PREFERRED"
+	connection.ConnectTimeout = 0
+	source, err = DataSource(connection)
+	require.NoError(t, err)
+	assert.Equal(t, "monitor:secret@tcp(db.example.com:3306)/appdb?tls=preferred", source)
+
+	connection.Host = "::1"
+	connection.Password = ""
+	connection.SSLMode = "REQUIRED"
+	source, err = DataSource(connection)
+	require.NoError(t, err)
+	config, err := driver.ParseDSN(source)
+	require.NoError(t, err)
+	assert.Equal(t, "monitor", config.User)
+	assert.Equal(t, "[::1]:3306", config.Addr)
+	require.NotNil(t, config.TLS)
+	assert.True(t, config.TLS.InsecureSkipVerify)
+
+	connection.SSLMode = "VERIFY_IDENTITY"
+	connection.SSLCA = filepath.Join(t.TempDir(), "missing.pem")
+	_, err = DataSource(connection)
+	assert.Error(t, err)
+
+	connection.SSLMode = "verify"
+	_, err = DataSource(connection)
+	assert.ErrorContains(t, err, "invalid ssl-mode")
+}
+
+func TestValidateSSLMode(t *testing.T) {
+	for _, mode := range append(SSLModes, "verify_ca") {
+		assert.NoError(t, ValidateSSLMode(mode))
+	}
+	assert.Error(t, ValidateSSLMode("require"))
+}
+
+func TestParseOptionFile(t *testing.T) {
+	options, err := ParseOptionFile(strings.NewReader(`
+# credentials for monitoring
+[mysqld]
+user = mysql
+
+[client]
+user = monitor
+password = "se cret"
+ssl_ca = '/etc/mysql/ca.pem'
+skip-ssl
+!includedir /etc/mysql/conf.d/
+
+[mysql]
+database = ignored
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"user":     "monitor",
+		"password": "se cret",
+		"ssl-ca":   "/etc/mysql/ca.pem",
+		"skip-ssl": "",
+	}, options)
+
+	_, err = ParseOptionFile(strings.NewReader("[client\nuser=monitor\n"))
+	assert.Error(t, err)
+}
+
+func TestApplyOptionFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my.cnf")
+	require.NoError(t, os.WriteFile(path, []byte("[client]\nuser=monitor\npassword=secret\nhost=db.example.com\nport=3307\nssl-mode=VERIFY_CA\n"), 0o600))
+
+	connection := Connection{Connection: common.Connection{Host: "localhost", Port: 3306, Database: "mysql"}}
+	require.NoError(t, ApplyOptionFile(&connection, path, func(string) bool { return false }))
+	assert.Equal(t, "monitor", connection.User)
+	assert.Equal(t, "secret", connection.Password)
+	assert.Equal(t, "db.example.com", connection.Host)
+	assert.Equal(t, 3307, connection.Port)
+	assert.Equal(t, "mysql", connection.Database)
+	assert.Equal(t, "VERIFY_CA", connection.SSLMode)
+
+	// Command line options and credentials from the environment win.
+	connection = Connection{Connection: common.Connection{Host: "localhost", Port: 3306, User: "admin"}}
+	given := func(name string) bool { return name == "host" || name == "port" }
+	require.NoError(t, ApplyOptionFile(&connection, path, given))
+	assert.Equal(t, "admin", connection.User)
+	assert.Equal(t, "secret", connection.Password)
+	assert.Equal(t, "localhost", connection.Host)
+	assert.Equal(t, 3306, connection.Port)
+
+	require.NoError(t, os.WriteFile(path, []byte("[client]\nport=abc\n"), 0o600))
+	assert.Error(t, ApplyOptionFile(&connection, path, func(string) bool { return false }))
+
+	assert.Error(t, ApplyOptionFile(&connection, filepath.Join(t.TempDir(), "missing"), func(string) bool { return false }))
+
+	t.Setenv("HOME", t.TempDir())
+	assert.NoError(t, ApplyOptionFile(&connection, "", func(string) bool { return false }))
+}
@@ -0,0 +1,127 @@
+// Package nginx reads the NGINX stub_status page, which looks like:
+//
+//	Active connections: 43
+//	server accepts handled requests
+//	 7368 7368 10993
+//	Reading: 0 Writing: 5 Waiting: 38
+package nginx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// StubStatus holds the values of the stub_status page. Accepts, Handled and
+// Requests are counters since NGINX started, the others current gauges.
+type StubStatus struct {
+	Active   uint64 `json:"active"`
+	Accepts  uint64 `json:"accepts"`
+	Handled  uint64 `json:"handled"`
+	Requests uint64 `json:"requests"`
+	Reading  uint64 `json:"reading"`
+	Writing  uint64 `json:"writing"`
+	Waiting  uint64 `json:"waiting"`
+}
+
+// Rates holds the change of the counters between two samples: requests and
+// accepted connections per second, and the connections dropped in between
+// (accepted but not handled, e.g. when worker_connections is exhausted).
+type Rates struct {
+	Requests float64
+	Accepts  float64
+	Dropped  uint64
+}
+
+// GetStubStatus fetches and parses the stub_status page at url.
+func GetStubStatus(client *http.Client, url string) (StubStatus, error) {
+	response, err := client.Get(url)
+	if err != nil {
+		return StubStatus{}, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return StubStatus{}, fmt.Errorf("received HTTP status code %v from %s", response.StatusCode, url)
+	}
+
+	return ParseStubStatus(response.Body)
+}
+
+// ParseStubStatus parses a stub_status page.
+func ParseStubStatus(r io.Reader) (StubStatus, error) {
+	lines := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); len(line) > 0 {
+			lines = append(lines, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return StubStatus{}, err
+	}
+	if len(lines) != 4 {
+		return StubStatus{}, fmt.Errorf("invalid stub_status page: expected 4 lines, got %d", len(lines))
+	}
+
+	var status StubStatus
+	var err error
+
+	active := strings.Fields(lines[0])
+	if len(active) != 3 || active[0] != "Active" || active[1] != "connections:" {
+		return StubStatus{}, fmt.Errorf("invalid stub_status line %q", lines[0])
+	}
+	if status.Active, err = strconv.ParseUint(active[2], 10, 64); err != nil {
+		return StubStatus{}, fmt.Errorf("invalid active connections %q", active[2])
+	}
+
+	if lines[1] != "server accepts handled requests" {
+		return StubStatus{}, fmt.Errorf("invalid stub_status line %q", lines[1])
+	}
+
+	counters := strings.Fields(lines[2])
+	if len(counters) != 3 {
+		return StubStatus{}, fmt.Errorf("invalid stub_status line %q", lines[2])
+	}
+	for i, target := range []*uint64{&status.Accepts, &status.Handled, &status.Requests} {
+		if *target, err = strconv.ParseUint(counters[i], 10, 64); err != nil {
+			return StubStatus{}, fmt.Errorf("invalid counter %q", counters[i])
+		}
+	}
+
+	states := strings.Fields(lines[3])
+	if len(states) != 6 || states[0] != "Reading:" || states[2] != "Writing:" || states[4] != "Waiting:" {
+		return StubStatus{}, fmt.Errorf("invalid stub_status line %q", lines[3])
+	}
+	for i, target := range []*uint64{&status.Reading, &status.Writing, &status.Waiting} {
+		if *target, err = strconv.ParseUint(states[2*i+1], 10, 64); err != nil {
+			return StubStatus{}, fmt.Errorf("invalid connection count %q", states[2*i+1])
+		}
+	}
+
+	return status, nil
+}
+
+// StubStatusRates computes the rates between two samples taken seconds
+// apart. It returns false when no rates can be computed, i.e. for a
+// non-positive interval or counters that went backwards after NGINX was
+// restarted.
+func StubStatusRates(before, after StubStatus, seconds float64) (Rates, bool) {
+	if seconds <= 0 || after.Accepts < before.Accepts || after.Handled < before.Handled || after.Requests < before.Requests {
+		return Rates{}, false
+	}
+
+	rates := Rates{
+		Requests: float64(after.Requests-before.Requests) / seconds,
+		Accepts:  float64(after.Accepts-before.Accepts) / seconds,
+	}
+	droppedBefore := before.Accepts - min(before.Handled, before.Accepts)
+	droppedAfter := after.Accepts - min(after.Handled, after.Accepts)
+	if droppedAfter > droppedBefore {
+		rates.Dropped = droppedAfter - droppedBefore
+	}
+	return rates, true
+}
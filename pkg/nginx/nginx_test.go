@@ -0,0 +1,84 @@
+package nginx
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStubStatus(t *testing.T) {
+	file, err := os.Open("testdata/stub_status")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	status, err := ParseStubStatus(file)
+	assert.Nil(t, err)
+	assert.Equal(t, StubStatus{Active: 43, Accepts: 7368, Handled: 7358, Requests: 10993, Reading: 0, Writing: 5, Waiting: 38}, status)
+
+	malformed, _ := os.Open("testdata/stub_status_malformed")
+	defer malformed.Close()
+	_, err = ParseStubStatus(malformed)
+	assert.NotNil(t, err)
+
+	for _, page := range []string{
+		"",
+		"<html>Welcome to nginx!</html>",
+		"Active connections: x\nserver accepts handled requests\n1 1 1\nReading: 0 Writing: 1 Waiting: 0\n",
+		"Active connections: 1\nserver accepts requests\n1 1 1\nReading: 0 Writing: 1 Waiting: 0\n",
+		"Active connections: 1\nserver accepts handled requests\n1 -1 1\nReading: 0 Writing: 1 Waiting: 0\n",
+		"Active connections: 1\nserver accepts handled requests\n1 1 1\nReading: 0 Writing: 1\n",
+		"Active connections: 1\nserver accepts handled requests\n1 1 1\nReading: 0 Writing: x Waiting: 0\n",
+	} {
+		_, err := ParseStubStatus(strings.NewReader(page))
+		assert.NotNil(t, err, page)
+	}
+}
+
+func TestGetStubStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/nginx-status" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "Active connections: 2 \nserver accepts handled requests\n 10 10 20 \nReading: 0 Writing: 1 Waiting: 1 \n")
+	}))
+	defer server.Close()
+
+	client := &http.Client{Timeout: time.Second}
+	status, err := GetStubStatus(client, server.URL+"/nginx-status")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(20), status.Requests)
+
+	_, err = GetStubStatus(client, server.URL+"/other")
+	assert.ErrorContains(t, err, "404")
+
+	_, err = GetStubStatus(client, "http://127.0.0.1:0/")
+	assert.NotNil(t, err)
+}
+
+func TestStubStatusRates(t *testing.T) {
+	before := StubStatus{Accepts: 100, Handled: 100, Requests: 1000}
+	after := StubStatus{Accepts: 160, Handled: 150, Requests: 1600}
+
+	rates, ok := StubStatusRates(before, after, 10)
+	assert.True(t, ok)
+	assert.Equal(t, Rates{Requests: 60, Accepts: 6, Dropped: 10}, rates)
+
+	// drops before the first sample are not counted again
+	rates, ok = StubStatusRates(after, StubStatus{Accepts: 170, Handled: 160, Requests: 1700}, 10)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(0), rates.Dropped)
+
+	// restart
+	_, ok = StubStatusRates(after, StubStatus{Accepts: 5, Handled: 5, Requests: 5}, 10)
+	assert.False(t, ok)
+
+	_, ok = StubStatusRates(before, after, 0)
+	assert.False(t, ok)
+}
@@ -73,6 +73,17 @@ func ParseConnectionsFromFile(fileParams FileParams) (*[]Connection, error) {
 	return &connections, nil
 }
 
+// DataSource returns the godror data source of a connection, with the
+// session time zone set to UTC.
+func DataSource(connection Connection) string {
+	params := godror.ConnectionParams{}
+	params.Username = connection.Username
+	params.Password = godror.NewPassword(connection.Password)
+	params.Timezone = time.UTC
+	params.ConnectString = connection.Database
+	return params.StringWithPassword()
+}
+
 func ExtractOracleError(err error) error {
 	if err == nil {
 		return err
@@ -0,0 +1,211 @@
+// Package postfix reads the Postfix mail queues, either directly from the
+// queue directories of the spool or from the JSON output of `postqueue -j`.
+package postfix
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+// DefaultSpool is the default Postfix queue_directory.
+const DefaultSpool = "/var/spool/postfix"
+
+// Queues lists the Postfix mail queues in the order mail passes them (hold is
+// set aside by the administrator).
+var Queues = []string{"maildrop", "incoming", "active", "deferred", "hold"}
+
+// QueueStats is the number of messages in a queue and the arrival time of the
+// oldest one. Oldest is zero for an empty queue.
+type QueueStats struct {
+	Name   string
+	Count  int
+	Oldest time.Time
+}
+
+// ReadQueue counts the message files of a queue below spool. Postfix hashes
+// the deferred and hold queues into subdirectories, which are walked as well.
+// Messages that are delivered while walking are ignored. The age comes from
+// the arrival time recorded in each queue file, as Postfix sets the
+// modification time of deferred messages to their next delivery attempt; the
+// modification time is only used for files without a readable time record.
+func ReadQueue(spool string, queue string) (QueueStats, error) {
+	stats := QueueStats{Name: queue}
+	root := filepath.Join(spool, queue)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path != root {
+				return nil
+			}
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+
+		arrival, err := arrivalTime(path)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			arrival = info.ModTime()
+		}
+
+		stats.Count++
+		if stats.Oldest.IsZero() || arrival.Before(stats.Oldest) {
+			stats.Oldest = arrival
+		}
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("cannot read %s queue: %w", queue, err)
+	}
+
+	return stats, nil
+}
+
+// Record types of the queue file envelope, see rec_type.h of Postfix.
+const (
+	recordTime    = 'T' // arrival time: "seconds [microseconds]"
+	recordMessage = 'M' // start of the message content
+	recordEnd     = 'E' // end of the envelope
+)
+
+// maxEnvelopeRecords bounds the records read before giving up on the time
+// record, which Postfix writes right after the size record.
+const maxEnvelopeRecords = 32
+
+// arrivalTime reads the arrival time from the time record of a queue file.
+func arrivalTime(path string) (time.Time, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer file.Close()
+
+	return readArrivalTime(bufio.NewReader(file))
+}
+
+// readArrivalTime reads the envelope records of a Postfix queue file up to
+// the time record and returns the arrival time it holds. Each record is a
+// type byte, the length of the data in 7 bit groups (least significant
+// first, the high bit set while more groups follow) and the data.
+func readArrivalTime(r *bufio.Reader) (time.Time, error) {
+	for i := 0; i < maxEnvelopeRecords; i++ {
+		recordType, err := r.ReadByte()
+		if err != nil {
+			return time.Time{}, fmt.Errorf("no time record: %w", err)
+		}
+
+		length := 0
+		for shift := 0; ; shift += 7 {
+			b, err := r.ReadByte()
+			if err != nil {
+				return time.Time{}, fmt.Errorf("truncated record: %w", err)
+			}
+			if shift > 21 {
+				return time.Time{}, fmt.Errorf("record too long")
+			}
+			length |= int(b&0x7f) << shift
+			if b&0x80 == 0 {
+				break
+			}
+		}
+
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return time.Time{}, fmt.Errorf("truncated record: %w", err)
+		}
+
+		switch recordType {
+		case recordTime:
+			var seconds int64
+			if _, err := fmt.Sscanf(string(data), "%d", &seconds); err != nil {
+				return time.Time{}, fmt.Errorf("invalid time record %q", data)
+			}
+			return time.Unix(seconds, 0), nil
+		case recordMessage, recordEnd:
+			return time.Time{}, fmt.Errorf("no time record")
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("no time record")
+}
+
+// Message is one queued message as reported by `postqueue -j`.
+type Message struct {
+	QueueName   string      `json:"queue_name"`
+	QueueID     string      `json:"queue_id"`
+	ArrivalTime int64       `json:"arrival_time"`
+	MessageSize int64       `json:"message_size"`
+	Sender      string      `json:"sender"`
+	Recipients  []Recipient `json:"recipients"`
+}
+
+// Recipient is a recipient of a queued message. DelayReason is set for
+// recipients whose delivery was deferred.
+type Recipient struct {
+	Address     string `json:"address"`
+	DelayReason string `json:"delay_reason"`
+}
+
+// ParsePostqueue parses the output of `postqueue -j`, one JSON object per
+// line.
+func ParsePostqueue(r io.Reader) ([]Message, error) {
+	messages := []Message{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var message Message
+		if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+			return nil, fmt.Errorf("invalid postqueue output on line %d: %w", line, err)
+		}
+		messages = append(messages, message)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// Postqueue runs `postqueue -j` and parses its output. Unlike the queue
+// directories it does not require access to the spool.
+func Postqueue(path string) ([]Message, error) {
+	out, err := exec.Command(path, "-j").Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return nil, fmt.Errorf("%s -j: %s", path, exitErr.Stderr)
+		}
+		return nil, err
+	}
+	return ParsePostqueue(bytes.NewReader(out))
+}
+
+// Available reports whether the postqueue binary exists.
+func Available(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
@@ -0,0 +1,173 @@
+package postfix
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// spool creates a queue directory layout with the given files, relative to the
+// spool, modified age ago.
+func spool(t *testing.T, files map[string]time.Duration) string {
+	dir := t.TempDir()
+	for _, queue := range Queues {
+		os.MkdirAll(filepath.Join(dir, queue), 0700)
+	}
+	for name, age := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0700)
+		os.WriteFile(path, []byte("message"), 0600)
+		modified := time.Now().Add(-age)
+		os.Chtimes(path, modified, modified)
+	}
+	return dir
+}
+
+func TestReadQueue(t *testing.T) {
+	dir := spool(t, map[string]time.Duration{
+		"deferred/A/A1B2C3": 2 * time.Hour,
+		"deferred/B/B1C2D3": 10 * time.Minute,
+		"deferred/C/C1D2E3": time.Minute,
+		"active/D1E2F3":     time.Second,
+	})
+
+	stats, err := ReadQueue(dir, "deferred")
+	assert.Nil(t, err)
+	assert.Equal(t, "deferred", stats.Name)
+	assert.Equal(t, 3, stats.Count)
+	assert.InDelta(t, (2 * time.Hour).Seconds(), time.Since(stats.Oldest).Seconds(), 5)
+
+	stats, err = ReadQueue(dir, "hold")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, stats.Count)
+	assert.True(t, stats.Oldest.IsZero())
+
+	_, err = ReadQueue(dir, "missing")
+	assert.NotNil(t, err)
+}
+
+// record encodes a queue file record: the type, the length in 7 bit groups
+// and the data.
+func record(recordType byte, data string) []byte {
+	out := []byte{recordType}
+	length := len(data)
+	for {
+		b := byte(length & 0x7f)
+		if length >>= 7; length > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(out, data...)
+}
+
+// queueFile builds the start of a queue file that arrived at arrival.
+func queueFile(arrival time.Time) []byte {
+	var file []byte
+	file = append(file, record('C', "             512              80               1               0             512")...)
+	file = append(file, record('T', fmt.Sprintf("%d %d", arrival.Unix(), 123456))...)
+	file = append(file, record('F', "0")...)
+	file = append(file, record('S', "noreply@example.com")...)
+	return append(file, record('M', "")...)
+}
+
+func TestReadQueueArrivalTime(t *testing.T) {
+	dir := spool(t, nil)
+	arrival := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+
+	// Postfix moves the modification time of deferred mail to the next retry.
+	path := filepath.Join(dir, "deferred", "A", "A1B2C3")
+	assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0700))
+	assert.Nil(t, os.WriteFile(path, queueFile(arrival), 0600))
+	retry := time.Now().Add(10 * time.Minute)
+	assert.Nil(t, os.Chtimes(path, retry, retry))
+
+	stats, err := ReadQueue(dir, "deferred")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, stats.Count)
+	assert.Equal(t, arrival, stats.Oldest)
+}
+
+func TestReadArrivalTime(t *testing.T) {
+	arrival := time.Unix(1780303600, 0)
+	got, err := readArrivalTime(bufio.NewReader(bytes.NewReader(queueFile(arrival))))
+	assert.Nil(t, err)
+	assert.Equal(t, arrival, got)
+
+	// Older Postfix versions write the seconds only; long records use several
+	// length bytes.
+	file := append(record('C', strings.Repeat(" ", 300)), record('T', "1780303600")...)
+	got, err = readArrivalTime(bufio.NewReader(bytes.NewReader(file)))
+	assert.Nil(t, err)
+	assert.Equal(t, arrival, got)
+
+	for name, file := range map[string][]byte{
+		"no time record": append(record('C', "512"), record('M', "")...),
+		"truncated":      record('C', "512")[:3],
+		"invalid time":   record('T', "yesterday"),
+		"empty":          {},
+	} {
+		_, err := readArrivalTime(bufio.NewReader(bytes.NewReader(file)))
+		assert.NotNil(t, err, name)
+	}
+}
+
+func TestParsePostqueue(t *testing.T) {
+	file, err := os.Open("testdata/postqueue.json")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	messages, err := ParsePostqueue(file)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(messages))
+	assert.Equal(t, Message{
+		QueueName:   "deferred",
+		QueueID:     "D1A2B3C4D5",
+		ArrivalTime: 1780303600,
+		MessageSize: 512,
+		Sender:      "noreply@example.com",
+		Recipients: []Recipient{{
+			Address:     "carol@gmail.com",
+			DelayReason: "connect to gmail-smtp-in.l.google.com[142.250.1.27]:25: Connection timed out",
+		}},
+	}, messages[1])
+	assert.Equal(t, "", messages[2].Recipients[0].DelayReason)
+
+	messages, err = ParsePostqueue(strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.Empty(t, messages)
+
+	malformed, _ := os.Open("testdata/postqueue_malformed.json")
+	defer malformed.Close()
+	_, err = ParsePostqueue(malformed)
+	assert.NotNil(t, err)
+}
+
+func TestPostqueue(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "postqueue")
+	os.WriteFile(script, []byte("#!/bin/sh\n[ \"$1\" = -j ] && cat testdata/postqueue.json\n"), 0755)
+
+	assert.True(t, Available(script))
+	assert.False(t, Available(dir))
+	assert.False(t, Available(filepath.Join(dir, "missing")))
+
+	messages, err := Postqueue(script)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(messages))
+
+	failing := filepath.Join(dir, "failing")
+	os.WriteFile(failing, []byte("#!/bin/sh\necho 'postqueue: fatal: Queue report unavailable' >&2\nexit 69\n"), 0755)
+	_, err = Postqueue(failing)
+	assert.ErrorContains(t, err, "Queue report unavailable")
+}
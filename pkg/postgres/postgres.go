@@ -0,0 +1,81 @@
+// Package postgres builds lib/pq connection strings with TLS options for
+// the PostgreSQL checks.
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+// SSLModes are the sslmode values lib/pq accepts.
+var SSLModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// Connection adds the TLS settings and the connect timeout (in seconds, 0
+// waits forever) to the common connection parameters.
+type Connection struct {
+	common.Connection
+	SSLMode        string
+	SSLRootCert    string
+	SSLCert        string
+	SSLKey         string
+	ConnectTimeout int
+}
+
+// DataSource assembles the keyword/value connection string. Empty values
+// are left out, so lib/pq falls back to the PG* environment variables and
+// ~/.pgpass; values with spaces, quotes or backslashes are quoted.
+func DataSource(c Connection) string {
+	parameters := []struct {
+		key   string
+		value string
+	}{
+		{"host", c.Host},
+		{"port", positiveInt(c.Port)},
+		{"user", c.User},
+		{"password", c.Password},
+		{"dbname", c.Database},
+		{"sslmode", c.SSLMode},
+		{"sslrootcert", c.SSLRootCert},
+		{"sslcert", c.SSLCert},
+		{"sslkey", c.SSLKey},
+		{"connect_timeout", positiveInt(c.ConnectTimeout)},
+	}
+
+	pairs := []string{}
+	for _, p := range parameters {
+		if len(p.value) > 0 {
+			pairs = append(pairs, p.key+"="+quote(p.value))
+		}
+	}
+	return strings.Join(pairs, " ")
+}
+
+// ValidateSSLMode reports an unknown sslmode.
+func ValidateSSLMode(mode string) error {
+	for _, m := range SSLModes {
+		if mode == m {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid sslmode %q, use one of %s", mode, strings.Join(SSLModes, ", "))
+}
+
+// positiveInt formats a port or timeout; zero and negative values are left
+// out of the connection string so lib/pq uses its default.
+func positiveInt(value int) string {
+	if value <= 0 {
+		return ""
+	}
+	return strconv.Itoa(value)
+}
+
+// quote escapes a value for a keyword/value connection string.
+func quote(value string) string {
+	if !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
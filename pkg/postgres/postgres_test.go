@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/thomis/sensu-plugins-go/pkg/common"
+)
+
+func TestDataSource(t *testing.T) {
+	tests := []struct {
+		name       string
+		connection Connection
+		expected   string
+	}{
+		{
+			name: "Standard connection",
+			connection: Connection{Connection: common.Connection{
+				Host: "localhost", Port: 5432, User: "testuser", Password: "testpass", Database: "testdb",
+			}, SSLMode: "disable"},
+			expected: "host=localhost port=5432 user=testuser password=testpass dbname=testdb sslmode=disable",
+		},
+		{
+			name: "Connection with special characters",
+			connection: Connection{Connection: common.Connection{
+				Host: "db.example.com", Port: 5433, User: "user@domain", Password: "p@ss!word", Database: "my-db",
+			}, SSLMode: "disable"},
+			expected: "host=db.example.com port=5433 user=user@domain password=p@ss!word dbname=my-db sslmode=disable",
+		},
+		{
+			name: "Connection with empty password",
+			connection: Connection{Connection: common.Connection{
+				Host: "localhost", Port: 5432, User: "postgres", Password: "", Database: "postgres",
+			}, SSLMode: "disable"},
+			expected: "host=localhost port=5432 user=postgres dbname=postgres sslmode=disable",
+		},
+		{
+			name: "Connection with quotes and spaces",
+			connection: Connection{Connection: common.Connection{
+				Host: "localhost", Port: 5432, User: "monitor", Password: `it's a \secret`, Database: "postgres",
+			}},
+			expected: `host=localhost port=5432 user=monitor password='it\'s a \\secret' dbname=postgres`,
+		},
+		{
+			name: "Connection with TLS and timeout",
+			connection: Connection{Connection: common.Connection{
+				Host: "db.example.com", Port: 5432, User: "monitor", Database: "postgres",
+			}, SSLMode: "verify-full", SSLRootCert: "/etc/ssl/ca.pem", SSLCert: "/etc/ssl/client.pem", SSLKey: "/etc/ssl/client.key", ConnectTimeout: 10},
+			expected: "host=db.example.com port=5432 user=monitor dbname=postgres sslmode=verify-full sslrootcert=/etc/ssl/ca.pem sslcert=/etc/ssl/client.pem sslkey=/etc/ssl/client.key connect_timeout=10",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, DataSource(tt.connection))
+			_, err := pq.NewConnector(DataSource(tt.connection))
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDataSourceParsed(t *testing.T) {
+	connection := Connection{Connection: common.Connection{
+		Host: "localhost", Port: 5432, User: "monitor", Password: `it's a \secret`, Database: "postgres",
+	}, SSLMode: "disable"}
+
+	parsed, err := pq.NewConfig(DataSource(connection))
+	assert.NoError(t, err)
+	assert.Equal(t, `it's a \secret`, parsed.Password)
+	assert.Equal(t, "postgres", parsed.Database)
+}
+
+func TestValidateSSLMode(t *testing.T) {
+	for _, mode := range SSLModes {
+		assert.NoError(t, ValidateSSLMode(mode))
+	}
+	assert.Error(t, ValidateSSLMode("verify"))
+	assert.Error(t, ValidateSSLMode(""))
+}
@@ -0,0 +1,189 @@
+// Package redis connects to Redis servers with authentication, TLS and
+// timeouts and parses the output of INFO and CLUSTER INFO.
+package redis
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	redigo "github.com/gomodule/redigo/redis"
+)
+
+// Options describe how to connect to a Redis server. Username is only sent
+// with a password and selects an ACL user (Redis 6 and later).
+type Options struct {
+	Host           string
+	Port           int
+	Username       string
+	Password       string
+	TLS            bool
+	TLSInsecure    bool
+	TLSCA          string
+	TLSCert        string
+	TLSKey         string
+	TLSServerName  string
+	ConnectTimeout time.Duration
+	ReadTimeout    time.Duration
+}
+
+// Info holds the fields of INFO or CLUSTER INFO by name. Section headers
+// are dropped, since field names are unique across sections.
+type Info map[string]string
+
+// Dial connects and authenticates.
+func Dial(o Options) (redigo.Conn, error) {
+	dialOptions := []redigo.DialOption{
+		redigo.DialConnectTimeout(o.ConnectTimeout),
+		redigo.DialReadTimeout(o.ReadTimeout),
+		redigo.DialWriteTimeout(o.ReadTimeout),
+	}
+	if len(o.Password) > 0 {
+		dialOptions = append(dialOptions, redigo.DialPassword(o.Password))
+		if len(o.Username) > 0 {
+			dialOptions = append(dialOptions, redigo.DialUsername(o.Username))
+		}
+	}
+	if o.TLS {
+		config, err := tlsConfig(o)
+		if err != nil {
+			return nil, err
+		}
+		dialOptions = append(dialOptions, redigo.DialUseTLS(true), redigo.DialTLSConfig(config))
+	}
+
+	return redigo.Dial("tcp", net.JoinHostPort(o.Host, strconv.Itoa(o.Port)), dialOptions...)
+}
+
+func tlsConfig(o Options) (*tls.Config, error) {
+	config := &tls.Config{
+		InsecureSkipVerify: o.TLSInsecure,
+		ServerName:         o.TLSServerName,
+	}
+	if len(config.ServerName) == 0 {
+		config.ServerName = o.Host
+	}
+
+	if len(o.TLSCA) > 0 {
+		pem, err := os.ReadFile(o.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", o.TLSCA)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(o.TLSCert) > 0 || len(o.TLSKey) > 0 {
+		certificate, err := tls.LoadX509KeyPair(o.TLSCert, o.TLSKey)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+
+	return config, nil
+}
+
+// GetInfo runs INFO, restricted to the given sections if any.
+func GetInfo(conn redigo.Conn, sections ...string) (Info, error) {
+	args := []interface{}{}
+	for _, section := range sections {
+		args = append(args, section)
+	}
+	text, err := redigo.String(conn.Do("INFO", args...))
+	if err != nil {
+		return nil, err
+	}
+	return ParseInfo(text), nil
+}
+
+// GetClusterInfo runs CLUSTER INFO.
+func GetClusterInfo(conn redigo.Conn) (Info, error) {
+	text, err := redigo.String(conn.Do("CLUSTER", "INFO"))
+	if err != nil {
+		return nil, err
+	}
+	return ParseInfo(text), nil
+}
+
+// Ping sends PING and returns the round trip time.
+func Ping(conn redigo.Conn) (time.Duration, error) {
+	start := time.Now()
+	reply, err := redigo.String(conn.Do("PING"))
+	if err != nil {
+		return 0, err
+	}
+	if reply != "PONG" {
+		return 0, fmt.Errorf("unexpected PING reply %q", reply)
+	}
+	return time.Since(start), nil
+}
+
+// ParseInfo parses the "key:value" lines of INFO or CLUSTER INFO, skipping
+// empty lines and "# Section" headers.
+func ParseInfo(text string) Info {
+	info := Info{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		info[key] = value
+	}
+	return info
+}
+
+// Int returns the field key as an integer.
+func (i Info) Int(key string) (int64, bool) {
+	value, err := strconv.ParseInt(i[key], 10, 64)
+	return value, err == nil
+}
+
+// Float returns the field key as a float.
+func (i Info) Float(key string) (float64, bool) {
+	value, err := strconv.ParseFloat(i[key], 64)
+	return value, err == nil
+}
+
+// Fields splits a composite field such as "db0:keys=1,expires=0" or
+// "slave0:ip=10.0.0.2,port=6379,state=online,offset=1,lag=0" into its parts.
+// It returns nil when the field is missing.
+func (i Info) Fields(key string) map[string]string {
+	value, ok := i[key]
+	if !ok {
+		return nil
+	}
+	fields := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		name, v, _ := strings.Cut(part, "=")
+		fields[name] = v
+	}
+	return fields
+}
+
+// Numbered returns the names of the fields prefix0, prefix1, ... in order,
+// e.g. the replicas ("slave") of a master or the masters of a Sentinel.
+func (i Info) Numbered(prefix string) []string {
+	names := []string{}
+	for n := 0; ; n++ {
+		name := prefix + strconv.Itoa(n)
+		if _, ok := i[name]; !ok {
+			return names
+		}
+		names = append(names, name)
+	}
+}
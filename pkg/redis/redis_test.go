@@ -0,0 +1,188 @@
+package redis
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readInfo(t *testing.T, name string) Info {
+	contents, err := os.ReadFile("testdata/" + name)
+	require.NoError(t, err)
+	return ParseInfo(string(contents))
+}
+
+func TestParseInfo(t *testing.T) {
+	info := readInfo(t, "info_master")
+
+	assert.Equal(t, "7.2.4", info["redis_version"])
+	assert.Equal(t, "master", info["role"])
+	assert.NotContains(t, info, "# Server")
+
+	memory, ok := info.Int("used_memory")
+	assert.True(t, ok)
+	assert.Equal(t, int64(471859200), memory)
+
+	ratio, ok := info.Float("mem_fragmentation_ratio")
+	assert.True(t, ok)
+	assert.Equal(t, 1.07, ratio)
+
+	_, ok = info.Int("used_memory_human")
+	assert.False(t, ok)
+	_, ok = info.Int("missing")
+	assert.False(t, ok)
+}
+
+func TestInfoFields(t *testing.T) {
+	info := readInfo(t, "info_master")
+
+	assert.Equal(t, map[string]string{"keys": "1520", "expires": "300", "avg_ttl": "3600000"}, info.Fields("db0"))
+	assert.Equal(t, "3", info.Fields("slave1")["lag"])
+	assert.Nil(t, info.Fields("db1"))
+
+	assert.Equal(t, []string{"slave0", "slave1"}, info.Numbered("slave"))
+	assert.Equal(t, []string{}, info.Numbered("master"))
+
+	sentinel := readInfo(t, "info_sentinel")
+	assert.Equal(t, []string{"master0", "master1"}, sentinel.Numbered("master"))
+	assert.Equal(t, "odown", sentinel.Fields("master1")["status"])
+}
+
+// fakeServer answers AUTH, PING and INFO in the Redis protocol.
+func fakeServer(t *testing.T, username, password, info string) (string, int) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serve(conn, username, password, info)
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port
+}
+
+func serve(conn net.Conn, username, password, info string) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	authenticated := len(password) == 0
+
+	for {
+		command, err := readCommand(reader)
+		if err != nil {
+			return
+		}
+		switch strings.ToUpper(command[0]) {
+		case "AUTH":
+			user, pass := "default", command[len(command)-1]
+			if len(command) == 3 {
+				user = command[1]
+			}
+			if pass == password && (len(username) == 0 || user == username) {
+				authenticated = true
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid username-password pair\r\n")
+			}
+		case "PING":
+			if !authenticated {
+				fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			} else {
+				fmt.Fprint(conn, "+PONG\r\n")
+			}
+		case "INFO":
+			if !authenticated {
+				fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+			} else {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(info), info)
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command '%s'\r\n", command[0])
+		}
+	}
+}
+
+func readCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	command := []string{}
+	for i := 0; i < count; i++ {
+		if _, err := reader.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		value, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		command = append(command, strings.TrimRight(value, "\r\n"))
+	}
+	return command, nil
+}
+
+func TestDial(t *testing.T) {
+	host, port := fakeServer(t, "monitor", "secret", "# Server\r\nredis_version:7.2.4\r\nrole:master\r\n")
+	options := Options{Host: host, Port: port, Username: "monitor", Password: "secret", ConnectTimeout: time.Second, ReadTimeout: time.Second}
+
+	conn, err := Dial(options)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	latency, err := Ping(conn)
+	assert.NoError(t, err)
+	assert.Greater(t, latency, time.Duration(0))
+
+	info, err := GetInfo(conn)
+	assert.NoError(t, err)
+	assert.Equal(t, "master", info["role"])
+
+	options.Password = "wrong"
+	_, err = Dial(options)
+	assert.ErrorContains(t, err, "WRONGPASS")
+
+	options.Password = ""
+	conn, err = Dial(options)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = Ping(conn)
+	assert.ErrorContains(t, err, "NOAUTH")
+}
+
+func TestTLSConfig(t *testing.T) {
+	config, err := tlsConfig(Options{Host: "redis.example.com", TLSInsecure: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "redis.example.com", config.ServerName)
+	assert.True(t, config.InsecureSkipVerify)
+
+	config, err = tlsConfig(Options{Host: "10.0.0.1", TLSServerName: "redis.example.com"})
+	assert.NoError(t, err)
+	assert.Equal(t, "redis.example.com", config.ServerName)
+
+	_, err = tlsConfig(Options{Host: "localhost", TLSCA: "testdata/missing.pem"})
+	assert.Error(t, err)
+
+	_, err = tlsConfig(Options{Host: "localhost", TLSCA: "testdata/info_master"})
+	assert.ErrorContains(t, err, "no certificates")
+
+	_, err = tlsConfig(Options{Host: "localhost", TLSCert: "testdata/info_master"})
+	assert.Error(t, err)
+}
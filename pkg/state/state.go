@@ -0,0 +1,64 @@
+// Package state keeps small JSON documents between check runs, such as the
+// read offset of check-log or the restart counters of check-systemd.
+package state
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultFile returns a state file in the temporary directory named after
+// prefix and a short hash of keys, such as the address of the monitored
+// server, so checks of several instances keep separate state.
+func DefaultFile(prefix string, keys ...string) string {
+	hash := sha1.Sum([]byte(strings.Join(keys, "\x00")))
+	return filepath.Join(os.TempDir(), fmt.Sprintf("%s-%s.json", prefix, hex.EncodeToString(hash[:4])))
+}
+
+// Load reads the JSON document in file into v. A missing file leaves v
+// untouched and is not an error, so the first run starts from scratch.
+func Load(file string, v interface{}) error {
+	contents, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(contents, v)
+}
+
+// Save writes v as JSON to file. The document is written to a temporary file
+// in the same directory and renamed, so concurrent runs never read a partial
+// document.
+func Save(file string, v interface{}) error {
+	contents, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
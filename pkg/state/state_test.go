@@ -0,0 +1,70 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type document struct {
+	Offset int64  `json:"offset"`
+	Name   string `json:"name"`
+}
+
+func TestLoadMissing(t *testing.T) {
+	doc := document{Offset: 7}
+	err := Load(filepath.Join(t.TempDir(), "missing.json"), &doc)
+	assert.Nil(t, err)
+	assert.Equal(t, document{Offset: 7}, doc)
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "state.json")
+
+	assert.Nil(t, Save(file, document{Offset: 42, Name: "syslog"}))
+	assert.Nil(t, Save(file, document{Offset: 43, Name: "syslog"}))
+
+	var doc document
+	assert.Nil(t, Load(file, &doc))
+	assert.Equal(t, document{Offset: 43, Name: "syslog"}, doc)
+
+	// no temporary files are left behind
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestLoadInvalid(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "state.json")
+	os.WriteFile(file, []byte("{"), 0644)
+
+	var doc document
+	assert.NotNil(t, Load(file, &doc))
+
+	assert.NotNil(t, Load(t.TempDir(), &doc))
+}
+
+func TestSaveErrors(t *testing.T) {
+	dir := t.TempDir()
+	assert.NotNil(t, Save(filepath.Join(dir, "missing", "state.json"), document{}))
+	assert.NotNil(t, Save(filepath.Join(dir, "state.json"), make(chan int)))
+
+	// the target is a directory, so the rename fails
+	target := filepath.Join(dir, "target")
+	os.Mkdir(target, 0755)
+	os.WriteFile(filepath.Join(target, "keep"), nil, 0644)
+	assert.NotNil(t, Save(target, document{}))
+	entries, _ := os.ReadDir(dir)
+	assert.Equal(t, 1, len(entries))
+}
+
+func TestDefaultFile(t *testing.T) {
+	a := DefaultFile("check-redis", "db1:6379")
+	assert.Equal(t, os.TempDir(), filepath.Dir(a))
+	assert.Regexp(t, `^check-redis-[0-9a-f]{8}\.json$`, filepath.Base(a))
+	assert.Equal(t, a, DefaultFile("check-redis", "db1:6379"))
+	assert.NotEqual(t, a, DefaultFile("check-redis", "db1:6380"))
+	assert.NotEqual(t, DefaultFile("check-log-syslog", "WARN", "ERROR"), DefaultFile("check-log-syslog", "WARN", "FATAL"))
+}